@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"syscall"
+	"time"
 
 	config "github.com/HUAHUAI23/simple-waf/coraza-spoa/config"
 	"github.com/HUAHUAI23/simple-waf/coraza-spoa/internal"
@@ -24,8 +25,18 @@ func main() {
 	flag.StringVar(&config.MemProfile, "memprofile", "", "write memory profile to `file`")
 	flag.StringVar(&config.ConfigPath, "config", "", "configuration file")
 	flag.StringVar(&config.MongoURI, "mongo", "", "mongodb uri")
+	flag.StringVar(&config.Bind, "bind", "", "listen address in managed mode, e.g. 0.0.0.0:2343 or unix:///run/coraza.sock")
+	flag.StringVar(&config.Database, "db", "waf", "mongodb database in managed mode")
+	flag.DurationVar(&config.SyncInterval, "sync-interval", 10*time.Second, "interval for checking configuration changes in managed mode")
+	flag.DurationVar(&config.DrainTimeout, "drain-timeout", 30*time.Second, "maximum time to wait for in-flight transactions on shutdown in managed mode")
 	flag.Parse()
 
+	// 未指定配置文件时从 MongoDB 拉取管理端的配置
+	if config.ConfigPath == "" && config.MongoURI != "" {
+		runManaged()
+		return
+	}
+
 	if config.ConfigPath == "" {
 		config.GlobalLogger.Fatal().Msg("Configuration file is not set")
 	}
@@ -69,6 +80,12 @@ func main() {
 			Database:   "waf",
 			Collection: wafLog.GetCollectionName(),
 		}
+
+		// SecAuditLogType mongo、mongo_concurrent 写入的审计记录存储器
+		auditStore := internal.NewMongoAuditStore(mongoClient, mongoConfig.Database, config.GlobalLogger)
+		auditStore.Start(ctx)
+		internal.SetAuditStore(auditStore)
+		defer internal.CloseAuditStore()
 	}
 
 	apps, err := cfg.NewApplicationsWithContext(ctx, mongoConfig)
@@ -133,13 +150,18 @@ outer:
 				continue
 			}
 
-			apps, err := newCfg.NewApplicationsWithContext(ctx, mongoConfig)
+			// 只重建配置有变化的应用，被替换的应用在处理完进行中的请求后退役
+			apps, retired, err := newCfg.ReloadApplicationsWithContext(ctx, mongoConfig, a.CurrentApplications())
 			if err != nil {
 				config.GlobalLogger.Error().Err(err).Msg("Error applying configuration, using old configuration")
 				continue
 			}
 
 			a.ReplaceApplications(apps)
+			for _, app := range retired {
+				app.Retire()
+			}
+			config.GlobalLogger.Info().Int("applications", len(apps)).Int("retired", len(retired)).Msg("Configuration reloaded")
 			cfg = newCfg
 		}
 	}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	config "github.com/HUAHUAI23/simple-waf/coraza-spoa/config"
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/network"
+	serverconfig "github.com/HUAHUAI23/simple-waf/server/config"
+)
+
+// runManaged 作为独立引擎实例运行：配置、自定义规则和规则排除从 MongoDB 读取，变化后自动热更新
+func runManaged() {
+	serverconfig.Global.DBConfig.URI = config.MongoURI
+	serverconfig.Global.DBConfig.Database = config.Database
+
+	agent, err := server.NewAgentServer(config.GlobalLogger, config.MongoURI)
+	if err != nil {
+		config.GlobalLogger.Fatal().Err(err).Msg("Failed creating agent server")
+	}
+
+	if config.Bind != "" {
+		agent.UpdateNetworkAddress(network.NetworkAddressFromBind(config.Bind))
+	}
+
+	if err := agent.Start(); err != nil {
+		config.GlobalLogger.Fatal().Err(err).Msg("Failed starting agent server")
+	}
+	config.GlobalLogger.Info().Msg("Started coraza-spoa in managed mode")
+
+	fingerprint, err := agent.ConfigFingerprint()
+	if err != nil {
+		config.GlobalLogger.Warn().Err(err).Msg("Failed computing configuration fingerprint")
+	}
+
+	reload := func() {
+		current, err := agent.ConfigFingerprint()
+		if err != nil {
+			config.GlobalLogger.Error().Err(err).Msg("Failed computing configuration fingerprint")
+			return
+		}
+		if err := agent.UpdateApplications(); err != nil {
+			config.GlobalLogger.Error().Err(err).Msg("Error applying configuration, using old configuration")
+			return
+		}
+		fingerprint = current
+		config.GlobalLogger.Info().Msg("Configuration reloaded")
+	}
+
+	ticker := time.NewTicker(config.SyncInterval)
+	defer ticker.Stop()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT)
+
+	for {
+		select {
+		case <-ticker.C:
+			current, err := agent.ConfigFingerprint()
+			if err != nil {
+				config.GlobalLogger.Warn().Err(err).Msg("Failed checking configuration")
+				continue
+			}
+			if current != fingerprint {
+				reload()
+			}
+		case sig := <-sigCh:
+			switch sig {
+			case syscall.SIGHUP:
+				config.GlobalLogger.Info().Msg("Received SIGHUP, reloading configuration...")
+				reload()
+			default:
+				config.GlobalLogger.Info().Msgf("Received %s, draining in-flight transactions...", sig)
+				// 等待进行中的事务完成并写完缓存的 WAF 日志和审计日志后再退出
+				if err := agent.Drain(config.DrainTimeout); err != nil {
+					config.GlobalLogger.Error().Err(err).Msg("Failed draining agent server")
+				}
+				config.GlobalLogger.Info().Msg("Agent server stopped")
+				return
+			}
+		}
+	}
+}
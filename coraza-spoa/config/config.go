@@ -18,6 +18,10 @@ var ConfigPath string
 var CpuProfile string
 var MemProfile string
 var MongoURI string
+var Bind string
+var Database string
+var SyncInterval time.Duration
+var DrainTimeout time.Duration
 var GlobalLogger = zerolog.New(os.Stderr).With().Timestamp().Logger()
 
 func ReadConfig() (*config, error) {
@@ -46,11 +50,13 @@ type config struct {
 	Bind         string    `yaml:"bind"`
 	Log          LogConfig `yaml:",inline"`
 	Applications []struct {
-		Log              LogConfig `yaml:",inline"`
-		Name             string    `yaml:"name"`
-		Directives       string    `yaml:"directives"`
-		ResponseCheck    bool      `yaml:"response_check"`
-		TransactionTTLMS int       `yaml:"transaction_ttl_ms"`
+		Log               LogConfig `yaml:",inline"`
+		Name              string    `yaml:"name"`
+		Directives        string    `yaml:"directives"`
+		ResponseCheck     bool      `yaml:"response_check"`
+		TransactionTTLMS  int       `yaml:"transaction_ttl_ms"`
+		LogPolicy         string    `yaml:"log_policy"`
+		LogScoreThreshold int       `yaml:"log_score_threshold"`
 	} `yaml:"applications"`
 }
 
@@ -64,30 +70,42 @@ func (c config) NetworkAddressFromBind() (network string, address string) {
 }
 
 func (c config) NewApplicationsWithContext(ctx context.Context, mongoConfig *internal.MongoConfig) (map[string]*internal.Application, error) {
-	allApps := make(map[string]*internal.Application)
+	apps, _, err := c.ReloadApplicationsWithContext(ctx, mongoConfig, nil)
+	return apps, err
+}
 
-	for index, a := range c.Applications {
-		logger, err := a.Log.NewLogger()
-		if err != nil {
-			return nil, fmt.Errorf("creating logger for application %q: %v", index, err)
-		}
+// ReloadApplicationsWithContext 基于当前应用按配置差异重建应用：配置未变化的应用直接复用，
+// 返回新的应用集合和需要退役的旧应用
+func (c config) ReloadApplicationsWithContext(ctx context.Context, mongoConfig *internal.MongoConfig, current map[string]*internal.Application) (map[string]*internal.Application, []*internal.Application, error) {
+	specs := make([]internal.AppSpec, 0, len(c.Applications))
 
+	for _, a := range c.Applications {
 		appConfig := internal.AppConfig{
-			Logger:         logger,
-			Directives:     a.Directives,
-			ResponseCheck:  a.ResponseCheck,
-			TransactionTTL: time.Duration(a.TransactionTTLMS) * time.Millisecond,
-		}
-
-		application, err := appConfig.NewApplicationWithContext(ctx, mongoConfig, false)
-		if err != nil {
-			return nil, fmt.Errorf("initializing application %q: %v", index, err)
+			Directives:        a.Directives,
+			ResponseCheck:     a.ResponseCheck,
+			TransactionTTL:    time.Duration(a.TransactionTTLMS) * time.Millisecond,
+			LogPolicy:         a.LogPolicy,
+			LogScoreThreshold: a.LogScoreThreshold,
 		}
-
-		allApps[a.Name] = application
+		logConfig := a.Log
+
+		specs = append(specs, internal.AppSpec{
+			Name: a.Name,
+			Key:  appConfig.Fingerprint(false, logConfig.String()),
+			Build: func() (*internal.Application, error) {
+				logger, closer, err := logConfig.NewLoggerWithCloser()
+				if err != nil {
+					return nil, fmt.Errorf("creating logger: %v", err)
+				}
+				appConfig.Logger = logger
+				appConfig.LogOutput = closer
+
+				return appConfig.NewApplicationWithContext(ctx, mongoConfig, false)
+			},
+		})
 	}
 
-	return allApps, nil
+	return internal.DiffApplications(current, specs)
 }
 
 func (c config) NewApplications() (map[string]*internal.Application, error) {
@@ -100,30 +118,46 @@ type LogConfig struct {
 	Format string `yaml:"log_format"`
 }
 
-func (lc LogConfig) outputWriter() (io.Writer, error) {
-	var out io.Writer
-	if lc.File == "" || lc.File == "/dev/stdout" {
-		out = os.Stdout
-	} else if lc.File == "/dev/stderr" {
-		out = os.Stderr
-	} else if lc.File == "/dev/null" {
-		out = io.Discard
-	} else {
-		// TODO: Close the handle if not used anymore.
-		// Currently these are leaked as soon as we reload.
-		f, err := os.OpenFile(lc.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-		if err != nil {
-			return nil, err
-		}
-		out = f
+// String 返回日志配置的文本表示，用于计算应用构建参数摘要
+func (lc LogConfig) String() string {
+	return fmt.Sprintf("level=%s file=%s format=%s", lc.Level, lc.File, lc.Format)
+}
+
+// outputWriter 打开日志输出，输出到文件时返回文件句柄，由调用方在不再使用时关闭
+func (lc LogConfig) outputWriter() (io.Writer, io.Closer, error) {
+	switch lc.File {
+	case "", "/dev/stdout":
+		return os.Stdout, nil, nil
+	case "/dev/stderr":
+		return os.Stderr, nil, nil
+	case "/dev/null":
+		return io.Discard, nil, nil
 	}
-	return out, nil
+
+	f, err := os.OpenFile(lc.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
 }
 
 func (lc LogConfig) NewLogger() (zerolog.Logger, error) {
-	out, err := lc.outputWriter()
+	logger, _, err := lc.NewLoggerWithCloser()
+	return logger, err
+}
+
+// NewLoggerWithCloser 创建日志记录器并返回日志文件句柄，输出到标准输出时句柄为空
+func (lc LogConfig) NewLoggerWithCloser() (zerolog.Logger, io.Closer, error) {
+	out, closer, err := lc.outputWriter()
 	if err != nil {
-		return GlobalLogger, err
+		return GlobalLogger, nil, err
+	}
+	// 创建失败时关闭已打开的文件
+	fail := func(err error) (zerolog.Logger, io.Closer, error) {
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return GlobalLogger, nil, err
 	}
 
 	switch lc.Format {
@@ -133,7 +167,7 @@ func (lc LogConfig) NewLogger() (zerolog.Logger, error) {
 		}
 	case "json":
 	default:
-		return GlobalLogger, fmt.Errorf("unknown log format: %v", lc.Format)
+		return fail(fmt.Errorf("unknown log format: %v", lc.Format))
 	}
 
 	if lc.Level == "" {
@@ -141,8 +175,8 @@ func (lc LogConfig) NewLogger() (zerolog.Logger, error) {
 	}
 	lvl, err := zerolog.ParseLevel(lc.Level)
 	if err != nil {
-		return GlobalLogger, err
+		return fail(err)
 	}
 
-	return zerolog.New(out).Level(lvl).With().Timestamp().Logger(), nil
+	return zerolog.New(out).Level(lvl).With().Timestamp().Logger(), closer, nil
 }
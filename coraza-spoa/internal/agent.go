@@ -28,12 +28,20 @@ func (a *Agent) Serve(l net.Listener) error {
 	return agent.Serve(l)
 }
 
+// ReplaceApplications 替换应用集合，返回后被替换的应用不会再接收新的消息
 func (a *Agent) ReplaceApplications(newApps map[string]*Application) {
 	a.mtx.Lock()
 	a.Applications = newApps
 	a.mtx.Unlock()
 }
 
+// CurrentApplications 返回当前的应用集合
+func (a *Agent) CurrentApplications() map[string]*Application {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	return a.Applications
+}
+
 func (a *Agent) HandleSPOE(ctx context.Context, writer *encoding.ActionWriter, message *encoding.Message) {
 	const (
 		messageCorazaRequest  = "coraza-req"
@@ -66,14 +74,19 @@ func (a *Agent) HandleSPOE(ctx context.Context, writer *encoding.ActionWriter, m
 		return
 	}
 
+	// 在读锁内登记进行中的消息，保证应用被替换后退役时能等待这些消息处理完成
 	a.mtx.RLock()
 	app := a.Applications[appName]
+	if app != nil {
+		app.inflight.Add(1)
+	}
 	a.mtx.RUnlock()
 	if app == nil {
 		// If we cannot resolve the app, we fail as this is an invalid configuration.
 		a.Logger.Panic().Str("app", appName).Msg("app not found")
 		return
 	}
+	defer app.inflight.Done()
 
 	err := messageHandler(app, ctx, writer, message)
 	if err == nil {
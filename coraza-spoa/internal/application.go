@@ -5,23 +5,28 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
+	"net/http"
 	"net/netip"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/mongo"
 
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/internal/bot"
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/geoip"
 	coreruleset "github.com/corazawaf/coraza-coreruleset"
 	"github.com/corazawaf/coraza/v3"
 	"github.com/corazawaf/coraza/v3/debuglog"
 	"github.com/corazawaf/coraza/v3/types"
 	"github.com/dropmorepackets/haproxy-go/pkg/encoding"
 	"github.com/jcchavezs/mergefs"
-	"github.com/jcchavezs/mergefs/io"
+	mergefsio "github.com/jcchavezs/mergefs/io"
 	"github.com/rs/zerolog"
 	"istio.io/istio/pkg/cache"
 )
@@ -38,12 +43,38 @@ type AppConfig struct {
 	ResponseCheck  bool
 	Logger         zerolog.Logger
 	TransactionTTL time.Duration
+	// LogOutput 日志文件句柄，应用关闭时一并关闭，输出到标准输出时为空
+	LogOutput io.Closer
+	// LogPolicy 防火墙日志记录策略，取值见 model.LogPolicy*，为空时只记录被中断的事务
+	LogPolicy string
+	// LogScoreThreshold anomaly 策略下记录日志的入站异常分数，为 0 时使用 CRS 入站阻断阈值
+	LogScoreThreshold int
+	// Challenge 人机验证配置，规则设置 tx.challenge 且客户端没有有效的放行 Cookie 时返回验证动作
+	Challenge model.ChallengeConfig
+	// Bot 机器人识别配置
+	Bot model.BotConfig
+	// GeoIP 离线地理位置数据库，所有应用共用，为空时不查询
+	GeoIP *geoip.Database
 }
 
 type Application struct {
-	waf      coraza.WAF
-	cache    cache.ExpiringCache
-	logStore LogStore
+	waf         coraza.WAF
+	cache       cache.ExpiringCache
+	logStore    LogStore
+	botDetector *bot.Detector
+
+	// key 应用构建参数摘要，热更新时用于判断应用是否需要重建
+	key string
+	// inflight 正在处理的 SPOE 消息数，退役时等待其归零
+	inflight sync.WaitGroup
+	// predecessor 被当前应用替换、仍可能持有未完成事务的旧应用
+	predecessor atomic.Pointer[Application]
+	successor   *Application
+	retireOnce  sync.Once
+	closeOnce   sync.Once
+	// closed 应用释放资源后关闭，懒加载以兼容直接构造的应用
+	closed     chan struct{}
+	closedInit sync.Once
 
 	AppConfig
 }
@@ -67,6 +98,12 @@ type applicationRequest struct {
 	Version string
 	Headers []byte
 	Body    []byte
+	// Challenged 请求被要求先通过人机验证
+	Challenged bool
+	// Bot 机器人识别结果，未识别为机器人时为空
+	Bot *model.BotInfo
+	// Geo 来源IP的地理位置，查询不到时为空
+	Geo *model.GeoInfo
 }
 
 func (a *Application) HandleRequest(ctx context.Context, writer *encoding.ActionWriter, message *encoding.Message) (err error) {
@@ -144,18 +181,13 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 	}
 
 	if len(req.ID) == 0 {
-		const idLength = 16
-		var sb strings.Builder
-		sb.Grow(idLength)
-		for i := 0; i < idLength; i++ {
-			sb.WriteRune(rune('A' + rand.Intn(26)))
-		}
-		req.ID = sb.String()
+		req.ID = newTransactionID()
 	}
 
 	tx := a.waf.NewTransactionWithID(req.ID)
 	defer func() {
-		if err == nil && a.ResponseCheck {
+		// 要求验证的请求不会转发到后端，没有响应阶段，直接记录日志
+		if err == nil && a.ResponseCheck && !req.Challenged {
 			// 存储transaction和请求信息到缓存
 			txCache := &transaction{
 				tx:      tx,
@@ -165,16 +197,8 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 			return
 		}
 
-		// 处理中断情况和日志记录
-		if tx.IsInterrupted() && a.logStore != nil {
-			interruption := tx.Interruption()
-			if matchedRules := tx.MatchedRules(); len(matchedRules) > 0 {
-				err := a.saveFirewallLog(matchedRules, interruption, &req, req.Headers)
-				if err != nil {
-					a.Logger.Error().Err(err).Msg("failed to save firewall log")
-				}
-			}
-		}
+		// 按日志策略记录防火墙日志
+		a.logTransaction(tx, &req)
 
 		tx.ProcessLogging()
 		if err := tx.Close(); err != nil {
@@ -186,6 +210,27 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 		return err
 	}
 
+	a.lookupGeo(tx, &req)
+	a.classifyBot(tx, &req)
+	if req.Bot != nil {
+		if err := writer.SetString(encoding.VarScopeTransaction, "bot", req.Bot.Class); err != nil {
+			return err
+		}
+	}
+
+	if err := a.processRequest(tx, &req); err != nil {
+		return err
+	}
+
+	if a.challengeRequired(tx, &req) {
+		req.Challenged = true
+		return writer.SetString(encoding.VarScopeTransaction, "action", model.ChallengeAction)
+	}
+	return nil
+}
+
+// processRequest 执行请求阶段（phase 1、2）的规则检测，SPOE 请求和请求回放共用
+func (a *Application) processRequest(tx types.Transaction, req *applicationRequest) error {
 	if tx.IsRuleEngineOff() {
 		a.Logger.Warn().Msg("Rule engine is Off, Coraza is not going to process any rule")
 		return nil
@@ -201,7 +246,7 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 			url.Write(req.Query)
 		}
 
-		tx.ProcessURI(url.String(), req.Method, "HTTP/"+req.Version)
+		tx.ProcessURI(url.String(), req.Method, httpProtocol(req.Version))
 	}
 
 	if err := readHeaders(req.Headers, tx.AddRequestHeader); err != nil {
@@ -229,6 +274,31 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 	return nil
 }
 
+// httpProtocol 将 HAProxy req.ver/res.ver 返回的版本号转换为 Coraza 使用的协议字符串，
+// HTTP/2、HTTP/3 的版本号可能只有主版本号，统一补全为 CRS allowed_http_versions 中的形式
+func httpProtocol(version string) string {
+	switch version {
+	case "":
+		return "HTTP/1.1"
+	case "2":
+		return "HTTP/2.0"
+	case "3":
+		return "HTTP/3.0"
+	}
+	return "HTTP/" + version
+}
+
+// newTransactionID 生成16位随机大写字母的事务ID
+func newTransactionID() string {
+	const idLength = 16
+	var sb strings.Builder
+	sb.Grow(idLength)
+	for i := 0; i < idLength; i++ {
+		sb.WriteRune(rune('A' + rand.Intn(26)))
+	}
+	return sb.String()
+}
+
 func readHeaders(headers []byte, callback func(key string, value string)) error {
 	s := bufio.NewScanner(bytes.NewReader(headers))
 	for s.Scan() {
@@ -309,13 +379,11 @@ func (a *Application) HandleResponse(ctx context.Context, writer *encoding.Actio
 		return fmt.Errorf("response id is empty")
 	}
 
-	cv, ok := a.cache.Get(res.ID)
+	t, owner, ok := a.takeTransaction(res.ID)
 	if !ok {
 		return fmt.Errorf("transaction not found: %s", res.ID)
 	}
-	a.cache.Remove(res.ID)
 
-	t := cv.(*transaction)
 	if !t.m.TryLock() {
 		return fmt.Errorf("transaction is already being deleted: %s", res.ID)
 	}
@@ -327,35 +395,38 @@ func (a *Application) HandleResponse(ctx context.Context, writer *encoding.Actio
 	tx := t.tx
 
 	defer func() {
-		// 处理中断情况和日志记录
-		if tx.IsInterrupted() && a.logStore != nil {
-			interruption := tx.Interruption()
-			if matchedRules := tx.MatchedRules(); len(matchedRules) > 0 && t.request != nil {
-				err := a.saveFirewallLog(matchedRules, interruption, t.request, t.request.Headers)
-				if err != nil {
-					a.Logger.Error().Err(err).Msg("failed to save firewall log")
-				}
-			}
-		}
+		// 按日志策略记录防火墙日志
+		// 事务可能属于被替换的旧应用，日志写入其所属应用并使用其日志策略
+		owner.logTransaction(tx, t.request)
 
 		tx.ProcessLogging()
 		if err := tx.Close(); err != nil {
-			a.Logger.Error().Str("tx", tx.ID()).Err(err).Msg("failed to close transaction")
+			owner.Logger.Error().Str("tx", tx.ID()).Err(err).Msg("failed to close transaction")
 		}
 	}()
 
+	return a.processResponse(tx, &res)
+}
+
+// processResponse 执行响应阶段（phase 3、4）的规则检测，SPOE 响应和请求回放共用
+func (a *Application) processResponse(tx types.Transaction, res *applicationResponse) error {
 	if tx.IsRuleEngineOff() {
-		goto exit
+		return nil
 	}
 
 	if err := readHeaders(res.Headers, tx.AddResponseHeader); err != nil {
 		return fmt.Errorf("reading headers: %v", err)
 	}
 
-	if it := tx.ProcessResponseHeaders(int(res.Status), "HTTP/"+res.Version); it != nil {
+	if it := tx.ProcessResponseHeaders(int(res.Status), httpProtocol(res.Version)); it != nil {
 		return ErrInterrupted{it}
 	}
 
+	// WebSocket 等协议升级后的数据在 HAProxy 中以隧道方式直接转发，没有响应体需要检测
+	if res.Status == http.StatusSwitchingProtocols {
+		return nil
+	}
+
 	switch it, _, err := tx.WriteResponseBody(res.Body); {
 	case err != nil:
 		return err
@@ -370,7 +441,6 @@ func (a *Application) HandleResponse(ctx context.Context, writer *encoding.Actio
 		return ErrInterrupted{it}
 	}
 
-exit:
 	return nil
 }
 
@@ -403,8 +473,8 @@ func buildRequestString(req *applicationRequest, headers []byte) string {
 		sb.WriteByte('?')
 		sb.Write(req.Query)
 	}
-	sb.WriteString(" HTTP/")
-	sb.WriteString(req.Version)
+	sb.WriteString(" ")
+	sb.WriteString(httpProtocol(req.Version))
 	sb.WriteByte('\n')
 	sb.Write(headers)
 
@@ -416,74 +486,160 @@ func buildRequestString(req *applicationRequest, headers []byte) string {
 	return sb.String()
 }
 
-func (a *Application) saveFirewallLog(matchedRules []types.MatchedRule, interruption *types.Interruption, req *applicationRequest, headers []byte) error {
+// logTransaction 按应用的日志策略决定是否记录事务及记录哪些命中规则，需在 ProcessLogging 之前调用
+func (a *Application) logTransaction(tx types.Transaction, req *applicationRequest) {
+	if a.logStore == nil || req == nil {
+		return
+	}
+
+	interruption := tx.Interruption()
+	scores := anomalyScores(tx)
+
+	var interruptRuleID int
+	if interruption != nil {
+		interruptRuleID = interruption.RuleID
+	}
+
+	var logged bool
+	switch a.LogPolicy {
+	case model.LogPolicyMatched:
+		logged = true
+	case model.LogPolicyAnomaly:
+		threshold := a.LogScoreThreshold
+		if threshold <= 0 {
+			threshold = scores.InboundThreshold
+		}
+		logged = interruption != nil || req.Challenged ||
+			(threshold > 0 && scores.Inbound >= threshold) ||
+			(scores.OutboundThreshold > 0 && scores.Outbound >= scores.OutboundThreshold)
+	default:
+		logged = interruption != nil || req.Challenged
+	}
+	if !logged {
+		return
+	}
+
+	// matched 策略记录所有带 log 动作的规则，其余策略只记录中断规则和带 logdata 的规则
+	var matchedRules []types.MatchedRule
+	for _, matchedRule := range tx.MatchedRules() {
+		isInterruptRule := interruption != nil && matchedRule.Rule().ID() == interruptRuleID
+		if a.LogPolicy == model.LogPolicyMatched {
+			if isInterruptRule || ruleLogEnabled(matchedRule) {
+				matchedRules = append(matchedRules, matchedRule)
+			}
+			continue
+		}
+		if isInterruptRule || len(matchedRule.Data()) > 0 || (req.Challenged && ruleLogEnabled(matchedRule)) {
+			matchedRules = append(matchedRules, matchedRule)
+		}
+	}
+	if len(matchedRules) == 0 {
+		return
+	}
+
+	if err := a.saveFirewallLog(matchedRules, interruption, req, req.Headers, scores); err != nil {
+		a.Logger.Error().Err(err).Msg("failed to save firewall log")
+	}
+}
+
+// ruleLogEnabled 判断命中规则是否设置了 log 动作，types.MatchedRule 未暴露该字段，通过接口断言读取
+func ruleLogEnabled(matchedRule types.MatchedRule) bool {
+	if lr, ok := matchedRule.(interface{ Log() bool }); ok {
+		return lr.Log()
+	}
+	return true
+}
+
+// logAction 将事务的中断动作转换为日志记录的实际动作，要求验证时为 challenged，未中断时为 observed
+func logAction(interruption *types.Interruption, challenged bool) string {
+	if interruption == nil {
+		if challenged {
+			return model.WAFLogActionChallenged
+		}
+		return model.WAFLogActionObserved
+	}
+	switch interruption.Action {
+	case "redirect":
+		return model.WAFLogActionRedirected
+	case "drop":
+		return model.WAFLogActionDropped
+	default:
+		return model.WAFLogActionBlocked
+	}
+}
+
+// saveFirewallLog 保存命中规则的防火墙日志，matchedRules 为按日志策略筛选后的规则，
+// scores 为 ProcessLogging 之前读取的异常评分，interruption 为空表示事务未被中断
+func (a *Application) saveFirewallLog(matchedRules []types.MatchedRule, interruption *types.Interruption, req *applicationRequest, headers []byte, scores model.AnomalyScore) error {
 	// 构建日志条目
 	logs := make([]model.Log, 0)
 
 	// 初始化防火墙日志
 	firewallLog := model.WAFLog{
-		CreatedAt: time.Now(),
-		Request:   buildRequestString(req, headers),
-		Response:  "", // 暂时不处理响应
-		Domain:    getHostFromRequest(req),
-		SrcIP:     getRealClientIP(req),
-		DstIP:     req.DstIp.String(),
-		SrcPort:   int(req.SrcPort),
-		DstPort:   int(req.DstPort),
-		RequestID: req.ID,
+		CreatedAt:    time.Now(),
+		Request:      buildRequestString(req, headers),
+		Response:     "", // 暂时不处理响应
+		Domain:       getHostFromRequest(req),
+		SrcIP:        getRealClientIP(req),
+		DstIP:        req.DstIp.String(),
+		SrcPort:      int(req.SrcPort),
+		DstPort:      int(req.DstPort),
+		RequestID:    req.ID,
+		AnomalyScore: scores,
+		Action:       logAction(interruption, req.Challenged),
+		Bot:          req.Bot,
+		Geo:          req.Geo,
 	}
 
 	// 遍历所有匹配的规则
 	for _, matchedRule := range matchedRules {
-		if data := matchedRule.Data(); matchedRule.Rule().ID() == interruption.RuleID || len(data) > 0 {
-			// 添加日志条目
-			log := model.Log{
-				Message:    matchedRule.Message(),
-				Payload:    matchedRule.Data(),
-				RuleID:     matchedRule.Rule().ID(),
-				Severity:   int(matchedRule.Rule().Severity()),
-				Phase:      int(matchedRule.Rule().Phase()),
-				SecMark:    matchedRule.Rule().SecMark(),
-				Accuracy:   matchedRule.Rule().Accuracy(),
-				SecLangRaw: matchedRule.Rule().Raw(),
-				LogRaw:     matchedRule.ErrorLog(),
-			}
-			logs = append(logs, log)
+		// 添加日志条目
+		log := model.Log{
+			Message:    matchedRule.Message(),
+			Payload:    matchedRule.Data(),
+			RuleID:     matchedRule.Rule().ID(),
+			Severity:   int(matchedRule.Rule().Severity()),
+			Phase:      int(matchedRule.Rule().Phase()),
+			SecMark:    matchedRule.Rule().SecMark(),
+			Accuracy:   matchedRule.Rule().Accuracy(),
+			SecLangRaw: matchedRule.Rule().Raw(),
+			LogRaw:     matchedRule.ErrorLog(),
+		}
+		logs = append(logs, log)
 
-			// 更新防火墙日志的字段（只有当新值不为空时才覆盖）
-			if id := matchedRule.Rule().ID(); id != 0 {
-				firewallLog.RuleID = id
-			}
-			if raw := matchedRule.Rule().Raw(); raw != "" {
-				firewallLog.SecLangRaw = raw
-			}
-			if severity := matchedRule.Rule().Severity(); severity != 0 {
-				firewallLog.Severity = int(severity)
-			}
-			if phase := matchedRule.Rule().Phase(); phase != 0 {
-				firewallLog.Phase = int(phase)
-			}
-			if secMark := matchedRule.Rule().SecMark(); secMark != "" {
-				firewallLog.SecMark = secMark
-			}
-			if accuracy := matchedRule.Rule().Accuracy(); accuracy != 0 {
-				firewallLog.Accuracy = accuracy
-			}
-			if payload := matchedRule.Data(); payload != "" {
-				firewallLog.Payload = payload
-			}
-			if msg := matchedRule.Message(); msg != "" {
-				firewallLog.Message = msg
-			}
-			if uri := matchedRule.URI(); uri != "" {
-				firewallLog.URI = uri
-			}
-			if clientIP := matchedRule.ClientIPAddress(); clientIP != "" {
-				firewallLog.ClientIP = clientIP
-			}
-			if serverIP := matchedRule.ServerIPAddress(); serverIP != "" {
-				firewallLog.ServerIP = serverIP
-			}
+		// 更新防火墙日志的字段（只有当新值不为空时才覆盖）
+		if id := matchedRule.Rule().ID(); id != 0 {
+			firewallLog.RuleID = id
+		}
+		if raw := matchedRule.Rule().Raw(); raw != "" {
+			firewallLog.SecLangRaw = raw
+		}
+		if severity := matchedRule.Rule().Severity(); severity != 0 {
+			firewallLog.Severity = int(severity)
+		}
+		if phase := matchedRule.Rule().Phase(); phase != 0 {
+			firewallLog.Phase = int(phase)
+		}
+		if secMark := matchedRule.Rule().SecMark(); secMark != "" {
+			firewallLog.SecMark = secMark
+		}
+		if accuracy := matchedRule.Rule().Accuracy(); accuracy != 0 {
+			firewallLog.Accuracy = accuracy
+		}
+		if payload := matchedRule.Data(); payload != "" {
+			firewallLog.Payload = payload
+		}
+		if msg := matchedRule.Message(); msg != "" {
+			firewallLog.Message = msg
+		}
+		if uri := matchedRule.URI(); uri != "" {
+			firewallLog.URI = uri
+		}
+		if clientIP := matchedRule.ClientIPAddress(); clientIP != "" {
+			firewallLog.ClientIP = clientIP
+		}
+		if serverIP := matchedRule.ServerIPAddress(); serverIP != "" {
+			firewallLog.ServerIP = serverIP
 		}
 	}
 
@@ -525,23 +681,26 @@ func (a AppConfig) NewApplicationWithContext(ctx context.Context, mongoConfig *M
 			WithDirectives(a.Directives).
 			WithErrorCallback(app.logCallback).
 			WithDebugLogger(debugLogger).
-			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
+			WithRootFS(mergefs.Merge(coreruleset.FS, mergefsio.OSFS))
 	case isDebug:
 		config = coraza.NewWAFConfig().
 			WithDirectives(a.Directives).
 			WithErrorCallback(app.logCallback).
-			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
+			WithRootFS(mergefs.Merge(coreruleset.FS, mergefsio.OSFS))
 	default:
 		config = coraza.NewWAFConfig().
 			WithDirectives(a.Directives).
-			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
+			WithRootFS(mergefs.Merge(coreruleset.FS, mergefsio.OSFS))
 	}
 
 	waf, err := coraza.NewWAF(config)
 	if err != nil {
+		// 释放已启动的日志存储器和日志文件句柄
+		app.Close()
 		return nil, err
 	}
 	app.waf = waf
+	app.botDetector = newBotDetector(a.Bot)
 
 	const defaultExpire = time.Second * 10
 	const defaultEvictionInterval = time.Second * 1
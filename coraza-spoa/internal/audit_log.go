@@ -0,0 +1,391 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/corazawaf/coraza/v3/experimental/plugins"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// 审计日志写入器类型，在指令中通过 SecAuditLogType 选择，SecAuditEngine、SecAuditLogParts 的语义与 Coraza 一致
+const (
+	// AuditLogTypeMongo 每个事务写入一条包含全部选中部分的 audit_transaction 记录
+	AuditLogTypeMongo = "mongo"
+	// AuditLogTypeMongoConcurrent 请求体和响应体单独写入 audit_body，audit_transaction 记录中只保留引用
+	AuditLogTypeMongoConcurrent = "mongo_concurrent"
+)
+
+func init() {
+	plugins.RegisterAuditLogWriter(AuditLogTypeMongo, func() plugintypes.AuditLogWriter {
+		return &auditWriter{}
+	})
+	plugins.RegisterAuditLogWriter(AuditLogTypeMongoConcurrent, func() plugintypes.AuditLogWriter {
+		return &auditWriter{concurrent: true}
+	})
+}
+
+// AuditStore 定义审计记录存储接口
+type AuditStore interface {
+	Store(record model.AuditTransaction, bodies []model.AuditBody) error
+	Start(ctx context.Context)
+	Close()
+}
+
+var (
+	auditStoreMu sync.RWMutex
+	auditStore   AuditStore
+)
+
+// SetAuditStore 设置审计日志写入器使用的存储器并返回之前的存储器，为 nil 时写入器回退到 SecAuditLog 指定的文件。
+// 写入器由 Coraza 在解析指令时创建，无法按应用注入依赖，因此所有应用共用同一个存储器
+func SetAuditStore(store AuditStore) AuditStore {
+	auditStoreMu.Lock()
+	defer auditStoreMu.Unlock()
+
+	prev := auditStore
+	auditStore = store
+	return prev
+}
+
+// CloseAuditStore 移除并关闭当前的审计记录存储器
+func CloseAuditStore() {
+	if prev := SetAuditStore(nil); prev != nil {
+		prev.Close()
+	}
+}
+
+// ReleaseAuditStore 关闭指定的存储器，仍是当前存储器时一并移除；已被新的存储器替换时不影响新的存储器
+func ReleaseAuditStore(store AuditStore) {
+	if store == nil {
+		return
+	}
+	auditStoreMu.Lock()
+	if auditStore == store {
+		auditStore = nil
+	}
+	auditStoreMu.Unlock()
+	store.Close()
+}
+
+func currentAuditStore() AuditStore {
+	auditStoreMu.RLock()
+	defer auditStoreMu.RUnlock()
+	return auditStore
+}
+
+// auditWriter 将 Coraza 审计日志按 SecAuditLogParts 转换为结构化记录，
+// 有存储器时写入 MongoDB，否则以 JSON 行追加到 SecAuditLog 指定的文件，SecAuditLogFormat 对其不生效
+type auditWriter struct {
+	concurrent bool
+	target     string
+	dir        string
+	fileMode   fs.FileMode
+	dirMode    fs.FileMode
+}
+
+// auditFileMu 串行化回退文件的写入，多个应用可能指向同一个文件
+var auditFileMu sync.Mutex
+
+func (w *auditWriter) Init(c plugintypes.AuditLogConfig) error {
+	w.target = c.Target
+	w.dir = c.Dir
+	w.fileMode = c.FileMode
+	w.dirMode = c.DirMode
+	if w.dir == "" && w.target != "" {
+		w.dir = filepath.Dir(w.target)
+	}
+	return nil
+}
+
+func (w *auditWriter) Write(al plugintypes.AuditLog) error {
+	record, bodies := newAuditTransaction(al, w.concurrent)
+
+	if store := currentAuditStore(); store != nil {
+		return store.Store(record, bodies)
+	}
+	return w.writeFile(record, bodies)
+}
+
+// Close 回退文件每次写入时打开和关闭，Coraza 也不会在应用退役时关闭写入器，因此无需释放资源
+func (w *auditWriter) Close() error {
+	return nil
+}
+
+// writeFile 将记录追加到 SecAuditLog 文件，并发模式下消息体按日期写入 SecAuditLogStorageDir
+func (w *auditWriter) writeFile(record model.AuditTransaction, bodies []model.AuditBody) error {
+	if w.target == "" {
+		return nil
+	}
+
+	if len(bodies) > 0 {
+		dir := filepath.Join(w.dir, record.Timestamp.Format("20060102"))
+		if err := os.MkdirAll(dir, w.dirMode); err != nil {
+			return err
+		}
+		for i, body := range bodies {
+			name := fmt.Sprintf("%s-%s-%s.body", record.Timestamp.Format("150405"), record.TransactionID, body.Part)
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(body.Content), w.fileMode); err != nil {
+				return err
+			}
+			record.Bodies[i].Location = path
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	auditFileMu.Lock()
+	defer auditFileMu.Unlock()
+
+	f, err := os.OpenFile(w.target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.fileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newAuditTransaction 按审计日志部分填充记录，concurrent 为 true 时把请求体、响应体拆分为单独的消息体
+func newAuditTransaction(al plugintypes.AuditLog, concurrent bool) (model.AuditTransaction, []model.AuditBody) {
+	parts := al.Parts()
+	has := func(ps ...types.AuditLogPart) bool {
+		for _, p := range ps {
+			if slices.Contains(parts, p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	tx := al.Transaction()
+	now := time.Now()
+	record := model.AuditTransaction{
+		TransactionID: tx.ID(),
+		Parts:         "A" + string(parts) + "Z",
+		Timestamp:     time.Unix(0, tx.UnixTimestamp()),
+		ClientIP:      tx.ClientIP(),
+		ClientPort:    tx.ClientPort(),
+		HostIP:        tx.HostIP(),
+		HostPort:      tx.HostPort(),
+		ServerID:      tx.ServerID(),
+		Interrupted:   tx.IsInterrupted(),
+		CreatedAt:     now,
+	}
+
+	if tx.HasRequest() {
+		req := tx.Request()
+		record.Request = model.AuditRequest{
+			Method:   req.Method(),
+			URI:      req.URI(),
+			Protocol: req.Protocol(),
+			Length:   req.Length(),
+		}
+		if has(types.AuditLogPartRequestHeaders) {
+			record.Request.Headers = req.Headers()
+		}
+		if has(types.AuditLogPartRequestBody, types.AuditLogPartRequestBodyAlternative) {
+			record.Request.Body = req.Body()
+		}
+		if has(types.AuditLogPartUploadedFiles) {
+			for _, file := range req.Files() {
+				record.Request.Files = append(record.Request.Files, model.AuditFile{
+					Name: file.Name(),
+					Size: file.Size(),
+					Mime: file.Mime(),
+				})
+			}
+		}
+	}
+
+	if tx.HasResponse() {
+		res := tx.Response()
+		if has(types.AuditLogPartResponseHeaders) {
+			record.Response.Status = res.Status()
+			record.Response.Headers = res.Headers()
+		}
+		if has(types.AuditLogPartIntermediaryResponseBody, types.AuditLogPartResponseBody) {
+			record.Response.Body = res.Body()
+		}
+	}
+
+	if has(types.AuditLogPartAuditLogTrailer) {
+		if producer := tx.Producer(); producer != nil {
+			record.Producer = &model.AuditProducer{
+				Connector:  producer.Connector(),
+				Version:    producer.Version(),
+				RuleEngine: producer.RuleEngine(),
+				Stopwatch:  producer.Stopwatch(),
+				Rulesets:   producer.Rulesets(),
+			}
+		}
+	}
+
+	if has(types.AuditLogPartRulesMatched) {
+		for _, msg := range al.Messages() {
+			data := msg.Data()
+			record.Messages = append(record.Messages, model.AuditMessage{
+				RuleID:   data.ID(),
+				Message:  msg.Message(),
+				Data:     data.Data(),
+				Severity: int(data.Severity()),
+				File:     data.File(),
+				Line:     data.Line(),
+				Tags:     data.Tags(),
+				Raw:      data.Raw(),
+			})
+		}
+	}
+
+	if !concurrent {
+		return record, nil
+	}
+
+	var bodies []model.AuditBody
+	split := func(part types.AuditLogPart, content *string) {
+		if *content == "" {
+			return
+		}
+		bodies = append(bodies, model.AuditBody{
+			TransactionID: record.TransactionID,
+			Part:          string(part),
+			Content:       *content,
+			CreatedAt:     now,
+		})
+		record.Bodies = append(record.Bodies, model.AuditBodyRef{
+			Part: string(part),
+			Size: len(*content),
+		})
+		*content = ""
+	}
+	split(types.AuditLogPartRequestBody, &record.Request.Body)
+	split(types.AuditLogPartIntermediaryResponseBody, &record.Response.Body)
+
+	return record, bodies
+}
+
+// auditEntry 等待写入的审计记录及其单独存储的消息体
+type auditEntry struct {
+	record model.AuditTransaction
+	bodies []model.AuditBody
+}
+
+// MongoAuditStore MongoDB实现的审计记录存储
+type MongoAuditStore struct {
+	mongo     *mongo.Client
+	mongoDB   string
+	entryChan chan auditEntry
+	logger    zerolog.Logger
+
+	// mu 保护 closed，避免关闭通道后仍有记录写入
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{} // 存储循环退出时关闭
+}
+
+// NewMongoAuditStore 创建新的MongoDB审计记录存储器
+func NewMongoAuditStore(client *mongo.Client, database string, logger zerolog.Logger) *MongoAuditStore {
+	return &MongoAuditStore{
+		mongo:     client,
+		mongoDB:   database,
+		entryChan: make(chan auditEntry, defaultChannelSize),
+		logger:    logger,
+		done:      make(chan struct{}),
+	}
+}
+
+// Store 非阻塞地发送审计记录到存储通道
+func (s *MongoAuditStore) Store(record model.AuditTransaction, bodies []model.AuditBody) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.logger.Warn().Msg("audit store is closed, dropping audit record")
+		return nil
+	}
+
+	select {
+	case s.entryChan <- auditEntry{record: record, bodies: bodies}:
+		return nil
+	default:
+		// 通道已满，丢弃记录
+		s.logger.Warn().Msg("audit channel is full, dropping audit record")
+		return nil
+	}
+}
+
+// Start 启动审计记录存储处理循环
+func (s *MongoAuditStore) Start(ctx context.Context) {
+	go s.processEntries(ctx)
+}
+
+// Close 关闭存储器并等待通道中剩余的记录写入完成，可重复调用
+func (s *MongoAuditStore) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.entryChan)
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+	case <-time.After(defaultFlushTimeout):
+		s.logger.Warn().Int("pending", len(s.entryChan)).Msg("timed out flushing audit records")
+	}
+}
+
+// processEntries 处理审计记录存储循环
+func (s *MongoAuditStore) processEntries(ctx context.Context) {
+	defer close(s.done)
+
+	var record model.AuditTransaction
+	var body model.AuditBody
+	db := s.mongo.Database(s.mongoDB)
+	records := db.Collection(record.GetCollectionName())
+	bodies := db.Collection(body.GetCollectionName())
+
+	for {
+		select {
+		case entry, ok := <-s.entryChan:
+			if !ok {
+				return // 通道已关闭
+			}
+
+			storeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			// 先写消息体，避免记录可见时消息体仍不存在
+			if len(entry.bodies) > 0 {
+				if _, err := bodies.InsertMany(storeCtx, entry.bodies); err != nil {
+					s.logger.Error().Err(err).Str("tx", entry.record.TransactionID).Msg("failed to save audit bodies to MongoDB")
+				}
+			}
+			if _, err := records.InsertOne(storeCtx, entry.record); err != nil {
+				s.logger.Error().Err(err).Str("tx", entry.record.TransactionID).Msg("failed to save audit record to MongoDB")
+			}
+			cancel()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"strconv"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/internal/bot"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// newBotDetector 按配置创建机器人识别器，未启用时返回 nil
+func newBotDetector(cfg model.BotConfig) *bot.Detector {
+	if !cfg.Enabled {
+		return nil
+	}
+	return bot.NewDetector(bot.Options{VerifyCrawlers: cfg.VerifyCrawlers})
+}
+
+// classifyBot 识别机器人请求并在规则执行前写入 TX 变量，需在处理请求之前调用
+func (a *Application) classifyBot(tx types.Transaction, req *applicationRequest) {
+	if a.botDetector == nil {
+		return
+	}
+
+	userAgent, _ := getHeaderValue(req.Headers, "user-agent")
+	secCHUA, _ := getHeaderValue(req.Headers, "sec-ch-ua")
+	info := a.botDetector.Classify(req.SrcIp, userAgent, secCHUA)
+	if info == nil {
+		return
+	}
+	req.Bot = info
+
+	state, ok := tx.(plugintypes.TransactionState)
+	if !ok {
+		return
+	}
+	txVars := state.Variables().TX()
+	txVars.Set(model.BotTXClass, []string{info.Class})
+	txVars.Set(model.BotTXName, []string{info.Name})
+	txVars.Set(model.BotTXScore, []string{strconv.Itoa(info.Score)})
+}
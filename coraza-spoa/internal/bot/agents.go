@@ -0,0 +1,73 @@
+package bot
+
+import "strings"
+
+// crawler 需要 DNS 验证的搜索引擎爬虫
+type crawler struct {
+	name    string
+	tokens  []string // User-Agent 中的标识，小写
+	domains []string // 反向解析的主机名必须属于的域名
+}
+
+// ownsHost 判断主机名是否属于爬虫的域名
+func (c *crawler) ownsHost(host string) bool {
+	for _, domain := range c.domains {
+		if strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// crawlers 搜索引擎公布了验证方式的爬虫
+var crawlers = []*crawler{
+	{
+		name:    "googlebot",
+		tokens:  []string{"googlebot", "google-inspectiontool", "googleother", "adsbot-google", "mediapartners-google"},
+		domains: []string{"googlebot.com", "google.com", "googleusercontent.com"},
+	},
+	{
+		name:    "bingbot",
+		tokens:  []string{"bingbot", "adidxbot", "bingpreview", "msnbot"},
+		domains: []string{"search.msn.com"},
+	},
+}
+
+func matchCrawler(ua string) *crawler {
+	for _, c := range crawlers {
+		for _, token := range c.tokens {
+			if strings.Contains(ua, token) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// badAgents 漏洞扫描器和恶意爬虫
+var badAgents = []string{
+	"sqlmap", "nikto", "nmap", "masscan", "zgrab", "nuclei", "acunetix", "netsparker", "wpscan",
+	"dirbuster", "gobuster", "feroxbuster", "ffuf", "wfuzz", "whatweb", "nessus", "openvas",
+	"arachni", "w3af", "skipfish", "jaeles", "commix", "xsstrike", "hydra", "zmeu", "morfeus",
+}
+
+// headlessAgents 无头浏览器和浏览器自动化工具
+var headlessAgents = []string{
+	"headlesschrome", "phantomjs", "slimerjs", "puppeteer", "playwright", "selenium", "webdriver",
+}
+
+// automatedAgents HTTP 库和命令行工具
+var automatedAgents = []string{
+	"python-requests", "python-urllib", "aiohttp", "httpx", "scrapy", "curl/", "wget/", "go-http-client",
+	"java/", "okhttp", "apache-httpclient", "libwww-perl", "node-fetch", "axios/", "guzzlehttp", "httpie",
+}
+
+// matchToken 返回 User-Agent 中第一个匹配的标识
+func matchToken(ua string, tokens []string) string {
+	for _, token := range tokens {
+		if strings.Contains(ua, token) {
+			return strings.TrimSuffix(token, "/")
+		}
+	}
+	return ""
+}
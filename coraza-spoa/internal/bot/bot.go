@@ -0,0 +1,224 @@
+// Package bot 根据 User-Agent、客户端提示和 DNS 验证识别机器人请求
+package bot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"istio.io/istio/pkg/cache"
+)
+
+// 各分类的可疑程度分数
+const (
+	scoreFake      = 5
+	scoreBad       = 5
+	scoreHeadless  = 3
+	scoreAutomated = 2
+)
+
+const (
+	defaultLookupTimeout = 2 * time.Second
+	defaultVerifiedTTL   = 24 * time.Hour
+	defaultFailedTTL     = time.Hour
+	defaultErrorTTL      = time.Minute
+
+	// maxPendingLookups 同时进行的 DNS 验证上限，超出时本次按未验证处理，避免伪造爬虫的请求耗尽资源
+	maxPendingLookups = 256
+)
+
+// verdict DNS 验证结果
+type verdict int
+
+const (
+	verdictPending  verdict = iota // 验证尚未完成
+	verdictVerified                // 通过验证
+	verdictFake                    // 未通过验证
+	verdictUnknown                 // DNS 查询出错或超时，无法判断真伪
+)
+
+// Resolver DNS 解析接口，*net.Resolver 实现了该接口，测试时可以替换
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Options 识别器配置
+type Options struct {
+	Resolver       Resolver      // DNS 解析器，为空时使用 net.DefaultResolver
+	VerifyCrawlers bool          // 是否通过 DNS 验证自称搜索引擎爬虫的请求
+	LookupTimeout  time.Duration // 单次验证的 DNS 查询超时，验证在后台进行，不占用请求处理时间
+	VerifiedTTL    time.Duration // 验证通过结果的缓存时间
+	FailedTTL      time.Duration // 验证未通过结果的缓存时间
+	ErrorTTL       time.Duration // DNS 查询出错结果的缓存时间，期间不再重复查询
+}
+
+// Detector 机器人识别器，可并发使用
+type Detector struct {
+	resolver       Resolver
+	verifyCrawlers bool
+	lookupTimeout  time.Duration
+	verifiedTTL    time.Duration
+	failedTTL      time.Duration
+	errorTTL       time.Duration
+	verified       cache.ExpiringCache // 爬虫名称和IP -> 验证结果
+
+	mu      sync.Mutex
+	pending map[string]struct{} // 正在后台验证的爬虫名称和IP
+	wg      sync.WaitGroup
+}
+
+// NewDetector 创建机器人识别器
+func NewDetector(opts Options) *Detector {
+	d := &Detector{
+		resolver:       opts.Resolver,
+		verifyCrawlers: opts.VerifyCrawlers,
+		lookupTimeout:  opts.LookupTimeout,
+		verifiedTTL:    opts.VerifiedTTL,
+		failedTTL:      opts.FailedTTL,
+		errorTTL:       opts.ErrorTTL,
+		pending:        make(map[string]struct{}),
+	}
+	if d.resolver == nil {
+		d.resolver = net.DefaultResolver
+	}
+	if d.lookupTimeout <= 0 {
+		d.lookupTimeout = defaultLookupTimeout
+	}
+	if d.verifiedTTL <= 0 {
+		d.verifiedTTL = defaultVerifiedTTL
+	}
+	if d.failedTTL <= 0 {
+		d.failedTTL = defaultFailedTTL
+	}
+	if d.errorTTL <= 0 {
+		d.errorTTL = defaultErrorTTL
+	}
+	d.verified = cache.NewTTL(d.verifiedTTL, time.Minute)
+	return d
+}
+
+// Classify 识别请求，secCHUA 为 Sec-CH-UA 请求头，未识别为机器人时返回 nil
+func (d *Detector) Classify(ip netip.Addr, userAgent, secCHUA string) *model.BotInfo {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+
+	// 自称搜索引擎爬虫的请求优先验证，伪造爬虫身份的扫描器按伪造处理
+	if crawler := matchCrawler(ua); crawler != nil {
+		if !d.verifyCrawlers {
+			return nil
+		}
+		switch d.verify(crawler, ip) {
+		case verdictVerified:
+			return &model.BotInfo{Class: model.BotClassVerified, Name: crawler.name}
+		case verdictFake:
+			return &model.BotInfo{Class: model.BotClassFake, Name: crawler.name, Score: scoreFake}
+		}
+		// 验证未完成或 DNS 不可用时无法判断真伪，不分类，避免误拦截真实爬虫
+		return nil
+	}
+
+	if name := matchToken(ua, badAgents); name != "" {
+		return &model.BotInfo{Class: model.BotClassBad, Name: name, Score: scoreBad}
+	}
+	if name := matchToken(ua, headlessAgents); name != "" {
+		return &model.BotInfo{Class: model.BotClassHeadless, Name: name, Score: scoreHeadless}
+	}
+	if strings.Contains(strings.ToLower(secCHUA), "headlesschrome") {
+		return &model.BotInfo{Class: model.BotClassHeadless, Name: "headlesschrome", Score: scoreHeadless}
+	}
+	if ua == "" {
+		return &model.BotInfo{Class: model.BotClassAutomated, Name: "empty-user-agent", Score: scoreAutomated}
+	}
+	if name := matchToken(ua, automatedAgents); name != "" {
+		return &model.BotInfo{Class: model.BotClassAutomated, Name: name, Score: scoreAutomated}
+	}
+	return nil
+}
+
+// verify 返回缓存的验证结果，没有缓存时在后台发起验证并返回 verdictPending，不阻塞请求处理
+func (d *Detector) verify(crawler *crawler, ip netip.Addr) verdict {
+	if !ip.IsValid() {
+		return verdictFake
+	}
+	key := crawler.name + "|" + ip.String()
+	if v, ok := d.verified.Get(key); ok {
+		return v.(verdict)
+	}
+
+	d.mu.Lock()
+	if _, ok := d.pending[key]; ok || len(d.pending) >= maxPendingLookups {
+		d.mu.Unlock()
+		return verdictPending
+	}
+	d.pending[key] = struct{}{}
+	d.wg.Add(1)
+	d.mu.Unlock()
+
+	go func() {
+		defer d.wg.Done()
+		d.resolve(key, crawler, ip)
+
+		d.mu.Lock()
+		delete(d.pending, key)
+		d.mu.Unlock()
+	}()
+	return verdictPending
+}
+
+// resolve 通过反向 DNS 查询IP的主机名，主机名属于爬虫的域名且正向解析包含该IP时验证通过，结果按IP缓存
+func (d *Detector) resolve(key string, crawler *crawler, ip netip.Addr) verdict {
+	ctx, cancel := context.WithTimeout(context.Background(), d.lookupTimeout)
+	defer cancel()
+
+	result, ttl := verdictFake, d.failedTTL
+	verified, err := d.lookup(ctx, crawler, ip)
+	switch {
+	case err != nil:
+		result, ttl = verdictUnknown, d.errorTTL
+	case verified:
+		result, ttl = verdictVerified, d.verifiedTTL
+	}
+	d.verified.SetWithExpiration(key, result, ttl)
+	return result
+}
+
+func (d *Detector) lookup(ctx context.Context, crawler *crawler, ip netip.Addr) (bool, error) {
+	names, err := d.resolver.LookupAddr(ctx, ip.String())
+	if err != nil {
+		// 没有 PTR 记录说明不是爬虫的IP，其余错误视为 DNS 不可用
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, name := range names {
+		host := strings.ToLower(strings.TrimSuffix(name, "."))
+		if !crawler.ownsHost(host) {
+			continue
+		}
+		addrs, err := d.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return false, err
+		}
+		for _, addr := range addrs {
+			if a, ok := netip.AddrFromSlice(addr.IP); ok && a.Unmap() == ip.Unmap() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
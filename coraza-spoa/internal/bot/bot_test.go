@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+const googlebotUA = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+// fakeResolver 按预设记录应答的 DNS 解析器，hang 为 true 时阻塞到超时
+type fakeResolver struct {
+	ptr   map[string][]string
+	hosts map[string][]string
+	hang  bool
+	calls atomic.Int32
+}
+
+func (r *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.calls.Add(1)
+	if r.hang {
+		<-ctx.Done()
+		return nil, &net.DNSError{Err: "i/o timeout", Name: addr, IsTimeout: true}
+	}
+	names, ok := r.ptr[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	result := make([]net.IPAddr, len(addrs))
+	for i, addr := range addrs {
+		result[i] = net.IPAddr{IP: net.ParseIP(addr)}
+	}
+	return result, nil
+}
+
+func TestClassifyCrawlerVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       string
+		resolver *fakeResolver
+		want     string // 验证完成后的分类，空表示不分类
+	}{
+		{
+			name: "verified",
+			ip:   "66.249.66.1",
+			resolver: &fakeResolver{
+				ptr:   map[string][]string{"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."}},
+				hosts: map[string][]string{"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"}},
+			},
+			want: model.BotClassVerified,
+		},
+		{
+			name: "spoofed ptr domain",
+			ip:   "203.0.113.7",
+			resolver: &fakeResolver{
+				ptr:   map[string][]string{"203.0.113.7": {"crawl.googlebot.com.evil.example."}},
+				hosts: map[string][]string{"crawl.googlebot.com.evil.example": {"203.0.113.7"}},
+			},
+			want: model.BotClassFake,
+		},
+		{
+			name: "forward mismatch",
+			ip:   "203.0.113.8",
+			resolver: &fakeResolver{
+				ptr:   map[string][]string{"203.0.113.8": {"crawl-66-249-66-1.googlebot.com."}},
+				hosts: map[string][]string{"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"}},
+			},
+			want: model.BotClassFake,
+		},
+		{
+			name:     "nxdomain",
+			ip:       "198.51.100.1",
+			resolver: &fakeResolver{},
+			want:     model.BotClassFake,
+		},
+		{
+			name:     "timeout",
+			ip:       "198.51.100.2",
+			resolver: &fakeResolver{hang: true},
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(Options{
+				Resolver:       tt.resolver,
+				VerifyCrawlers: true,
+				LookupTimeout:  20 * time.Millisecond,
+			})
+			ip := netip.MustParseAddr(tt.ip)
+
+			// 首次请求不等待 DNS，按未验证处理
+			start := time.Now()
+			if info := d.Classify(ip, googlebotUA, ""); info != nil {
+				t.Fatalf("pending classify = %+v, want nil", info)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+				t.Fatalf("classify blocked for %s", elapsed)
+			}
+			d.wg.Wait()
+
+			info := d.Classify(ip, googlebotUA, "")
+			got := ""
+			if info != nil {
+				got = info.Class
+			}
+			if got != tt.want {
+				t.Fatalf("class = %q, want %q", got, tt.want)
+			}
+
+			// 结果（包括 DNS 出错）已缓存，不再重复查询
+			d.Classify(ip, googlebotUA, "")
+			d.wg.Wait()
+			if calls := tt.resolver.calls.Load(); calls != 1 {
+				t.Fatalf("resolver called %d times, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestClassifyUserAgent(t *testing.T) {
+	d := NewDetector(Options{Resolver: &fakeResolver{}})
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	tests := []struct {
+		ua, secCHUA string
+		want        string
+	}{
+		{ua: googlebotUA, want: ""}, // 未启用爬虫验证
+		{ua: "sqlmap/1.7", want: model.BotClassBad},
+		{ua: "Mozilla/5.0 HeadlessChrome/120.0", want: model.BotClassHeadless},
+		{ua: "Mozilla/5.0", secCHUA: `"HeadlessChrome";v="120"`, want: model.BotClassHeadless},
+		{ua: "", want: model.BotClassAutomated},
+		{ua: "curl/8.0", want: model.BotClassAutomated},
+		{ua: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0", want: ""},
+	}
+	for _, tt := range tests {
+		info := d.Classify(ip, tt.ua, tt.secCHUA)
+		got := ""
+		if info != nil {
+			got = info.Class
+		}
+		if got != tt.want {
+			t.Errorf("Classify(%q, %q) = %q, want %q", tt.ua, tt.secCHUA, got, tt.want)
+		}
+	}
+}
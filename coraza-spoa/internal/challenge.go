@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/challenge"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// challengeRequired 判断请求是否需要先通过人机验证：规则设置了 tx.challenge 且请求未被拦截，
+// 验证页面自身的请求和携带有效放行 Cookie 的请求不需要验证
+func (a *Application) challengeRequired(tx types.Transaction, req *applicationRequest) bool {
+	if !a.Challenge.Active() || tx.IsInterrupted() || bytes.HasPrefix(req.Path, []byte(model.ChallengePath)) {
+		return false
+	}
+
+	state, ok := tx.(plugintypes.TransactionState)
+	if !ok {
+		return false
+	}
+	values := state.Variables().TX().Get(model.ChallengeTXVariable)
+	if len(values) == 0 || values[0] == "" || values[0] == "0" {
+		return false
+	}
+
+	cookieHeader, _ := getHeaderValue(req.Headers, "cookie")
+	cookies, err := http.ParseCookie(cookieHeader)
+	if err != nil {
+		return true
+	}
+	host, _ := getHeaderValue(req.Headers, "host")
+	userAgent, _ := getHeaderValue(req.Headers, "user-agent")
+	for _, cookie := range cookies {
+		if cookie.Name == model.ChallengeCookieName &&
+			challenge.VerifyClearance(a.Challenge.Secret, cookie.Value, req.SrcIp.String(), userAgent, host, time.Now()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"strconv"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// lookupGeo 查询来源IP的地理位置并在规则执行前写入 GEO 集合，需在处理请求之前调用
+func (a *Application) lookupGeo(tx types.Transaction, req *applicationRequest) {
+	if a.GeoIP == nil {
+		return
+	}
+
+	info := a.GeoIP.Lookup(req.SrcIp)
+	if info == nil {
+		return
+	}
+	req.Geo = info
+
+	state, ok := tx.(plugintypes.TransactionState)
+	if !ok {
+		return
+	}
+	geo := state.Variables().Geo()
+	if info.Country != "" {
+		geo.Set(model.GeoCountryCode, []string{info.Country})
+	}
+	if info.ASN != 0 {
+		geo.Set(model.GeoASN, []string{strconv.FormatUint(uint64(info.ASN), 10)})
+		geo.Set(model.GeoASOrg, []string{info.ASOrg})
+	}
+}
@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	"github.com/corazawaf/coraza/v3/experimental/plugins"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// BodyProcessorGRPC gRPC 请求体处理器名称，通过 ctl:requestBodyProcessor=GRPC 启用
+const BodyProcessorGRPC = "grpc"
+
+const (
+	// grpcFrameHeaderSize gRPC 消息前缀：1 字节压缩标志 + 4 字节大端长度
+	grpcFrameHeaderSize = 5
+	// grpcMaxDepth 解析嵌套消息的最大深度
+	grpcMaxDepth = 8
+	// grpcMaxFields 单个请求最多提取的字段数量
+	grpcMaxFields = 1024
+	// grpcMaxMessageSize 解压后单条消息的上限，与 gRPC 默认的最大接收消息大小一致
+	grpcMaxMessageSize = 4 << 20
+)
+
+func init() {
+	plugins.RegisterBodyProcessor(BodyProcessorGRPC, func() plugintypes.BodyProcessor {
+		return &grpcBodyProcessor{}
+	})
+}
+
+// grpcBodyProcessor 按 gRPC 消息前缀拆分请求体，不依赖 .proto 定义按 protobuf 编码解析每条消息，
+// 把其中的文本字段写入 ARGS_POST，键为字段编号路径，如 1.2，二进制内容不参与 CRS 的文本规则检测。
+// 压缩的消息按 gzip 解压后解析，无法解压时设置 tx.grpc_compressed=1，由规则拒绝请求
+type grpcBodyProcessor struct{}
+
+func (p *grpcBodyProcessor) ProcessRequest(reader io.Reader, v plugintypes.TransactionVariables, _ plugintypes.BodyProcessorOptions) error {
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	args := v.ArgsPost()
+	fields := 0
+	add := func(key, value string) bool {
+		if fields >= grpcMaxFields {
+			return false
+		}
+		fields++
+		args.Add(key, value)
+		return true
+	}
+
+	for len(body) >= grpcFrameHeaderSize {
+		compressed := body[0] == 1
+		size := int(binary.BigEndian.Uint32(body[1:grpcFrameHeaderSize]))
+		body = body[grpcFrameHeaderSize:]
+		// 流式请求或请求体超出检测上限时最后一条消息可能不完整，只解析已到达的部分
+		truncated := size > len(body)
+		if truncated {
+			size = len(body)
+		}
+		msg := body[:size]
+		body = body[size:]
+
+		if compressed {
+			var ok bool
+			if msg, ok = decompressGRPC(msg, truncated); !ok {
+				v.TX().Set(seclang.GRPCCompressedVariable, []string{"1"})
+				continue
+			}
+		}
+		if !parseProtobuf(msg, "", 0, add) {
+			break
+		}
+	}
+	return nil
+}
+
+func (p *grpcBodyProcessor) ProcessResponse(io.Reader, plugintypes.TransactionVariables, plugintypes.BodyProcessorOptions) error {
+	return nil
+}
+
+// decompressGRPC 按 gzip 解压消息，不完整的消息返回已解压的部分。
+// 不是 gzip 格式（其他压缩算法）、数据损坏或解压后超过上限时返回 false
+func decompressGRPC(msg []byte, truncated bool) ([]byte, bool) {
+	r, err := gzip.NewReader(bytes.NewReader(msg))
+	if err != nil {
+		return nil, false
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, grpcMaxMessageSize+1))
+	if err != nil && !(truncated && errors.Is(err, io.ErrUnexpectedEOF)) {
+		return nil, false
+	}
+	if len(data) > grpcMaxMessageSize {
+		return nil, false
+	}
+	return data, true
+}
+
+// parseProtobuf 按 protobuf 线格式解析消息，文本字段通过 add 写入，add 返回 false 时停止解析
+// 长度前缀字段优先作为文本处理，不是可打印文本时尝试作为嵌套消息解析，都不是时视为二进制数据忽略
+func parseProtobuf(msg []byte, prefix string, depth int, add func(key, value string) bool) bool {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return true
+		}
+		msg = msg[n:]
+
+		key := strconv.Itoa(int(num))
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+			if n < 0 {
+				return true
+			}
+			msg = msg[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(msg)
+		if n < 0 {
+			return true
+		}
+		msg = msg[n:]
+
+		switch {
+		case isPrintable(value):
+			if !add(key, string(value)) {
+				return false
+			}
+		case depth < grpcMaxDepth && isProtobufMessage(value):
+			if !parseProtobuf(value, key, depth+1, add) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isProtobufMessage 检查数据能否完整解析为 protobuf 消息
+func isProtobufMessage(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
+
+// isPrintable 检查数据是否为可打印的 UTF-8 文本
+func isPrintable(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
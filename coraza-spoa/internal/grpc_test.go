@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	"github.com/corazawaf/coraza/v3"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// grpcFrame 按 gRPC 消息前缀封装消息
+func grpcFrame(compressed bool, msg []byte) []byte {
+	frame := make([]byte, grpcFrameHeaderSize, grpcFrameHeaderSize+len(msg))
+	if compressed {
+		frame[0] = 1
+	}
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGRPCBodyProcessor(t *testing.T) {
+	msg := protowire.AppendTag(nil, 1, protowire.BytesType)
+	msg = protowire.AppendString(msg, "1' OR '1'='1")
+
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(
+		"SecRuleEngine On\nSecRequestBodyAccess On\n" + seclang.ProtocolDirectives() +
+			`SecRule ARGS_POST:1 "@contains OR '1'='1" "id:1,phase:2,deny,status:403"`,
+	))
+	if err != nil {
+		t.Fatalf("create waf: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		body   []byte
+		ruleID int // 0 表示放行
+	}{
+		{name: "plain", body: grpcFrame(false, msg), ruleID: 1},
+		{name: "gzip", body: grpcFrame(true, gzipBytes(t, msg)), ruleID: 1},
+		{name: "unknown compression", body: grpcFrame(true, msg), ruleID: seclang.ProtocolRuleIDBase + 1},
+		{name: "benign", body: grpcFrame(false, protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "hello"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			defer tx.Close()
+			tx.ProcessURI("/pkg.Service/Method", "POST", "HTTP/2.0")
+			tx.AddRequestHeader("Content-Type", "application/grpc")
+			tx.ProcessRequestHeaders()
+			if _, _, err := tx.WriteRequestBody(tt.body); err != nil {
+				t.Fatalf("write body: %v", err)
+			}
+			it, err := tx.ProcessRequestBody()
+			if err != nil {
+				t.Fatalf("process body: %v", err)
+			}
+
+			got := 0
+			if it != nil {
+				got = it.RuleID
+			}
+			if got != tt.ruleID {
+				t.Fatalf("interrupted by rule %d, want %d", got, tt.ruleID)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	// retireDrainTimeout 退役应用等待进行中请求完成的最长时间
+	retireDrainTimeout = 30 * time.Second
+	// retireMaxTransactionWait 退役应用等待已缓存事务收到响应的最长时间
+	retireMaxTransactionWait = 5 * time.Minute
+)
+
+// AppSpec 描述一个应用的构建参数，Key 相同时认为应用无需重建
+type AppSpec struct {
+	Name  string
+	Key   string
+	Build func() (*Application, error)
+}
+
+// Fingerprint 计算应用构建参数的摘要，extra 用于附加日志配置等不在 AppConfig 中的参数
+func (a AppConfig) Fingerprint(isDebug bool, extra ...string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%s\n", len(a.Directives), a.Directives)
+	fmt.Fprintf(h, "response_check=%t\nttl=%d\ndebug=%t\n", a.ResponseCheck, a.TransactionTTL, isDebug)
+	fmt.Fprintf(h, "log_policy=%s\nlog_score_threshold=%d\n", a.LogPolicy, a.LogScoreThreshold)
+	fmt.Fprintf(h, "challenge=%t:%s:%d\n", a.Challenge.Enabled, a.Challenge.Secret, a.Challenge.TTL)
+	fmt.Fprintf(h, "bot=%t:%t\n", a.Bot.Enabled, a.Bot.VerifyCrawlers)
+	// 数据库文件更新时原地重新加载，只有数据库路径变化时才会换成新的实例
+	fmt.Fprintf(h, "geoip=%p\n", a.GeoIP)
+	for _, e := range extra {
+		fmt.Fprintf(h, "%d:%s\n", len(e), e)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DiffApplications 对比当前应用和新的构建参数：Key 未变化的应用直接复用，变化或新增的应用重新构建。
+// 返回新的应用集合以及被替换或删除、需要退役的旧应用；任意应用构建失败时关闭本次新建的应用并返回错误，当前应用不受影响
+func DiffApplications(current map[string]*Application, specs []AppSpec) (map[string]*Application, []*Application, error) {
+	next := make(map[string]*Application, len(specs))
+	var built []*Application
+
+	for _, spec := range specs {
+		if old, ok := current[spec.Name]; ok && old.key == spec.Key {
+			next[spec.Name] = old
+			continue
+		}
+
+		app, err := spec.Build()
+		if err != nil {
+			for _, b := range built {
+				b.Close()
+			}
+			return nil, nil, fmt.Errorf("initializing application %q: %w", spec.Name, err)
+		}
+		app.key = spec.Key
+		built = append(built, app)
+		next[spec.Name] = app
+	}
+
+	var retired []*Application
+	for name, old := range current {
+		if next[name] == old {
+			continue
+		}
+		// 新应用接管同名旧应用尚未收到响应的事务
+		if app, ok := next[name]; ok && app.ResponseCheck && old.ResponseCheck {
+			app.predecessor.Store(old)
+			old.successor = app
+		}
+		retired = append(retired, old)
+	}
+
+	return next, retired, nil
+}
+
+// Retire 在后台退役应用：等待进行中的请求完成、已缓存事务收到响应或超时，然后释放资源
+func (a *Application) Retire() {
+	a.retireOnce.Do(func() {
+		go a.retire()
+	})
+}
+
+func (a *Application) retire() {
+	ctx, cancel := context.WithTimeout(context.Background(), retireDrainTimeout)
+	if !a.Drain(ctx) {
+		a.Logger.Warn().Dur("timeout", retireDrainTimeout).Msg("timed out draining in-flight requests of retired application")
+	}
+	cancel()
+
+	if a.ResponseCheck && a.TransactionTTL > 0 {
+		wait := a.TransactionTTL
+		if wait > retireMaxTransactionWait {
+			wait = retireMaxTransactionWait
+		}
+		time.Sleep(wait)
+	}
+
+	if a.successor != nil {
+		a.successor.predecessor.CompareAndSwap(a, nil)
+	}
+	a.Close()
+}
+
+// Drain 等待进行中的请求处理完成，ctx 结束前未完成时返回 false
+func (a *Application) Drain(ctx context.Context) bool {
+	drained := make(chan struct{})
+	go func() {
+		a.inflight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Close 释放应用持有的事务缓存、日志存储器和日志文件句柄，日志存储器关闭前会写完剩余日志，可重复调用
+func (a *Application) Close() {
+	a.closeOnce.Do(func() {
+		if a.cache != nil {
+			// 超时回调负责关闭已过期的事务，剩余条目直接丢弃，缓存的清理协程随应用一起被回收
+			a.cache.EvictExpired()
+			a.cache.RemoveAll()
+		}
+		if a.logStore != nil {
+			a.logStore.Close()
+		}
+		if a.LogOutput != nil {
+			if err := a.LogOutput.Close(); err != nil {
+				a.Logger.Error().Err(err).Msg("failed to close log output")
+			}
+		}
+		close(a.closedChan())
+	})
+}
+
+// Closed 返回应用释放资源后关闭的通道，用于等待退役应用处理完剩余事务
+func (a *Application) Closed() <-chan struct{} {
+	return a.closedChan()
+}
+
+func (a *Application) closedChan() chan struct{} {
+	a.closedInit.Do(func() {
+		a.closed = make(chan struct{})
+	})
+	return a.closed
+}
+
+// takeTransaction 从缓存中取出事务，找不到时继续在被替换的旧应用中查找，返回事务及其所属应用
+func (a *Application) takeTransaction(id string) (*transaction, *Application, bool) {
+	if cv, ok := a.cache.Get(id); ok {
+		a.cache.Remove(id)
+		return cv.(*transaction), a, true
+	}
+
+	if prev := a.predecessor.Load(); prev != nil {
+		return prev.takeTransaction(id)
+	}
+	return nil, nil, false
+}
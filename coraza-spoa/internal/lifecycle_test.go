@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// closeCounter 记录日志文件句柄被关闭的次数，用于判断应用是否已释放
+type closeCounter struct {
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestFingerprint(t *testing.T) {
+	base := AppConfig{
+		Directives:     "SecRuleEngine On",
+		ResponseCheck:  true,
+		TransactionTTL: 1000,
+		Challenge:      model.ChallengeConfig{Enabled: true, Secret: "secret", TTL: 60},
+	}
+	want := base.Fingerprint(false, "log.txt")
+
+	// 不参与构建的字段（如日志器）变化时摘要保持不变
+	same := base
+	same.LogOutput = &closeCounter{}
+	if got := same.Fingerprint(false, "log.txt"); got != want {
+		t.Fatalf("fingerprint changed without build parameter changes")
+	}
+
+	tests := []struct {
+		name   string
+		config func(*AppConfig)
+		debug  bool
+		extra  []string
+	}{
+		{name: "directives", config: func(c *AppConfig) { c.Directives = "SecRuleEngine DetectionOnly" }, extra: []string{"log.txt"}},
+		{name: "response check", config: func(c *AppConfig) { c.ResponseCheck = false }, extra: []string{"log.txt"}},
+		{name: "challenge secret", config: func(c *AppConfig) { c.Challenge.Secret = "other" }, extra: []string{"log.txt"}},
+		{name: "bot", config: func(c *AppConfig) { c.Bot.Enabled = true }, extra: []string{"log.txt"}},
+		{name: "debug", config: func(*AppConfig) {}, debug: true, extra: []string{"log.txt"}},
+		{name: "extra", config: func(*AppConfig) {}, extra: []string{"other.txt"}},
+		// 带长度前缀，拼接位置不同的参数不会得到相同摘要
+		{name: "extra boundary", config: func(*AppConfig) {}, extra: []string{"log", ".txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base
+			tt.config(&c)
+			if got := c.Fingerprint(tt.debug, tt.extra...); got == want {
+				t.Fatalf("fingerprint unchanged after %s changed", tt.name)
+			}
+		})
+	}
+}
+
+func TestDiffApplications(t *testing.T) {
+	builds := 0
+	build := func(name string) func() (*Application, error) {
+		return func() (*Application, error) {
+			builds++
+			return &Application{AppConfig: AppConfig{Directives: name, LogOutput: &closeCounter{}}}, nil
+		}
+	}
+
+	current, retired, err := DiffApplications(nil, []AppSpec{
+		{Name: "a", Key: "a1", Build: build("a")},
+		{Name: "b", Key: "b1", Build: build("b")},
+		{Name: "c", Key: "c1", Build: build("c")},
+	})
+	if err != nil {
+		t.Fatalf("initial diff: %v", err)
+	}
+	if builds != 3 || len(current) != 3 || len(retired) != 0 {
+		t.Fatalf("initial diff: builds=%d apps=%d retired=%d", builds, len(current), len(retired))
+	}
+
+	// a 不变复用，b 的 Key 变化重建，c 被删除
+	builds = 0
+	next, retired, err := DiffApplications(current, []AppSpec{
+		{Name: "a", Key: "a1", Build: build("a")},
+		{Name: "b", Key: "b2", Build: build("b")},
+	})
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if builds != 1 {
+		t.Fatalf("builds = %d, want 1", builds)
+	}
+	if next["a"] != current["a"] {
+		t.Fatalf("unchanged application was rebuilt")
+	}
+	if next["b"] == current["b"] || next["b"].key != "b2" {
+		t.Fatalf("changed application was not rebuilt")
+	}
+	if _, ok := next["c"]; ok {
+		t.Fatalf("removed application still present")
+	}
+	if len(retired) != 2 {
+		t.Fatalf("retired %d applications, want 2", len(retired))
+	}
+	for _, app := range retired {
+		if app != current["b"] && app != current["c"] {
+			t.Fatalf("unexpected retired application %q", app.Directives)
+		}
+	}
+}
+
+func TestDiffApplicationsBuildFailure(t *testing.T) {
+	var outputs []*closeCounter
+	build := func() (*Application, error) {
+		output := &closeCounter{}
+		outputs = append(outputs, output)
+		return &Application{AppConfig: AppConfig{LogOutput: output}}, nil
+	}
+	current := map[string]*Application{"a": {key: "a1"}}
+
+	next, retired, err := DiffApplications(current, []AppSpec{
+		{Name: "a", Key: "a2", Build: build},
+		{Name: "b", Key: "b1", Build: build},
+		{Name: "c", Key: "c1", Build: func() (*Application, error) { return nil, errors.New("invalid directives") }},
+	})
+	if err == nil {
+		t.Fatalf("expected build error")
+	}
+	if next != nil || retired != nil {
+		t.Fatalf("failed diff returned applications")
+	}
+	// 本次新建的应用全部释放，当前应用不受影响
+	for i, output := range outputs {
+		if output.closed != 1 {
+			t.Fatalf("built application %d closed %d times, want 1", i, output.closed)
+		}
+	}
+	if current["a"].key != "a1" {
+		t.Fatalf("current application modified")
+	}
+}
+
+func TestApplicationClosed(t *testing.T) {
+	app := &Application{AppConfig: AppConfig{LogOutput: &closeCounter{}}}
+	select {
+	case <-app.Closed():
+		t.Fatalf("closed before Close")
+	default:
+	}
+	app.Close()
+	app.Close()
+	select {
+	case <-app.Closed():
+	default:
+		t.Fatalf("not closed after Close")
+	}
+}
+
+// countingAuditStore 记录关闭次数的审计记录存储器
+type countingAuditStore struct {
+	closed int
+}
+
+func (s *countingAuditStore) Store(model.AuditTransaction, []model.AuditBody) error { return nil }
+func (s *countingAuditStore) Start(context.Context)                                 {}
+func (s *countingAuditStore) Close()                                                { s.closed++ }
+
+func TestReleaseAuditStore(t *testing.T) {
+	old, current := &countingAuditStore{}, &countingAuditStore{}
+	SetAuditStore(old)
+	// 旧存储器已被替换时只关闭旧存储器
+	SetAuditStore(current)
+	ReleaseAuditStore(old)
+	if old.closed != 1 || currentAuditStore() != current {
+		t.Fatalf("release replaced store: closed=%d current=%v", old.closed, currentAuditStore())
+	}
+
+	ReleaseAuditStore(current)
+	if current.closed != 1 || currentAuditStore() != nil {
+		t.Fatalf("release current store: closed=%d current=%v", current.closed, currentAuditStore())
+	}
+	ReleaseAuditStore(nil)
+}
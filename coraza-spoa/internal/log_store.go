@@ -2,10 +2,13 @@ package internal
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"github.com/HUAHUAI23/simple-waf/pkg/event"
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
@@ -23,10 +26,16 @@ type MongoLogStore struct {
 	mongoCollection string
 	logChan         chan model.WAFLog
 	logger          zerolog.Logger
+
+	// mu 保护 closed，避免关闭通道后仍有日志写入
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{} // 存储循环退出时关闭
 }
 
 const (
-	defaultChannelSize = 1000 // 默认通道缓冲大小
+	defaultChannelSize  = 1000             // 默认通道缓冲大小
+	defaultFlushTimeout = 10 * time.Second // 关闭时等待剩余日志写入的最长时间
 )
 
 // NewMongoLogStore 创建新的MongoDB日志存储器
@@ -37,11 +46,20 @@ func NewMongoLogStore(client *mongo.Client, database, collection string, logger
 		mongoCollection: collection,
 		logChan:         make(chan model.WAFLog, defaultChannelSize),
 		logger:          logger,
+		done:            make(chan struct{}),
 	}
 }
 
 // Store 非阻塞地发送日志到存储通道
 func (s *MongoLogStore) Store(log model.WAFLog) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.logger.Warn().Msg("log store is closed, dropping log entry")
+		return nil
+	}
+
 	select {
 	case s.logChan <- log:
 		return nil
@@ -57,13 +75,28 @@ func (s *MongoLogStore) Start(ctx context.Context) {
 	go s.processLogs(ctx)
 }
 
-// Close 关闭日志存储器
+// Close 关闭日志存储器并等待通道中剩余的日志写入完成，可重复调用
 func (s *MongoLogStore) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
 	close(s.logChan)
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+	case <-time.After(defaultFlushTimeout):
+		s.logger.Warn().Int("pending", len(s.logChan)).Msg("timed out flushing firewall logs")
+	}
 }
 
 // processLogs 处理日志存储循环
 func (s *MongoLogStore) processLogs(ctx context.Context) {
+	defer close(s.done)
+
 	collection := s.mongo.Database(s.mongoDB).Collection(s.mongoCollection)
 
 	for {
@@ -76,12 +109,19 @@ func (s *MongoLogStore) processLogs(ctx context.Context) {
 			// 使用带超时的上下文进行存储操作
 			storeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 
-			_, err := collection.InsertOne(storeCtx, log)
+			result, err := collection.InsertOne(storeCtx, log)
 			cancel()
 
 			if err != nil {
 				s.logger.Error().Err(err).Msg("failed to save firewall log to MongoDB")
+				continue
+			}
+
+			// 存储成功后发布到进程内订阅者（内嵌运行时供管理端实时推送）
+			if id, ok := result.InsertedID.(bson.ObjectID); ok {
+				log.ID = id
 			}
+			event.DefaultWAFLogBroker().Publish(log)
 
 		case <-ctx.Done():
 			return
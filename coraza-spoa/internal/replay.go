@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	coreruleset "github.com/corazawaf/coraza-coreruleset"
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/jcchavezs/mergefs"
+	"github.com/jcchavezs/mergefs/io"
+)
+
+// NewReplayApplication 创建仅用于请求回放的应用，不写入日志存储，也不缓存事务
+func (a AppConfig) NewReplayApplication() (*Application, error) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithDirectives(a.Directives).
+		WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Application{
+		waf:       waf,
+		AppConfig: a,
+	}, nil
+}
+
+// Replay 按照 HandleRequest/HandleResponse 相同的流程检测一条请求（以及可选的响应），
+// 不记录防火墙日志，返回中断信息、命中规则和异常分数
+func (a *Application) Replay(input model.ReplayInput) (*model.ReplayResult, error) {
+	req, err := parseRequestString(input.Request)
+	if err != nil {
+		return nil, err
+	}
+	req.SrcIp = parseAddr(input.SrcIP)
+	req.SrcPort = int64(input.SrcPort)
+	req.DstIp = parseAddr(input.DstIP)
+	req.DstPort = int64(input.DstPort)
+	req.ID = newTransactionID()
+
+	var res *applicationResponse
+	if input.Response != "" {
+		if res, err = parseResponseString(input.Response); err != nil {
+			return nil, err
+		}
+		res.ID = req.ID
+	}
+
+	tx := a.waf.NewTransactionWithID(req.ID)
+	defer func() {
+		if err := tx.Close(); err != nil {
+			a.Logger.Error().Str("tx", tx.ID()).Err(err).Msg("failed to close transaction")
+		}
+	}()
+
+	result := &model.ReplayResult{
+		RequestID:    tx.ID(),
+		MatchedRules: []model.ReplayMatchedRule{},
+	}
+
+	err = a.processRequest(tx, req)
+	// 与线上一致：请求被拦截后不会再进入响应阶段，未开启响应检测时也不检测响应
+	if err == nil && res != nil && a.ResponseCheck {
+		result.ResponseChecked = true
+		err = a.processResponse(tx, res)
+	}
+
+	var interrupted ErrInterrupted
+	if err != nil && !errors.As(err, &interrupted) {
+		return nil, err
+	}
+
+	if it := tx.Interruption(); it != nil {
+		result.Interrupted = true
+		result.Interruption = &model.ReplayInterruption{
+			RuleID: it.RuleID,
+			Action: it.Action,
+			Status: it.Status,
+			Data:   it.Data,
+		}
+	}
+
+	for _, mr := range tx.MatchedRules() {
+		// 跳过 CRS 初始化、计分等没有消息的内部规则
+		if mr.Message() == "" && !mr.Disruptive() {
+			continue
+		}
+		rule := mr.Rule()
+		result.MatchedRules = append(result.MatchedRules, model.ReplayMatchedRule{
+			RuleID:     rule.ID(),
+			Phase:      int(rule.Phase()),
+			Severity:   int(rule.Severity()),
+			Message:    mr.Message(),
+			Data:       mr.Data(),
+			Tags:       rule.Tags(),
+			Disruptive: mr.Disruptive(),
+		})
+	}
+
+	scores := anomalyScores(tx)
+	result.InboundAnomalyScore = scores.Inbound
+	result.OutboundAnomalyScore = scores.Outbound
+	result.InboundThreshold = scores.InboundThreshold
+	result.OutboundThreshold = scores.OutboundThreshold
+
+	return result, nil
+}
+
+// anomalyScores 从事务的 TX 变量中读取 CRS 计算的异常分数和各攻击类别的分数，
+// 需要在 ProcessLogging 之前调用
+func anomalyScores(tx types.Transaction) model.AnomalyScore {
+	state, ok := tx.(plugintypes.TransactionState)
+	if !ok {
+		return model.AnomalyScore{}
+	}
+
+	txVars := state.Variables().TX()
+	get := func(key string) int {
+		values := txVars.Get(key)
+		if len(values) == 0 {
+			return 0
+		}
+		n, _ := strconv.Atoi(values[0])
+		return n
+	}
+
+	scores := model.AnomalyScore{
+		Inbound:           get("blocking_inbound_anomaly_score"),
+		Outbound:          get("blocking_outbound_anomaly_score"),
+		InboundThreshold:  get("inbound_anomaly_score_threshold"),
+		OutboundThreshold: get("outbound_anomaly_score_threshold"),
+		ParanoiaLevel:     get("blocking_paranoia_level"),
+		SQLi:              get("sql_injection_score"),
+		XSS:               get("xss_score"),
+		RCE:               get("rce_score"),
+		LFI:               get("lfi_score"),
+		RFI:               get("rfi_score"),
+		PHP:               get("php_injection_score"),
+		SessionFixation:   get("session_fixation_score"),
+		HTTPViolation:     get("http_violation_score"),
+	}
+	// CRS 3 及自定义规则使用 inbound_anomaly_score / outbound_anomaly_score 累计分数
+	if scores.Inbound == 0 {
+		scores.Inbound = get("inbound_anomaly_score")
+	}
+	if scores.Outbound == 0 {
+		scores.Outbound = get("outbound_anomaly_score")
+	}
+	return scores
+}
+
+// parseRequestString 解析 buildRequestString 生成的请求文本：
+// 请求行、请求头，空行之后为请求体
+func parseRequestString(raw string) (*applicationRequest, error) {
+	line, headers, body := splitHTTPMessage(raw)
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid request line: %q", line)
+	}
+
+	req := &applicationRequest{
+		Method:  fields[0],
+		Version: "1.1",
+		Headers: headers,
+		Body:    body,
+	}
+
+	target := fields[1]
+	if path, query, ok := strings.Cut(target, "?"); ok {
+		req.Path = []byte(path)
+		req.Query = []byte(query)
+	} else {
+		req.Path = []byte(target)
+	}
+
+	if len(fields) > 2 {
+		version, ok := strings.CutPrefix(fields[2], "HTTP/")
+		if !ok {
+			return nil, fmt.Errorf("invalid request line: %q", line)
+		}
+		req.Version = version
+	}
+
+	if err := readHeaders(req.Headers, func(string, string) {}); err != nil {
+		return nil, fmt.Errorf("reading headers: %v", err)
+	}
+
+	return req, nil
+}
+
+// parseResponseString 解析响应文本：状态行、响应头，空行之后为响应体
+func parseResponseString(raw string) (*applicationResponse, error) {
+	line, headers, body := splitHTTPMessage(raw)
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid status line: %q", line)
+	}
+
+	version, ok := strings.CutPrefix(fields[0], "HTTP/")
+	if !ok {
+		return nil, fmt.Errorf("invalid status line: %q", line)
+	}
+
+	status, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid status code: %q", fields[1])
+	}
+
+	if err := readHeaders(headers, func(string, string) {}); err != nil {
+		return nil, fmt.Errorf("reading headers: %v", err)
+	}
+
+	return &applicationResponse{
+		Version: version,
+		Status:  int64(status),
+		Headers: headers,
+		Body:    body,
+	}, nil
+}
+
+// splitHTTPMessage 拆分首行、头部和消息体。
+// HAProxy 的 req.hdrs 以空行结尾，buildRequestString 会在其后再追加一个换行，
+// 因此消息体开头多出的一个换行会被去掉
+func splitHTTPMessage(raw string) (string, []byte, []byte) {
+	raw = strings.TrimLeft(raw, "\r\n")
+
+	first, rest, _ := strings.Cut(raw, "\n")
+	first = strings.TrimSpace(first)
+
+	var headers strings.Builder
+	for rest != "" {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			rest = strings.TrimPrefix(strings.TrimPrefix(rest, "\r"), "\n")
+			var body []byte
+			if rest != "" {
+				body = []byte(rest)
+			}
+			return first, []byte(headers.String()), body
+		}
+		headers.WriteString(line)
+		headers.WriteString("\r\n")
+	}
+
+	return first, []byte(headers.String()), nil
+}
+
+// parseAddr 解析IP地址，为空或无效时使用未指定地址
+func parseAddr(s string) netip.Addr {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr
+	}
+	return netip.IPv4Unspecified()
+}
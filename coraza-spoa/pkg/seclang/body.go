@@ -0,0 +1,178 @@
+package seclang
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+const (
+	// BodyInspectionRuleIDBase 请求体检测规则使用的自动生成规则ID起点
+	BodyInspectionRuleIDBase = 9300000
+
+	// bodyPartialVar 站点允许部分检测时设置的事务变量
+	bodyPartialVar = "body_limit_partial"
+	// bodyRejectVar 站点要求超限拒绝时设置的事务变量
+	bodyRejectVar = "body_limit_reject"
+
+	// 单个站点最多配置的跳过检测 Content-Type 数量
+	maxSkipContentTypes = 20
+)
+
+// contentTypePattern 允许的 Content-Type 前缀，如 multipart/form-data、video/
+// 前缀同时写入 HAProxy 配置，不允许 #、$ 等在配置文件中有特殊含义的字符
+var contentTypePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9!^_.+-]*(?:/[A-Za-z0-9!^_.+-]*)?$`)
+
+// ValidateBodyInspection 校验站点的请求体检测配置，nil 表示未配置
+func ValidateBodyInspection(b *model.BodyInspection) error {
+	if b == nil {
+		return nil
+	}
+	if b.MaxBytes < 0 || b.MaxBytes > model.BodyInspectionMaxBytes {
+		return fmt.Errorf("请求体检测上限必须在 0-%d 字节之间: %d", model.BodyInspectionMaxBytes, b.MaxBytes)
+	}
+	switch b.LimitAction {
+	case "", model.BodyLimitActionProcessPartial, model.BodyLimitActionReject:
+	default:
+		return fmt.Errorf("请求体超限处理方式无效: %q", b.LimitAction)
+	}
+	if len(b.SkipContentTypes) > maxSkipContentTypes {
+		return fmt.Errorf("跳过检测的 Content-Type 最多 %d 个", maxSkipContentTypes)
+	}
+	for _, ct := range b.SkipContentTypes {
+		if !contentTypePattern.MatchString(ct) {
+			return fmt.Errorf("跳过检测的 Content-Type 无效: %q", ct)
+		}
+	}
+	return nil
+}
+
+// CompiledBodyInspection 请求体检测编译结果
+type CompiledBodyInspection struct {
+	// BeforeCRS 按站点设置检测上限和跳过检测的规则，之后需要紧接 LimitDirectives 返回的超限拒绝规则
+	BeforeCRS string
+	// AfterCRS 覆盖基础指令中 SecRequestBodyLimitAction 的配置期指令，必须在基础指令之后加载
+	AfterCRS string
+
+	limitRuleID int // 超限拒绝规则ID，为 0 时没有站点配置
+}
+
+// LimitDirectives 按基础指令中的 SecRequestBodyLimitAction 生成超限拒绝规则。
+// AfterCRS 统一改为 ProcessPartial 后，未配置的站点需要保持基础指令的行为：基础指令为 Reject 时
+// 除允许部分检测的站点外一律拒绝；否则只拒绝要求超限拒绝的站点
+func (c CompiledBodyInspection) LimitDirectives(base string) string {
+	if c.limitRuleID == 0 {
+		return ""
+	}
+
+	// 超出上限时 Coraza 设置 INBOUND_DATA_ERROR
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SecRule INBOUND_DATA_ERROR \"@eq 1\" \"id:%d,phase:2,deny,status:413,log,t:none,msg:'Request body exceeds the inspection limit',tag:'body-inspection',chain\"\n", c.limitRuleID)
+	if strings.EqualFold(RequestBodyLimitAction(base), "Reject") {
+		fmt.Fprintf(&sb, "    SecRule &TX:%s \"@eq 0\" \"t:none\"\n", bodyPartialVar)
+	} else {
+		fmt.Fprintf(&sb, "    SecRule TX:%s \"@eq 1\" \"t:none\"\n", bodyRejectVar)
+	}
+	return sb.String()
+}
+
+// RequestBodyLimitAction 返回指令中最后一条 SecRequestBodyLimitAction 的值，未配置时为 Coraza 的默认值 Reject。
+// 只读取内联指令，不展开 Include 的文件
+func RequestBodyLimitAction(directives string) string {
+	action := "Reject"
+	lines, _ := splitDirectives(directives)
+	for _, l := range lines {
+		fields := strings.Fields(l.text)
+		if len(fields) >= 2 && strings.EqualFold(fields[0], "SecRequestBodyLimitAction") {
+			action = strings.Trim(fields[1], `"'`)
+		}
+	}
+	return action
+}
+
+// CompileBodyInspection 将站点的请求体检测配置编译为按 Host 和端口生效的 SecLang，没有站点配置时返回空结果
+// 配置存在时统一使用 ProcessPartial，由站点守卫规则设置检测上限，超出上限的请求由 LimitDirectives 的规则在 phase 2 返回 413
+func CompileBodyInspection(sites []model.SiteBodyInspection) (CompiledBodyInspection, error) {
+	configured := make([]model.SiteBodyInspection, 0, len(sites))
+	for _, site := range sites {
+		if site.BodyInspection == nil {
+			continue
+		}
+		if err := ValidateBodyInspection(site.BodyInspection); err != nil {
+			return CompiledBodyInspection{}, fmt.Errorf("站点 %s: %w", site.Domain, err)
+		}
+		if site.Domain == "" || strings.ContainsAny(site.Domain, " \t\r\n\"'") {
+			return CompiledBodyInspection{}, fmt.Errorf("站点域名无效: %q", site.Domain)
+		}
+		configured = append(configured, site)
+	}
+	if len(configured) == 0 {
+		return CompiledBodyInspection{}, nil
+	}
+	sort.SliceStable(configured, func(i, j int) bool {
+		if configured[i].Domain != configured[j].Domain {
+			return configured[i].Domain < configured[j].Domain
+		}
+		return configured[i].ListenPort < configured[j].ListenPort
+	})
+
+	var sb strings.Builder
+	nextID := BodyInspectionRuleIDBase
+
+	for index, site := range configured {
+		b := site.BodyInspection
+		marker := fmt.Sprintf("END_BODY_INSPECTION_%d", index)
+
+		fmt.Fprintf(&sb, "# body inspection: %s:%d\n", site.Domain, site.ListenPort)
+		// 缺少 Host、Host 或端口不匹配时跳过该站点的设置
+		fmt.Fprintf(&sb, "SecRule &REQUEST_HEADERS:Host \"@eq 0\" \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", nextID, marker)
+		nextID++
+		fmt.Fprintf(&sb, "SecRule REQUEST_HEADERS:Host %s \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", quote("!@rx "+hostRegex([]string{site.Domain})), nextID, marker)
+		nextID++
+		if site.ListenPort > 0 {
+			fmt.Fprintf(&sb, "SecRule SERVER_PORT \"!@eq %d\" \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", site.ListenPort, nextID, marker)
+			nextID++
+		}
+
+		if !b.Enabled {
+			fmt.Fprintf(&sb, "SecAction \"id:%d,phase:1,pass,nolog,ctl:requestBodyAccess=Off\"\n", nextID)
+			nextID++
+			fmt.Fprintf(&sb, "SecMarker %s\n", marker)
+			continue
+		}
+
+		var actions []string
+		if b.MaxBytes > 0 {
+			actions = append(actions, fmt.Sprintf("ctl:requestBodyLimit=%d", b.MaxBytes))
+		}
+		if b.LimitAction != model.BodyLimitActionReject {
+			actions = append(actions, "setvar:tx."+bodyPartialVar+"=1")
+		} else {
+			actions = append(actions, "setvar:tx."+bodyRejectVar+"=1")
+		}
+		if len(actions) > 0 {
+			fmt.Fprintf(&sb, "SecAction \"id:%d,phase:1,pass,nolog,%s\"\n", nextID, strings.Join(actions, ","))
+			nextID++
+		}
+
+		if len(b.SkipContentTypes) > 0 {
+			quoted := make([]string, 0, len(b.SkipContentTypes))
+			for _, ct := range b.SkipContentTypes {
+				quoted = append(quoted, regexp.QuoteMeta(ct))
+			}
+			pattern := fmt.Sprintf("(?i)^(?:%s)", strings.Join(quoted, "|"))
+			fmt.Fprintf(&sb, "SecRule REQUEST_HEADERS:Content-Type %s \"id:%d,phase:1,pass,nolog,t:none,ctl:requestBodyAccess=Off\"\n", quote("@rx "+pattern), nextID)
+			nextID++
+		}
+		fmt.Fprintf(&sb, "SecMarker %s\n", marker)
+	}
+
+	return CompiledBodyInspection{
+		BeforeCRS:   sb.String(),
+		AfterCRS:    "# body inspection\nSecRequestBodyLimitAction ProcessPartial\n",
+		limitRuleID: nextID,
+	}, nil
+}
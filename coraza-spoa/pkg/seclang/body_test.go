@@ -0,0 +1,62 @@
+package seclang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+func TestRequestBodyLimitAction(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives string
+		want       string
+	}{
+		{name: "default", directives: "SecRuleEngine On", want: "Reject"},
+		{name: "partial", directives: "SecRequestBodyLimitAction ProcessPartial", want: "ProcessPartial"},
+		{name: "last wins", directives: "SecRequestBodyLimitAction ProcessPartial\nsecrequestbodylimitaction Reject", want: "Reject"},
+		{name: "comment", directives: "# SecRequestBodyLimitAction ProcessPartial", want: "Reject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestBodyLimitAction(tt.directives); got != tt.want {
+				t.Fatalf("RequestBodyLimitAction() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitDirectives(t *testing.T) {
+	empty, err := CompileBodyInspection(nil)
+	if err != nil {
+		t.Fatalf("CompileBodyInspection() error: %v", err)
+	}
+	if got := empty.LimitDirectives(""); got != "" {
+		t.Fatalf("LimitDirectives() without sites = %q, want empty", got)
+	}
+
+	compiled, err := CompileBodyInspection([]model.SiteBodyInspection{
+		{Domain: "a.example.com", ListenPort: 80, BodyInspection: &model.BodyInspection{Enabled: true, MaxBytes: 1024, LimitAction: model.BodyLimitActionReject}},
+		{Domain: "b.example.com", ListenPort: 80, BodyInspection: &model.BodyInspection{Enabled: true, MaxBytes: 1024, LimitAction: model.BodyLimitActionProcessPartial}},
+	})
+	if err != nil {
+		t.Fatalf("CompileBodyInspection() error: %v", err)
+	}
+	if !strings.Contains(compiled.BeforeCRS, "setvar:tx."+bodyRejectVar+"=1") || !strings.Contains(compiled.BeforeCRS, "setvar:tx."+bodyPartialVar+"=1") {
+		t.Fatalf("site rules missing limit action variables:\n%s", compiled.BeforeCRS)
+	}
+
+	// 基础指令为 Reject 时未允许部分检测的请求都拒绝，否则只拒绝要求超限拒绝的站点
+	if got := compiled.LimitDirectives("SecRequestBodyLimitAction Reject"); !strings.Contains(got, "&TX:"+bodyPartialVar+" \"@eq 0\"") {
+		t.Fatalf("LimitDirectives(Reject) = %q", got)
+	}
+	if got := compiled.LimitDirectives("SecRequestBodyLimitAction ProcessPartial"); !strings.Contains(got, "TX:"+bodyRejectVar+" \"@eq 1\"") {
+		t.Fatalf("LimitDirectives(ProcessPartial) = %q", got)
+	}
+	for _, base := range []string{"SecRequestBodyLimitAction Reject", "SecRequestBodyLimitAction ProcessPartial"} {
+		if result := Validate(compiled.BeforeCRS + compiled.LimitDirectives(base) + compiled.AfterCRS); !result.Valid {
+			t.Fatalf("compiled directives invalid for %q: %v", base, result.Errors)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package seclang
+
+import (
+	coreruleset "github.com/corazawaf/coraza-coreruleset"
+	"github.com/corazawaf/coraza/v3"
+	"github.com/jcchavezs/mergefs"
+	"github.com/jcchavezs/mergefs/io"
+)
+
+// Compile 使用与引擎相同的文件系统编译指令，只用于校验，不保留 WAF 实例
+func Compile(directives string) error {
+	_, err := coraza.NewWAF(
+		coraza.NewWAFConfig().
+			WithDirectives(directives).
+			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS)),
+	)
+	return err
+}
@@ -0,0 +1,192 @@
+// Package seclang 负责将结构化的规则配置编译为 SecLang 指令
+package seclang
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+const (
+	// ExclusionRuleIDBase 作用域排除规则使用的自动生成规则ID起点
+	ExclusionRuleIDBase = 9100000
+
+	// crsRulesInclude CRS 规则集的引入语句，运行时排除规则需要放在它之前
+	crsRulesInclude = "Include @owasp_crs/"
+)
+
+// CompiledExclusions 规则排除编译结果
+type CompiledExclusions struct {
+	// BeforeCRS 运行时排除规则（ctl），必须在 CRS 规则之前加载
+	BeforeCRS string
+	// AfterCRS 配置期排除指令（SecRuleRemoveById/SecRuleUpdateTargetById），必须在 CRS 规则之后加载
+	AfterCRS string
+}
+
+// CompileExclusions 将规则排除编译为 SecLang 指令，已撤销的排除会被忽略
+// 输出顺序按创建时间和ID排序，保证相同输入得到相同结果
+func CompileExclusions(exclusions []model.RuleExclusion) (CompiledExclusions, error) {
+	active := make([]model.RuleExclusion, 0, len(exclusions))
+	for _, e := range exclusions {
+		if !e.Revoked {
+			active = append(active, e)
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		if !active[i].CreatedAt.Equal(active[j].CreatedAt) {
+			return active[i].CreatedAt.Before(active[j].CreatedAt)
+		}
+		return active[i].ID.Hex() < active[j].ID.Hex()
+	})
+
+	var before, after strings.Builder
+	nextID := ExclusionRuleIDBase
+
+	for _, e := range active {
+		if err := ValidateExclusion(e); err != nil {
+			return CompiledExclusions{}, err
+		}
+
+		comment := fmt.Sprintf("# exclusion %s", e.ID.Hex())
+		if e.Reason != "" {
+			comment += ": " + strings.ReplaceAll(e.Reason, "\n", " ")
+		}
+
+		if e.Scope.IsGlobal() {
+			after.WriteString(comment + "\n")
+			switch e.Type {
+			case model.ExclusionRemoveRule:
+				fmt.Fprintf(&after, "SecRuleRemoveById %d\n", e.RuleID)
+			case model.ExclusionRemoveTarget:
+				fmt.Fprintf(&after, "SecRuleUpdateTargetById %d !%s\n", e.RuleID, e.Target)
+			}
+			continue
+		}
+
+		var ctl string
+		switch e.Type {
+		case model.ExclusionRemoveRule:
+			ctl = fmt.Sprintf("ctl:ruleRemoveById=%d", e.RuleID)
+		case model.ExclusionRemoveTarget:
+			ctl = fmt.Sprintf("ctl:ruleRemoveTargetById=%d;%s", e.RuleID, e.Target)
+		}
+
+		before.WriteString(comment + "\n")
+		before.WriteString(scopedRule(nextID, e.Scope, ctl))
+		nextID++
+	}
+
+	return CompiledExclusions{
+		BeforeCRS: before.String(),
+		AfterCRS:  after.String(),
+	}, nil
+}
+
+// scopedRule 生成按域名和路径匹配后执行 ctl 动作的运行时规则
+func scopedRule(id int, scope model.ExclusionScope, ctl string) string {
+	type condition struct {
+		variable string
+		operator string
+	}
+
+	var conditions []condition
+	if scope.Domain != "" {
+		conditions = append(conditions, condition{
+			variable: "REQUEST_HEADERS:Host",
+			operator: fmt.Sprintf("@rx ^%s(?::\\d+)?$", regexp.QuoteMeta(scope.Domain)),
+		})
+	}
+	if scope.Path != "" {
+		conditions = append(conditions, condition{
+			variable: "REQUEST_FILENAME",
+			operator: "@beginsWith " + scope.Path,
+		})
+	}
+
+	var sb strings.Builder
+	for i, c := range conditions {
+		var actions string
+		switch {
+		case i == 0 && len(conditions) == 1:
+			actions = fmt.Sprintf("id:%d,phase:1,pass,nolog,t:none,%s", id, ctl)
+		case i == 0:
+			actions = fmt.Sprintf("id:%d,phase:1,pass,nolog,t:none,chain", id)
+		case i == len(conditions)-1:
+			actions = "t:none," + ctl
+		default:
+			actions = "t:none,chain"
+		}
+		if i > 0 {
+			sb.WriteString("    ")
+		}
+		fmt.Fprintf(&sb, "SecRule %s %s %s\n", c.variable, quote(c.operator), quote(actions))
+	}
+	return sb.String()
+}
+
+// ValidateExclusion 校验规则排除是否可以安全编译
+func ValidateExclusion(e model.RuleExclusion) error {
+	if e.RuleID <= 0 {
+		return fmt.Errorf("排除 %s 的规则ID无效: %d", e.ID.Hex(), e.RuleID)
+	}
+	switch e.Type {
+	case model.ExclusionRemoveRule:
+	case model.ExclusionRemoveTarget:
+		if !targetPattern.MatchString(e.Target) {
+			return fmt.Errorf("排除 %s 的检测目标无效: %q", e.ID.Hex(), e.Target)
+		}
+	default:
+		return fmt.Errorf("排除 %s 的类型无效: %q", e.ID.Hex(), e.Type)
+	}
+	if strings.ContainsAny(e.Scope.Domain, " \t\r\n\"'") {
+		return fmt.Errorf("排除 %s 的域名无效: %q", e.ID.Hex(), e.Scope.Domain)
+	}
+	if e.Scope.Path != "" && (!strings.HasPrefix(e.Scope.Path, "/") || strings.ContainsAny(e.Scope.Path, " \t\r\n\"'")) {
+		return fmt.Errorf("排除 %s 的路径无效: %q", e.ID.Hex(), e.Scope.Path)
+	}
+	return nil
+}
+
+// targetPattern 允许的检测目标，如 ARGS、ARGS:foo、REQUEST_COOKIES:/^sess_/
+var targetPattern = regexp.MustCompile(`^[A-Z_]+(?::[^\s"',;]+)?$`)
+
+// InjectDirectives 将额外的指令插入基础指令：before 放在 CRS 规则引入之前，after 追加到末尾
+// 基础指令中没有 CRS 引入时，before 放在最前面
+func InjectDirectives(base, before, after string) string {
+	var sb strings.Builder
+
+	if before != "" {
+		if idx := strings.Index(base, crsRulesInclude); idx >= 0 {
+			// 找到所在行的行首
+			lineStart := strings.LastIndex(base[:idx], "\n") + 1
+			sb.WriteString(base[:lineStart])
+			sb.WriteString(before)
+			sb.WriteString("\n")
+			sb.WriteString(base[lineStart:])
+		} else {
+			sb.WriteString(before)
+			sb.WriteString("\n")
+			sb.WriteString(base)
+		}
+	} else {
+		sb.WriteString(base)
+	}
+
+	if after != "" {
+		if !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+		sb.WriteString(after)
+	}
+
+	return sb.String()
+}
+
+// quote 用双引号包裹 SecLang 参数并转义内部的双引号
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
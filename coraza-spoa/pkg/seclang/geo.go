@@ -0,0 +1,98 @@
+package seclang
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// GeoPolicyRuleIDBase 国家访问策略规则使用的自动生成规则ID起点
+const GeoPolicyRuleIDBase = 9500000
+
+// countryCodePattern ISO 3166-1 两位国家代码
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ValidateGeoPolicy 校验站点的国家访问策略，nil 表示未配置
+func ValidateGeoPolicy(p *model.GeoPolicy) error {
+	if p == nil {
+		return nil
+	}
+	switch p.Mode {
+	case model.GeoPolicyAllow, model.GeoPolicyDeny:
+	default:
+		return fmt.Errorf("国家访问策略无效: %q", p.Mode)
+	}
+	if len(p.Countries) == 0 {
+		return fmt.Errorf("国家访问策略至少需要一个国家")
+	}
+	if len(p.Countries) > model.GeoPolicyMaxCountries {
+		return fmt.Errorf("国家访问策略最多 %d 个国家", model.GeoPolicyMaxCountries)
+	}
+	for _, country := range p.Countries {
+		if !countryCodePattern.MatchString(country) {
+			return fmt.Errorf("国家代码无效: %q", country)
+		}
+	}
+	return nil
+}
+
+// CompileGeoPolicies 将站点的国家访问策略编译为按 Host 和端口生效的 SecLang，需要在 CRS 之前加载。
+// 规则读取引擎写入的 GEO:COUNTRY_CODE，来源IP的国家未知时变量不存在，规则不匹配，请求不会被拦截
+func CompileGeoPolicies(sites []model.SiteGeoPolicy) (string, error) {
+	configured := make([]model.SiteGeoPolicy, 0, len(sites))
+	for _, site := range sites {
+		if site.GeoPolicy == nil {
+			continue
+		}
+		if err := ValidateGeoPolicy(site.GeoPolicy); err != nil {
+			return "", fmt.Errorf("站点 %s: %w", site.Domain, err)
+		}
+		if site.Domain == "" || strings.ContainsAny(site.Domain, " \t\r\n\"'") {
+			return "", fmt.Errorf("站点域名无效: %q", site.Domain)
+		}
+		configured = append(configured, site)
+	}
+	if len(configured) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(configured, func(i, j int) bool {
+		if configured[i].Domain != configured[j].Domain {
+			return configured[i].Domain < configured[j].Domain
+		}
+		return configured[i].ListenPort < configured[j].ListenPort
+	})
+
+	var sb strings.Builder
+	nextID := GeoPolicyRuleIDBase
+
+	for index, site := range configured {
+		p := site.GeoPolicy
+		marker := fmt.Sprintf("END_GEO_POLICY_%d", index)
+
+		fmt.Fprintf(&sb, "# geo policy: %s:%d\n", site.Domain, site.ListenPort)
+		// 缺少 Host、Host 或端口不匹配时跳过该站点的策略
+		fmt.Fprintf(&sb, "SecRule &REQUEST_HEADERS:Host \"@eq 0\" \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", nextID, marker)
+		nextID++
+		fmt.Fprintf(&sb, "SecRule REQUEST_HEADERS:Host %s \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", quote("!@rx "+hostRegex([]string{site.Domain})), nextID, marker)
+		nextID++
+		if site.ListenPort > 0 {
+			fmt.Fprintf(&sb, "SecRule SERVER_PORT \"!@eq %d\" \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", site.ListenPort, nextID, marker)
+			nextID++
+		}
+
+		operator := "@rx"
+		if p.Mode == model.GeoPolicyAllow {
+			operator = "!@rx"
+		}
+		pattern := fmt.Sprintf("%s ^(?:%s)$", operator, strings.Join(p.Countries, "|"))
+		fmt.Fprintf(&sb, "SecRule GEO:%s %s \"id:%d,phase:1,deny,status:403,log,t:none,msg:'Access from country is not allowed',logdata:'%%{MATCHED_VAR}',tag:'geo-policy'\"\n",
+			strings.ToUpper(model.GeoCountryCode), quote(pattern), nextID)
+		nextID++
+		fmt.Fprintf(&sb, "SecMarker %s\n", marker)
+	}
+
+	return sb.String(), nil
+}
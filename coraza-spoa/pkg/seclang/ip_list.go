@@ -0,0 +1,201 @@
+package seclang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+const (
+	// IPListRuleIDBase IP 信誉列表规则使用的自动生成规则ID起点
+	IPListRuleIDBase = 9600000
+
+	// ipListMatchVar 请求命中引用列表的站点时设置的事务变量前缀，后接列表序号，表示需要查询该列表
+	ipListMatchVar = "ip_list_match_"
+
+	// 单个站点最多引用的列表数量
+	maxSiteIPLists = 20
+)
+
+// ipListNamePattern 列表名称同时用于数据文件名和规则标签
+var ipListNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidateIPListName 校验 IP 信誉列表名称
+func ValidateIPListName(name string) error {
+	if !ipListNamePattern.MatchString(name) {
+		return fmt.Errorf("IP 信誉列表名称无效: %q，只允许小写字母、数字、- 和 _，最长 64 个字符", name)
+	}
+	return nil
+}
+
+// ValidateSiteIPLists 校验站点引用的 IP 信誉列表
+func ValidateSiteIPLists(names []string) error {
+	if len(names) > maxSiteIPLists {
+		return fmt.Errorf("站点最多引用 %d 个 IP 信誉列表", maxSiteIPLists)
+	}
+	for _, name := range names {
+		if err := ValidateIPListName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteIPListFiles 将列表条目写入 dir 下的数据文件，供 IPListOperator 读取，返回列表名称到文件路径的映射。
+// 文件名包含列表摘要：操作符只在编译规则时读取文件，列表变化时规则随之变化，应用才会重新构建。
+// 没有条目的列表不写入，先写临时文件再重命名，避免正在编译的规则读到不完整的文件，写入后删除同一列表的旧文件
+func WriteIPListFiles(dir string, lists []model.IPList) (map[string]string, error) {
+	paths := make(map[string]string, len(lists))
+	if len(lists) == 0 {
+		return paths, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建 IP 信誉列表目录失败: %w", err)
+	}
+
+	for _, list := range lists {
+		if err := ValidateIPListName(list.Name); err != nil {
+			return nil, err
+		}
+		if len(list.Entries) == 0 {
+			continue
+		}
+
+		content := fmt.Sprintf("# %s %s\n%s\n", list.Name, list.Digest, strings.Join(list.Entries, "\n"))
+		path := filepath.Join(dir, ipListFileName(list.Name, content))
+		tmpPath := path + ".tmp"
+		if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+			os.Remove(tmpPath)
+			return nil, fmt.Errorf("写入 IP 信誉列表 %s 失败: %w", list.Name, err)
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(tmpPath)
+			return nil, fmt.Errorf("写入 IP 信誉列表 %s 失败: %w", list.Name, err)
+		}
+		paths[list.Name] = path
+		removeStaleIPListFiles(dir, list.Name, path)
+	}
+	return paths, nil
+}
+
+// ipListFileName 数据文件名，包含文件内容摘要的前 16 位，足以区分同一列表的不同版本
+func ipListFileName(name, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return fmt.Sprintf("%s.%s.data", name, hex.EncodeToString(sum[:8]))
+}
+
+// removeStaleIPListFiles 删除同一列表的旧版本数据文件，已编译的规则不再读取这些文件
+func removeStaleIPListFiles(dir, name, keep string) {
+	matches, err := filepath.Glob(filepath.Join(dir, name+".*.data"))
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		if match != keep {
+			os.Remove(match)
+		}
+	}
+}
+
+// CompileIPListPolicies 将站点引用的 IP 信誉列表编译为 SecLang，需要在 CRS 之前加载。
+// 站点规则按 Host 和端口匹配后只标记需要查询的列表，之后每个被标记的列表查询一次，命中时拒绝请求：
+// 多个站点引用同一列表时列表只加载一次，未引用列表的站点的请求不做查询。files 中不存在的列表（未同步或没有条目）不生效
+func CompileIPListPolicies(sites []model.SiteIPListPolicy, files map[string]string) (string, error) {
+	configured := make([]model.SiteIPListPolicy, 0, len(sites))
+	referenced := make(map[string]bool)
+	for _, site := range sites {
+		if len(site.IPLists) == 0 {
+			continue
+		}
+		if err := ValidateSiteIPLists(site.IPLists); err != nil {
+			return "", fmt.Errorf("站点 %s: %w", site.Domain, err)
+		}
+		if site.Domain == "" || strings.ContainsAny(site.Domain, " \t\r\n\"'") {
+			return "", fmt.Errorf("站点域名无效: %q", site.Domain)
+		}
+		configured = append(configured, site)
+		for _, name := range site.IPLists {
+			referenced[name] = true
+		}
+	}
+	if len(configured) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(configured, func(i, j int) bool {
+		if configured[i].Domain != configured[j].Domain {
+			return configured[i].Domain < configured[j].Domain
+		}
+		return configured[i].ListenPort < configured[j].ListenPort
+	})
+
+	names := make([]string, 0, len(referenced))
+	for name := range referenced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	nextID := IPListRuleIDBase
+
+	// 列表序号作为事务变量名，避免列表名称中的字符影响变量解析
+	index := make(map[string]int, len(names))
+	for _, name := range names {
+		path, ok := files[name]
+		if !ok {
+			fmt.Fprintf(&sb, "# ip list %s: 列表不存在或没有条目，引用该列表的站点规则不生效\n", name)
+			continue
+		}
+		if strings.ContainsAny(path, " \t\r\n\"'") {
+			return "", fmt.Errorf("IP 信誉列表文件路径无效: %q", path)
+		}
+		index[name] = len(index)
+	}
+
+	for siteIndex, site := range configured {
+		marker := fmt.Sprintf("END_IP_LIST_%d", siteIndex)
+
+		fmt.Fprintf(&sb, "# ip list: %s:%d\n", site.Domain, site.ListenPort)
+		// 缺少 Host、Host 或端口不匹配时跳过该站点的规则
+		fmt.Fprintf(&sb, "SecRule &REQUEST_HEADERS:Host \"@eq 0\" \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", nextID, marker)
+		nextID++
+		fmt.Fprintf(&sb, "SecRule REQUEST_HEADERS:Host %s \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", quote("!@rx "+hostRegex([]string{site.Domain})), nextID, marker)
+		nextID++
+		if site.ListenPort > 0 {
+			fmt.Fprintf(&sb, "SecRule SERVER_PORT \"!@eq %d\" \"id:%d,phase:1,pass,nolog,t:none,skipAfter:%s\"\n", site.ListenPort, nextID, marker)
+			nextID++
+		}
+
+		var actions []string
+		for _, name := range site.IPLists {
+			if i, ok := index[name]; ok {
+				actions = append(actions, fmt.Sprintf("setvar:'tx.%s%d=1'", ipListMatchVar, i))
+			}
+		}
+		if len(actions) > 0 {
+			fmt.Fprintf(&sb, "SecAction \"id:%d,phase:1,pass,nolog,t:none,%s\"\n", nextID, strings.Join(actions, ","))
+			nextID++
+		}
+		fmt.Fprintf(&sb, "SecMarker %s\n", marker)
+	}
+
+	// 查询规则，只有请求命中引用该列表的站点时才执行查询
+	for _, name := range names {
+		i, ok := index[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&sb, "SecRule TX:%s%d \"@eq 1\" \"id:%d,phase:1,deny,status:403,log,t:none,msg:'Source IP is listed in IP reputation list %s',logdata:'%%{REMOTE_ADDR}',tag:'ip-reputation',tag:'ip-list/%s',chain\"\n",
+			ipListMatchVar, i, nextID, name, name)
+		fmt.Fprintf(&sb, "    SecRule REMOTE_ADDR \"@%s %s\" \"t:none\"\n", IPListOperator, files[name])
+		nextID++
+	}
+
+	return sb.String(), nil
+}
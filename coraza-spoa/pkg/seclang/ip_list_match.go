@@ -0,0 +1,115 @@
+package seclang
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+)
+
+// IPListOperator IP 信誉列表查询操作符，参数为 WriteIPListFiles 写入的数据文件路径。
+// 内置的 @ipMatchFromFile 逐个网段线性比较，列表可达 IPListMaxEntries 条，这里加载时排序后二分查找
+const IPListOperator = "ipMatchListFromFile"
+
+func init() {
+	plugins.RegisterOperator(IPListOperator, newIPListMatch)
+}
+
+// ipListMatch 按起始地址排序且互不重叠的网段，命中判断为 O(log n)
+type ipListMatch struct {
+	prefixes []netip.Prefix
+}
+
+var _ plugintypes.Operator = (*ipListMatch)(nil)
+
+// newIPListMatch 读取数据文件，每行一个 IP 或 CIDR，忽略空行和 # 注释
+func newIPListMatch(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
+	path := strings.TrimSpace(options.Arguments)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 IP 信誉列表文件失败: %w", err)
+	}
+
+	var prefixes []netip.Prefix
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		prefix, err := parseListEntry(l)
+		if err != nil {
+			return nil, fmt.Errorf("IP 信誉列表文件 %s 第 %d 行: %w", path, line, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("读取 IP 信誉列表文件失败: %w", err)
+	}
+
+	return &ipListMatch{prefixes: normalizePrefixes(prefixes)}, nil
+}
+
+// parseListEntry 解析单个 IP 或 CIDR，IPv4 映射的 IPv6 地址按 IPv4 处理
+func parseListEntry(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if prefix.Addr().Is4In6() {
+		bits := prefix.Bits() - 96
+		if bits < 0 {
+			return netip.Prefix{}, fmt.Errorf("网段无效: %s", s)
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), bits)
+	}
+	return prefix.Masked(), nil
+}
+
+// normalizePrefixes 按起始地址排序并去掉被其他网段包含的网段。
+// 网段按前缀对齐，排序后要么包含于前一个网段，要么位于其之后，不会部分重叠
+func normalizePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+
+	result := prefixes[:0]
+	for _, prefix := range prefixes {
+		if n := len(result); n > 0 && result[n-1].Contains(prefix.Addr()) {
+			continue
+		}
+		result = append(result, prefix)
+	}
+	return result
+}
+
+// Evaluate 查找起始地址不大于 value 的最后一个网段，判断是否包含 value
+func (m *ipListMatch) Evaluate(_ plugintypes.TransactionState, value string) bool {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+
+	i := sort.Search(len(m.prefixes), func(i int) bool {
+		return m.prefixes[i].Addr().Compare(addr) > 0
+	})
+	return i > 0 && m.prefixes[i-1].Contains(addr)
+}
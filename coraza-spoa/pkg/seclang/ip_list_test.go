@@ -0,0 +1,167 @@
+package seclang
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+)
+
+func TestWriteIPListFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	paths, err := WriteIPListFiles(dir, []model.IPList{
+		{Name: "blocklist", Entries: []string{"192.0.2.0/24", "198.51.100.1/32"}, Digest: "v1"},
+		{Name: "empty"},
+	})
+	if err != nil {
+		t.Fatalf("WriteIPListFiles() error: %v", err)
+	}
+	first, ok := paths["blocklist"]
+	if !ok {
+		t.Fatalf("blocklist not written: %v", paths)
+	}
+	if _, ok := paths["empty"]; ok {
+		t.Fatalf("list without entries should not be written")
+	}
+	content, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatalf("read list file: %v", err)
+	}
+	if !strings.Contains(string(content), "192.0.2.0/24\n198.51.100.1/32\n") {
+		t.Fatalf("unexpected list file content:\n%s", content)
+	}
+
+	// 内容不变时文件名不变
+	again, err := WriteIPListFiles(dir, []model.IPList{
+		{Name: "blocklist", Entries: []string{"192.0.2.0/24", "198.51.100.1/32"}, Digest: "v1"},
+	})
+	if err != nil {
+		t.Fatalf("WriteIPListFiles() error: %v", err)
+	}
+	if again["blocklist"] != first {
+		t.Fatalf("unchanged list written to %s, want %s", again["blocklist"], first)
+	}
+
+	// 内容变化时换成新文件名，旧文件被删除
+	changed, err := WriteIPListFiles(dir, []model.IPList{
+		{Name: "blocklist", Entries: []string{"203.0.113.0/24"}, Digest: "v2"},
+	})
+	if err != nil {
+		t.Fatalf("WriteIPListFiles() error: %v", err)
+	}
+	if changed["blocklist"] == first {
+		t.Fatalf("changed list reused file name %s", first)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "blocklist.*"))
+	if len(matches) != 1 || matches[0] != changed["blocklist"] {
+		t.Fatalf("list files = %v, want only %s", matches, changed["blocklist"])
+	}
+}
+
+func TestWriteIPListFilesInvalidName(t *testing.T) {
+	if _, err := WriteIPListFiles(t.TempDir(), []model.IPList{{Name: "../etc", Entries: []string{"192.0.2.1"}}}); err == nil {
+		t.Fatalf("WriteIPListFiles() expected error for invalid name")
+	}
+}
+
+func TestIPListMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.data")
+	content := "# comment\n10.0.0.0/8\n10.1.0.0/16\n192.0.2.1\n::ffff:198.51.100.0/120\n2001:db8::/32\n\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write list file: %v", err)
+	}
+	op, err := newIPListMatch(plugintypes.OperatorOptions{Arguments: path})
+	if err != nil {
+		t.Fatalf("newIPListMatch() error: %v", err)
+	}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "10.2.3.4", want: true}, // 被包含的网段去掉后仍命中外层网段
+		{addr: "10.1.0.1", want: true},
+		{addr: "11.0.0.0"},
+		{addr: "192.0.2.1", want: true},
+		{addr: "192.0.2.2"},
+		{addr: "198.51.100.7", want: true},
+		{addr: "::ffff:192.0.2.1", want: true},
+		{addr: "2001:db8::1", want: true},
+		{addr: "2001:db9::1"},
+		{addr: "0.0.0.0"},
+		{addr: "not-an-ip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := op.Evaluate(nil, tt.addr); got != tt.want {
+				t.Fatalf("Evaluate(%q) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+
+	if err := os.WriteFile(path, []byte("10.0.0.0/33\n"), 0644); err != nil {
+		t.Fatalf("write list file: %v", err)
+	}
+	if _, err := newIPListMatch(plugintypes.OperatorOptions{Arguments: path}); err == nil {
+		t.Fatalf("newIPListMatch() expected error for invalid entry")
+	}
+}
+
+func TestCompileIPListPolicies(t *testing.T) {
+	dir := t.TempDir()
+	files, err := WriteIPListFiles(dir, []model.IPList{
+		{Name: "blocklist", Entries: []string{"192.0.2.0/24"}, Digest: "v1"},
+	})
+	if err != nil {
+		t.Fatalf("WriteIPListFiles() error: %v", err)
+	}
+	directives, err := CompileIPListPolicies([]model.SiteIPListPolicy{
+		{Domain: "a.example.com", ListenPort: 80, IPLists: []string{"blocklist", "missing"}},
+		{Domain: "b.example.com", ListenPort: 80, IPLists: []string{"blocklist"}},
+		{Domain: "c.example.com", ListenPort: 80},
+	}, files)
+	if err != nil {
+		t.Fatalf("CompileIPListPolicies() error: %v", err)
+	}
+	// 多个站点引用同一列表时只生成一条查询规则
+	if n := strings.Count(directives, "@"+IPListOperator); n != 1 {
+		t.Fatalf("lookup rules = %d, want 1:\n%s", n, directives)
+	}
+	if !strings.Contains(directives, "# ip list missing") {
+		t.Fatalf("missing list not reported:\n%s", directives)
+	}
+
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(directives))
+	if err != nil {
+		t.Fatalf("compile directives: %v\n%s", err, directives)
+	}
+	tests := []struct {
+		name string
+		host string
+		ip   string
+		want bool
+	}{
+		{name: "listed", host: "a.example.com", ip: "192.0.2.10", want: true},
+		{name: "second site", host: "b.example.com", ip: "192.0.2.10", want: true},
+		{name: "not listed", host: "a.example.com", ip: "198.51.100.1"},
+		{name: "site without lists", host: "c.example.com", ip: "192.0.2.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			defer tx.Close()
+			tx.ProcessConnection(tt.ip, 12345, "127.0.0.1", 80)
+			tx.ProcessURI("/", "GET", "HTTP/1.1")
+			tx.AddRequestHeader("Host", tt.host)
+			interrupted := tx.ProcessRequestHeaders() != nil
+			if interrupted != tt.want {
+				t.Fatalf("interrupted = %v, want %v", interrupted, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package seclang
+
+import "fmt"
+
+const (
+	// ProtocolRuleIDBase 协议识别规则使用的自动生成规则ID起点
+	ProtocolRuleIDBase = 9400000
+
+	// GRPCCompressedVariable GRPC 处理器遇到无法解压检测的压缩消息时设置的事务变量
+	GRPCCompressedVariable = "grpc_compressed"
+)
+
+// ProtocolDirectives 返回按协议调整检测方式的运行时规则，需要在 CRS 之前加载：
+// gRPC 请求体使用 GRPC 处理器解析 protobuf，只把文本字段交给 CRS 检测，并跳过 CRS 的 Content-Type 白名单检查。
+// 压缩标志由客户端设置，无法解压的压缩消息直接拒绝，避免借压缩标志隐藏请求内容
+func ProtocolDirectives() string {
+	return fmt.Sprintf(`# protocol: gRPC
+SecRule REQUEST_HEADERS:Content-Type "@rx ^application/grpc(?:[+;]|$)" "id:%d,phase:1,pass,nolog,t:none,t:lowercase,ctl:requestBodyProcessor=GRPC,ctl:ruleRemoveById=920420,tag:'grpc'"
+SecRule TX:%s "@eq 1" "id:%d,phase:2,deny,status:403,log,t:none,msg:'Compressed gRPC message could not be inspected',tag:'grpc'"
+`, ProtocolRuleIDBase, GRPCCompressedVariable, ProtocolRuleIDBase+1)
+}
@@ -0,0 +1,254 @@
+package seclang
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+const (
+	// SiteScopeRuleIDBase 站点范围守卫规则使用的自动生成规则ID起点
+	SiteScopeRuleIDBase = 9200000
+
+	// 自动生成规则ID区间大小
+	generatedRuleIDSpan = 100000
+
+	// defaultPhase SecLang 未指定 phase 时的默认阶段
+	defaultPhase = 2
+)
+
+// RuleIDRange 保留的规则ID区间
+type RuleIDRange struct {
+	Min  int
+	Max  int
+	Name string
+}
+
+// ReservedRuleIDRanges 自定义规则不能使用的规则ID区间
+var ReservedRuleIDRanges = []RuleIDRange{
+	{Min: 200000, Max: 200999, Name: "Coraza 推荐配置"},
+	{Min: 900000, Max: 999999, Name: "OWASP CRS"},
+	{Min: ExclusionRuleIDBase, Max: ExclusionRuleIDBase + generatedRuleIDSpan - 1, Name: "规则排除自动生成"},
+	{Min: SiteScopeRuleIDBase, Max: SiteScopeRuleIDBase + generatedRuleIDSpan - 1, Name: "站点规则自动生成"},
+	{Min: BodyInspectionRuleIDBase, Max: BodyInspectionRuleIDBase + generatedRuleIDSpan - 1, Name: "请求体检测自动生成"},
+	{Min: ProtocolRuleIDBase, Max: ProtocolRuleIDBase + generatedRuleIDSpan - 1, Name: "协议识别自动生成"},
+}
+
+var (
+	ruleIDPattern    = regexp.MustCompile(`(?:^|[\s"',])id\s*:\s*'?(\d+)`)
+	rulePhasePattern = regexp.MustCompile(`(?:^|[\s"',])phase\s*:\s*'?(\d|request|response|logging)`)
+	directivePattern = regexp.MustCompile(`^\s*(SecRule|SecAction)\b`)
+	forbiddenPattern = regexp.MustCompile(`(?mi)^\s*(Include|SecRuleEngine|SecRuleRemoveBy\w*|SecRuleUpdate\w*|SecMarker)\b`)
+)
+
+// CheckRuleID 检查规则ID是否落在保留区间内
+func CheckRuleID(id int) error {
+	if id <= 0 {
+		return fmt.Errorf("规则ID必须大于0: %d", id)
+	}
+	for _, r := range ReservedRuleIDRanges {
+		if id >= r.Min && id <= r.Max {
+			return fmt.Errorf("规则ID %d 与%s的ID区间 %d-%d 冲突", id, r.Name, r.Min, r.Max)
+		}
+	}
+	return nil
+}
+
+// ParseRuleIDs 解析 SecLang 中声明的所有规则ID
+func ParseRuleIDs(secLang string) []int {
+	var ids []int
+	for _, m := range ruleIDPattern.FindAllStringSubmatch(secLang, -1) {
+		if id, err := strconv.Atoi(m[1]); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ParsePhase 解析 SecLang 的执行阶段，未指定时返回默认阶段 2
+func ParsePhase(secLang string) int {
+	m := rulePhasePattern.FindStringSubmatch(secLang)
+	if m == nil {
+		return defaultPhase
+	}
+	switch m[1] {
+	case "request":
+		return 2
+	case "response":
+		return 4
+	case "logging":
+		return 5
+	}
+	phase, _ := strconv.Atoi(m[1])
+	return phase
+}
+
+// ValidateRule 校验单条自定义规则的结构：必须是 SecRule/SecAction，只能声明自身的规则ID，且不能落在保留区间
+func ValidateRule(rule model.Rule) error {
+	body := strings.TrimSpace(rule.SecLang)
+	if body == "" {
+		return fmt.Errorf("规则 %d 的内容为空", rule.RuleID)
+	}
+	if !directivePattern.MatchString(body) {
+		return fmt.Errorf("规则 %d 必须以 SecRule 或 SecAction 开头", rule.RuleID)
+	}
+	if m := forbiddenPattern.FindStringSubmatch(body); m != nil {
+		return fmt.Errorf("规则 %d 中不允许使用 %s 指令", rule.RuleID, m[1])
+	}
+	if err := CheckRuleID(rule.RuleID); err != nil {
+		return err
+	}
+
+	ids := ParseRuleIDs(body)
+	if len(ids) != 1 || ids[0] != rule.RuleID {
+		return fmt.Errorf("规则内容必须且只能声明规则ID %d，实际解析到 %v", rule.RuleID, ids)
+	}
+
+	for _, domain := range rule.Scope.Domains {
+		if domain == "" || strings.ContainsAny(domain, " \t\r\n\"'") {
+			return fmt.Errorf("规则 %d 的生效域名无效: %q", rule.RuleID, domain)
+		}
+	}
+	return nil
+}
+
+// Assemble 按固定顺序组装最终指令：基础指令（含 CRS 引入）、全局规则、站点规则，
+// 规则排除中的运行时规则插入 CRS 之前，配置期指令追加在最后。未启用的规则会被忽略
+func Assemble(base string, rules []model.Rule, exclusions []model.RuleExclusion) (string, error) {
+	compiled, err := CompileExclusions(exclusions)
+	if err != nil {
+		return "", err
+	}
+
+	custom, err := CompileRules(rules)
+	if err != nil {
+		return "", err
+	}
+
+	after := custom
+	if compiled.AfterCRS != "" {
+		if after != "" {
+			after += "\n"
+		}
+		after += compiled.AfterCRS
+	}
+
+	return InjectDirectives(base, compiled.BeforeCRS, after), nil
+}
+
+// CompileRules 将启用的自定义规则编译为 SecLang，全局规则在前，站点规则按域名分组在后
+// 站点规则按阶段用守卫规则包裹，Host 不匹配时通过 skipAfter 跳过
+func CompileRules(rules []model.Rule) (string, error) {
+	var global []model.Rule
+	groups := make(map[string][]model.Rule)
+	groupDomains := make(map[string][]string)
+
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if err := ValidateRule(rule); err != nil {
+			return "", err
+		}
+		if rule.Scope.IsGlobal() {
+			global = append(global, rule)
+			continue
+		}
+
+		domains := append([]string(nil), rule.Scope.Domains...)
+		sort.Strings(domains)
+		key := strings.Join(domains, ",")
+		groups[key] = append(groups[key], rule)
+		groupDomains[key] = domains
+	}
+
+	var sb strings.Builder
+
+	if len(global) > 0 {
+		sortRules(global)
+		sb.WriteString("# custom rules: global\n")
+		for _, rule := range global {
+			writeRule(&sb, rule)
+		}
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	nextID := SiteScopeRuleIDBase
+	for groupIndex, key := range keys {
+		groupRules := groups[key]
+		sortRules(groupRules)
+
+		byPhase := make(map[int][]model.Rule)
+		var phases []int
+		for _, rule := range groupRules {
+			phase := ParsePhase(rule.SecLang)
+			if _, ok := byPhase[phase]; !ok {
+				phases = append(phases, phase)
+			}
+			byPhase[phase] = append(byPhase[phase], rule)
+		}
+		sort.Ints(phases)
+
+		hostPattern := hostRegex(groupDomains[key])
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "# custom rules: %s\n", key)
+
+		for _, phase := range phases {
+			marker := fmt.Sprintf("END_SITE_RULES_%d_%d", groupIndex, phase)
+
+			// 缺少 Host 或 Host 不匹配时跳过该分组在当前阶段的规则
+			fmt.Fprintf(&sb, "SecRule &REQUEST_HEADERS:Host \"@eq 0\" \"id:%d,phase:%d,pass,nolog,t:none,skipAfter:%s\"\n", nextID, phase, marker)
+			nextID++
+			fmt.Fprintf(&sb, "SecRule REQUEST_HEADERS:Host %s \"id:%d,phase:%d,pass,nolog,t:none,skipAfter:%s\"\n", quote("!@rx "+hostPattern), nextID, phase, marker)
+			nextID++
+
+			for _, rule := range byPhase[phase] {
+				writeRule(&sb, rule)
+			}
+			fmt.Fprintf(&sb, "SecMarker %s\n", marker)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// sortRules 按优先级和规则ID排序，保证组装结果稳定
+func sortRules(rules []model.Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].RuleID < rules[j].RuleID
+	})
+}
+
+// writeRule 写入单条规则，附带规则ID注释便于定位
+func writeRule(sb *strings.Builder, rule model.Rule) {
+	fmt.Fprintf(sb, "# rule %d", rule.RuleID)
+	if rule.Name != "" {
+		sb.WriteString(" " + strings.ReplaceAll(rule.Name, "\n", " "))
+	}
+	sb.WriteString("\n")
+	sb.WriteString(strings.TrimSpace(rule.SecLang))
+	sb.WriteString("\n")
+}
+
+// hostRegex 生成匹配域名列表（允许带端口）的正则
+func hostRegex(domains []string) string {
+	quoted := make([]string, 0, len(domains))
+	for _, d := range domains {
+		quoted = append(quoted, regexp.QuoteMeta(d))
+	}
+	return fmt.Sprintf("^(?:%s)(?::\\d+)?$", strings.Join(quoted, "|"))
+}
@@ -0,0 +1,97 @@
+package seclang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+const testBase = "SecRuleEngine On\nInclude @owasp_crs/*.conf\n"
+
+func TestAssemble(t *testing.T) {
+	rules := []model.Rule{
+		{
+			RuleID:  100001,
+			SecLang: `SecRule REQUEST_URI "@beginsWith /admin" "id:100001,phase:1,deny,status:403"`,
+			Enabled: true,
+		},
+		{
+			RuleID:  100002,
+			SecLang: `SecRule REQUEST_URI "@beginsWith /disabled" "id:100002,phase:1,deny,status:403"`,
+		},
+	}
+	exclusions := []model.RuleExclusion{
+		{RuleID: 942100, Type: model.ExclusionRemoveRule},
+		{RuleID: 941100, Type: model.ExclusionRemoveTarget, Target: "ARGS:content", Scope: model.ExclusionScope{Path: "/upload"}},
+		{RuleID: 920100, Type: model.ExclusionRemoveRule, Revoked: true},
+	}
+
+	got, err := Assemble(testBase, rules, exclusions)
+	if err != nil {
+		t.Fatalf("Assemble() error: %v", err)
+	}
+
+	// 运行时排除在 CRS 之前，自定义规则和配置期排除依次追加在最后
+	order := []string{
+		"SecRuleEngine On",
+		"ctl:ruleRemoveTargetById=941100;ARGS:content",
+		"Include @owasp_crs/*.conf",
+		"id:100001",
+		"SecRuleRemoveById 942100",
+	}
+	last := -1
+	for _, s := range order {
+		idx := strings.Index(got, s)
+		if idx < 0 {
+			t.Fatalf("assembled directives missing %q:\n%s", s, got)
+		}
+		if idx < last {
+			t.Fatalf("%q out of order:\n%s", s, got)
+		}
+		last = idx
+	}
+	for _, s := range []string{"id:100002", "920100"} {
+		if strings.Contains(got, s) {
+			t.Fatalf("disabled or revoked entry %q assembled:\n%s", s, got)
+		}
+	}
+}
+
+func TestAssembleWithoutExtras(t *testing.T) {
+	got, err := Assemble(testBase, nil, nil)
+	if err != nil {
+		t.Fatalf("Assemble() error: %v", err)
+	}
+	if got != testBase {
+		t.Fatalf("Assemble() = %q, want base unchanged", got)
+	}
+}
+
+func TestAssembleInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []model.Rule
+		exclusions []model.RuleExclusion
+	}{
+		{
+			name:  "rule declares other id",
+			rules: []model.Rule{{RuleID: 100001, SecLang: `SecRule ARGS "@rx x" "id:100003,deny"`, Enabled: true}},
+		},
+		{
+			name:  "forbidden directive",
+			rules: []model.Rule{{RuleID: 100001, SecLang: "SecRuleEngine Off", Enabled: true}},
+		},
+		{
+			name:       "invalid exclusion target",
+			exclusions: []model.RuleExclusion{{RuleID: 942100, Type: model.ExclusionRemoveTarget, Target: "args content"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Assemble(testBase, tt.rules, tt.exclusions); err == nil {
+				t.Fatalf("Assemble() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package seclang
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// untrustedDirectivePattern 不受信任的指令中禁止的指令：读取或写入服务器上的文件和目录
+	untrustedDirectivePattern = regexp.MustCompile(`(?i)^(SecAuditLog\w*|SecDebugLog|SecDataDir|SecUploadDir|SecTmpDir|SecUploadKeepFiles)$`)
+	// untrustedOperatorPattern 不受信任的指令中禁止的操作符：从服务器文件加载数据或检查文件
+	untrustedOperatorPattern = regexp.MustCompile(`(?i)@(\w+FromFile|pmf|inspectFile)\b`)
+)
+
+// CheckUntrusted 校验来自请求的候选指令（如规则回放），禁止读取或写入服务器文件的指令和操作符。
+// Include 只允许引入内置规则集（以 @ 开头的路径），不允许引入服务器上的文件
+func CheckUntrusted(directives string) error {
+	lines, splitErr := splitDirectives(directives)
+	if splitErr != nil {
+		return fmt.Errorf("第 %d 行: %s", splitErr.Line, splitErr.Message)
+	}
+
+	for _, l := range lines {
+		fields := strings.Fields(l.text)
+		name := fields[0]
+		if strings.EqualFold(name, "Include") {
+			if len(fields) < 2 {
+				continue
+			}
+			path := strings.Trim(fields[1], `"'`)
+			if !strings.HasPrefix(path, "@") || strings.Contains(path, "..") {
+				return fmt.Errorf("第 %d 行: Include 只允许引入内置规则集: %s", l.line, path)
+			}
+			continue
+		}
+		if untrustedDirectivePattern.MatchString(name) {
+			return fmt.Errorf("第 %d 行: 不允许使用 %s 指令", l.line, name)
+		}
+		if m := untrustedOperatorPattern.FindString(l.text); m != "" {
+			return fmt.Errorf("第 %d 行: 不允许使用 %s 操作符", l.line, m)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package seclang
+
+import "testing"
+
+func TestCheckUntrusted(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives string
+		wantErr    bool
+	}{
+		{name: "builtin rule set", directives: "Include @coraza.conf-recommended\nInclude @owasp_crs/*.conf\nSecRuleRemoveById 942100"},
+		{name: "rule", directives: `SecRule ARGS "@rx select" "id:100001,phase:2,deny"`},
+		{name: "server file include", directives: "Include /etc/passwd", wantErr: true},
+		{name: "builtin path traversal", directives: "Include @owasp_crs/../../etc/passwd", wantErr: true},
+		{name: "audit log", directives: "SecAuditLog /tmp/out.log", wantErr: true},
+		{name: "audit log storage dir", directives: "secauditlogstoragedir /tmp", wantErr: true},
+		{name: "debug log", directives: "SecDebugLog /tmp/debug.log", wantErr: true},
+		{name: "data dir", directives: "SecDataDir /tmp", wantErr: true},
+		{name: "upload dir", directives: "SecUploadDir /tmp", wantErr: true},
+		{name: "ip match from file", directives: `SecRule REMOTE_ADDR "@ipMatchFromFile /etc/hosts" "id:1,deny"`, wantErr: true},
+		{name: "ip list from file", directives: `SecRule REMOTE_ADDR "@ipMatchListFromFile /etc/hosts" "id:1,deny"`, wantErr: true},
+		{name: "pmf alias", directives: `SecRule ARGS "@pmf /etc/passwd" "id:1,deny"`, wantErr: true},
+		{
+			name:       "continuation line",
+			directives: "SecRule ARGS \\\n    \"@pmFromFile /etc/passwd\" \"id:1,deny\"",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckUntrusted(tt.directives)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckUntrusted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
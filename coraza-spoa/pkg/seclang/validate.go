@@ -0,0 +1,255 @@
+package seclang
+
+import (
+	"bufio"
+	"fmt"
+	iofs "io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	coreruleset "github.com/corazawaf/coraza-coreruleset"
+	"github.com/jcchavezs/mergefs"
+	"github.com/jcchavezs/mergefs/io"
+)
+
+// 与 coraza 解析器保持一致的 Include 递归上限
+const maxIncludeRecursion = 100
+
+// ValidationError 指令校验错误，Line 为内联指令中的行号（从1开始）
+type ValidationError struct {
+	Line      int    `json:"line" example:"12"`                                       // 出错指令的起始行号
+	Directive string `json:"directive,omitempty" example:"SecRule ARGS \"@rx (\"..."` // 出错的指令
+	Message   string `json:"message" example:"failed to compile the directive \"secrule\": ..."`
+}
+
+// DuplicateRuleID 重复声明的规则ID
+type DuplicateRuleID struct {
+	ID        int      `json:"id" example:"100001"`                         // 规则ID
+	Locations []string `json:"locations" example:"_inline_:12,_inline_:30"` // 声明位置，格式为 文件:行号
+}
+
+// ValidationResult 指令校验结果
+type ValidationResult struct {
+	Valid        bool              `json:"valid"`                   // 是否可以编译
+	RuleCount    int               `json:"ruleCount" example:"642"` // 加载的规则数量（含 Include 文件，扣除 SecRuleRemoveById 移除的规则）
+	Errors       []ValidationError `json:"errors"`                  // 编译错误
+	DuplicateIDs []DuplicateRuleID `json:"duplicateIds"`            // 重复的规则ID
+}
+
+// directiveLine 一条完整的指令（已合并续行）及其起始行号
+type directiveLine struct {
+	line int
+	text string
+}
+
+// Validate 使用引擎相同的文件系统编译指令，并给出出错行号、规则数量和重复的规则ID
+func Validate(directives string) ValidationResult {
+	result := ValidationResult{
+		Errors:       []ValidationError{},
+		DuplicateIDs: []DuplicateRuleID{},
+	}
+
+	root := mergefs.Merge(coreruleset.FS, io.OSFS)
+
+	lines, splitErr := splitDirectives(directives)
+
+	// 统计规则数量和重复ID，Include 的文件一并扫描
+	scan := &ruleScanner{root: root, locations: make(map[int][]string), removed: make(map[int]bool)}
+	scan.scan(lines, "_inline_", "")
+	result.RuleCount = scan.count()
+	result.DuplicateIDs = scan.duplicates()
+
+	if splitErr != nil {
+		result.Errors = append(result.Errors, *splitErr)
+		return result
+	}
+
+	err := Compile(directives)
+	if err == nil {
+		result.Valid = len(result.DuplicateIDs) == 0
+		return result
+	}
+
+	// 二分查找第一条导致编译失败的指令
+	failed := sort.Search(len(lines), func(i int) bool {
+		return Compile(joinDirectives(lines[:i+1])) != nil
+	})
+
+	validationErr := ValidationError{Message: err.Error()}
+	if failed < len(lines) {
+		validationErr.Line = lines[failed].line
+		validationErr.Directive = lines[failed].text
+	}
+	result.Errors = append(result.Errors, validationErr)
+	return result
+}
+
+// splitDirectives 按 coraza 解析器的规则拆分指令：忽略空行和注释，合并反斜杠续行和反引号块
+func splitDirectives(data string) ([]directiveLine, *ValidationError) {
+	var (
+		lines        []directiveLine
+		buffer       strings.Builder
+		startLine    int
+		lineNumber   int
+		inBackticks  bool
+		backtickLine int
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if buffer.Len() == 0 {
+			startLine = lineNumber
+		}
+
+		if !inBackticks && line[len(line)-1] == '`' {
+			inBackticks = true
+			backtickLine = lineNumber
+		} else if inBackticks && line[0] == '`' {
+			inBackticks = false
+		}
+
+		if inBackticks {
+			buffer.WriteString(line)
+			buffer.WriteString("\n")
+			continue
+		}
+
+		if line[len(line)-1] == '\\' {
+			buffer.WriteString(strings.TrimSuffix(line, "\\"))
+			continue
+		}
+
+		buffer.WriteString(line)
+		lines = append(lines, directiveLine{line: startLine, text: buffer.String()})
+		buffer.Reset()
+	}
+
+	if inBackticks {
+		return lines, &ValidationError{Line: backtickLine, Message: "backticks left open"}
+	}
+	if buffer.Len() > 0 {
+		// 末尾的续行没有结束，coraza 会忽略它，这里仍然保留以便统计
+		lines = append(lines, directiveLine{line: startLine, text: buffer.String()})
+	}
+	return lines, nil
+}
+
+// joinDirectives 将拆分后的指令重新拼接为可编译的文本
+func joinDirectives(lines []directiveLine) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		sb.WriteString(l.text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// ruleScanner 扫描指令及其 Include 文件中的规则ID
+type ruleScanner struct {
+	root         iofs.FS
+	locations    map[int][]string
+	order        []int
+	removed      map[int]bool
+	includeCount int
+}
+
+func (s *ruleScanner) scan(lines []directiveLine, file, dir string) {
+	for _, l := range lines {
+		name, opts, _ := strings.Cut(l.text, " ")
+		opts = strings.TrimSpace(opts)
+
+		switch strings.ToLower(name) {
+		case "include":
+			s.include(strings.Trim(opts, `"`), dir)
+		case "secrule", "secaction":
+			ids := ParseRuleIDs(l.text)
+			if len(ids) == 0 {
+				continue // chain 中的后续规则没有ID
+			}
+			id := ids[0]
+			if _, ok := s.locations[id]; !ok {
+				s.order = append(s.order, id)
+			}
+			s.locations[id] = append(s.locations[id], fmt.Sprintf("%s:%d", file, l.line))
+		case "secruleremovebyid":
+			s.remove(opts)
+		}
+	}
+}
+
+func (s *ruleScanner) include(path, dir string) {
+	if s.includeCount >= maxIncludeRecursion {
+		return
+	}
+	s.includeCount++
+
+	var files []string
+	if strings.Contains(path, "*") {
+		files, _ = iofs.Glob(s.root, path)
+	} else {
+		files = []string{path}
+	}
+
+	for _, f := range files {
+		f = strings.TrimSpace(f)
+		if !strings.HasPrefix(f, "/") {
+			f = filepath.Join(dir, f)
+		}
+		data, err := iofs.ReadFile(s.root, f)
+		if err != nil {
+			continue // 读取失败由编译步骤报告
+		}
+		lines, _ := splitDirectives(string(data))
+		s.scan(lines, f, filepath.Dir(f))
+	}
+}
+
+// remove 处理 SecRuleRemoveById 的单个ID和ID区间
+func (s *ruleScanner) remove(opts string) {
+	for _, field := range strings.Fields(strings.Trim(opts, `"`)) {
+		if from, to, ok := strings.Cut(field, "-"); ok {
+			start, err1 := strconv.Atoi(from)
+			end, err2 := strconv.Atoi(to)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			for _, id := range s.order {
+				if id >= start && id <= end {
+					s.removed[id] = true
+				}
+			}
+			continue
+		}
+		if id, err := strconv.Atoi(field); err == nil {
+			s.removed[id] = true
+		}
+	}
+}
+
+func (s *ruleScanner) count() int {
+	n := 0
+	for _, id := range s.order {
+		if !s.removed[id] {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *ruleScanner) duplicates() []DuplicateRuleID {
+	duplicates := []DuplicateRuleID{}
+	for _, id := range s.order {
+		if locations := s.locations[id]; len(locations) > 1 {
+			duplicates = append(duplicates, DuplicateRuleID{ID: id, Locations: locations})
+		}
+	}
+	return duplicates
+}
@@ -3,10 +3,13 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -19,6 +22,7 @@ import (
 	"github.com/HUAHUAI23/simple-waf/coraza-spoa/internal"
 	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/geoip"
 	"github.com/HUAHUAI23/simple-waf/pkg/utils/network"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 )
@@ -29,14 +33,21 @@ var globalLogger = zerolog.New(os.Stderr).With().Timestamp().Logger()
 type ServerState int
 
 const (
-	ServerStopped ServerState = iota // 服务已停止
-	ServerRunning                    // 服务正在运行
-	ServerError                      // 服务出错
+	ServerStopped  ServerState = iota // 服务已停止
+	ServerRunning                     // 服务正在运行
+	ServerError                       // 服务出错
+	ServerDraining                    // 服务正在优雅停止
 )
 
+var ErrServerDraining = errors.New("服务正在优雅停止")
+
+// restartDrainTimeout 重启时等待进行中事务的最长时间
+const restartDrainTimeout = 30 * time.Second
+
 type AgentServer interface {
 	Start() error
 	Stop() error
+	Drain(timeout time.Duration) error
 	Restart() error
 	UpdateApplications() error
 	UpdateNetworkAddress(network, address string)
@@ -44,6 +55,8 @@ type AgentServer interface {
 	GetState() ServerState
 	GetLastError() error
 	GetLatestConfig() (*model.Config, error)
+	GetReplayer(appName string) (Replayer, error)
+	ConfigFingerprint() (string, error)
 }
 
 // AgentServer 管理Agent服务的生命周期
@@ -55,11 +68,16 @@ type AgentServerImpl struct {
 	listener     net.Listener
 	network      string
 	address      string
+	fixedAddress bool // 通过 UpdateNetworkAddress 指定地址后，不再使用配置中的 bind
 	applications map[string]*internal.Application
 	logger       zerolog.Logger
 	state        ServerState
 	lastError    error
 	mongoURI     string
+	geo          *geoip.Database     // 所有应用共用的 GeoIP 数据库，未启用时为 nil
+	geoConfig    model.GeoIPConfig   // 当前数据库对应的配置
+	geoCancel    context.CancelFunc  // 停止数据库文件更新检查
+	auditStore   internal.AuditStore // 本次启动创建的审计记录存储器
 }
 
 func NewAgentServer(logger zerolog.Logger, mongoURI string) (AgentServer, error) {
@@ -79,26 +97,27 @@ func (s *AgentServerImpl) Start() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.state == ServerRunning {
+	switch s.state {
+	case ServerRunning:
 		return errors.New("服务已经在运行中")
+	case ServerDraining:
+		return ErrServerDraining
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	s.ctx = ctx
-	s.cancelFunc = cancel
-
 	globalConfig, err := s.GetLatestConfig()
 	if err != nil {
-		s.logger.Fatal().Err(err).Msg("Failed getting latest config")
-		return err
+		return s.startFailed(fmt.Errorf("获取最新配置失败: %w", err))
 	}
 
 	mongoClient, err := mongodb.Connect(s.mongoURI)
 	if err != nil {
-		s.logger.Fatal().Err(err).Msg("Failed creating MongoDB client")
-		return err
+		return s.startFailed(fmt.Errorf("创建 MongoDB 客户端失败: %w", err))
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	s.ctx = ctx
+	s.cancelFunc = cancel
+
 	var wafLog model.WAFLog
 	mongoConfig := &internal.MongoConfig{
 		Client:     mongoClient,
@@ -106,46 +125,30 @@ func (s *AgentServerImpl) Start() error {
 		Collection: wafLog.GetCollectionName(),
 	}
 
-	appConfigs := globalConfig.Engine.AppConfig
-
-	// Convert model.AppConfig to internal.AppConfig and create applications
-	allApps := make(map[string]*internal.Application)
-	for _, appConfig := range appConfigs {
-		// 创建日志配置
-		logConfig := cfg.LogConfig{
-			Level:  appConfig.LogLevel,
-			File:   appConfig.LogFile,
-			Format: appConfig.LogFormat,
-		}
-
-		// 创建日志记录器
-		appLogger, err := logConfig.NewLogger()
-		if err != nil {
-			s.logger.Warn().Err(err).Str("app", appConfig.Name).Msg("使用默认日志记录器")
-			appLogger = globalLogger
-		}
-
-		// 创建内部 AppConfig
-		internalAppConfig := internal.AppConfig{
-			Directives:     appConfig.Directives,
-			ResponseCheck:  globalConfig.IsResponseCheck, // 使用全局响应检查设置
-			Logger:         appLogger,
-			TransactionTTL: appConfig.TransactionTTL,
-		}
-
-		// 创建应用
-		application, err := internalAppConfig.NewApplicationWithContext(ctx, mongoConfig, globalConfig.IsDebug)
-		if err != nil {
-			s.logger.Fatal().Err(err).Msg("Failed creating application: " + appConfig.Name)
+	// SecAuditLogType mongo、mongo_concurrent 写入的审计记录存储器，所有应用共用。
+	// 存储器由 Close 结束，不随服务上下文取消，停止后退役的应用仍可写完剩余审计记录
+	auditStore := internal.NewMongoAuditStore(mongoClient, mongoConfig.Database, s.logger)
+	auditStore.Start(context.Background())
+	internal.SetAuditStore(auditStore)
+	s.auditStore = auditStore
 
-			return err
-		}
+	s.syncGeoIP(globalConfig.GeoIP)
 
-		allApps[appConfig.Name] = application
+	allApps, _, err := s.buildApplications(ctx, globalConfig, mongoConfig, nil)
+	if err != nil {
+		// 释放已启动的审计记录存储器和 GeoIP 数据库，服务保持未运行状态，可以重新启动
+		cancel()
+		s.ctx = nil
+		s.cancelFunc = nil
+		s.releaseAuditStore()
+		s.stopGeoIP()
+		return s.startFailed(fmt.Errorf("创建应用失败: %w", err))
 	}
 
 	s.applications = allApps
-	s.network, s.address = network.NetworkAddressFromBind(globalConfig.Engine.Bind)
+	if !s.fixedAddress {
+		s.network, s.address = network.NetworkAddressFromBind(globalConfig.Engine.Bind)
+	}
 
 	// 创建监听器
 	l, err := (&net.ListenConfig{}).Listen(s.ctx, s.network, s.address)
@@ -185,13 +188,24 @@ func (s *AgentServerImpl) Start() error {
 	return nil
 }
 
+// startFailed 记录启动失败的原因，需持有锁时调用
+func (s *AgentServerImpl) startFailed(err error) error {
+	s.logger.Error().Err(err).Msg("启动服务失败")
+	s.state = ServerError
+	s.lastError = err
+	return err
+}
+
 // Stop 停止服务
 func (s *AgentServerImpl) Stop() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.state == ServerStopped {
-		return errors.New("服务未运行")
+	switch s.state {
+	case ServerStopped:
+		return ErrServerNotRunning
+	case ServerDraining:
+		return ErrServerDraining
 	}
 
 	// 取消上下文
@@ -209,6 +223,23 @@ func (s *AgentServerImpl) Stop() error {
 		s.listener = nil
 	}
 
+	// 释放所有应用持有的事务缓存、日志存储器和日志文件句柄，
+	// 应用在后台等待剩余事务后关闭，审计记录存储器在它们全部关闭后再关闭
+	retired := make([]*internal.Application, 0, len(s.applications))
+	for _, app := range s.applications {
+		app.Retire()
+		retired = append(retired, app)
+	}
+	store := s.auditStore
+	s.auditStore = nil
+	go func() {
+		for _, app := range retired {
+			<-app.Closed()
+		}
+		internal.ReleaseAuditStore(store)
+	}()
+	s.stopGeoIP()
+
 	s.agent = nil
 	s.applications = nil
 	s.ctx = nil
@@ -218,9 +249,65 @@ func (s *AgentServerImpl) Stop() error {
 	return nil
 }
 
-// Restart 重启服务
+// Drain 优雅停止服务：停止接收新连接，在 timeout 内等待进行中的事务处理完成，写完剩余日志后停止
+func (s *AgentServerImpl) Drain(timeout time.Duration) error {
+	// 只在持锁时停止接收新连接并取出应用，等待期间不持锁，避免阻塞状态查询和回放
+	s.mu.Lock()
+	switch s.state {
+	case ServerStopped:
+		s.mu.Unlock()
+		return ErrServerNotRunning
+	case ServerDraining:
+		s.mu.Unlock()
+		return ErrServerDraining
+	}
+
+	// 停止接收新连接，已建立的连接继续处理
+	if s.listener != nil {
+		if err := s.listener.Close(); err != nil {
+			s.logger.Error().Err(err).Msg("关闭监听器失败")
+		}
+		s.listener = nil
+	}
+	applications := s.applications
+	s.state = ServerDraining
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for name, app := range applications {
+		if !app.Drain(ctx) {
+			s.logger.Warn().Str("app", name).Dur("timeout", timeout).Msg("等待进行中的事务超时")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 在取消上下文之前关闭应用，日志存储器写完剩余日志，之后再关闭审计记录存储器
+	for _, app := range applications {
+		app.Close()
+	}
+	s.releaseAuditStore()
+	s.stopGeoIP()
+
+	if s.cancelFunc != nil {
+		s.cancelFunc()
+		s.cancelFunc = nil
+	}
+
+	s.agent = nil
+	s.applications = nil
+	s.ctx = nil
+
+	s.state = ServerStopped
+	s.logger.Info().Msg("服务已优雅停止")
+	return nil
+}
+
+// Restart 重启服务，先等待进行中的事务处理完成
 func (s *AgentServerImpl) Restart() error {
-	if err := s.Stop(); err != nil && !errors.Is(err, errors.New("服务未运行")) {
+	if err := s.Drain(restartDrainTimeout); err != nil && !errors.Is(err, ErrServerNotRunning) {
 		return err
 	}
 	return s.Start()
@@ -231,17 +318,22 @@ func (s *AgentServerImpl) UpdateApplications() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// 优雅停止期间不再创建应用，避免新应用在停止后无人释放
+	if s.state == ServerDraining {
+		return ErrServerDraining
+	}
+
+	// 热更新失败时保留正在运行的应用，不退出进程
 	globalConfig, err := s.GetLatestConfig()
 	if err != nil {
-		s.logger.Fatal().Err(err).Msg("Failed getting latest config")
-		return err
+		s.logger.Error().Err(err).Msg("获取最新配置失败，继续使用当前应用")
+		return fmt.Errorf("获取最新配置失败: %w", err)
 	}
 
 	mongoClient, err := mongodb.Connect(s.mongoURI)
-
 	if err != nil {
-		s.logger.Fatal().Err(err).Msg("Failed creating MongoDB client")
-		return err
+		s.logger.Error().Err(err).Msg("创建 MongoDB 客户端失败，继续使用当前应用")
+		return fmt.Errorf("创建 MongoDB 客户端失败: %w", err)
 	}
 
 	var wafLog model.WAFLog
@@ -251,12 +343,122 @@ func (s *AgentServerImpl) UpdateApplications() error {
 		Collection: wafLog.GetCollectionName(),
 	}
 
-	// 从 Config 中提取 AppConfig 列表
-	appConfigs := globalConfig.Engine.AppConfig
+	s.syncGeoIP(globalConfig.GeoIP)
+
+	// 只重建配置有变化的应用，未变化的应用继续使用
+	allApps, retired, err := s.buildApplications(s.ctx, globalConfig, mongoConfig, s.applications)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("创建应用失败，继续使用当前应用")
+		return fmt.Errorf("创建应用失败: %w", err)
+	}
+
+	s.applications = allApps
+
+	// 如果服务正在运行，热更新Agent的应用
+	if s.state == ServerRunning && s.agent != nil && s.ctx != nil {
+		s.agent.ReplaceApplications(allApps)
+		s.logger.Info().Int("applications", len(allApps)).Int("retired", len(retired)).Msg("应用配置已更新")
+	}
+
+	// 被替换的应用处理完进行中的请求和未完成的事务后释放资源
+	for _, app := range retired {
+		app.Retire()
+	}
+
+	return nil
+}
+
+// releaseAuditStore 关闭本次启动创建的审计记录存储器，需持有 s.mu
+func (s *AgentServerImpl) releaseAuditStore() {
+	internal.ReleaseAuditStore(s.auditStore)
+	s.auditStore = nil
+}
+
+// geoReloadInterval 检查 GeoIP 数据库文件是否更新的间隔
+const geoReloadInterval = time.Minute
+
+// ipListDataDir 供 IP 信誉列表查询操作符读取的 IP 信誉列表数据文件目录
+var ipListDataDir = filepath.Join(os.TempDir(), "simple-waf", "ip-lists")
+
+// syncGeoIP 按配置打开或关闭 GeoIP 数据库，文件路径未变化时继续使用已打开的数据库。
+// 打开失败只记录日志，引擎不查询地理位置，国家访问策略不会拦截请求
+func (s *AgentServerImpl) syncGeoIP(geoCfg model.GeoIPConfig) {
+	if !geoCfg.Enabled {
+		s.stopGeoIP()
+		return
+	}
+	if s.geo != nil && geoCfg == s.geoConfig {
+		return
+	}
+
+	db, err := geoip.Open(geoCfg.CountryDB, geoCfg.ASNDB)
+	if err != nil {
+		s.logger.Error().Err(err).Str("countryDB", geoCfg.CountryDB).Str("asnDB", geoCfg.ASNDB).Msg("打开 GeoIP 数据库失败")
+		s.stopGeoIP()
+		return
+	}
+
+	s.stopGeoIP()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.geo = db
+	s.geoConfig = geoCfg
+	s.geoCancel = cancel
+	s.logger.Info().Str("countryDB", geoCfg.CountryDB).Str("asnDB", geoCfg.ASNDB).Msg("GeoIP 数据库已加载")
+
+	// 数据库文件被外部工具（如 geoipupdate）更新后原地重新加载，不需要重建应用
+	go func() {
+		ticker := time.NewTicker(geoReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reloaded, err := db.Reload()
+				if err != nil {
+					s.logger.Warn().Err(err).Msg("重新加载 GeoIP 数据库失败，继续使用已加载的数据")
+				} else if reloaded {
+					s.logger.Info().Msg("GeoIP 数据库已重新加载")
+				}
+			}
+		}
+	}()
+}
+
+// stopGeoIP 停止数据库文件更新检查并释放数据库
+func (s *AgentServerImpl) stopGeoIP() {
+	if s.geoCancel != nil {
+		s.geoCancel()
+		s.geoCancel = nil
+	}
+	s.geo = nil
+	s.geoConfig = model.GeoIPConfig{}
+}
+
+// buildApplications 按最新配置构建应用，current 中构建参数未变化的应用直接复用，
+// 返回新的应用集合和需要退役的旧应用
+func (s *AgentServerImpl) buildApplications(ctx context.Context, globalConfig *model.Config, mongoConfig *internal.MongoConfig, current map[string]*internal.Application) (map[string]*internal.Application, []*internal.Application, error) {
+	// 加载自定义规则、规则排除和站点的请求体检测配置
+	ruleSet, err := s.loadRuleSet(true)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed loading custom rules and exclusions")
+		return nil, nil, err
+	}
+
+	compiled, err := ruleSet.Compile(ipListDataDir)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed compiling site policy directives")
+		return nil, nil, err
+	}
+
+	specs := make([]internal.AppSpec, 0, len(globalConfig.Engine.AppConfig))
+	for _, appConfig := range globalConfig.Engine.AppConfig {
+		directives, err := compiled.Directives(appConfig.Directives)
+		if err != nil {
+			s.logger.Error().Err(err).Str("app", appConfig.Name).Msg("Failed assembling directives")
+			return nil, nil, err
+		}
 
-	// Convert model.AppConfig to internal.AppConfig and create applications
-	allApps := make(map[string]*internal.Application)
-	for _, appConfig := range appConfigs {
 		// 创建日志配置
 		logConfig := cfg.LogConfig{
 			Level:  appConfig.LogLevel,
@@ -264,40 +466,38 @@ func (s *AgentServerImpl) UpdateApplications() error {
 			Format: appConfig.LogFormat,
 		}
 
-		// 创建日志记录器
-		appLogger, err := logConfig.NewLogger()
-		if err != nil {
-			s.logger.Warn().Err(err).Str("app", appConfig.Name).Msg("使用默认日志记录器")
-			appLogger = globalLogger
-		}
-
 		// 创建内部 AppConfig
 		internalAppConfig := internal.AppConfig{
-			Directives:     appConfig.Directives,
-			ResponseCheck:  globalConfig.IsResponseCheck, // 使用全局响应检查设置
-			Logger:         appLogger,
-			TransactionTTL: appConfig.TransactionTTL,
-		}
-
-		// 创建应用
-		application, err := internalAppConfig.NewApplicationWithContext(s.ctx, mongoConfig, globalConfig.IsDebug)
-		if err != nil {
-			s.logger.Fatal().Err(err).Msg("Failed creating application: " + appConfig.Name)
-			return err
+			Directives:        directives,
+			ResponseCheck:     globalConfig.IsResponseCheck, // 使用全局响应检查设置
+			TransactionTTL:    appConfig.TransactionTTL,
+			LogPolicy:         appConfig.LogPolicy,
+			LogScoreThreshold: appConfig.LogScoreThreshold,
+			Challenge:         globalConfig.Challenge,
+			Bot:               globalConfig.Bot,
+			GeoIP:             s.geo,
 		}
-
-		allApps[appConfig.Name] = application
-	}
-
-	s.applications = allApps
-
-	// 如果服务正在运行，热更新Agent的应用
-	if s.state == ServerRunning && s.agent != nil && s.ctx != nil {
-		s.agent.ReplaceApplications(allApps)
-		s.logger.Info().Msg("应用配置已更新")
+		name := appConfig.Name
+
+		specs = append(specs, internal.AppSpec{
+			Name: name,
+			Key:  internalAppConfig.Fingerprint(globalConfig.IsDebug, logConfig.String()),
+			Build: func() (*internal.Application, error) {
+				// 创建日志记录器
+				appLogger, closer, err := logConfig.NewLoggerWithCloser()
+				if err != nil {
+					s.logger.Warn().Err(err).Str("app", name).Msg("使用默认日志记录器")
+					appLogger = globalLogger
+				}
+				internalAppConfig.Logger = appLogger
+				internalAppConfig.LogOutput = closer
+
+				return internalAppConfig.NewApplicationWithContext(ctx, mongoConfig, globalConfig.IsDebug)
+			},
+		})
 	}
 
-	return nil
+	return internal.DiffApplications(current, specs)
 }
 
 // UpdateNetworkAddress 更新网络地址 not support hot reload
@@ -307,6 +507,7 @@ func (s *AgentServerImpl) UpdateNetworkAddress(network, address string) {
 
 	s.network = network
 	s.address = address
+	s.fixedAddress = true
 }
 
 // UpdateLogger 更新日志记录器 support hot reload
@@ -366,3 +567,56 @@ func (s *AgentServerImpl) GetLatestConfig() (*model.Config, error) {
 	}
 	return &cfg, nil
 }
+
+// ConfigFingerprint 计算引擎相关配置、人机验证和机器人识别配置、自定义规则、规则排除和请求体检测配置的摘要，摘要变化时需要重新加载应用
+func (s *AgentServerImpl) ConfigFingerprint() (string, error) {
+	globalConfig, err := s.GetLatestConfig()
+	if err != nil {
+		return "", err
+	}
+
+	ruleSet, err := s.loadRuleSet(false)
+	if err != nil {
+		return "", err
+	}
+
+	// 列表条目可能很大，只比较摘要
+	ipListDigests := make(bson.D, 0, len(ruleSet.IPLists))
+	for _, list := range ruleSet.IPLists {
+		ipListDigests = append(ipListDigests, bson.E{Key: list.Name, Value: list.Digest})
+	}
+
+	data, err := bson.Marshal(bson.D{
+		{Key: "appConfig", Value: globalConfig.Engine.AppConfig},
+		{Key: "isResponseCheck", Value: globalConfig.IsResponseCheck},
+		{Key: "isDebug", Value: globalConfig.IsDebug},
+		{Key: "challenge", Value: globalConfig.Challenge},
+		{Key: "bot", Value: globalConfig.Bot},
+		{Key: "geoip", Value: globalConfig.GeoIP},
+		{Key: "rules", Value: ruleSet.Rules},
+		{Key: "exclusions", Value: ruleSet.Exclusions},
+		{Key: "bodyInspections", Value: ruleSet.BodyInspections},
+		{Key: "geoPolicies", Value: ruleSet.GeoPolicies},
+		{Key: "ipListPolicies", Value: ruleSet.IPListPolicies},
+		{Key: "ipLists", Value: ipListDigests},
+	})
+	if err != nil {
+		return "", fmt.Errorf("计算配置摘要失败: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// loadRuleSet 从数据库加载编译引擎指令所需的配置，withEntries 为 false 时不读取列表条目，只用于计算配置摘要
+func (s *AgentServerImpl) loadRuleSet(withEntries bool) (*RuleSet, error) {
+	client, err := mongodb.Connect(s.mongoURI)
+	if err != nil {
+		return nil, fmt.Errorf("连接数据库失败: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return LoadRuleSet(ctx, client.Database(config.Global.DBConfig.Database), withEntries)
+}
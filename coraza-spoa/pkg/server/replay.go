@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/internal"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrServerNotRunning = errors.New("引擎未在运行中")
+	ErrAppNotFound      = errors.New("应用不存在")
+)
+
+// Replayer 使用某个应用的规则集回放请求
+type Replayer interface {
+	Replay(input model.ReplayInput) (*model.ReplayResult, error)
+}
+
+// GetReplayer 获取正在运行的应用，回放使用与线上流量相同的 WAF 实例
+func (s *AgentServerImpl) GetReplayer(appName string) (Replayer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != ServerRunning || s.applications == nil {
+		return nil, ErrServerNotRunning
+	}
+
+	app, ok := s.applications[appName]
+	if !ok {
+		return nil, ErrAppNotFound
+	}
+	return app, nil
+}
+
+// NewCandidateReplayer 使用候选指令创建独立的回放器，用于评估规则变更的影响
+func NewCandidateReplayer(directives string, responseCheck bool, logger zerolog.Logger) (Replayer, error) {
+	appConfig := internal.AppConfig{
+		Directives:    directives,
+		ResponseCheck: responseCheck,
+		Logger:        logger,
+	}
+	return appConfig.NewReplayApplication()
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// RuleSet 编译引擎指令所需的数据库配置
+type RuleSet struct {
+	Rules           []model.Rule
+	Exclusions      []model.RuleExclusion
+	BodyInspections []model.SiteBodyInspection
+	GeoPolicies     []model.SiteGeoPolicy
+	IPListPolicies  []model.SiteIPListPolicy
+	IPLists         []model.IPList // 站点引用的列表，按名称排序
+}
+
+// LoadRuleSet 加载启用的自定义规则、未撤销的规则排除和激活站点的请求体检测、国家访问策略、IP 信誉列表配置，
+// withEntries 为 false 时不读取列表条目，只用于计算配置摘要
+func LoadRuleSet(ctx context.Context, db *mongo.Database, withEntries bool) (*RuleSet, error) {
+	result := &RuleSet{}
+
+	var rule model.Rule
+	ruleCursor, err := db.Collection(rule.GetCollectionName()).Find(ctx, bson.D{{Key: "enabled", Value: true}})
+	if err != nil {
+		return nil, fmt.Errorf("查询自定义规则失败: %w", err)
+	}
+	if err := ruleCursor.All(ctx, &result.Rules); err != nil {
+		return nil, fmt.Errorf("解析自定义规则失败: %w", err)
+	}
+
+	var exclusion model.RuleExclusion
+	exclusionCursor, err := db.Collection(exclusion.GetCollectionName()).Find(ctx, bson.D{{Key: "revoked", Value: false}})
+	if err != nil {
+		return nil, fmt.Errorf("查询规则排除失败: %w", err)
+	}
+	if err := exclusionCursor.All(ctx, &result.Exclusions); err != nil {
+		return nil, fmt.Errorf("解析规则排除失败: %w", err)
+	}
+
+	var site model.SiteBodyInspection
+	siteCursor, err := db.Collection(site.GetCollectionName()).Find(ctx,
+		bson.D{
+			{Key: "activeStatus", Value: true},
+			{Key: "bodyInspection", Value: bson.D{{Key: "$ne", Value: nil}}},
+		},
+		options.Find().SetProjection(bson.D{{Key: "domain", Value: 1}, {Key: "listenPort", Value: 1}, {Key: "bodyInspection", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询站点请求体检测配置失败: %w", err)
+	}
+	if err := siteCursor.All(ctx, &result.BodyInspections); err != nil {
+		return nil, fmt.Errorf("解析站点请求体检测配置失败: %w", err)
+	}
+
+	var geoSite model.SiteGeoPolicy
+	geoCursor, err := db.Collection(geoSite.GetCollectionName()).Find(ctx,
+		bson.D{
+			{Key: "activeStatus", Value: true},
+			{Key: "geoPolicy", Value: bson.D{{Key: "$ne", Value: nil}}},
+		},
+		options.Find().SetProjection(bson.D{{Key: "domain", Value: 1}, {Key: "listenPort", Value: 1}, {Key: "geoPolicy", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询站点国家访问策略失败: %w", err)
+	}
+	if err := geoCursor.All(ctx, &result.GeoPolicies); err != nil {
+		return nil, fmt.Errorf("解析站点国家访问策略失败: %w", err)
+	}
+
+	var listSite model.SiteIPListPolicy
+	listSiteCursor, err := db.Collection(listSite.GetCollectionName()).Find(ctx,
+		bson.D{
+			{Key: "activeStatus", Value: true},
+			{Key: "ipLists.0", Value: bson.D{{Key: "$exists", Value: true}}},
+		},
+		options.Find().SetProjection(bson.D{{Key: "domain", Value: 1}, {Key: "listenPort", Value: 1}, {Key: "ipLists", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询站点 IP 信誉列表配置失败: %w", err)
+	}
+	if err := listSiteCursor.All(ctx, &result.IPListPolicies); err != nil {
+		return nil, fmt.Errorf("解析站点 IP 信誉列表配置失败: %w", err)
+	}
+
+	names := make([]string, 0)
+	for _, site := range result.IPListPolicies {
+		for _, name := range site.IPLists {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) > 0 {
+		listOpts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+		if !withEntries {
+			listOpts.SetProjection(bson.D{{Key: "entries", Value: 0}})
+		}
+		var list model.IPList
+		listCursor, err := db.Collection(list.GetCollectionName()).Find(ctx,
+			bson.D{{Key: "name", Value: bson.D{{Key: "$in", Value: names}}}},
+			listOpts,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("查询 IP 信誉列表失败: %w", err)
+		}
+		if err := listCursor.All(ctx, &result.IPLists); err != nil {
+			return nil, fmt.Errorf("解析 IP 信誉列表失败: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// CompiledRuleSet 编译后的站点策略，所有应用共用
+type CompiledRuleSet struct {
+	rules      []model.Rule
+	exclusions []model.RuleExclusion
+	beforeCRS  string
+	afterCRS   string
+	body       seclang.CompiledBodyInspection
+}
+
+// Compile 编译站点的请求体检测、国家访问策略和 IP 信誉列表，列表数据文件写入 ipListDir
+func (r *RuleSet) Compile(ipListDir string) (*CompiledRuleSet, error) {
+	body, err := seclang.CompileBodyInspection(r.BodyInspections)
+	if err != nil {
+		return nil, fmt.Errorf("编译请求体检测配置失败: %w", err)
+	}
+
+	geoPolicies, err := seclang.CompileGeoPolicies(r.GeoPolicies)
+	if err != nil {
+		return nil, fmt.Errorf("编译国家访问策略失败: %w", err)
+	}
+
+	ipListFiles, err := seclang.WriteIPListFiles(ipListDir, r.IPLists)
+	if err != nil {
+		return nil, fmt.Errorf("写入 IP 信誉列表失败: %w", err)
+	}
+	ipListPolicies, err := seclang.CompileIPListPolicies(r.IPListPolicies, ipListFiles)
+	if err != nil {
+		return nil, fmt.Errorf("编译 IP 信誉列表策略失败: %w", err)
+	}
+
+	return &CompiledRuleSet{
+		rules:      r.Rules,
+		exclusions: r.Exclusions,
+		// 协议识别、国家访问策略、IP 信誉列表和请求体检测规则在 CRS 之前生效，超限或被拒绝的请求不再经过 CRS 检测
+		beforeCRS: seclang.ProtocolDirectives() + geoPolicies + ipListPolicies + body.BeforeCRS,
+		afterCRS:  body.AfterCRS,
+		body:      body,
+	}, nil
+}
+
+// Directives 组装应用最终加载的指令：按固定顺序组装 CRS、全局规则、站点规则、规则排除，再注入站点策略
+func (c *CompiledRuleSet) Directives(base string) (string, error) {
+	directives, err := seclang.Assemble(base, c.rules, c.exclusions)
+	if err != nil {
+		return "", err
+	}
+	// 超限拒绝规则依赖基础指令中的 SecRequestBodyLimitAction，按应用生成
+	return seclang.InjectDirectives(directives, c.beforeCRS+c.body.LimitDirectives(base), c.afterCRS), nil
+}
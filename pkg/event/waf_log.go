@@ -0,0 +1,93 @@
+package event
+
+import (
+	"sync"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// WAFLogBroker 进程内的 WAF 日志发布订阅中心
+// 引擎以内嵌方式运行时，日志写入 MongoDB 后在这里发布，管理端直接订阅即可获得实时事件
+type WAFLogBroker struct {
+	mu          sync.RWMutex
+	subscribers map[uint64]chan model.WAFLog
+	nextID      uint64
+}
+
+// Subscription 一个订阅者
+type Subscription struct {
+	id     uint64
+	C      <-chan model.WAFLog
+	broker *WAFLogBroker
+	once   sync.Once
+}
+
+var (
+	defaultBroker     *WAFLogBroker
+	defaultBrokerOnce sync.Once
+)
+
+// DefaultWAFLogBroker 获取进程级别的默认日志发布订阅中心
+func DefaultWAFLogBroker() *WAFLogBroker {
+	defaultBrokerOnce.Do(func() {
+		defaultBroker = NewWAFLogBroker()
+	})
+	return defaultBroker
+}
+
+// NewWAFLogBroker 创建日志发布订阅中心
+func NewWAFLogBroker() *WAFLogBroker {
+	return &WAFLogBroker{
+		subscribers: make(map[uint64]chan model.WAFLog),
+	}
+}
+
+// Subscribe 订阅日志，buffer 为订阅通道缓冲大小
+func (b *WAFLogBroker) Subscribe(buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan model.WAFLog, buffer)
+
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	b.subscribers[id] = ch
+	b.mu.Unlock()
+
+	return &Subscription{id: id, C: ch, broker: b}
+}
+
+// Publish 非阻塞地向所有订阅者发布日志，消费过慢的订阅者会丢弃该条日志
+func (b *WAFLogBroker) Publish(log model.WAFLog) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- log:
+		default:
+		}
+	}
+}
+
+// SubscriberCount 当前订阅者数量
+func (b *WAFLogBroker) SubscriberCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscribers)
+}
+
+// Unsubscribe 取消订阅并关闭订阅通道，可重复调用
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.broker.mu.Lock()
+		ch := s.broker.subscribers[s.id]
+		delete(s.broker.subscribers, s.id)
+		s.broker.mu.Unlock()
+
+		if ch != nil {
+			close(ch)
+		}
+	})
+}
@@ -3,6 +3,7 @@ module github.com/HUAHUAI23/simple-waf/pkg
 go 1.24.1
 
 require (
+	github.com/oschwald/maxminddb-golang v1.13.1
 	github.com/rs/zerolog v1.33.0
 	go.mongodb.org/mongo-driver/v2 v2.1.0
 )
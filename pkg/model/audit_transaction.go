@@ -0,0 +1,100 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// AuditTransaction Coraza 审计日志按 SecAuditLogParts 拆分后的结构化记录
+// @Description 由 SecAuditEngine 选中的事务，各字段只在对应部分被 SecAuditLogParts 选中时填充
+type AuditTransaction struct {
+	ID            bson.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`                   // 记录唯一标识符
+	TransactionID string         `json:"transactionId" bson:"transactionId" example:"ABCDEF"` // A: 事务ID
+	Parts         string         `json:"parts" bson:"parts" example:"ABIJDEFHZ"`              // 记录的审计日志部分
+	Timestamp     time.Time      `json:"timestamp" bson:"timestamp"`                          // A: 事务开始时间
+	ClientIP      string         `json:"clientIp" bson:"clientIp" example:"192.168.1.1"`      // A: 客户端地址
+	ClientPort    int            `json:"clientPort" bson:"clientPort" example:"52134"`        // A: 客户端端口
+	HostIP        string         `json:"hostIp" bson:"hostIp" example:"10.0.0.1"`             // A: 服务端地址
+	HostPort      int            `json:"hostPort" bson:"hostPort" example:"443"`              // A: 服务端端口
+	ServerID      string         `json:"serverId" bson:"serverId"`                            // A: 服务名称
+	Interrupted   bool           `json:"interrupted" bson:"interrupted"`                      // 事务是否被中断
+	Request       AuditRequest   `json:"request" bson:"request"`                              // 请求信息
+	Response      AuditResponse  `json:"response" bson:"response"`                            // E、F: 响应信息
+	Producer      *AuditProducer `json:"producer,omitempty" bson:"producer,omitempty"`        // H: 审计日志尾部
+	Messages      []AuditMessage `json:"messages,omitempty" bson:"messages,omitempty"`        // K: 命中的规则
+	Bodies        []AuditBodyRef `json:"bodies,omitempty" bson:"bodies,omitempty"`            // 单独存储的请求体、响应体，只在并发模式下存在
+	CreatedAt     time.Time      `json:"createdAt" bson:"createdAt"`                          // 记录写入时间
+}
+
+// AuditRequest 审计日志中的请求信息
+type AuditRequest struct {
+	Method   string              `json:"method" bson:"method" example:"POST"`         // A: 请求方法
+	URI      string              `json:"uri" bson:"uri" example:"/login"`             // A: 请求 URI
+	Protocol string              `json:"protocol" bson:"protocol" example:"HTTP/1.1"` // A: 请求协议
+	Length   int32               `json:"length" bson:"length" example:"512"`          // A: 请求总长度
+	Headers  map[string][]string `json:"headers,omitempty" bson:"headers,omitempty"`  // B: 请求头
+	Body     string              `json:"body,omitempty" bson:"body,omitempty"`        // C、I: 请求体，并发模式下单独存储
+	Files    []AuditFile         `json:"files,omitempty" bson:"files,omitempty"`      // J: 上传文件
+}
+
+// AuditResponse 审计日志中的响应信息
+type AuditResponse struct {
+	Status  int                 `json:"status,omitempty" bson:"status,omitempty" example:"403"` // F: 响应状态码
+	Headers map[string][]string `json:"headers,omitempty" bson:"headers,omitempty"`             // F: 响应头
+	Body    string              `json:"body,omitempty" bson:"body,omitempty"`                   // E: 响应体，并发模式下单独存储
+}
+
+// AuditFile 通过 multipart/form-data 上传的文件
+type AuditFile struct {
+	Name string `json:"name" bson:"name"` // 文件名
+	Size int64  `json:"size" bson:"size"` // 文件大小
+	Mime string `json:"mime" bson:"mime"` // 按扩展名推断的 MIME 类型
+}
+
+// AuditProducer 审计日志尾部的引擎信息
+type AuditProducer struct {
+	Connector  string   `json:"connector" bson:"connector"`   // 连接器
+	Version    string   `json:"version" bson:"version"`       // 连接器版本
+	RuleEngine string   `json:"ruleEngine" bson:"ruleEngine"` // 规则引擎状态
+	Stopwatch  string   `json:"stopwatch" bson:"stopwatch"`   // 各阶段耗时
+	Rulesets   []string `json:"rulesets" bson:"rulesets"`     // 加载的规则集
+}
+
+// AuditMessage 审计日志中命中的规则
+type AuditMessage struct {
+	RuleID   int      `json:"ruleId" bson:"ruleId" example:"942100"` // 规则ID
+	Message  string   `json:"message" bson:"message"`                // 规则消息
+	Data     string   `json:"data" bson:"data"`                      // 规则 logdata
+	Severity int      `json:"severity" bson:"severity" example:"2"`  // 严重级别
+	File     string   `json:"file" bson:"file"`                      // 规则所在文件
+	Line     int      `json:"line" bson:"line"`                      // 规则所在行
+	Tags     []string `json:"tags,omitempty" bson:"tags,omitempty"`  // 规则标签
+	Raw      string   `json:"raw" bson:"raw"`                        // 规则原始定义
+}
+
+// AuditBodyRef 单独存储的消息体引用
+type AuditBodyRef struct {
+	Part     string `json:"part" bson:"part" example:"C"`                 // 所属审计日志部分：C 请求体，E 响应体
+	Size     int    `json:"size" bson:"size" example:"1048576"`           // 消息体字节数
+	Location string `json:"location,omitempty" bson:"location,omitempty"` // 写入文件时的文件路径，存储在 audit_body 集合时为空
+}
+
+// AuditBody 并发模式下单独存储的请求体或响应体，通过 transactionId 和 part 关联审计记录
+type AuditBody struct {
+	ID            bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	TransactionID string        `json:"transactionId" bson:"transactionId"` // 事务ID
+	Part          string        `json:"part" bson:"part"`                   // 所属审计日志部分
+	Content       string        `json:"content" bson:"content"`             // 消息体内容
+	CreatedAt     time.Time     `json:"createdAt" bson:"createdAt"`         // 写入时间
+}
+
+// GetCollectionName 返回审计记录对应的MongoDB集合名称
+func (a *AuditTransaction) GetCollectionName() string {
+	return "audit_transaction"
+}
+
+// GetCollectionName 返回单独存储的消息体对应的MongoDB集合名称
+func (b *AuditBody) GetCollectionName() string {
+	return "audit_body"
+}
@@ -0,0 +1,69 @@
+package model
+
+// 拦截页面模板中可以使用的占位符
+const (
+	BlockPagePlaceholderRequestID      = "{{requestId}}"      // 引擎事务ID，与防火墙日志中的 requestId 一致
+	BlockPagePlaceholderSupportContact = "{{supportContact}}" // 支持联系方式
+)
+
+// BlockPageMaxSize 单个模板的最大字节数，拦截响应由 HAProxy 直接返回，需要放入一个缓冲区
+const BlockPageMaxSize = 8 * 1024
+
+// DefaultBlockPageHTML 默认的 HTML 拦截页面
+const DefaultBlockPageHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>403 Forbidden</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #333; background: #f5f5f5; margin: 0; }
+main { max-width: 560px; margin: 12vh auto; padding: 32px; background: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0, 0, 0, .1); }
+h1 { font-size: 22px; margin-top: 0; }
+code { background: #f0f0f0; padding: 2px 6px; border-radius: 4px; }
+</style>
+</head>
+<body>
+<main>
+<h1>请求已被拦截</h1>
+<p>您的请求被 Web 应用防火墙识别为潜在威胁，已被拒绝。</p>
+<p>请求 ID：<code>{{requestId}}</code></p>
+<p>如果您认为这是误拦截，请将请求 ID 发送给：{{supportContact}}</p>
+</main>
+</body>
+</html>
+`
+
+// DefaultBlockPageJSON 默认的 JSON 拦截响应
+const DefaultBlockPageJSON = `{"code":403,"error":"forbidden","message":"request blocked by web application firewall","requestId":"{{requestId}}","support":"{{supportContact}}"}
+`
+
+// BlockPage 拦截页面配置，请求的 Accept 优先 JSON 时返回 JSON 模板，否则返回 HTML 模板
+// @Description 拦截响应模板，模板中可以使用 {{requestId}} 和 {{supportContact}} 占位符
+type BlockPage struct {
+	HTML           string `json:"html" bson:"html"`                                                    // HTML 模板，为空时使用上一级配置
+	JSON           string `json:"json" bson:"json"`                                                    // JSON 模板，为空时使用上一级配置
+	SupportContact string `json:"supportContact" bson:"supportContact" example:"security@example.com"` // 支持联系方式，为空时使用上一级配置
+}
+
+// WithDefaults 用 base 中的配置补全为空的字段
+func (p BlockPage) WithDefaults(base BlockPage) BlockPage {
+	if p.HTML == "" {
+		p.HTML = base.HTML
+	}
+	if p.JSON == "" {
+		p.JSON = base.JSON
+	}
+	if p.SupportContact == "" {
+		p.SupportContact = base.SupportContact
+	}
+	return p
+}
+
+// DefaultBlockPage 返回默认模板
+func DefaultBlockPage() BlockPage {
+	return BlockPage{
+		HTML: DefaultBlockPageHTML,
+		JSON: DefaultBlockPageJSON,
+	}
+}
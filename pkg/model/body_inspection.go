@@ -0,0 +1,42 @@
+package model
+
+// 请求体超出检测上限时的处理方式
+const (
+	BodyLimitActionProcessPartial = "process_partial" // 只检测上限以内的部分，请求继续转发
+	BodyLimitActionReject         = "reject"          // 直接拒绝，返回 413
+)
+
+const (
+	// BodyInspectionMaxBytes 请求体检测上限的最大值。请求体由 HAProxy 缓冲后通过 SPOE 发送给引擎，
+	// 引擎一帧最多接收 64KB，需要给请求头和其他参数预留空间
+	BodyInspectionMaxBytes = 48 * 1024
+
+	// BodyBufferHeadroom HAProxy 缓冲区中为请求头预留的空间
+	BodyBufferHeadroom = 16 * 1024
+)
+
+// BodyInspection 站点的请求体检测配置
+// @Description 控制 HAProxy 缓冲请求体的大小和引擎检测请求体的方式，未配置时使用引擎指令中的默认设置
+type BodyInspection struct {
+	Enabled          bool     `json:"enabled" bson:"enabled" example:"true"`                                                      // 是否检测请求体
+	MaxBytes         int64    `json:"maxBytes" bson:"maxBytes" example:"32768"`                                                   // 检测上限字节数，0 表示使用引擎默认的 SecRequestBodyLimit
+	LimitAction      string   `json:"limitAction" bson:"limitAction" example:"reject"`                                            // 超出上限时的处理方式：process_partial、reject
+	SkipContentTypes []string `json:"skipContentTypes,omitempty" bson:"skipContentTypes,omitempty" example:"multipart/form-data"` // 不检测请求体的 Content-Type 前缀
+}
+
+// RejectOversize 超出上限的请求体是否需要拒绝
+func (b *BodyInspection) RejectOversize() bool {
+	return b.Enabled && b.MaxBytes > 0 && b.LimitAction == BodyLimitActionReject
+}
+
+// SiteBodyInspection 引擎按 Host 生成请求体检测规则时读取的站点字段
+type SiteBodyInspection struct {
+	Domain         string          `bson:"domain"`
+	ListenPort     int             `bson:"listenPort"`
+	BodyInspection *BodyInspection `bson:"bodyInspection"`
+}
+
+// GetCollectionName 返回站点对应的MongoDB集合名称
+func (s *SiteBodyInspection) GetCollectionName() string {
+	return "site"
+}
@@ -0,0 +1,31 @@
+package model
+
+// 机器人识别结果写入的 TX 变量，规则可以通过 TX:bot_class 等变量引用，HAProxy 可以通过 txn.coraza.bot 引用分类
+const (
+	BotTXClass = "bot_class"
+	BotTXName  = "bot_name"
+	BotTXScore = "bot_score"
+)
+
+// 机器人分类，未识别为机器人的请求没有分类
+const (
+	BotClassVerified  = "verified"  // 通过反向和正向 DNS 验证的搜索引擎爬虫
+	BotClassFake      = "fake"      // 自称搜索引擎爬虫但未通过 DNS 验证
+	BotClassBad       = "bad"       // 已知的扫描器和恶意爬虫
+	BotClassHeadless  = "headless"  // 无头浏览器和浏览器自动化工具
+	BotClassAutomated = "automated" // HTTP 库、命令行工具和缺少 User-Agent 的请求
+)
+
+// BotInfo 机器人识别结果
+// @Description 引擎根据 User-Agent、客户端提示和 DNS 验证得到的机器人分类
+type BotInfo struct {
+	Class string `json:"class" bson:"class" example:"fake"`    // 分类：verified、fake、bad、headless、automated
+	Name  string `json:"name" bson:"name" example:"googlebot"` // 识别出的机器人或工具名称
+	Score int    `json:"score" bson:"score" example:"5"`       // 可疑程度分数，规则可以按分数决定拦截或验证
+}
+
+// BotConfig 机器人识别配置
+type BotConfig struct {
+	Enabled        bool `bson:"enabled" json:"enabled"`               // 是否识别机器人
+	VerifyCrawlers bool `bson:"verifyCrawlers" json:"verifyCrawlers"` // 是否通过 DNS 验证自称搜索引擎爬虫的请求，关闭时不发起 DNS 查询，自称爬虫的请求不分类
+}
@@ -0,0 +1,37 @@
+package model
+
+const (
+	// ChallengeTXVariable 规则通过 setvar:tx.challenge=1 要求客户端先通过人机验证
+	ChallengeTXVariable = "challenge"
+	// ChallengeAction 引擎通过 SPOE 变量 txn.coraza.action 返回的验证动作
+	ChallengeAction = "challenge"
+	// ChallengePath 验证页面路径，HAProxy 将该路径和需要验证的请求转发给管理服务
+	ChallengePath = "/.well-known/simple-waf/challenge"
+	// ChallengeVerifyPath 提交验证结果的路径
+	ChallengeVerifyPath = ChallengePath + "/verify"
+	// ChallengeCookieName 验证通过后下发的签名 Cookie
+	ChallengeCookieName = "waf_clearance"
+	// ChallengeClientIPHeader HAProxy 转发验证请求时写入的客户端IP，与引擎看到的来源IP一致
+	ChallengeClientIPHeader = "X-WAF-Client-IP"
+	// ChallengeClientProtoHeader HAProxy 转发验证请求时写入的客户端协议（http 或 https），用于决定 Cookie 是否设置 Secure
+	ChallengeClientProtoHeader = "X-WAF-Client-Proto"
+)
+
+const (
+	DefaultChallengeTTL        = 1800 // 默认验证有效期（秒）
+	DefaultChallengeDifficulty = 16   // 默认工作量证明难度（前导零位数）
+	MaxChallengeDifficulty     = 24
+)
+
+// ChallengeConfig 人机验证配置，规则命中后客户端需要在浏览器中完成工作量证明，通过后在有效期内放行
+type ChallengeConfig struct {
+	Enabled    bool   `bson:"enabled" json:"enabled"`
+	Secret     string `bson:"secret" json:"-"`              // Cookie 签名密钥，管理服务和引擎共用
+	TTL        int    `bson:"ttl" json:"ttl"`               // 验证通过后的有效期（秒）
+	Difficulty int    `bson:"difficulty" json:"difficulty"` // 工作量证明难度，sha256 结果的前导零位数
+}
+
+// Active 是否启用验证，未生成签名密钥时不启用
+func (c ChallengeConfig) Active() bool {
+	return c.Enabled && c.Secret != ""
+}
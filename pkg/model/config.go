@@ -5,37 +5,83 @@ import (
 )
 
 type Config struct {
-	Name            string        `bson:"name" json:"name"`
-	Engine          EngineConfig  `bson:"engine" json:"engine"`
-	Haproxy         HaproxyConfig `bson:"haproxy" json:"haproxy"`
-	CreatedAt       time.Time     `bson:"createdAt" json:"createdAt"`
-	UpdatedAt       time.Time     `bson:"updatedAt" json:"updatedAt"`
-	IsResponseCheck bool          `bson:"isResponseCheck" json:"isResponseCheck"`
-	IsDebug         bool          `bson:"isDebug" json:"isDebug"`
+	Name            string          `bson:"name" json:"name"`
+	Engine          EngineConfig    `bson:"engine" json:"engine"`
+	Haproxy         HaproxyConfig   `bson:"haproxy" json:"haproxy"`
+	CreatedAt       time.Time       `bson:"createdAt" json:"createdAt"`
+	UpdatedAt       time.Time       `bson:"updatedAt" json:"updatedAt"`
+	IsResponseCheck bool            `bson:"isResponseCheck" json:"isResponseCheck"`
+	IsDebug         bool            `bson:"isDebug" json:"isDebug"`
+	LogRetention    LogRetention    `bson:"logRetention" json:"logRetention"`
+	Challenge       ChallengeConfig `bson:"challenge" json:"challenge"`
+	Bot             BotConfig       `bson:"bot" json:"bot"`
+	GeoIP           GeoIPConfig     `bson:"geoip" json:"geoip"`
 }
 
 type EngineConfig struct {
-	Bind            string      `bson:"bind" json:"bind"`
-	UseBuiltinRules bool        `bson:"useBuiltinRules" json:"useBuiltinRules"`
-	AppConfig       []AppConfig `bson:"appConfig" json:"appConfig"`
+	Bind            string           `bson:"bind" json:"bind"`
+	UseBuiltinRules bool             `bson:"useBuiltinRules" json:"useBuiltinRules"`
+	AppConfig       []AppConfig      `bson:"appConfig" json:"appConfig"`
+	ExternalOnly    bool             `bson:"externalOnly" json:"externalOnly"` // 只使用外部引擎实例，管理进程内不运行引擎
+	Balance         string           `bson:"balance" json:"balance"`           // 引擎实例间的负载均衡算法，为空时使用 roundrobin
+	Instances       []EngineInstance `bson:"instances" json:"instances"`       // 独立运行的 coraza-spoa 实例
+}
+
+// EngineInstance 独立运行的 coraza-spoa 实例
+type EngineInstance struct {
+	Name    string `bson:"name" json:"name"`
+	Address string `bson:"address" json:"address"`
+	Port    int    `bson:"port" json:"port"`
+	Weight  int    `bson:"weight" json:"weight"` // 为 0 时使用 HAProxy 默认权重
+	Enabled bool   `bson:"enabled" json:"enabled"`
 }
 
 type AppConfig struct {
-	Name           string        `bson:"name" json:"name"`
-	Directives     string        `bson:"directives" json:"directives"`
-	TransactionTTL time.Duration `bson:"transactionTTL" json:"transactionTTL"`
-	LogLevel       string        `bson:"logLevel" json:"logLevel"`
-	LogFile        string        `bson:"logFile" json:"logFile"`
-	LogFormat      string        `bson:"logFormat" json:"logFormat"`
+	Name              string        `bson:"name" json:"name"`
+	Directives        string        `bson:"directives" json:"directives"`
+	TransactionTTL    time.Duration `bson:"transactionTTL" json:"transactionTTL"`
+	LogLevel          string        `bson:"logLevel" json:"logLevel"`
+	LogFile           string        `bson:"logFile" json:"logFile"`
+	LogFormat         string        `bson:"logFormat" json:"logFormat"`
+	LogPolicy         string        `bson:"logPolicy" json:"logPolicy"`                 // 防火墙日志记录策略，为空时使用 interrupted
+	LogScoreThreshold int           `bson:"logScoreThreshold" json:"logScoreThreshold"` // anomaly 策略下记录日志的异常分数，为 0 时使用 CRS 阻断阈值
 }
 
+// 防火墙日志记录策略
+const (
+	// LogPolicyInterrupted 只记录被中断的事务
+	LogPolicyInterrupted = "interrupted"
+	// LogPolicyMatched 记录所有命中带 log 动作规则的事务，包括检测模式和 pass 规则
+	LogPolicyMatched = "matched"
+	// LogPolicyAnomaly 记录被中断或异常分数达到阈值的事务
+	LogPolicyAnomaly = "anomaly"
+)
+
 type HaproxyConfig struct {
-	ConfigBaseDir string `bson:"configBaseDir" json:"configBaseDir"`
-	HaproxyBin    string `bson:"haproxyBin" json:"haproxyBin"`
-	BackupsNumber int    `bson:"backupsNumber" json:"backupsNumber"`
-	SpoeAgentAddr string `bson:"spoeAgentAddr" json:"spoeAgentAddr"`
-	SpoeAgentPort int    `bson:"spoeAgentPort" json:"spoeAgentPort"`
-	Thread        int    `bson:"thread" json:"thread"`
+	ConfigBaseDir string    `bson:"configBaseDir" json:"configBaseDir"`
+	HaproxyBin    string    `bson:"haproxyBin" json:"haproxyBin"`
+	BackupsNumber int       `bson:"backupsNumber" json:"backupsNumber"`
+	SpoeAgentAddr string    `bson:"spoeAgentAddr" json:"spoeAgentAddr"`
+	SpoeAgentPort int       `bson:"spoeAgentPort" json:"spoeAgentPort"`
+	Thread        int       `bson:"thread" json:"thread"`
+	HardStopAfter int       `bson:"hardStopAfter" json:"hardStopAfter"` // 软停止后等待连接结束的最长秒数，超过后强制关闭，为 0 时不限制
+	BlockPage     BlockPage `bson:"blockPage" json:"blockPage"`         // 全局拦截页面，站点未配置时使用
+}
+
+type LogRetention struct {
+	Enabled        bool   `bson:"enabled" json:"enabled"`
+	RetentionDays  int    `bson:"retentionDays" json:"retentionDays"`
+	ArchiveEnabled bool   `bson:"archiveEnabled" json:"archiveEnabled"`
+	ArchiveDir     string `bson:"archiveDir" json:"archiveDir"`
+}
+
+// ExpireAfter 返回 TTL 索引的过期时间，启用归档时额外保留一天，保证归档任务先于 TTL 删除执行
+func (r LogRetention) ExpireAfter() time.Duration {
+	expire := time.Duration(r.RetentionDays) * 24 * time.Hour
+	if r.ArchiveEnabled {
+		expire += 24 * time.Hour
+	}
+	return expire
 }
 
 func (c *Config) GetCollectionName() string {
@@ -0,0 +1,51 @@
+package model
+
+// 引擎在规则执行前写入 GEO 集合的字段，规则可以通过 GEO:COUNTRY_CODE 等变量引用
+const (
+	GeoCountryCode = "country_code"
+	GeoASN         = "asn"
+	GeoASOrg       = "asn_org"
+)
+
+// 站点国家访问策略
+const (
+	GeoPolicyAllow = "allow" // 只允许列表中的国家访问
+	GeoPolicyDeny  = "deny"  // 拒绝列表中的国家访问
+)
+
+// GeoPolicyMaxCountries 单个站点最多配置的国家数量
+const GeoPolicyMaxCountries = 300
+
+// GeoInfo 来源IP的地理位置信息
+// @Description 引擎使用离线 GeoIP 数据库查询的来源IP国家和自治系统
+type GeoInfo struct {
+	Country string `json:"country,omitempty" bson:"country,omitempty" example:"US"` // ISO 3166-1 两位国家代码
+	ASN     uint   `json:"asn,omitempty" bson:"asn,omitempty" example:"15169"`      // 自治系统号
+	ASOrg   string `json:"asOrg,omitempty" bson:"asOrg,omitempty" example:"GOOGLE"` // 自治系统所属组织
+}
+
+// GeoIPConfig GeoIP 数据库配置，数据库文件为 MaxMind mmdb 格式，文件更新后自动重新加载
+type GeoIPConfig struct {
+	Enabled   bool   `bson:"enabled" json:"enabled"`     // 是否查询来源IP的地理位置
+	CountryDB string `bson:"countryDB" json:"countryDB"` // 国家或城市数据库路径，如 GeoLite2-Country.mmdb
+	ASNDB     string `bson:"asnDB" json:"asnDB"`         // ASN 数据库路径，如 GeoLite2-ASN.mmdb，为空时不查询 ASN
+}
+
+// GeoPolicy 站点国家访问策略，来源IP的国家未知时不拦截
+// @Description 按来源IP所属国家允许或拒绝访问站点
+type GeoPolicy struct {
+	Mode      string   `json:"mode" bson:"mode" example:"deny"`            // 策略：allow 只允许列表中的国家，deny 拒绝列表中的国家
+	Countries []string `json:"countries" bson:"countries" example:"CN,RU"` // ISO 3166-1 两位国家代码
+}
+
+// SiteGeoPolicy 引擎按 Host 生成国家访问策略规则时读取的站点字段
+type SiteGeoPolicy struct {
+	Domain     string     `bson:"domain"`
+	ListenPort int        `bson:"listenPort"`
+	GeoPolicy  *GeoPolicy `bson:"geoPolicy"`
+}
+
+// GetCollectionName 返回站点对应的MongoDB集合名称
+func (s *SiteGeoPolicy) GetCollectionName() string {
+	return "site"
+}
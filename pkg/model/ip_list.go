@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// IPListMaxEntries 单个 IP 信誉列表合并后的最大条目数，避免文档超过 MongoDB 的大小限制
+const IPListMaxEntries = 200000
+
+// IPList IP 信誉列表，由引用同一列表名称的威胁情报源合并去重生成
+// @Description 合并去重后的 CIDR 列表，站点引用列表后来源IP命中时拒绝请求
+type IPList struct {
+	ID        bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`                         // 记录ID
+	Name      string        `json:"name" bson:"name" example:"firehol-level1"`                 // 列表名称
+	Entries   []string      `json:"-" bson:"entries"`                                          // 排序去重后的 CIDR，被更大网段包含的条目已合并
+	Count     int           `json:"count" bson:"count" example:"4500"`                         // 条目数
+	Digest    string        `json:"digest" bson:"digest"`                                      // 条目摘要，用于判断列表是否变化
+	Feeds     []string      `json:"feeds" bson:"feeds" example:"firehol-level1"`               // 来源情报源名称
+	UpdatedAt time.Time     `json:"updatedAt" bson:"updatedAt" example:"2024-03-18T08:00:00Z"` // 最近一次内容变化的时间
+}
+
+// GetCollectionName 返回集合名称
+func (l *IPList) GetCollectionName() string {
+	return "ip_list"
+}
+
+// SiteIPListPolicy 引擎按 Host 生成 IP 信誉列表规则时读取的站点字段
+type SiteIPListPolicy struct {
+	Domain     string   `bson:"domain"`
+	ListenPort int      `bson:"listenPort"`
+	IPLists    []string `bson:"ipLists"`
+}
+
+// GetCollectionName 返回站点对应的MongoDB集合名称
+func (s *SiteIPListPolicy) GetCollectionName() string {
+	return "site"
+}
@@ -0,0 +1,43 @@
+package model
+
+// ReplayInput 回放输入，Request/Response 使用与 WAFLog.Request 相同的文本格式
+type ReplayInput struct {
+	Request  string `json:"request" example:"GET /index.php?id=1' OR '1'='1 HTTP/1.1\nHost: example.com\nUser-Agent: curl/8.0"` // 原始HTTP请求
+	Response string `json:"response,omitempty" example:"HTTP/1.1 200 OK\nContent-Type: text/html\n\n<html></html>"`             // 原始HTTP响应（可选）
+	SrcIP    string `json:"srcIp,omitempty" example:"192.168.1.1"`                                                              // 来源IP地址
+	SrcPort  int    `json:"srcPort,omitempty" example:"52134"`                                                                  // 来源端口
+	DstIP    string `json:"dstIp,omitempty" example:"10.0.0.1"`                                                                 // 目标IP地址
+	DstPort  int    `json:"dstPort,omitempty" example:"443"`                                                                    // 目标端口
+}
+
+// ReplayInterruption 回放中断信息
+type ReplayInterruption struct {
+	RuleID int    `json:"ruleId" example:"949110"` // 触发中断的规则ID
+	Action string `json:"action" example:"deny"`   // 中断动作
+	Status int    `json:"status" example:"403"`    // 返回状态码
+	Data   string `json:"data,omitempty"`          // 附加数据
+}
+
+// ReplayMatchedRule 回放命中的规则
+type ReplayMatchedRule struct {
+	RuleID     int      `json:"ruleId" example:"942100"`                                           // 规则ID
+	Phase      int      `json:"phase" example:"2"`                                                 // 处理阶段
+	Severity   int      `json:"severity" example:"2"`                                              // 严重级别(0-7)
+	Message    string   `json:"message" example:"SQL Injection Attack Detected via libinjection"`  // 规则消息
+	Data       string   `json:"data,omitempty" example:"Matched Data: s&sos found within ARGS:id"` // 匹配数据
+	Tags       []string `json:"tags,omitempty"`                                                    // 规则标签
+	Disruptive bool     `json:"disruptive"`                                                        // 是否为中断动作
+}
+
+// ReplayResult 回放结果
+type ReplayResult struct {
+	RequestID            string              `json:"requestId" example:"REPLAYABCDEFGHIJ"` // 回放事务ID
+	Interrupted          bool                `json:"interrupted"`                          // 是否被拦截
+	Interruption         *ReplayInterruption `json:"interruption,omitempty"`               // 中断信息
+	MatchedRules         []ReplayMatchedRule `json:"matchedRules"`                         // 命中的规则
+	InboundAnomalyScore  int                 `json:"inboundAnomalyScore" example:"10"`     // 请求异常分数
+	OutboundAnomalyScore int                 `json:"outboundAnomalyScore" example:"0"`     // 响应异常分数
+	InboundThreshold     int                 `json:"inboundThreshold" example:"5"`         // 请求异常分数阈值
+	OutboundThreshold    int                 `json:"outboundThreshold" example:"4"`        // 响应异常分数阈值
+	ResponseChecked      bool                `json:"responseChecked"`                      // 是否执行了响应阶段检测
+}
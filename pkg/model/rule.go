@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RuleScope 自定义规则的生效范围，Domains 为空表示对所有站点生效
+type RuleScope struct {
+	Domains []string `json:"domains,omitempty" bson:"domains,omitempty" example:"api.example.com"` // 生效域名列表
+}
+
+// IsGlobal 是否为全局规则
+func (s RuleScope) IsGlobal() bool {
+	return len(s.Domains) == 0
+}
+
+// Rule 自定义 SecLang 规则
+// @Description 结构化管理的自定义规则，按固定顺序组装进引擎指令：CRS 规则、全局规则、站点规则
+type Rule struct {
+	ID          bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`                                                                                 // 记录ID
+	RuleID      int           `json:"ruleId" bson:"ruleId" example:"100001"`                                                                             // SecLang 规则ID
+	Name        string        `json:"name" bson:"name" example:"block-admin-path"`                                                                       // 规则名称
+	Description string        `json:"description" bson:"description" example:"禁止访问后台路径"`                                                                 // 规则描述
+	SecLang     string        `json:"secLang" bson:"secLang" example:"SecRule REQUEST_URI \"@beginsWith /admin\" \"id:100001,phase:1,deny,status:403\""` // 规则内容
+	Phase       int           `json:"phase" bson:"phase" example:"1"`                                                                                    // 规则执行阶段，从规则内容解析
+	Priority    int           `json:"priority" bson:"priority" example:"0"`                                                                              // 同一分组内的排序，越小越靠前
+	Enabled     bool          `json:"enabled" bson:"enabled" example:"true"`                                                                             // 是否启用
+	Tags        []string      `json:"tags,omitempty" bson:"tags,omitempty" example:"custom"`                                                             // 标签
+	Scope       RuleScope     `json:"scope" bson:"scope"`                                                                                                // 生效范围
+	CreatedBy   string        `json:"createdBy" bson:"createdBy"`                                                                                        // 创建人
+	UpdatedBy   string        `json:"updatedBy" bson:"updatedBy"`                                                                                        // 最后修改人
+	CreatedAt   time.Time     `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time     `json:"updatedAt" bson:"updatedAt"`
+}
+
+// GetCollectionName 返回集合名称
+func (r *Rule) GetCollectionName() string {
+	return "rule"
+}
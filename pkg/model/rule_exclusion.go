@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ExclusionType 规则排除类型
+type ExclusionType string
+
+const (
+	ExclusionRemoveRule   ExclusionType = "remove_rule"   // 禁用整条规则
+	ExclusionRemoveTarget ExclusionType = "remove_target" // 从规则中移除检测目标
+)
+
+// ExclusionScope 规则排除的生效范围，字段为空表示不限制
+type ExclusionScope struct {
+	Domain string `json:"domain,omitempty" bson:"domain,omitempty" example:"api.example.com"` // 生效域名
+	Path   string `json:"path,omitempty" bson:"path,omitempty" example:"/api/v1/upload"`      // 生效路径前缀
+}
+
+// IsGlobal 是否为全局生效
+func (s ExclusionScope) IsGlobal() bool {
+	return s.Domain == "" && s.Path == ""
+}
+
+// RuleExclusion 规则排除（误报处理），编译为 SecRuleUpdateTargetById/SecRuleRemoveById 或 ctl 指令
+// @Description 结构化的规则排除配置，用于处理误报
+type RuleExclusion struct {
+	ID          bson.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`                               // 排除ID
+	RuleID      int            `json:"ruleId" bson:"ruleId" example:"942100"`                           // 目标规则ID
+	Type        ExclusionType  `json:"type" bson:"type" example:"remove_target"`                        // 排除类型
+	Target      string         `json:"target,omitempty" bson:"target,omitempty" example:"ARGS:content"` // 需移除的检测目标，仅 remove_target 使用
+	Scope       ExclusionScope `json:"scope" bson:"scope"`                                              // 生效范围
+	Reason      string         `json:"reason,omitempty" bson:"reason,omitempty" example:"富文本编辑器误报"`     // 排除原因
+	SourceLogID bson.ObjectID  `json:"sourceLogId,omitempty" bson:"sourceLogId,omitempty"`              // 来源WAF日志ID
+	Revoked     bool           `json:"revoked" bson:"revoked"`                                          // 是否已撤销
+	RevokedBy   string         `json:"revokedBy,omitempty" bson:"revokedBy,omitempty"`                  // 撤销人
+	RevokedAt   *time.Time     `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`                  // 撤销时间
+	CreatedBy   string         `json:"createdBy" bson:"createdBy"`                                      // 创建人
+	CreatedAt   time.Time      `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt" bson:"updatedAt"`
+}
+
+// GetCollectionName 返回集合名称
+func (e *RuleExclusion) GetCollectionName() string {
+	return "rule_exclusion"
+}
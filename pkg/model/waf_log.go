@@ -31,8 +31,44 @@ type WAFLog struct {
 	Request    string        `json:"request" bson:"request" example:"GET /api/v1/users HTTP/1.1\nHost: api.example.com\nUser-Agent: Scanner/1.0"`                           // 原始HTTP请求
 	Response   string        `json:"response" bson:"response" example:"HTTP/1.1 403 Forbidden\nContent-Type: text/html\nContent-Length: 146"`                               // 原始HTTP响应
 	CreatedAt  time.Time     `json:"createdAt" bson:"createdAt" example:"2024-03-18T08:12:33Z"`                                                                             // 事件发生时间戳
+
+	AnomalyScore AnomalyScore `json:"anomalyScore" bson:"anomalyScore"`       // CRS 异常评分
+	Action       string       `json:"action" bson:"action" example:"blocked"` // 实际执行的动作：blocked、redirected、dropped、observed、challenged，旧日志为空时视为 blocked
+	Bot          *BotInfo     `json:"bot,omitempty" bson:"bot,omitempty"`     // 机器人识别结果，未识别为机器人时为空
+	Geo          *GeoInfo     `json:"geo,omitempty" bson:"geo,omitempty"`     // 来源IP的地理位置，未启用 GeoIP 或查询不到时为空
 }
 
+// WAF 日志记录的实际动作
+const (
+	WAFLogActionBlocked    = "blocked"    // 请求被拒绝
+	WAFLogActionRedirected = "redirected" // 请求被重定向
+	WAFLogActionDropped    = "dropped"    // 连接被断开
+	WAFLogActionObserved   = "observed"   // 只检测未拦截
+	WAFLogActionChallenged = "challenged" // 客户端需要先通过人机验证
+)
+
+// AnomalyScore CRS 异常评分
+// @Description 事务结束前从 TX 变量读取的 CRS 异常分数及各攻击类别的累计分数，用于判断请求离阻断阈值的距离
+type AnomalyScore struct {
+	Inbound           int `json:"inbound" bson:"inbound" example:"10"`                    // 入站异常分数
+	Outbound          int `json:"outbound" bson:"outbound" example:"0"`                   // 出站异常分数
+	InboundThreshold  int `json:"inboundThreshold" bson:"inboundThreshold" example:"5"`   // 入站阻断阈值
+	OutboundThreshold int `json:"outboundThreshold" bson:"outboundThreshold" example:"4"` // 出站阻断阈值
+	ParanoiaLevel     int `json:"paranoiaLevel" bson:"paranoiaLevel" example:"1"`         // 阻断使用的偏执级别
+
+	SQLi            int `json:"sqli" bson:"sqli" example:"10"`                      // SQL 注入
+	XSS             int `json:"xss" bson:"xss" example:"0"`                         // 跨站脚本
+	RCE             int `json:"rce" bson:"rce" example:"0"`                         // 远程命令执行
+	LFI             int `json:"lfi" bson:"lfi" example:"0"`                         // 本地文件包含
+	RFI             int `json:"rfi" bson:"rfi" example:"0"`                         // 远程文件包含
+	PHP             int `json:"php" bson:"php" example:"0"`                         // PHP 注入
+	SessionFixation int `json:"sessionFixation" bson:"sessionFixation" example:"0"` // 会话固定
+	HTTPViolation   int `json:"httpViolation" bson:"httpViolation" example:"0"`     // HTTP 协议违规
+}
+
+// AnomalyCategories 异常评分中的攻击类别，值为 bson 字段名
+var AnomalyCategories = []string{"sqli", "xss", "rce", "lfi", "rfi", "php", "sessionFixation", "httpViolation"}
+
 // Log 表示单个日志条目
 // @Description 详细的WAF规则匹配记录，包含规则触发的详细信息和原始日志
 type Log struct {
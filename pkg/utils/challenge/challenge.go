@@ -0,0 +1,106 @@
+// Package challenge 实现人机验证的题目、验证结果和放行 Cookie 的签名与校验，管理服务和引擎共用
+package challenge
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/bits"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewSecret 生成签名密钥
+func NewSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewToken 生成工作量证明题目，格式为 过期时间.随机数.签名，签名绑定客户端IP和 User-Agent
+func NewToken(secret, clientIP, userAgent string, expires time.Time) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	salt := base64.RawURLEncoding.EncodeToString(b)
+	return exp + "." + salt + "." + sign(secret, "token", clientIP, userAgentHash(userAgent), exp, salt)
+}
+
+// VerifySolution 校验题目的签名和有效期，并检查 sha256(token + nonce) 的前导零位数是否达到难度。
+// 题目是否已被使用由调用方判断
+func VerifySolution(secret, token, nonce, clientIP, userAgent string, difficulty int, now time.Time) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || nonce == "" || len(nonce) > 32 || expired(parts[0], now) {
+		return false
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(secret, "token", clientIP, userAgentHash(userAgent), parts[0], parts[1]))) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token + nonce))
+	return leadingZeroBits(sum[:]) >= difficulty
+}
+
+// TokenExpires 返回题目的过期时间，格式错误时返回零值
+func TokenExpires(token string) time.Time {
+	exp, _, _ := strings.Cut(token, ".")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0)
+}
+
+// NewClearance 生成验证通过后的放行 Cookie 值，格式为 过期时间.签名，签名绑定客户端IP、User-Agent 和站点
+func NewClearance(secret, clientIP, userAgent, host string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + sign(secret, "clearance", clientIP, userAgentHash(userAgent), normalizeHost(host), exp)
+}
+
+// VerifyClearance 校验放行 Cookie 的签名和有效期
+func VerifyClearance(secret, value, clientIP, userAgent, host string, now time.Time) bool {
+	exp, mac, ok := strings.Cut(value, ".")
+	if !ok || expired(exp, now) {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(sign(secret, "clearance", clientIP, userAgentHash(userAgent), normalizeHost(host), exp)))
+}
+
+func sign(secret string, parts ...string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strings.Join(parts, "|")))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func expired(exp string, now time.Time) bool {
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	return err != nil || now.Unix() > unix
+}
+
+// userAgentHash 返回 User-Agent 的摘要，避免签名内容随请求头长度增长
+func userAgentHash(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:8])
+}
+
+// normalizeHost 去掉 Host 中的端口并转为小写
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, v := range b {
+		if v != 0 {
+			return n + bits.LeadingZeros8(v)
+		}
+		n += 8
+	}
+	return n
+}
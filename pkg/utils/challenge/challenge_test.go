@@ -0,0 +1,100 @@
+package challenge
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	testSecret = "test-secret"
+	testIP     = "192.0.2.1"
+	testUA     = "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0"
+)
+
+// solve 暴力求解题目，测试使用较低难度
+func solve(token string, difficulty int) string {
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(token + nonce))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+func TestVerifySolution(t *testing.T) {
+	now := time.Now()
+	token := NewToken(testSecret, testIP, testUA, now.Add(time.Minute))
+	nonce := solve(token, 8)
+
+	tests := []struct {
+		name       string
+		secret     string
+		token      string
+		nonce      string
+		clientIP   string
+		userAgent  string
+		difficulty int
+		now        time.Time
+		want       bool
+	}{
+		{name: "valid", secret: testSecret, token: token, nonce: nonce, clientIP: testIP, userAgent: testUA, difficulty: 8, now: now, want: true},
+		{name: "wrong secret", secret: "other", token: token, nonce: nonce, clientIP: testIP, userAgent: testUA, difficulty: 8, now: now},
+		{name: "wrong ip", secret: testSecret, token: token, nonce: nonce, clientIP: "192.0.2.2", userAgent: testUA, difficulty: 8, now: now},
+		{name: "wrong user agent", secret: testSecret, token: token, nonce: nonce, clientIP: testIP, userAgent: "curl/8.0", difficulty: 8, now: now},
+		{name: "expired", secret: testSecret, token: token, nonce: nonce, clientIP: testIP, userAgent: testUA, difficulty: 8, now: now.Add(2 * time.Minute)},
+		{name: "insufficient work", secret: testSecret, token: token, nonce: nonce, clientIP: testIP, userAgent: testUA, difficulty: 64, now: now},
+		{name: "empty nonce", secret: testSecret, token: token, nonce: "", clientIP: testIP, userAgent: testUA, difficulty: 0, now: now},
+		{name: "tampered token", secret: testSecret, token: token + "x", nonce: nonce, clientIP: testIP, userAgent: testUA, difficulty: 0, now: now},
+		{name: "malformed token", secret: testSecret, token: "abc", nonce: nonce, clientIP: testIP, userAgent: testUA, difficulty: 0, now: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := VerifySolution(tt.secret, tt.token, tt.nonce, tt.clientIP, tt.userAgent, tt.difficulty, tt.now)
+			if got != tt.want {
+				t.Fatalf("VerifySolution() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenExpires(t *testing.T) {
+	expires := time.Unix(1700000000, 0)
+	if got := TokenExpires(NewToken(testSecret, testIP, testUA, expires)); !got.Equal(expires) {
+		t.Fatalf("TokenExpires() = %v, want %v", got, expires)
+	}
+	if got := TokenExpires("abc"); !got.IsZero() {
+		t.Fatalf("TokenExpires(malformed) = %v, want zero", got)
+	}
+}
+
+func TestVerifyClearance(t *testing.T) {
+	now := time.Now()
+	value := NewClearance(testSecret, testIP, testUA, "Example.com:8080", now.Add(time.Minute))
+
+	tests := []struct {
+		name      string
+		value     string
+		clientIP  string
+		userAgent string
+		host      string
+		now       time.Time
+		want      bool
+	}{
+		{name: "valid", value: value, clientIP: testIP, userAgent: testUA, host: "example.com", now: now, want: true},
+		{name: "wrong ip", value: value, clientIP: "192.0.2.2", userAgent: testUA, host: "example.com", now: now},
+		{name: "wrong user agent", value: value, clientIP: testIP, userAgent: "curl/8.0", host: "example.com", now: now},
+		{name: "wrong host", value: value, clientIP: testIP, userAgent: testUA, host: "other.example.com", now: now},
+		{name: "expired", value: value, clientIP: testIP, userAgent: testUA, host: "example.com", now: now.Add(2 * time.Minute)},
+		{name: "malformed", value: "abc", clientIP: testIP, userAgent: testUA, host: "example.com", now: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyClearance(testSecret, tt.value, tt.clientIP, tt.userAgent, tt.host, tt.now); got != tt.want {
+				t.Fatalf("VerifyClearance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Package geoip 读取 MaxMind mmdb 格式的离线数据库，查询IP的国家和自治系统，文件更新后可以在运行中重新加载
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// countryRecord 国家和城市数据库中使用的字段
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// asnRecord ASN 数据库中使用的字段
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// dbFile 一个数据库文件，读取到内存中使用，重新加载时旧的读取器可以继续被进行中的查询使用
+type dbFile struct {
+	path    string
+	reader  atomic.Pointer[maxminddb.Reader]
+	modTime time.Time
+	size    int64
+}
+
+// Database 国家和 ASN 数据库，可并发查询
+type Database struct {
+	country *dbFile
+	asn     *dbFile
+	mu      sync.Mutex // 重新加载同一时间只允许一次
+}
+
+// Open 打开数据库文件，asnPath 为空时不查询 ASN
+func Open(countryPath, asnPath string) (*Database, error) {
+	if countryPath == "" && asnPath == "" {
+		return nil, fmt.Errorf("未配置 GeoIP 数据库文件")
+	}
+	db := &Database{}
+	if countryPath != "" {
+		db.country = &dbFile{path: countryPath}
+	}
+	if asnPath != "" {
+		db.asn = &dbFile{path: asnPath}
+	}
+	if _, err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Reload 重新加载修改时间或大小发生变化的数据库文件，返回是否有文件被重新加载。
+// 加载失败时继续使用已加载的数据
+func (db *Database) Reload() (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	reloaded := false
+	for _, f := range []*dbFile{db.country, db.asn} {
+		if f == nil {
+			continue
+		}
+		changed, err := f.reload()
+		if err != nil {
+			return reloaded, err
+		}
+		reloaded = reloaded || changed
+	}
+	return reloaded, nil
+}
+
+func (f *dbFile) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("读取 GeoIP 数据库 %s 失败: %w", f.path, err)
+	}
+	if f.reader.Load() != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, fmt.Errorf("读取 GeoIP 数据库 %s 失败: %w", f.path, err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return false, fmt.Errorf("解析 GeoIP 数据库 %s 失败: %w", f.path, err)
+	}
+	f.reader.Store(reader)
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return true, nil
+}
+
+// Lookup 查询IP的国家和自治系统，私有地址或查询不到时返回 nil
+func (db *Database) Lookup(ip netip.Addr) *model.GeoInfo {
+	if db == nil || !ip.IsValid() {
+		return nil
+	}
+	addr := net.IP(ip.Unmap().AsSlice())
+
+	var info model.GeoInfo
+	if reader := db.country.load(); reader != nil {
+		var record countryRecord
+		if err := reader.Lookup(addr, &record); err == nil {
+			info.Country = record.Country.ISOCode
+			if info.Country == "" {
+				info.Country = record.RegisteredCountry.ISOCode
+			}
+		}
+	}
+	if reader := db.asn.load(); reader != nil {
+		var record asnRecord
+		if err := reader.Lookup(addr, &record); err == nil {
+			info.ASN = record.Number
+			info.ASOrg = record.Organization
+		}
+	}
+
+	if info == (model.GeoInfo{}) {
+		return nil
+	}
+	return &info
+}
+
+func (f *dbFile) load() *maxminddb.Reader {
+	if f == nil {
+		return nil
+	}
+	return f.reader.Load()
+}
@@ -3,17 +3,21 @@ package config
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/challenge"
 	"github.com/HUAHUAI23/simple-waf/server/constant"
 	"github.com/HUAHUAI23/simple-waf/server/utils/jwt"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // Global 全局配置实例
@@ -26,6 +30,9 @@ type Config struct {
 	Log          LogConfig
 	DBConfig     DBConfig
 	JWT          JWTConfig
+	LogStream    LogStreamConfig
+	ConfigWatch  ConfigWatchConfig
+	Challenge    ChallengeConfig
 }
 
 // DBConfig 数据库配置
@@ -40,6 +47,38 @@ type JWTConfig struct {
 	ExpirationHrs int
 }
 
+// LogStreamConfig 实时日志推送配置
+type LogStreamConfig struct {
+	Source string // 事件来源：embedded 使用进程内发布订阅，changestream 使用 MongoDB 变更流
+}
+
+// 实时日志事件来源
+const (
+	LogStreamSourceEmbedded     = "embedded"
+	LogStreamSourceChangeStream = "changestream"
+)
+
+// ConfigWatchConfig 配置变更自动重载配置
+type ConfigWatchConfig struct {
+	Enabled      bool          // 是否监听配置、站点和证书的变更并自动重载
+	Mode         string        // 监听方式：auto 优先使用变更流、不可用时轮询，changestream 只使用变更流，poll 只使用轮询
+	Debounce     time.Duration // 合并连续变更的等待时间
+	PollInterval time.Duration // 轮询间隔
+}
+
+// 配置变更监听方式
+const (
+	ConfigWatchModeAuto         = "auto"
+	ConfigWatchModeChangeStream = "changestream"
+	ConfigWatchModePoll         = "poll"
+)
+
+// ChallengeConfig 人机验证配置
+type ChallengeConfig struct {
+	// TrustedProxies 可信代理地址，只有来自这些地址的请求才使用 HAProxy 写入的客户端IP和协议请求头
+	TrustedProxies []netip.Prefix
+}
+
 // InitConfig 从环境变量初始化配置
 func InitConfig() error {
 	// 加载.env文件
@@ -66,6 +105,22 @@ func InitConfig() error {
 			Secret:        "default-jwt-secret-key",
 			ExpirationHrs: 24,
 		},
+		LogStream: LogStreamConfig{
+			Source: LogStreamSourceEmbedded,
+		},
+		ConfigWatch: ConfigWatchConfig{
+			Enabled:      false,
+			Mode:         ConfigWatchModeAuto,
+			Debounce:     2 * time.Second,
+			PollInterval: 10 * time.Second,
+		},
+		Challenge: ChallengeConfig{
+			// HAProxy 默认与管理服务部署在同一主机
+			TrustedProxies: []netip.Prefix{
+				netip.MustParsePrefix("127.0.0.1/32"),
+				netip.MustParsePrefix("::1/128"),
+			},
+		},
 	}
 
 	// 从环境变量加载配置
@@ -106,6 +161,38 @@ func InitConfig() error {
 		}
 	}
 
+	// 实时日志推送配置
+	if env := os.Getenv("LOG_STREAM_SOURCE"); env != "" {
+		Global.LogStream.Source = env
+	}
+
+	// 配置变更自动重载
+	if env := os.Getenv("CONFIG_WATCH_ENABLED"); env != "" {
+		Global.ConfigWatch.Enabled = env == "true"
+	}
+	if env := os.Getenv("CONFIG_WATCH_MODE"); env != "" {
+		Global.ConfigWatch.Mode = env
+	}
+	if env := os.Getenv("CONFIG_WATCH_DEBOUNCE"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			Global.ConfigWatch.Debounce = d
+		}
+	}
+	if env := os.Getenv("CONFIG_WATCH_POLL_INTERVAL"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			Global.ConfigWatch.PollInterval = d
+		}
+	}
+
+	// 人机验证配置
+	if env := os.Getenv("CHALLENGE_TRUSTED_PROXIES"); env != "" {
+		proxies, err := parseTrustedProxies(env)
+		if err != nil {
+			return fmt.Errorf("invalid CHALLENGE_TRUSTED_PROXIES: %w", err)
+		}
+		Global.Challenge.TrustedProxies = proxies
+	}
+
 	// 初始化JWT
 	err = jwt.InitJWTSecret(Global.JWT.Secret)
 	if err != nil {
@@ -122,6 +209,32 @@ func InitConfig() error {
 	return nil
 }
 
+// parseTrustedProxies 解析逗号分隔的IP或CIDR列表，单个IP按主机地址处理
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
 func InitDB(db *mongo.Database) error {
 	// 检查配置集合是否存在
 	var cfg model.Config
@@ -148,6 +261,138 @@ func InitDB(db *mongo.Database) error {
 		Logger.Info().Int64("count", count).Msg("Found existing configuration documents in database, skip initialization")
 	}
 
+	// 根据配置中的日志保留策略创建 waf_log 索引
+	configName := constant.GetString("APP_CONFIG_NAME", "AppConfig")
+	err = configCollection.FindOne(ctx, bson.D{{Key: "name", Value: configName}}).Decode(&cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var wafLog model.WAFLog
+	if err = EnsureWAFLogIndexes(ctx, db.Collection(wafLog.GetCollectionName()), cfg.LogRetention); err != nil {
+		return fmt.Errorf("failed to ensure waf_log indexes: %w", err)
+	}
+
+	if err = EnsureAuditIndexes(ctx, db, cfg.LogRetention); err != nil {
+		return fmt.Errorf("failed to ensure audit indexes: %w", err)
+	}
+
+	return nil
+}
+
+// EnsureAuditIndexes 创建引擎审计日志写入器（SecAuditLogType mongo、mongo_concurrent）使用的集合索引，
+// 审计记录和消息体与 waf_log 使用相同的保留策略
+func EnsureAuditIndexes(ctx context.Context, db *mongo.Database, retention model.LogRetention) error {
+	var record model.AuditTransaction
+	transactions := db.Collection(record.GetCollectionName())
+	_, err := transactions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "transactionId", Value: 1}}},
+		{Keys: bson.D{{Key: "clientIp", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := ensureTTLIndex(ctx, transactions, retention); err != nil {
+		return err
+	}
+
+	// 消息体按事务ID和部分关联审计记录
+	var body model.AuditBody
+	bodies := db.Collection(body.GetCollectionName())
+	_, err = bodies.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "transactionId", Value: 1}, {Key: "part", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	return ensureTTLIndex(ctx, bodies, retention)
+}
+
+// logTTLIndexName 日志集合 createdAt 上的过期索引名称
+const logTTLIndexName = "createdAt_ttl"
+
+// EnsureWAFLogIndexes 创建 waf_log 查询所需的复合索引，并按保留策略维护 createdAt 上的 TTL 索引
+func EnsureWAFLogIndexes(ctx context.Context, collection *mongo.Collection, retention model.LogRetention) error {
+	// 与日志查询、聚合条件对应的复合索引
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "srcIp", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "ruleId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "anomalyScore.inbound", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "requestId", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create waf_log indexes: %w", err)
+	}
+
+	return ensureTTLIndex(ctx, collection, retention)
+}
+
+// ensureTTLIndex 按保留策略维护集合 createdAt 上的 TTL 索引，未启用保留策略时删除
+func ensureTTLIndex(ctx context.Context, collection *mongo.Collection, retention model.LogRetention) error {
+	name := collection.Name()
+
+	// 查找已存在的 TTL 索引
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list %s indexes: %w", name, err)
+	}
+	var indexes []bson.M
+	if err = cursor.All(ctx, &indexes); err != nil {
+		return fmt.Errorf("failed to decode %s indexes: %w", name, err)
+	}
+
+	var current bson.M
+	for _, index := range indexes {
+		if index["name"] == logTTLIndexName {
+			current = index
+			break
+		}
+	}
+
+	// 未启用保留策略时删除 TTL 索引
+	if !retention.Enabled || retention.RetentionDays <= 0 {
+		if current != nil {
+			if err := collection.Indexes().DropOne(ctx, logTTLIndexName); err != nil {
+				return fmt.Errorf("failed to drop %s ttl index: %w", name, err)
+			}
+			Logger.Info().Str("collection", name).Msg("retention disabled, ttl index dropped")
+		}
+		return nil
+	}
+
+	expireSeconds := int32(retention.ExpireAfter() / time.Second)
+
+	if current == nil {
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName(logTTLIndexName).SetExpireAfterSeconds(expireSeconds),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create %s ttl index: %w", name, err)
+		}
+		Logger.Info().Str("collection", name).Int32("expireAfterSeconds", expireSeconds).Msg("ttl index created")
+		return nil
+	}
+
+	// 已存在则通过 collMod 修改过期时间，避免重建索引
+	if existing, ok := current["expireAfterSeconds"]; ok && fmt.Sprint(existing) == fmt.Sprint(expireSeconds) {
+		return nil
+	}
+	err = collection.Database().RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: logTTLIndexName},
+			{Key: "expireAfterSeconds", Value: expireSeconds},
+		}},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to update %s ttl index: %w", name, err)
+	}
+	Logger.Info().Str("collection", name).Int32("expireAfterSeconds", expireSeconds).Msg("ttl index updated")
+
 	return nil
 }
 
@@ -181,8 +426,11 @@ SecRuleUpdateTargetById 933120 !ARGS:json.engine.appConfig.0.directives`,
 					LogLevel:       "info",
 					LogFile:        "/dev/stdout",
 					LogFormat:      "console",
+					LogPolicy:      model.LogPolicyInterrupted,
 				},
 			},
+			Balance:   "roundrobin",
+			Instances: []model.EngineInstance{},
 		},
 		Haproxy: model.HaproxyConfig{
 			ConfigBaseDir: "/simple-waf",
@@ -191,11 +439,33 @@ SecRuleUpdateTargetById 933120 !ARGS:json.engine.appConfig.0.directives`,
 			SpoeAgentAddr: "127.0.0.1",
 			SpoeAgentPort: 2342,
 			Thread:        0,
+			HardStopAfter: 30,
+			BlockPage:     model.DefaultBlockPage(),
+		},
+		Challenge: model.ChallengeConfig{
+			Secret:     challenge.NewSecret(),
+			TTL:        model.DefaultChallengeTTL,
+			Difficulty: model.DefaultChallengeDifficulty,
+		},
+		Bot: model.BotConfig{
+			Enabled:        true,
+			VerifyCrawlers: true,
+		},
+		GeoIP: model.GeoIPConfig{
+			Enabled:   false,
+			CountryDB: "/simple-waf/geoip/GeoLite2-Country.mmdb",
+			ASNDB:     "/simple-waf/geoip/GeoLite2-ASN.mmdb",
 		},
 		CreatedAt:       now,
 		UpdatedAt:       now,
 		IsResponseCheck: false,
 		IsDebug:         !Global.IsProduction,
+		LogRetention: model.LogRetention{
+			Enabled:        true,
+			RetentionDays:  30,
+			ArchiveEnabled: false,
+			ArchiveDir:     "/simple-waf/archive",
+		},
 	}
 }
 
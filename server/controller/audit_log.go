@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// AuditLogController 审计日志控制器接口
+type AuditLogController interface {
+	GetAuditLogs(ctx *gin.Context)
+}
+
+// AuditLogControllerImpl 审计日志控制器实现
+type AuditLogControllerImpl struct {
+	auditLogService service.AuditLogService
+	logger          zerolog.Logger
+}
+
+// NewAuditLogController 创建审计日志控制器
+func NewAuditLogController(auditLogService service.AuditLogService) AuditLogController {
+	logger := config.GetControllerLogger("audit_log")
+	return &AuditLogControllerImpl{
+		auditLogService: auditLogService,
+		logger:          logger,
+	}
+}
+
+// GetAuditLogs 获取审计日志列表
+//
+//	@Summary		获取审计日志列表
+//	@Description	分页获取用户敏感操作的审计记录，支持按操作类型、用户名和时间范围过滤
+//	@Tags			审计日志
+//	@Produce		json
+//	@Param			action		query	string	false	"操作类型，如: waf:log:export"
+//	@Param			username	query	string	false	"操作用户名"
+//	@Param			startTime	query	string	false	"查询起始时间 (ISO8601格式)"
+//	@Param			endTime		query	string	false	"查询结束时间 (ISO8601格式)"
+//	@Param			page		query	int		false	"页码"		default(1)
+//	@Param			size		query	int		false	"每页数量"	default(10)
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.AuditLogListResponse}	"获取审计日志成功"
+//	@Failure		400	{object}	model.ErrResponse										"请求参数错误"
+//	@Failure		401	{object}	model.ErrResponseDontShowError							"未授权访问"
+//	@Failure		500	{object}	model.ErrResponseDontShowError							"服务器内部错误"
+//	@Router			/api/v1/audit [get]
+func (c *AuditLogControllerImpl) GetAuditLogs(ctx *gin.Context) {
+	var req dto.AuditLogRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	result, err := c.auditLogService.GetAuditLogs(ctx, req)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取审计日志失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取审计日志成功", result)
+}
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ChallengeController 人机验证控制器接口，路由由 HAProxy 从被保护站点转发，不需要登录
+type ChallengeController interface {
+	Page(ctx *gin.Context)
+	Verify(ctx *gin.Context)
+}
+
+// ChallengeControllerImpl 人机验证控制器实现
+type ChallengeControllerImpl struct {
+	challengeService service.ChallengeService
+	logger           zerolog.Logger
+}
+
+// NewChallengeController 创建人机验证控制器
+func NewChallengeController(challengeService service.ChallengeService) ChallengeController {
+	logger := config.GetControllerLogger("challenge")
+	return &ChallengeControllerImpl{
+		challengeService: challengeService,
+		logger:           logger,
+	}
+}
+
+// Page 返回工作量证明验证页面
+//
+//	@Summary		获取人机验证页面
+//	@Description	引擎要求验证的请求由 HAProxy 改写到该页面，浏览器完成工作量证明后提交结果，通过后刷新原页面。题目绑定客户端IP和 User-Agent，有效期5分钟。只有来自可信代理（CHALLENGE_TRUSTED_PROXIES）的请求才使用 X-WAF-Client-IP 请求头
+//	@Tags			人机验证
+//	@Produce		html
+//	@Success		200	{string}	string							"验证页面"
+//	@Failure		404	{object}	model.ErrResponseDontShowError	"人机验证未启用"
+//	@Failure		500	{object}	model.ErrResponseDontShowError	"服务器内部错误"
+//	@Router			/.well-known/simple-waf/challenge [get]
+func (c *ChallengeControllerImpl) Page(ctx *gin.Context) {
+	task, err := c.challengeService.Issue(ctx, challengeClientIP(ctx), ctx.Request.UserAgent())
+	if err != nil {
+		c.handleError(ctx, err, "生成人机验证题目失败")
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	if err := challengePage.Execute(ctx.Writer, struct {
+		*dto.ChallengeTask
+		VerifyPath string
+	}{task, pkgmodel.ChallengeVerifyPath}); err != nil {
+		c.logger.Error().Err(err).Msg("渲染人机验证页面失败")
+	}
+}
+
+// Verify 校验工作量证明结果并下发放行 Cookie
+//
+//	@Summary		提交人机验证结果
+//	@Description	校验题目签名、有效期和工作量证明，每个题目只能通过一次。通过后下发绑定客户端IP、User-Agent 和站点的签名 Cookie，有效期内的请求不再要求验证，客户端使用 HTTPS 时 Cookie 设置 Secure
+//	@Tags			人机验证
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		dto.ChallengeVerifyRequest		true	"验证结果"
+//	@Success		200		{object}	model.SuccessResponse			"验证通过"
+//	@Failure		400		{object}	model.ErrResponse				"请求参数错误"
+//	@Failure		403		{object}	model.ErrResponse				"验证未通过"
+//	@Failure		404		{object}	model.ErrResponseDontShowError	"人机验证未启用"
+//	@Failure		500		{object}	model.ErrResponseDontShowError	"服务器内部错误"
+//	@Router			/.well-known/simple-waf/challenge/verify [post]
+func (c *ChallengeControllerImpl) Verify(ctx *gin.Context) {
+	var req dto.ChallengeVerifyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	value, maxAge, err := c.challengeService.Verify(ctx, challengeClientIP(ctx), ctx.Request.UserAgent(), ctx.Request.Host, &req)
+	if err != nil {
+		c.handleError(ctx, err, "校验人机验证结果失败")
+		return
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(pkgmodel.ChallengeCookieName, value, maxAge, "/", "", challengeSecure(ctx), true)
+	response.Success(ctx, "验证通过", nil)
+}
+
+func (c *ChallengeControllerImpl) handleError(ctx *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrChallengeDisabled):
+		response.NotFound(ctx, err)
+	case errors.Is(err, service.ErrChallengeFailed):
+		response.Forbidden(ctx, err)
+	default:
+		c.logger.Error().Err(err).Msg(msg)
+		response.InternalServerError(ctx, err, false)
+	}
+}
+
+// challengeClientIP 返回客户端IP。请求来自可信代理时使用 HAProxy 写入的客户端IP，
+// 与引擎校验放行 Cookie 时使用的来源IP一致，否则使用连接的来源地址
+func challengeClientIP(ctx *gin.Context) string {
+	remote := remoteAddr(ctx)
+	if trustedProxy(remote) {
+		if ip, err := netip.ParseAddr(ctx.GetHeader(pkgmodel.ChallengeClientIPHeader)); err == nil {
+			return ip.Unmap().String()
+		}
+	}
+	if remote.IsValid() {
+		return remote.String()
+	}
+	return ctx.Request.RemoteAddr
+}
+
+// challengeSecure 判断客户端是否使用 HTTPS 访问，请求来自可信代理时以 HAProxy 写入的协议为准
+func challengeSecure(ctx *gin.Context) bool {
+	if ctx.Request.TLS != nil {
+		return true
+	}
+	return trustedProxy(remoteAddr(ctx)) && ctx.GetHeader(pkgmodel.ChallengeClientProtoHeader) == "https"
+}
+
+// remoteAddr 返回连接的来源IP，解析失败时返回零值
+func remoteAddr(ctx *gin.Context) netip.Addr {
+	host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+	if err != nil {
+		host = ctx.Request.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// trustedProxy 判断来源地址是否为配置的可信代理
+func trustedProxy(addr netip.Addr) bool {
+	return addr.IsValid() && slices.ContainsFunc(config.Global.Challenge.TrustedProxies, func(prefix netip.Prefix) bool {
+		return prefix.Contains(addr)
+	})
+}
+
+// challengePage 验证页面。被保护站点可能只使用 HTTP，浏览器在非安全上下文中没有 crypto.subtle，
+// 因此页面内置 SHA-256 实现
+var challengePage = template.Must(template.New("challenge").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>安全验证</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #333; background: #f5f5f5; margin: 0; }
+main { max-width: 560px; margin: 12vh auto; padding: 32px; background: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0, 0, 0, .1); }
+h1 { font-size: 22px; margin-top: 0; }
+</style>
+</head>
+<body>
+<main>
+<h1>正在验证您的浏览器</h1>
+<p id="status">请稍候，验证完成后将自动返回页面。</p>
+<noscript><p>请启用 JavaScript 后刷新页面。</p></noscript>
+</main>
+<script>
+(function () {
+	var token = {{.Token}}, difficulty = {{.Difficulty}}, verifyPath = {{.VerifyPath}};
+	var K = [
+		0x428a2f98,0x71374491,0xb5c0fbcf,0xe9b5dba5,0x3956c25b,0x59f111f1,0x923f82a4,0xab1c5ed5,
+		0xd807aa98,0x12835b01,0x243185be,0x550c7dc3,0x72be5d74,0x80deb1fe,0x9bdc06a7,0xc19bf174,
+		0xe49b69c1,0xefbe4786,0x0fc19dc6,0x240ca1cc,0x2de92c6f,0x4a7484aa,0x5cb0a9dc,0x76f988da,
+		0x983e5152,0xa831c66d,0xb00327c8,0xbf597fc7,0xc6e00bf3,0xd5a79147,0x06ca6351,0x14292967,
+		0x27b70a85,0x2e1b2138,0x4d2c6dfc,0x53380d13,0x650a7354,0x766a0abb,0x81c2c92e,0x92722c85,
+		0xa2bfe8a1,0xa81a664b,0xc24b8b70,0xc76c51a3,0xd192e819,0xd6990624,0xf40e3585,0x106aa070,
+		0x19a4c116,0x1e376c08,0x2748774c,0x34b0bcb5,0x391c0cb3,0x4ed8aa4a,0x5b9cca4f,0x682e6ff3,
+		0x748f82ee,0x78a5636f,0x84c87814,0x8cc70208,0x90befffa,0xa4506ceb,0xbef9a3f7,0xc67178f2
+	];
+
+	function rotr(x, n) { return (x >>> n) | (x << (32 - n)); }
+
+	// sha256 计算 ASCII 字符串的摘要，返回 8 个 32 位整数
+	function sha256(msg) {
+		var H = [0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19];
+		var l = msg.length, n = ((l + 8) >> 6) + 1 << 4, w = new Array(n), W = new Array(64), i, t;
+		for (i = 0; i < n; i++) w[i] = 0;
+		for (i = 0; i < l; i++) w[i >> 2] |= msg.charCodeAt(i) << (24 - (i % 4) * 8);
+		w[l >> 2] |= 0x80 << (24 - (l % 4) * 8);
+		w[n - 1] = l * 8;
+		for (i = 0; i < n; i += 16) {
+			var a = H[0], b = H[1], c = H[2], d = H[3], e = H[4], f = H[5], g = H[6], h = H[7];
+			for (t = 0; t < 64; t++) {
+				if (t < 16) {
+					W[t] = w[i + t] | 0;
+				} else {
+					var s0 = rotr(W[t - 15], 7) ^ rotr(W[t - 15], 18) ^ (W[t - 15] >>> 3);
+					var s1 = rotr(W[t - 2], 17) ^ rotr(W[t - 2], 19) ^ (W[t - 2] >>> 10);
+					W[t] = (W[t - 16] + s0 + W[t - 7] + s1) | 0;
+				}
+				var t1 = (h + (rotr(e, 6) ^ rotr(e, 11) ^ rotr(e, 25)) + ((e & f) ^ (~e & g)) + K[t] + W[t]) | 0;
+				var t2 = ((rotr(a, 2) ^ rotr(a, 13) ^ rotr(a, 22)) + ((a & b) ^ (a & c) ^ (b & c))) | 0;
+				h = g; g = f; f = e; e = (d + t1) | 0; d = c; c = b; b = a; a = (t1 + t2) | 0;
+			}
+			H[0] = (H[0] + a) | 0; H[1] = (H[1] + b) | 0; H[2] = (H[2] + c) | 0; H[3] = (H[3] + d) | 0;
+			H[4] = (H[4] + e) | 0; H[5] = (H[5] + f) | 0; H[6] = (H[6] + g) | 0; H[7] = (H[7] + h) | 0;
+		}
+		return H;
+	}
+
+	function zeroBits(H) {
+		var n = 0;
+		for (var i = 0; i < H.length; i++) {
+			if (H[i] !== 0) return n + Math.clz32(H[i]);
+			n += 32;
+		}
+		return n;
+	}
+
+	function fail() {
+		document.getElementById("status").textContent = "验证失败，请刷新页面重试。";
+	}
+
+	var nonce = 0;
+	function work() {
+		for (var end = nonce + 5000; nonce < end; nonce++) {
+			if (zeroBits(sha256(token + nonce)) >= difficulty) {
+				var xhr = new XMLHttpRequest();
+				xhr.open("POST", verifyPath);
+				xhr.setRequestHeader("Content-Type", "application/json");
+				xhr.onload = function () {
+					if (xhr.status === 200) {
+						location.reload();
+					} else {
+						fail();
+					}
+				};
+				xhr.onerror = fail;
+				xhr.send(JSON.stringify({ token: token, nonce: String(nonce) }));
+				return;
+			}
+		}
+		setTimeout(work, 0);
+	}
+	work();
+})();
+</script>
+</body>
+</html>
+`))
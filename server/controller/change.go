@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ChangeController 待应用变更控制器接口
+type ChangeController interface {
+	GetPendingChanges(ctx *gin.Context)
+	ApplyChanges(ctx *gin.Context)
+}
+
+// ChangeControllerImpl 待应用变更控制器实现
+type ChangeControllerImpl struct {
+	changeService   service.ChangeService
+	auditLogService service.AuditLogService
+	logger          zerolog.Logger
+}
+
+// NewChangeController 创建待应用变更控制器
+func NewChangeController(changeService service.ChangeService, auditLogService service.AuditLogService) ChangeController {
+	logger := config.GetControllerLogger("change")
+	return &ChangeControllerImpl{
+		changeService:   changeService,
+		auditLogService: auditLogService,
+		logger:          logger,
+	}
+}
+
+// GetPendingChanges 获取待应用变更
+//
+//	@Summary		获取待应用变更
+//	@Description	列出上次生效以来保存的配置版本（已写入数据库，尚未热重载），并对比按当前数据生成的 haproxy.cfg、SPOE 配置与运行中的配置
+//	@Tags			配置变更
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.PendingChangesResponse}	"获取待应用变更成功"
+//	@Failure		500	{object}	model.ErrResponseDontShowError							"服务器内部错误"
+//	@Router			/api/v1/changes/pending [get]
+func (c *ChangeControllerImpl) GetPendingChanges(ctx *gin.Context) {
+	result, err := c.changeService.GetPendingChanges(ctx)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取待应用变更失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取待应用变更成功", result)
+}
+
+// ApplyChanges 应用待生效的变更
+//
+//	@Summary		应用配置变更
+//	@Description	站点和配置的修改保存后已写入数据库，应用即立即热重载：使用 haproxy -c 校验生成的配置后热重载，热重载失败时回滚 HAProxy 配置，并只撤销本次应用批次中修改过的资源（应用期间又被其他用户修改的资源保留最新修改）；服务未运行时只做校验，配置在下次启动时生效
+//	@Tags			配置变更
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.ApplyChangesResponse}	"应用配置变更成功"
+//	@Failure		400	{object}	model.ErrResponse										"配置未通过校验"
+//	@Failure		500	{object}	model.ErrResponse										"应用失败，已回滚"
+//	@Router			/api/v1/changes/apply [post]
+func (c *ChangeControllerImpl) ApplyChanges(ctx *gin.Context) {
+	result, err := c.changeService.ApplyChanges(ctx)
+
+	// 无论成功与否都记录审计日志
+	auditLog := &model.AuditLog{
+		Action:   model.AuditActionChangesApply,
+		ClientIP: ctx.ClientIP(),
+		Success:  err == nil,
+	}
+	if err != nil {
+		auditLog.Error = err.Error()
+	} else {
+		auditLog.Details = map[string]any{
+			"applied":    result.Applied,
+			"revisions":  result.Revisions,
+			"siteErrors": result.SiteErrors,
+		}
+	}
+	_ = c.auditLogService.Record(context.WithoutCancel(ctx), auditLog)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChangesInvalid):
+			response.BadRequest(ctx, err, true)
+		case errors.Is(err, service.ErrChangesApply):
+			response.Error(ctx, model.NewAPIError(http.StatusInternalServerError, "应用配置变更失败，已回滚到上次生效的配置", err), true)
+		default:
+			c.logger.Error().Err(err).Msg("应用配置变更失败")
+			response.InternalServerError(ctx, err, false)
+		}
+		return
+	}
+
+	response.Success(ctx, "应用配置变更成功", result)
+}
@@ -17,6 +17,7 @@ import (
 type ConfigController interface {
 	GetConfig(ctx *gin.Context)
 	PatchConfig(ctx *gin.Context)
+	ValidateConfig(ctx *gin.Context)
 }
 
 // ConfigControllerImpl 配置控制器实现
@@ -95,6 +96,10 @@ func (c *ConfigControllerImpl) PatchConfig(ctx *gin.Context) {
 			response.NotFound(ctx, err)
 			return
 		}
+		if errors.Is(err, service.ErrInvalidDirectives) || errors.Is(err, service.ErrInvalidInstances) || errors.Is(err, service.ErrInvalidBlockPage) || errors.Is(err, service.ErrInvalidGeoIP) {
+			response.BadRequest(ctx, err, true)
+			return
+		}
 		c.logger.Error().Err(err).Msg("更新配置失败")
 		response.InternalServerError(ctx, err, false)
 		return
@@ -106,6 +111,33 @@ func (c *ConfigControllerImpl) PatchConfig(ctx *gin.Context) {
 	response.Success(ctx, "配置更新成功", configResponse)
 }
 
+// ValidateConfig 校验指令
+//
+//	@Summary		校验SecLang指令
+//	@Description	使用与引擎相同的规则文件系统试编译指令，返回出错行号、加载的规则数量和重复的规则ID，不保存配置
+//	@Tags			配置管理
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body	dto.ConfigValidateRequest	true	"待校验的指令"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=seclang.ValidationResult}	"校验完成"
+//	@Failure		400	{object}	model.ErrResponse										"请求参数错误"
+//	@Failure		401	{object}	model.ErrResponseDontShowError							"未授权访问"
+//	@Failure		403	{object}	model.ErrResponseDontShowError							"禁止访问"
+//	@Router			/api/v1/config/validate [post]
+func (c *ConfigControllerImpl) ValidateConfig(ctx *gin.Context) {
+	var req dto.ConfigValidateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.Warn().Err(err).Msg("请求参数绑定失败")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	result := c.configService.ValidateDirectives(ctx, req.Directives)
+
+	response.Success(ctx, "校验完成", result)
+}
+
 // mapConfigToDTO 将模型转换为DTO
 func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 	// 将配置模型转换为响应DTO
@@ -113,17 +145,33 @@ func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 		Bind:            cfg.Engine.Bind,
 		UseBuiltinRules: cfg.Engine.UseBuiltinRules,
 		AppConfig:       make([]dto.AppConfigDTO, len(cfg.Engine.AppConfig)),
+		ExternalOnly:    cfg.Engine.ExternalOnly,
+		Balance:         cfg.Engine.Balance,
+		Instances:       make([]dto.EngineInstanceDTO, len(cfg.Engine.Instances)),
+	}
+
+	// 转换外部引擎实例
+	for i, instance := range cfg.Engine.Instances {
+		engineDTO.Instances[i] = dto.EngineInstanceDTO{
+			Name:    instance.Name,
+			Address: instance.Address,
+			Port:    instance.Port,
+			Weight:  instance.Weight,
+			Enabled: instance.Enabled,
+		}
 	}
 
 	// 转换应用配置
 	for i, app := range cfg.Engine.AppConfig {
 		engineDTO.AppConfig[i] = dto.AppConfigDTO{
-			Name:           app.Name,
-			Directives:     app.Directives,
-			TransactionTTL: dto.DurationToMillis(app.TransactionTTL),
-			LogLevel:       app.LogLevel,
-			LogFile:        app.LogFile,
-			LogFormat:      app.LogFormat,
+			Name:              app.Name,
+			Directives:        app.Directives,
+			TransactionTTL:    dto.DurationToMillis(app.TransactionTTL),
+			LogLevel:          app.LogLevel,
+			LogFile:           app.LogFile,
+			LogFormat:         app.LogFormat,
+			LogPolicy:         app.LogPolicy,
+			LogScoreThreshold: app.LogScoreThreshold,
 		}
 	}
 
@@ -135,6 +183,12 @@ func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 		SpoeAgentAddr: cfg.Haproxy.SpoeAgentAddr,
 		SpoeAgentPort: cfg.Haproxy.SpoeAgentPort,
 		Thread:        cfg.Haproxy.Thread,
+		HardStopAfter: cfg.Haproxy.HardStopAfter,
+		BlockPage: dto.BlockPageDTO{
+			HTML:           cfg.Haproxy.BlockPage.HTML,
+			JSON:           cfg.Haproxy.BlockPage.JSON,
+			SupportContact: cfg.Haproxy.BlockPage.SupportContact,
+		},
 	}
 
 	return dto.ConfigResponse{
@@ -145,5 +199,25 @@ func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 		UpdatedAt:       cfg.UpdatedAt,
 		IsResponseCheck: cfg.IsResponseCheck,
 		IsDebug:         cfg.IsDebug,
+		LogRetention: dto.LogRetentionDTO{
+			Enabled:        cfg.LogRetention.Enabled,
+			RetentionDays:  cfg.LogRetention.RetentionDays,
+			ArchiveEnabled: cfg.LogRetention.ArchiveEnabled,
+			ArchiveDir:     cfg.LogRetention.ArchiveDir,
+		},
+		Challenge: dto.ChallengeDTO{
+			Enabled:    cfg.Challenge.Enabled,
+			TTL:        cfg.Challenge.TTL,
+			Difficulty: cfg.Challenge.Difficulty,
+		},
+		Bot: dto.BotDTO{
+			Enabled:        cfg.Bot.Enabled,
+			VerifyCrawlers: cfg.Bot.VerifyCrawlers,
+		},
+		GeoIP: dto.GeoIPDTO{
+			Enabled:   cfg.GeoIP.Enabled,
+			CountryDB: cfg.GeoIP.CountryDB,
+			ASNDB:     cfg.GeoIP.ASNDB,
+		},
 	}
 }
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ReplayController 请求回放控制器接口
+type ReplayController interface {
+	Replay(ctx *gin.Context)
+	ReplayLogs(ctx *gin.Context)
+}
+
+// ReplayControllerImpl 请求回放控制器实现
+type ReplayControllerImpl struct {
+	replayService service.ReplayService
+	logger        zerolog.Logger
+}
+
+// NewReplayController 创建请求回放控制器
+func NewReplayController(replayService service.ReplayService) ReplayController {
+	logger := config.GetControllerLogger("replay")
+	return &ReplayControllerImpl{
+		replayService: replayService,
+		logger:        logger,
+	}
+}
+
+// Replay 回放单条请求
+//
+//	@Summary		回放单条请求
+//	@Description	使用正在运行的引擎应用检测一条原始HTTP请求（可附带响应），返回中断信息、命中规则和异常分数，不经过HAProxy，也不写入WAF日志
+//	@Tags			规则测试
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body	dto.ReplayRequest	true	"原始请求"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.ReplayResult}	"回放成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"引擎应用不存在"
+//	@Failure		409	{object}	model.ErrResponse								"引擎未运行"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/replay [post]
+func (c *ReplayControllerImpl) Replay(ctx *gin.Context) {
+	var req dto.ReplayRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	result, err := c.replayService.Replay(ctx, &req)
+	if err != nil {
+		c.handleError(ctx, err, "回放请求失败")
+		return
+	}
+
+	response.Success(ctx, "回放成功", result)
+}
+
+// ReplayLogs 使用候选规则集批量回放WAF日志
+//
+//	@Summary		批量回放WAF日志
+//	@Description	使用候选规则集回放已存储的WAF日志请求，对比原始拦截规则，查看规则变更后哪些请求会被放行或由其他规则拦截。候选规则集按引擎的加载方式组装，包括站点策略；请求中的指令不能使用读取或写入服务器文件的指令和操作符
+//	@Tags			规则测试
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body	dto.ReplayBatchRequest	true	"候选规则集和日志筛选条件"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.ReplayBatchResponse}	"回放成功"
+//	@Failure		400	{object}	model.ErrResponse									"请求参数错误或候选规则集无法编译"
+//	@Failure		404	{object}	model.ErrResponseDontShowError						"引擎应用不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError						"服务器内部错误"
+//	@Router			/api/v1/replay/logs [post]
+func (c *ReplayControllerImpl) ReplayLogs(ctx *gin.Context) {
+	var req dto.ReplayBatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	result, err := c.replayService.ReplayLogs(ctx, &req)
+	if err != nil {
+		c.handleError(ctx, err, "批量回放失败")
+		return
+	}
+
+	response.Success(ctx, "回放成功", result)
+}
+
+func (c *ReplayControllerImpl) handleError(ctx *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrReplayAppNotFound):
+		response.NotFound(ctx, err)
+	case errors.Is(err, service.ErrInvalidReplay), errors.Is(err, service.ErrInvalidCandidate):
+		response.BadRequest(ctx, err, true)
+	case errors.Is(err, service.ErrReplayUnavailable):
+		response.Error(ctx, model.NewAPIError(http.StatusConflict, err.Error(), err), true)
+	default:
+		c.logger.Error().Err(err).Msg(msg)
+		response.InternalServerError(ctx, err, false)
+	}
+}
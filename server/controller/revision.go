@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RevisionController 配置版本控制器接口
+type RevisionController interface {
+	GetRevisions(ctx *gin.Context)
+	GetRevision(ctx *gin.Context)
+	DiffRevisions(ctx *gin.Context)
+	Rollback(ctx *gin.Context)
+}
+
+// RevisionControllerImpl 配置版本控制器实现
+type RevisionControllerImpl struct {
+	revisionService service.RevisionService
+	logger          zerolog.Logger
+}
+
+// NewRevisionController 创建配置版本控制器
+func NewRevisionController(revisionService service.RevisionService) RevisionController {
+	logger := config.GetControllerLogger("revision")
+	return &RevisionControllerImpl{
+		revisionService: revisionService,
+		logger:          logger,
+	}
+}
+
+// GetRevisions 获取版本列表
+//
+//	@Summary		获取配置版本列表
+//	@Description	获取系统配置、站点、自定义规则和证书的变更版本，按时间倒序
+//	@Tags			配置版本
+//	@Produce		json
+//	@Param			resourceType	query	string	false	"资源类型"	Enums(config, site, rule, certificate)
+//	@Param			resourceId		query	string	false	"资源ID"
+//	@Param			page			query	int		false	"页码"	default(1)
+//	@Param			size			query	int		false	"每页数量"	default(10)
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.RevisionListResponse}	"获取版本列表成功"
+//	@Failure		400	{object}	model.ErrResponse										"请求参数错误"
+//	@Failure		500	{object}	model.ErrResponseDontShowError							"服务器内部错误"
+//	@Router			/api/v1/revision [get]
+func (c *RevisionControllerImpl) GetRevisions(ctx *gin.Context) {
+	var req dto.RevisionListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	result, err := c.revisionService.GetRevisions(ctx, req)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取版本列表失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取版本列表成功", result)
+}
+
+// GetRevision 获取版本详情
+//
+//	@Summary		获取配置版本详情
+//	@Description	获取版本元数据和资源快照，私钥只显示摘要
+//	@Tags			配置版本
+//	@Produce		json
+//	@Param			id	path	string	true	"版本ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.RevisionDetailResponse}	"获取版本详情成功"
+//	@Failure		400	{object}	model.ErrResponse										"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError							"版本不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError							"服务器内部错误"
+//	@Router			/api/v1/revision/{id} [get]
+func (c *RevisionControllerImpl) GetRevision(ctx *gin.Context) {
+	id, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		response.BadRequest(ctx, errors.New("无效的版本ID"), true)
+		return
+	}
+
+	result, err := c.revisionService.GetRevision(ctx, id)
+	if err != nil {
+		c.handleError(ctx, err, "获取版本详情失败")
+		return
+	}
+
+	response.Success(ctx, "获取版本详情成功", result)
+}
+
+// DiffRevisions 对比两个版本
+//
+//	@Summary		对比配置版本
+//	@Description	逐字段对比两个版本的快照，多行文本（如指令）额外给出逐行差异
+//	@Tags			配置版本
+//	@Produce		json
+//	@Param			from	query	string	true	"旧版本ID"
+//	@Param			to		query	string	true	"新版本ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.RevisionDiffResponse}	"对比成功"
+//	@Failure		400	{object}	model.ErrResponse										"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError							"版本不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError							"服务器内部错误"
+//	@Router			/api/v1/revision/diff [get]
+func (c *RevisionControllerImpl) DiffRevisions(ctx *gin.Context) {
+	var req dto.RevisionDiffRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	fromID, err := bson.ObjectIDFromHex(req.From)
+	if err != nil {
+		response.BadRequest(ctx, errors.New("无效的版本ID"), true)
+		return
+	}
+	toID, err := bson.ObjectIDFromHex(req.To)
+	if err != nil {
+		response.BadRequest(ctx, errors.New("无效的版本ID"), true)
+		return
+	}
+
+	result, err := c.revisionService.DiffRevisions(ctx, fromID, toID)
+	if err != nil {
+		c.handleError(ctx, err, "对比版本失败")
+		return
+	}
+
+	response.Success(ctx, "对比成功", result)
+}
+
+// Rollback 回滚到指定版本
+//
+//	@Summary		回滚到指定版本
+//	@Description	将资源恢复到指定版本的状态（删除版本会重新删除资源），生成一条回滚版本，并热重载HAProxy和引擎
+//	@Tags			配置版本
+//	@Produce		json
+//	@Param			id	path	string	true	"目标版本ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.Revision}	"回滚成功"
+//	@Failure		400	{object}	model.ErrResponse							"请求参数错误或版本无法回滚"
+//	@Failure		404	{object}	model.ErrResponseDontShowError				"版本不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError				"服务器内部错误"
+//	@Router			/api/v1/revision/{id}/rollback [post]
+func (c *RevisionControllerImpl) Rollback(ctx *gin.Context) {
+	id, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		response.BadRequest(ctx, errors.New("无效的版本ID"), true)
+		return
+	}
+
+	result, err := c.revisionService.Rollback(ctx, id)
+	if err != nil {
+		c.handleError(ctx, err, "回滚版本失败")
+		return
+	}
+
+	response.Success(ctx, "回滚成功", result)
+}
+
+func (c *RevisionControllerImpl) handleError(ctx *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrRevisionNotFound):
+		response.NotFound(ctx, err)
+	case errors.Is(err, service.ErrRevisionUnsupported),
+		errors.Is(err, service.ErrInvalidDirectives),
+		errors.Is(err, repository.ErrDomainPortConflict),
+		errors.Is(err, repository.ErrRuleIDExists):
+		response.BadRequest(ctx, err, true)
+	case errors.Is(err, service.ErrRollbackReload):
+		response.Error(ctx, model.NewAPIError(http.StatusInternalServerError, "已回滚，但服务热重载失败", err), true)
+	default:
+		c.logger.Error().Err(err).Msg(msg)
+		response.InternalServerError(ctx, err, false)
+	}
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RuleController 自定义规则控制器接口
+type RuleController interface {
+	CreateRule(ctx *gin.Context)
+	GetRules(ctx *gin.Context)
+	GetRuleByID(ctx *gin.Context)
+	UpdateRule(ctx *gin.Context)
+	DeleteRule(ctx *gin.Context)
+	PreviewDirectives(ctx *gin.Context)
+}
+
+// RuleControllerImpl 自定义规则控制器实现
+type RuleControllerImpl struct {
+	ruleService service.RuleService
+	logger      zerolog.Logger
+}
+
+// NewRuleController 创建自定义规则控制器
+func NewRuleController(ruleService service.RuleService) RuleController {
+	logger := config.GetControllerLogger("rule")
+	return &RuleControllerImpl{
+		ruleService: ruleService,
+		logger:      logger,
+	}
+}
+
+// CreateRule 创建自定义规则
+//
+//	@Summary		创建自定义规则
+//	@Description	创建自定义 SecLang 规则，保存前检查规则ID与 CRS 等保留区间的冲突并编译校验，保存后引擎自动热重载
+//	@Tags			自定义规则
+//	@Accept			json
+//	@Produce		json
+//	@Param			rule	body	dto.RuleRequest	true	"规则信息"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.Rule}	"规则创建成功"
+//	@Failure		400	{object}	model.ErrResponse						"请求参数错误或规则无效"
+//	@Failure		409	{object}	model.ErrResponseDontShowError			"规则ID已存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError			"服务器内部错误"
+//	@Router			/api/v1/rule [post]
+func (c *RuleControllerImpl) CreateRule(ctx *gin.Context) {
+	var req dto.RuleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	rule, err := c.ruleService.CreateRule(ctx, &req)
+	if err != nil {
+		c.handleError(ctx, err, "创建自定义规则失败")
+		return
+	}
+
+	response.Success(ctx, "规则创建成功", rule)
+}
+
+// GetRules 获取自定义规则列表
+//
+//	@Summary		获取自定义规则列表
+//	@Description	分页获取自定义规则，按排序和规则ID升序
+//	@Tags			自定义规则
+//	@Produce		json
+//	@Param			tag		query	string	false	"标签"
+//	@Param			domain	query	string	false	"生效域名"
+//	@Param			enabled	query	bool	false	"是否启用"
+//	@Param			page	query	int		false	"页码"		default(1)
+//	@Param			size	query	int		false	"每页数量"	default(10)
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.RuleListResponse}	"获取规则列表成功"
+//	@Failure		400	{object}	model.ErrResponse									"请求参数错误"
+//	@Failure		500	{object}	model.ErrResponseDontShowError						"服务器内部错误"
+//	@Router			/api/v1/rule [get]
+func (c *RuleControllerImpl) GetRules(ctx *gin.Context) {
+	var req dto.RuleListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	result, err := c.ruleService.GetRules(ctx, req)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取规则列表失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取规则列表成功", result)
+}
+
+// GetRuleByID 获取单条自定义规则
+//
+//	@Summary		获取单条自定义规则
+//	@Description	根据ID获取自定义规则详情
+//	@Tags			自定义规则
+//	@Produce		json
+//	@Param			id	path	string	true	"规则记录ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.Rule}	"获取规则成功"
+//	@Failure		400	{object}	model.ErrResponse						"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError			"规则不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError			"服务器内部错误"
+//	@Router			/api/v1/rule/{id} [get]
+func (c *RuleControllerImpl) GetRuleByID(ctx *gin.Context) {
+	objectID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	rule, err := c.ruleService.GetRuleByID(ctx, objectID)
+	if err != nil {
+		c.handleError(ctx, err, "获取规则失败")
+		return
+	}
+
+	response.Success(ctx, "获取规则成功", rule)
+}
+
+// UpdateRule 更新自定义规则
+//
+//	@Summary		更新自定义规则
+//	@Description	更新自定义规则，校验规则与创建时一致，保存后引擎自动热重载。禁用规则或修改规则ID时，规则不能被未撤销的排除引用
+//	@Tags			自定义规则
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path	string			true	"规则记录ID"
+//	@Param			rule	body	dto.RuleRequest	true	"规则信息"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.Rule}	"规则更新成功"
+//	@Failure		400	{object}	model.ErrResponse						"请求参数错误或规则无效"
+//	@Failure		404	{object}	model.ErrResponseDontShowError			"规则不存在"
+//	@Failure		409	{object}	model.ErrResponse						"规则ID已存在或规则被排除引用"
+//	@Failure		500	{object}	model.ErrResponseDontShowError			"服务器内部错误"
+//	@Router			/api/v1/rule/{id} [put]
+func (c *RuleControllerImpl) UpdateRule(ctx *gin.Context) {
+	objectID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	var req dto.RuleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	rule, err := c.ruleService.UpdateRule(ctx, objectID, &req)
+	if err != nil {
+		c.handleError(ctx, err, "更新自定义规则失败")
+		return
+	}
+
+	response.Success(ctx, "规则更新成功", rule)
+}
+
+// DeleteRule 删除自定义规则
+//
+//	@Summary		删除自定义规则
+//	@Description	删除自定义规则，删除后引擎自动热重载。规则仍被未撤销的排除引用时拒绝删除，需要先撤销这些排除
+//	@Tags			自定义规则
+//	@Produce		json
+//	@Param			id	path	string	true	"规则记录ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponseNoData		"规则删除成功"
+//	@Failure		400	{object}	model.ErrResponse				"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError	"规则不存在"
+//	@Failure		409	{object}	model.ErrResponse				"规则被排除引用"
+//	@Failure		500	{object}	model.ErrResponseDontShowError	"服务器内部错误"
+//	@Router			/api/v1/rule/{id} [delete]
+func (c *RuleControllerImpl) DeleteRule(ctx *gin.Context) {
+	objectID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	if err := c.ruleService.DeleteRule(ctx, objectID); err != nil {
+		c.handleError(ctx, err, "删除自定义规则失败")
+		return
+	}
+
+	response.Success(ctx, "规则删除成功", nil)
+}
+
+// PreviewDirectives 预览组装后的完整指令
+//
+//	@Summary		预览引擎指令
+//	@Description	按引擎的加载方式组装每个引擎应用最终加载的指令：CRS、全局规则、站点规则、规则排除，以及协议识别、国家访问、IP 信誉列表和请求体检测等站点策略
+//	@Tags			自定义规则
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=[]dto.DirectivesPreviewResponse}	"获取指令预览成功"
+//	@Failure		500	{object}	model.ErrResponseDontShowError								"服务器内部错误"
+//	@Router			/api/v1/rule/directives [get]
+func (c *RuleControllerImpl) PreviewDirectives(ctx *gin.Context) {
+	previews, err := c.ruleService.PreviewDirectives(ctx)
+	if err != nil {
+		c.handleError(ctx, err, "获取指令预览失败")
+		return
+	}
+
+	response.Success(ctx, "获取指令预览成功", previews)
+}
+
+// handleError 将服务层错误映射为响应
+func (c *RuleControllerImpl) handleError(ctx *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, repository.ErrRuleNotFound):
+		response.NotFound(ctx, err)
+	case errors.Is(err, repository.ErrRuleIDExists):
+		response.Error(ctx, model.NewAPIError(http.StatusConflict, "规则ID已存在", err), true)
+	case errors.Is(err, service.ErrRuleReferenced):
+		response.Error(ctx, model.NewAPIError(http.StatusConflict, "规则被排除引用", err), true)
+	case errors.Is(err, service.ErrInvalidRule), errors.Is(err, service.ErrRuleIDCollision):
+		response.BadRequest(ctx, err, true)
+	case errors.Is(err, service.ErrEngineReload):
+		response.Error(ctx, model.NewAPIError(http.StatusInternalServerError, "规则已保存，但引擎热重载失败", err), true)
+	default:
+		c.logger.Error().Err(err).Msg(msg)
+		response.InternalServerError(ctx, err, false)
+	}
+}
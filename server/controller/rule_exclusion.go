@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RuleExclusionController 规则排除控制器接口
+type RuleExclusionController interface {
+	ProposeExclusion(ctx *gin.Context)
+	CreateExclusion(ctx *gin.Context)
+	GetExclusions(ctx *gin.Context)
+	RevokeExclusion(ctx *gin.Context)
+}
+
+// RuleExclusionControllerImpl 规则排除控制器实现
+type RuleExclusionControllerImpl struct {
+	exclusionService service.RuleExclusionService
+	logger           zerolog.Logger
+}
+
+// NewRuleExclusionController 创建规则排除控制器
+func NewRuleExclusionController(exclusionService service.RuleExclusionService) RuleExclusionController {
+	logger := config.GetControllerLogger("rule_exclusion")
+	return &RuleExclusionControllerImpl{
+		exclusionService: exclusionService,
+		logger:           logger,
+	}
+}
+
+// ProposeExclusion 根据WAF日志生成规则排除建议
+//
+//	@Summary		生成规则排除建议
+//	@Description	根据一条WAF日志，为其中命中的每条检测规则生成排除建议（禁用规则或移除检测目标），默认限定在日志所属的域名和路径
+//	@Tags			规则排除
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body	dto.ExclusionProposeRequest	true	"WAF日志ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=[]dto.ExclusionProposal}	"生成排除建议成功"
+//	@Failure		400	{object}	model.ErrResponse									"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError						"日志不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError						"服务器内部错误"
+//	@Router			/api/v1/exclusion/propose [post]
+func (c *RuleExclusionControllerImpl) ProposeExclusion(ctx *gin.Context) {
+	var req dto.ExclusionProposeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	proposals, err := c.exclusionService.ProposeFromLog(ctx, req.LogID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrWAFLogNotFound):
+			response.NotFound(ctx, err)
+		case errors.Is(err, service.ErrInvalidExclusion), errors.Is(err, service.ErrNoExclusionOptions):
+			response.BadRequest(ctx, err, true)
+		default:
+			c.logger.Error().Err(err).Str("logId", req.LogID).Msg("生成规则排除建议失败")
+			response.InternalServerError(ctx, err, false)
+		}
+		return
+	}
+
+	response.Success(ctx, "生成排除建议成功", proposals)
+}
+
+// CreateExclusion 创建规则排除
+//
+//	@Summary		创建规则排除
+//	@Description	保存结构化的规则排除并热重载引擎，全局排除编译为 SecRuleRemoveById/SecRuleUpdateTargetById，限定范围的排除编译为 ctl 运行时规则。保存前与当前规则和站点策略一起组装每个应用的最终指令并试编译，目标规则不存在等无法加载的排除会被拒绝
+//	@Tags			规则排除
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body	dto.ExclusionCreateRequest	true	"规则排除"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.RuleExclusion}	"规则排除创建成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误或排除无法编译"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/exclusion [post]
+func (c *RuleExclusionControllerImpl) CreateExclusion(ctx *gin.Context) {
+	var req dto.ExclusionCreateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	exclusion, err := c.exclusionService.CreateExclusion(ctx, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidExclusion):
+			response.BadRequest(ctx, err, true)
+		case errors.Is(err, service.ErrEngineReload):
+			response.Error(ctx, model.NewAPIError(http.StatusInternalServerError, "规则排除已保存，但引擎热重载失败", err), true)
+		default:
+			c.logger.Error().Err(err).Msg("创建规则排除失败")
+			response.InternalServerError(ctx, err, false)
+		}
+		return
+	}
+
+	response.Success(ctx, "规则排除创建成功", exclusion)
+}
+
+// GetExclusions 获取规则排除列表
+//
+//	@Summary		获取规则排除列表
+//	@Description	分页获取规则排除，默认不包含已撤销的排除
+//	@Tags			规则排除
+//	@Produce		json
+//	@Param			ruleId			query	int		false	"规则ID"
+//	@Param			domain			query	string	false	"生效域名"
+//	@Param			includeRevoked	query	bool	false	"是否包含已撤销的排除"
+//	@Param			page			query	int		false	"页码"		default(1)
+//	@Param			size			query	int		false	"每页数量"	default(10)
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.ExclusionListResponse}	"获取规则排除列表成功"
+//	@Failure		400	{object}	model.ErrResponse										"请求参数错误"
+//	@Failure		500	{object}	model.ErrResponseDontShowError							"服务器内部错误"
+//	@Router			/api/v1/exclusion [get]
+func (c *RuleExclusionControllerImpl) GetExclusions(ctx *gin.Context) {
+	var req dto.ExclusionListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	result, err := c.exclusionService.GetExclusions(ctx, req)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取规则排除列表失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取规则排除列表成功", result)
+}
+
+// RevokeExclusion 撤销规则排除
+//
+//	@Summary		撤销规则排除
+//	@Description	撤销规则排除并热重载引擎，记录会保留以便追溯
+//	@Tags			规则排除
+//	@Produce		json
+//	@Param			id	path	string	true	"规则排除ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.RuleExclusion}	"规则排除已撤销"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"规则排除不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/exclusion/{id} [delete]
+func (c *RuleExclusionControllerImpl) RevokeExclusion(ctx *gin.Context) {
+	id := ctx.Param("id")
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	exclusion, err := c.exclusionService.RevokeExclusion(ctx, objectID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrExclusionNotFound):
+			response.NotFound(ctx, err)
+		case errors.Is(err, repository.ErrExclusionRevoked):
+			response.BadRequest(ctx, err, true)
+		case errors.Is(err, service.ErrEngineReload):
+			response.Error(ctx, model.NewAPIError(http.StatusInternalServerError, "规则排除已撤销，但引擎热重载失败", err), true)
+		default:
+			c.logger.Error().Err(err).Str("id", id).Msg("撤销规则排除失败")
+			response.InternalServerError(ctx, err, false)
+		}
+		return
+	}
+
+	response.Success(ctx, "规则排除已撤销", exclusion)
+}
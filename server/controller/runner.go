@@ -15,6 +15,7 @@ import (
 // RunnerController 运行器控制器接口
 type RunnerController interface {
 	GetStatus(ctx *gin.Context)
+	GetHAProxyOutput(ctx *gin.Context)
 	Control(ctx *gin.Context)
 }
 
@@ -63,6 +64,8 @@ func getSuccessMessage(action string) string {
 		return "运行器已成功重启"
 	case "force_stop":
 		return "运行器已强制停止"
+	case "drain":
+		return "运行器已优雅停止"
 	case "reload":
 		return "运行器配置已重新加载"
 	default:
@@ -89,6 +92,7 @@ func buildControlResponse(action string, state daemon.ServiceState) dto.RunnerCo
 }
 
 // GetStatus 获取运行器状态
+//
 //	@Summary		获取后台运行器状态
 //	@Description	获取WAF后台运行器的运行状态
 //	@Tags			运行器管理
@@ -108,13 +112,44 @@ func (c *RunnerControllerImpl) GetStatus(ctx *gin.Context) {
 
 	// 构建响应
 	resp := toRunnerStatusResponse(state)
+	resp.HAProxy = c.runnerService.GetHAProxyStatus(ctx)
+	resp.ConfigWatch = c.runnerService.GetConfigWatchStatus(ctx)
 
 	response.Success(ctx, "获取运行器状态成功", resp)
 }
 
+// GetHAProxyOutput 获取HAProxy输出
+//
+//	@Summary		获取HAProxy进程输出
+//	@Description	获取HAProxy标准输出和标准错误中最近的内容，按时间顺序排列
+//	@Tags			运行器管理
+//	@Produce		json
+//	@Param			lines	query	int	false	"返回最近的行数"	default(200)
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.HAProxyOutputResponse}	"获取HAProxy输出成功"
+//	@Failure		400	{object}	model.ErrResponse										"请求参数错误"
+//	@Router			/api/runner/haproxy/output [get]
+func (c *RunnerControllerImpl) GetHAProxyOutput(ctx *gin.Context) {
+	var req dto.HAProxyOutputRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+	if req.Lines == 0 {
+		req.Lines = 200
+	}
+
+	resp := dto.HAProxyOutputResponse{
+		Lines: c.runnerService.GetHAProxyOutput(ctx, req.Lines),
+	}
+
+	response.Success(ctx, "获取HAProxy输出成功", resp)
+}
+
 // Control 控制运行器
+//
 //	@Summary		控制后台运行器
-//	@Description	执行启动、停止、重启、强制停止或热重载操作
+//	@Description	执行启动、停止、重启、强制停止、优雅停止或热重载操作。drain 先软停止 HAProxy 等待已有连接结束，再等待引擎处理完进行中的事务
 //	@Tags			运行器管理
 //	@Accept			json
 //	@Produce		json
@@ -148,6 +183,8 @@ func (c *RunnerControllerImpl) Control(ctx *gin.Context) {
 		err = c.runnerService.Restart(ctx)
 	case "force_stop":
 		err = c.runnerService.ForceStop(ctx)
+	case "drain":
+		err = c.runnerService.Drain(ctx)
 	case "reload":
 		err = c.runnerService.Reload(ctx)
 	default:
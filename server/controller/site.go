@@ -70,6 +70,9 @@ func (c *SiteControllerImpl) CreateSite(ctx *gin.Context) {
 		if errors.Is(err, repository.ErrDomainPortExists) {
 			response.Error(ctx, model.NewAPIError(http.StatusConflict, "域名和端口组合已存在", err), false)
 			return
+		} else if errors.Is(err, service.ErrInvalidSite) {
+			response.BadRequest(ctx, err, true)
+			return
 		}
 		c.logger.Error().Err(err).Msg("创建站点失败")
 		response.InternalServerError(ctx, err, false)
@@ -196,6 +199,9 @@ func (c *SiteControllerImpl) UpdateSite(ctx *gin.Context) {
 		} else if errors.Is(err, repository.ErrDomainPortConflict) {
 			response.Error(ctx, model.NewAPIError(http.StatusConflict, "域名和端口组合已被其他站点使用", err), false)
 			return
+		} else if errors.Is(err, service.ErrInvalidSite) {
+			response.BadRequest(ctx, err, true)
+			return
 		}
 		c.logger.Error().Err(err).Str("id", id).Msg("更新站点失败")
 		response.InternalServerError(ctx, err, false)
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ThreatFeedController 威胁情报源控制器接口
+type ThreatFeedController interface {
+	CreateFeed(ctx *gin.Context)
+	GetFeeds(ctx *gin.Context)
+	GetFeedByID(ctx *gin.Context)
+	UpdateFeed(ctx *gin.Context)
+	DeleteFeed(ctx *gin.Context)
+	RefreshFeed(ctx *gin.Context)
+	GetIPLists(ctx *gin.Context)
+}
+
+// ThreatFeedControllerImpl 威胁情报源控制器实现
+type ThreatFeedControllerImpl struct {
+	feedService service.ThreatFeedService
+	logger      zerolog.Logger
+}
+
+// NewThreatFeedController 创建威胁情报源控制器
+func NewThreatFeedController(feedService service.ThreatFeedService) ThreatFeedController {
+	logger := config.GetControllerLogger("threat_feed")
+	return &ThreatFeedControllerImpl{
+		feedService: feedService,
+		logger:      logger,
+	}
+}
+
+// CreateFeed 创建威胁情报源
+//
+//	@Summary		创建威胁情报源
+//	@Description	创建威胁情报源，启用时立即下载或读取一次，首次刷新失败不影响创建，失败原因记录在统计中
+//	@Tags			威胁情报
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body	dto.ThreatFeedRequest	true	"威胁情报源"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.ThreatFeed}	"威胁情报源创建成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		409	{object}	model.ErrResponseDontShowError					"情报源名称已存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/threat-feed [post]
+func (c *ThreatFeedControllerImpl) CreateFeed(ctx *gin.Context) {
+	var req dto.ThreatFeedRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	threatFeed, err := c.feedService.CreateFeed(ctx, &req)
+	if err != nil {
+		c.handleError(ctx, err, "创建威胁情报源失败")
+		return
+	}
+
+	response.Success(ctx, "威胁情报源创建成功", threatFeed)
+}
+
+// GetFeeds 获取威胁情报源列表
+//
+//	@Summary		获取威胁情报源列表
+//	@Description	获取全部威胁情报源及其刷新统计
+//	@Tags			威胁情报
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=[]model.ThreatFeed}	"获取威胁情报源列表成功"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/threat-feed [get]
+func (c *ThreatFeedControllerImpl) GetFeeds(ctx *gin.Context) {
+	feeds, err := c.feedService.GetFeeds(ctx)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取威胁情报源列表失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取威胁情报源列表成功", feeds)
+}
+
+// GetFeedByID 获取威胁情报源详情
+//
+//	@Summary		获取威胁情报源详情
+//	@Description	获取单个威胁情报源及其刷新统计
+//	@Tags			威胁情报
+//	@Produce		json
+//	@Param			id	path	string	true	"威胁情报源ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.ThreatFeed}	"获取威胁情报源成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"威胁情报源不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/threat-feed/{id} [get]
+func (c *ThreatFeedControllerImpl) GetFeedByID(ctx *gin.Context) {
+	objectID, ok := parseFeedID(ctx)
+	if !ok {
+		return
+	}
+
+	threatFeed, err := c.feedService.GetFeedByID(ctx, objectID)
+	if err != nil {
+		c.handleError(ctx, err, "获取威胁情报源失败")
+		return
+	}
+
+	response.Success(ctx, "获取威胁情报源成功", threatFeed)
+}
+
+// UpdateFeed 更新威胁情报源
+//
+//	@Summary		更新威胁情报源
+//	@Description	更新威胁情报源设置，来源变化时立即刷新，启用状态或所属列表变化时重新合并列表并热重载引擎
+//	@Tags			威胁情报
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path	string					true	"威胁情报源ID"
+//	@Param			request	body	dto.ThreatFeedRequest	true	"威胁情报源"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.ThreatFeed}	"威胁情报源更新成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"威胁情报源不存在"
+//	@Failure		409	{object}	model.ErrResponseDontShowError					"情报源名称已存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/threat-feed/{id} [put]
+func (c *ThreatFeedControllerImpl) UpdateFeed(ctx *gin.Context) {
+	objectID, ok := parseFeedID(ctx)
+	if !ok {
+		return
+	}
+
+	var req dto.ThreatFeedRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	threatFeed, err := c.feedService.UpdateFeed(ctx, objectID, &req)
+	if err != nil {
+		c.handleError(ctx, err, "更新威胁情报源失败")
+		return
+	}
+
+	response.Success(ctx, "威胁情报源更新成功", threatFeed)
+}
+
+// DeleteFeed 删除威胁情报源
+//
+//	@Summary		删除威胁情报源
+//	@Description	删除威胁情报源，重新合并所属列表并热重载引擎，列表没有其他情报源时一并删除
+//	@Tags			威胁情报
+//	@Produce		json
+//	@Param			id	path	string	true	"威胁情报源ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse			"威胁情报源删除成功"
+//	@Failure		400	{object}	model.ErrResponse				"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError	"威胁情报源不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError	"服务器内部错误"
+//	@Router			/api/v1/threat-feed/{id} [delete]
+func (c *ThreatFeedControllerImpl) DeleteFeed(ctx *gin.Context) {
+	objectID, ok := parseFeedID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.feedService.DeleteFeed(ctx, objectID); err != nil {
+		c.handleError(ctx, err, "删除威胁情报源失败")
+		return
+	}
+
+	response.Success(ctx, "威胁情报源删除成功", nil)
+}
+
+// RefreshFeed 立即刷新威胁情报源
+//
+//	@Summary		立即刷新威胁情报源
+//	@Description	立即下载或读取威胁情报源，列表变化时热重载引擎。刷新失败时继续使用上次成功刷新的条目，失败原因记录在统计中
+//	@Tags			威胁情报
+//	@Produce		json
+//	@Param			id	path	string	true	"威胁情报源ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.ThreatFeed}	"威胁情报源刷新成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"威胁情报源不存在"
+//	@Failure		502	{object}	model.ErrResponse								"下载或解析威胁情报源失败"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/threat-feed/{id}/refresh [post]
+func (c *ThreatFeedControllerImpl) RefreshFeed(ctx *gin.Context) {
+	objectID, ok := parseFeedID(ctx)
+	if !ok {
+		return
+	}
+
+	threatFeed, err := c.feedService.RefreshFeed(ctx, objectID)
+	if err != nil {
+		c.handleError(ctx, err, "刷新威胁情报源失败")
+		return
+	}
+
+	response.Success(ctx, "威胁情报源刷新成功", threatFeed)
+}
+
+// GetIPLists 获取 IP 信誉列表
+//
+//	@Summary		获取 IP 信誉列表
+//	@Description	获取由威胁情报源合并生成的 IP 信誉列表，包含条目数量、摘要和来源情报源，不返回条目。站点通过 ipLists 引用列表名称
+//	@Tags			威胁情报
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=[]model.IPList}	"获取 IP 信誉列表成功"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/ip-list [get]
+func (c *ThreatFeedControllerImpl) GetIPLists(ctx *gin.Context) {
+	lists, err := c.feedService.GetLists(ctx)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取 IP 信誉列表失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取 IP 信誉列表成功", lists)
+}
+
+// handleError 将服务层错误转换为响应
+func (c *ThreatFeedControllerImpl) handleError(ctx *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, repository.ErrThreatFeedNotFound):
+		response.NotFound(ctx, err)
+	case errors.Is(err, repository.ErrThreatFeedNameExists):
+		response.Error(ctx, model.NewAPIError(http.StatusConflict, "情报源名称已存在", err), false)
+	case errors.Is(err, service.ErrInvalidThreatFeed):
+		response.BadRequest(ctx, err, true)
+	case errors.Is(err, service.ErrThreatFeedRefresh):
+		response.Error(ctx, model.NewAPIError(http.StatusBadGateway, "下载或解析威胁情报源失败，继续使用上次成功刷新的条目", err), true)
+	default:
+		c.logger.Error().Err(err).Msg(msg)
+		response.InternalServerError(ctx, err, false)
+	}
+}
+
+// parseFeedID 解析路径中的情报源ID，失败时直接返回错误响应
+func parseFeedID(ctx *gin.Context) (bson.ObjectID, bool) {
+	objectID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		response.BadRequest(ctx, err, true)
+		return bson.ObjectID{}, false
+	}
+	return objectID, true
+}
@@ -1,27 +1,47 @@
 package controller
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"time"
 
+	"github.com/HUAHUAI23/simple-waf/server/config"
 	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
 	"github.com/HUAHUAI23/simple-waf/server/service"
 	"github.com/HUAHUAI23/simple-waf/server/utils/response"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
 )
 
 type WAFLogController interface {
 	GetAttackEvents(ctx *gin.Context)
 	GetAttackLogs(ctx *gin.Context)
+	ExportAttackLogs(ctx *gin.Context)
+	StreamAttackLogs(ctx *gin.Context)
+	GetAnomalyScoreStats(ctx *gin.Context)
+	GetGeoStats(ctx *gin.Context)
 }
 
 type WAFLogControllerImpl struct {
-	wafLogService service.WAFLogService
+	wafLogService    service.WAFLogService
+	auditLogService  service.AuditLogService
+	logStreamService service.LogStreamService
+	logger           zerolog.Logger
 }
 
 // NewWAFLogController 创建新的WAF日志控制器实例
-func NewWAFLogController(wafLogService service.WAFLogService) WAFLogController {
+func NewWAFLogController(
+	wafLogService service.WAFLogService,
+	auditLogService service.AuditLogService,
+	logStreamService service.LogStreamService,
+) WAFLogController {
 	return &WAFLogControllerImpl{
-		wafLogService: wafLogService,
+		wafLogService:    wafLogService,
+		auditLogService:  auditLogService,
+		logStreamService: logStreamService,
+		logger:           config.GetControllerLogger("waf_log"),
 	}
 }
 
@@ -103,6 +123,11 @@ func (c *WAFLogControllerImpl) GetAttackEvents(ctx *gin.Context) {
 //	@Param			requestId	query		string												false	"请求ID，唯一标识HTTP请求的ID"
 //	@Param			startTime	query		string												false	"查询起始时间 (ISO8601格式，如: 2024-03-17T00:00:00Z)"
 //	@Param			endTime		query		string												false	"查询结束时间 (ISO8601格式，如: 2024-03-18T23:59:59Z)"
+//	@Param			minInboundScore	query	integer												false	"最小入站异常分数"
+//	@Param			maxInboundScore	query	integer												false	"最大入站异常分数"
+//	@Param			action		query		string												false	"实际执行的动作：blocked、redirected、dropped、observed"
+//	@Param			category	query		string												false	"攻击类别：sqli、xss、rce、lfi、rfi、php、sessionFixation、httpViolation"
+//	@Param			country		query		string												false	"来源国家代码，如: CN"
 //	@Param			page		query		integer												false	"当前页码，从1开始计数 (默认: 1)"
 //	@Param			pageSize	query		integer												false	"每页记录数，最大100条 (默认: 10)"
 //	@Success		200			{object}	model.SuccessResponse{data=dto.AttackLogResponse}	"成功"
@@ -150,3 +175,241 @@ func (c *WAFLogControllerImpl) GetAttackLogs(ctx *gin.Context) {
 
 	response.Success(ctx, "获取攻击日志成功", result)
 }
+
+// GetAnomalyScoreStats godoc
+//
+//	@Summary		异常评分统计
+//	@Description	统计 CRS 异常评分模式下日志的入站分数分布、达到阻断阈值的比例和各攻击类别分数，用于调整阈值和偏执级别，未记录异常分数的日志不参与统计
+//	@Tags			WAF安全日志
+//	@Produce		json
+//	@Param			domain		query		string														false	"域名"
+//	@Param			startTime	query		string														false	"查询起始时间 (ISO8601格式，默认: 24小时前)"
+//	@Param			endTime		query		string														false	"查询结束时间 (ISO8601格式，默认: 当前时间)"
+//	@Security		BearerAuth
+//	@Success		200			{object}	model.SuccessResponse{data=dto.AnomalyScoreStatsResponse}	"成功"
+//	@Failure		400			{object}	model.ErrResponse											"请求参数错误"
+//	@Failure		500			{object}	model.ErrResponseDontShowError								"服务器内部错误"
+//	@Router			/api/v1/log/anomaly-stats [get]
+func (c *WAFLogControllerImpl) GetAnomalyScoreStats(ctx *gin.Context) {
+	var req dto.AnomalyScoreStatsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	if req.StartTime.IsZero() {
+		req.StartTime = time.Now().UTC().Add(-24 * time.Hour)
+	}
+	if req.EndTime.IsZero() {
+		req.EndTime = time.Now().UTC()
+	}
+
+	result, err := c.wafLogService.GetAnomalyScoreStats(ctx, req)
+	if err != nil {
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取异常评分统计成功", result)
+}
+
+// GetGeoStats godoc
+//
+//	@Summary		地理位置统计
+//	@Description	统计日志的来源国家和自治系统排行，需要在配置中启用 GeoIP，启用前记录的日志不包含地理位置
+//	@Tags			WAF安全日志
+//	@Produce		json
+//	@Param			domain		query		string												false	"域名"
+//	@Param			startTime	query		string												false	"查询起始时间 (ISO8601格式，默认: 24小时前)"
+//	@Param			endTime		query		string												false	"查询结束时间 (ISO8601格式，默认: 当前时间)"
+//	@Param			limit		query		integer												false	"排行返回的条数 (默认: 10，最大: 100)"
+//	@Security		BearerAuth
+//	@Success		200			{object}	model.SuccessResponse{data=dto.GeoStatsResponse}	"成功"
+//	@Failure		400			{object}	model.ErrResponse									"请求参数错误"
+//	@Failure		500			{object}	model.ErrResponseDontShowError						"服务器内部错误"
+//	@Router			/api/v1/log/geo-stats [get]
+func (c *WAFLogControllerImpl) GetGeoStats(ctx *gin.Context) {
+	var req dto.GeoStatsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	if req.StartTime.IsZero() {
+		req.StartTime = time.Now().UTC().Add(-24 * time.Hour)
+	}
+	if req.EndTime.IsZero() {
+		req.EndTime = time.Now().UTC()
+	}
+
+	result, err := c.wafLogService.GetGeoStats(ctx, req)
+	if err != nil {
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取地理位置统计成功", result)
+}
+
+// ExportAttackLogs godoc
+//
+//	@Summary		导出攻击日志
+//	@Description	按与攻击日志查询相同的过滤条件流式导出日志，支持 CSV 与 NDJSON 格式及字段选择，不受分页大小限制，每次导出都会记录审计日志
+//	@Tags			WAF安全日志
+//	@Produce		text/csv
+//	@Produce		application/x-ndjson
+//	@Param			ruleId		query		integer							false	"规则ID，触发攻击检测的WAF规则标识"
+//	@Param			srcIp		query		string							false	"来源IP地址，攻击者地址"
+//	@Param			dstIp		query		string							false	"目标IP地址，被攻击的服务器地址"
+//	@Param			domain		query		string							false	"域名，被攻击的站点域名"
+//	@Param			srcPort		query		integer							false	"来源端口号，发起攻击的端口"
+//	@Param			dstPort		query		integer							false	"目标端口号，被攻击的服务端口"
+//	@Param			requestId	query		string							false	"请求ID，唯一标识HTTP请求的ID"
+//	@Param			startTime	query		string							false	"查询起始时间 (ISO8601格式，如: 2024-03-17T00:00:00Z)"
+//	@Param			endTime		query		string							false	"查询结束时间 (ISO8601格式，如: 2024-03-18T23:59:59Z)"
+//	@Param			minInboundScore	query	integer							false	"最小入站异常分数"
+//	@Param			maxInboundScore	query	integer							false	"最大入站异常分数"
+//	@Param			action		query		string							false	"实际执行的动作：blocked、redirected、dropped、observed"
+//	@Param			category	query		string							false	"攻击类别：sqli、xss、rce、lfi、rfi、php、sessionFixation、httpViolation"
+//	@Param			country		query		string							false	"来源国家代码，如: CN"
+//	@Param			format		query		string							false	"导出格式：csv、ndjson、jsonl (默认: ndjson)"
+//	@Param			fields		query		string							false	"导出字段，逗号分隔，如: createdAt,srcIp,domain,uri,ruleId"
+//	@Param			limit		query		integer							false	"最大导出条数，为空时不限制"
+//	@Security		BearerAuth
+//	@Success		200			{file}		file							"导出文件"
+//	@Failure		400			{object}	model.ErrResponse				"请求参数错误"
+//	@Failure		500			{object}	model.ErrResponseDontShowError	"服务器内部错误"
+//	@Router			/api/v1/log/export [get]
+func (c *WAFLogControllerImpl) ExportAttackLogs(ctx *gin.Context) {
+	var req dto.LogExportRequest
+
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	// 导出默认最近24小时，使用UTC时区
+	if req.StartTime.IsZero() {
+		req.StartTime = time.Now().UTC().Add(-24 * time.Hour)
+	}
+	if req.EndTime.IsZero() {
+		req.EndTime = time.Now().UTC()
+	}
+	if req.Format == "" || req.Format == "jsonl" {
+		req.Format = "ndjson"
+	}
+
+	fields, err := c.wafLogService.ResolveExportFields(req.Fields)
+	if err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	contentType, ext := "application/x-ndjson", "ndjson"
+	if req.Format == "csv" {
+		contentType, ext = "text/csv; charset=utf-8", "csv"
+	}
+	filename := fmt.Sprintf("waf_log_%s.%s", time.Now().UTC().Format("20060102T150405Z"), ext)
+
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(200)
+
+	count, exportErr := c.wafLogService.ExportAttackLogs(ctx, req, fields, ctx.Writer)
+
+	// 无论成功与否都记录审计日志
+	auditLog := &model.AuditLog{
+		Action:   model.AuditActionWAFLogExport,
+		ClientIP: ctx.ClientIP(),
+		Success:  exportErr == nil,
+		Details: map[string]any{
+			"format":    req.Format,
+			"fields":    fields,
+			"limit":     req.Limit,
+			"count":     count,
+			"ruleId":    req.RuleID,
+			"srcIp":     req.SrcIP,
+			"dstIp":     req.DstIP,
+			"srcPort":   req.SrcPort,
+			"dstPort":   req.DstPort,
+			"domain":    req.Domain,
+			"requestId": req.RequestID,
+			"startTime": req.StartTime,
+			"endTime":   req.EndTime,
+		},
+	}
+	if exportErr != nil {
+		auditLog.Error = exportErr.Error()
+	}
+	// 使用独立的上下文，避免客户端断开导致审计日志丢失
+	_ = c.auditLogService.Record(context.WithoutCancel(ctx), auditLog)
+
+	if exportErr != nil {
+		c.logger.Error().Err(exportErr).Int64("count", count).Msg("导出攻击日志失败")
+		if !ctx.Writer.Written() {
+			ctx.Writer.Header().Del("Content-Disposition")
+			response.InternalServerError(ctx, exportErr, false)
+			return
+		}
+		// 数据已经开始传输，只能中断连接
+		ctx.Abort()
+		return
+	}
+
+	c.logger.Info().Int64("count", count).Str("format", req.Format).Msg("导出攻击日志成功")
+}
+
+// StreamAttackLogs godoc
+//
+//	@Summary		实时攻击日志推送
+//	@Description	通过 Server-Sent Events 推送新写入的攻击日志，支持按域名、严重级别和规则ID在服务端过滤，每 15 秒发送一次心跳
+//	@Tags			WAF安全日志
+//	@Produce		text/event-stream
+//	@Param			domain		query		string							false	"域名，被攻击的站点域名"
+//	@Param			severity	query		[]integer						false	"严重级别，可重复传递多个"	collectionFormat(multi)
+//	@Param			ruleId		query		integer							false	"规则ID"
+//	@Security		BearerAuth
+//	@Success		200			{object}	model.WAFLog					"attack 事件，data 为日志 JSON"
+//	@Failure		400			{object}	model.ErrResponse				"请求参数错误"
+//	@Router			/api/v1/log/stream [get]
+func (c *WAFLogControllerImpl) StreamAttackLogs(ctx *gin.Context) {
+	var req dto.LogStreamRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	sub := c.logStreamService.Subscribe()
+	defer sub.Unsubscribe()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.logger.Info().Str("domain", req.Domain).Ints("severity", req.Severity).Int("ruleId", req.RuleID).Msg("实时日志订阅已建立")
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case wafLog, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			if c.logStreamService.Match(req, &wafLog) {
+				ctx.SSEvent("attack", wafLog)
+			}
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		}
+	})
+
+	c.logger.Info().Msg("实时日志订阅已断开")
+}
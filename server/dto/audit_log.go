@@ -0,0 +1,25 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/model"
+)
+
+// AuditLogRequest 审计日志查询请求
+// @Description 审计日志查询参数，支持按操作类型、用户名和时间范围过滤
+type AuditLogRequest struct {
+	Action    string    `json:"action" form:"action" binding:"omitempty" example:"waf:log:export"`                                                // 操作类型
+	Username  string    `json:"username" form:"username" binding:"omitempty" example:"admin"`                                                     // 操作用户名
+	StartTime time.Time `json:"startTime" form:"startTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-17T00:00:00Z"` // 查询起始时间
+	EndTime   time.Time `json:"endTime" form:"endTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-18T23:59:59Z"`     // 查询结束时间
+	Page      int64     `json:"page" form:"page" binding:"omitempty,min=1" default:"1" example:"1"`                                               // 当前页码
+	Size      int64     `json:"size" form:"size" binding:"omitempty,min=1,max=100" default:"10" example:"10"`                                     // 每页数量
+}
+
+// AuditLogListResponse 审计日志列表响应
+// @Description 审计日志列表响应
+type AuditLogListResponse struct {
+	Total int64            `json:"total"` // 总数
+	Items []model.AuditLog `json:"items"` // 审计日志列表
+}
@@ -0,0 +1,14 @@
+package dto
+
+// ChallengeVerifyRequest 提交工作量证明结果
+// @Description 浏览器计算出使 sha256(token + nonce) 满足难度的 nonce 后提交
+type ChallengeVerifyRequest struct {
+	Token string `json:"token" binding:"required,max=128" example:"1735689600.abcdefghijklmnop.signature"` // 验证页面下发的题目
+	Nonce string `json:"nonce" binding:"required,max=32" example:"48213"`                                  // 计算结果
+}
+
+// ChallengeTask 工作量证明题目
+type ChallengeTask struct {
+	Token      string `json:"token"`      // 题目，绑定客户端IP并带有过期时间
+	Difficulty int    `json:"difficulty"` // 难度，sha256 结果需要满足的前导零位数
+}
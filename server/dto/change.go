@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/model"
+)
+
+// PendingChangesResponse 待应用变更
+// @Description 上次生效以来的配置版本，以及生成的 HAProxy/SPOE 配置与运行中配置的差异
+type PendingChangesResponse struct {
+	Running       bool             `json:"running"`                 // 服务是否运行中
+	AppliedAt     *time.Time       `json:"appliedAt,omitempty"`     // 最近一次配置生效时间
+	HasChanges    bool             `json:"hasChanges"`              // 是否存在未生效的变更
+	Revisions     []model.Revision `json:"revisions"`               // 上次生效以来的配置版本
+	HAProxyDiff   []string         `json:"haproxyDiff"`             // haproxy.cfg 差异，以 "+ "、"- "、"  " 开头，"@@" 分隔不相邻的片段
+	SpoeDiff      []string         `json:"spoeDiff"`                // SPOE 配置差异
+	Valid         bool             `json:"valid"`                   // 生成的配置是否通过 haproxy -c 校验
+	CheckOutput   string           `json:"checkOutput,omitempty"`   // haproxy -c 输出
+	SiteErrors    []string         `json:"siteErrors,omitempty"`    // 生成配置失败的站点
+	HAProxyConfig string           `json:"haproxyConfig,omitempty"` // 完整的待应用 haproxy.cfg，差异过大无法逐行对比时返回
+}
+
+// ApplyChangesResponse 应用变更结果
+type ApplyChangesResponse struct {
+	Applied     bool      `json:"applied"`               // 是否已热重载生效，服务未运行时为 false
+	AppliedAt   time.Time `json:"appliedAt"`             // 生效时间
+	Revisions   int       `json:"revisions"`             // 本次生效的配置版本数
+	CheckOutput string    `json:"checkOutput,omitempty"` // haproxy -c 输出
+	SiteErrors  []string  `json:"siteErrors,omitempty"`  // 生成配置失败的站点
+}
@@ -7,78 +7,170 @@ import (
 // ConfigPatchRequest 配置补丁更新请求
 // @Description 用于部分更新配置的请求参数
 type ConfigPatchRequest struct {
-	Name            *string          `json:"name,omitempty" binding:"omitempty" example:"AppConfig"`        // 配置名称
-	Engine          *EnginePatchDTO  `json:"engine,omitempty" binding:"omitempty"`                          // 引擎配置
-	Haproxy         *HaproxyPatchDTO `json:"haproxy,omitempty" binding:"omitempty"`                         // HAProxy配置
-	IsResponseCheck *bool            `json:"isResponseCheck,omitempty" binding:"omitempty" example:"false"` // 是否检查响应
-	IsDebug         *bool            `json:"isDebug,omitempty" binding:"omitempty" example:"false"`         // 是否开启调试模式
+	Name            *string               `json:"name,omitempty" binding:"omitempty" example:"AppConfig"`        // 配置名称
+	Engine          *EnginePatchDTO       `json:"engine,omitempty" binding:"omitempty"`                          // 引擎配置
+	Haproxy         *HaproxyPatchDTO      `json:"haproxy,omitempty" binding:"omitempty"`                         // HAProxy配置
+	IsResponseCheck *bool                 `json:"isResponseCheck,omitempty" binding:"omitempty" example:"false"` // 是否检查响应
+	IsDebug         *bool                 `json:"isDebug,omitempty" binding:"omitempty" example:"false"`         // 是否开启调试模式
+	LogRetention    *LogRetentionPatchDTO `json:"logRetention,omitempty" binding:"omitempty"`                    // 日志保留策略
+	Challenge       *ChallengePatchDTO    `json:"challenge,omitempty" binding:"omitempty"`                       // 人机验证配置
+	Bot             *BotPatchDTO          `json:"bot,omitempty" binding:"omitempty"`                             // 机器人识别配置
+	GeoIP           *GeoIPPatchDTO        `json:"geoip,omitempty" binding:"omitempty"`                           // GeoIP 配置
 }
 
 // EnginePatchDTO 引擎配置补丁DTO
 type EnginePatchDTO struct {
-	Bind            *string             `json:"bind,omitempty" binding:"omitempty" example:"127.0.0.1:2342"`  // 引擎绑定地址
-	UseBuiltinRules *bool               `json:"useBuiltinRules,omitempty" binding:"omitempty" example:"true"` // 是否使用内置规则
-	AppConfig       []AppConfigPatchDTO `json:"appConfig,omitempty" binding:"omitempty,dive"`                 // 应用配置列表
+	Bind            *string              `json:"bind,omitempty" binding:"omitempty" example:"127.0.0.1:2342"`                                        // 引擎绑定地址
+	UseBuiltinRules *bool                `json:"useBuiltinRules,omitempty" binding:"omitempty" example:"true"`                                       // 是否使用内置规则
+	AppConfig       []AppConfigPatchDTO  `json:"appConfig,omitempty" binding:"omitempty,dive"`                                                       // 应用配置列表
+	ExternalOnly    *bool                `json:"externalOnly,omitempty" binding:"omitempty" example:"false"`                                         // 只使用外部引擎实例
+	Balance         *string              `json:"balance,omitempty" binding:"omitempty,oneof=roundrobin leastconn first random" example:"roundrobin"` // 引擎实例负载均衡算法
+	Instances       *[]EngineInstanceDTO `json:"instances,omitempty" binding:"omitempty,dive"`                                                       // 外部引擎实例，提供时整体替换
+}
+
+// EngineInstanceDTO 外部引擎实例
+type EngineInstanceDTO struct {
+	Name    string `json:"name" binding:"required,max=32,alphanum" example:"agent1"` // 实例名称
+	Address string `json:"address" binding:"required" example:"127.0.0.1"`           // 实例地址
+	Port    int    `json:"port" binding:"required,min=1,max=65535" example:"2343"`   // 实例端口
+	Weight  int    `json:"weight" binding:"omitempty,min=0,max=256" example:"100"`   // 权重，为 0 时使用默认权重
+	Enabled bool   `json:"enabled" example:"true"`                                   // 是否启用
 }
 
 // AppConfigPatchDTO 应用配置补丁DTO
 type AppConfigPatchDTO struct {
-	Name           *string `json:"name,omitempty" binding:"omitempty" example:"coraza"`          // 应用名称
-	Directives     *string `json:"directives,omitempty" binding:"omitempty"`                     // 指令配置
-	TransactionTTL *int64  `json:"transactionTTL,omitempty" binding:"omitempty" example:"60000"` // 事务超时时间(毫秒)
-	LogLevel       *string `json:"logLevel,omitempty" binding:"omitempty" example:"info"`        // 日志级别
-	LogFile        *string `json:"logFile,omitempty" binding:"omitempty" example:"/dev/stdout"`  // 日志文件
-	LogFormat      *string `json:"logFormat,omitempty" binding:"omitempty" example:"console"`    // 日志格式
+	Name              *string `json:"name,omitempty" binding:"omitempty" example:"coraza"`                                             // 应用名称
+	Directives        *string `json:"directives,omitempty" binding:"omitempty"`                                                        // 指令配置
+	TransactionTTL    *int64  `json:"transactionTTL,omitempty" binding:"omitempty" example:"60000"`                                    // 事务超时时间(毫秒)
+	LogLevel          *string `json:"logLevel,omitempty" binding:"omitempty" example:"info"`                                           // 日志级别
+	LogFile           *string `json:"logFile,omitempty" binding:"omitempty" example:"/dev/stdout"`                                     // 日志文件
+	LogFormat         *string `json:"logFormat,omitempty" binding:"omitempty" example:"console"`                                       // 日志格式
+	LogPolicy         *string `json:"logPolicy,omitempty" binding:"omitempty,oneof=interrupted matched anomaly" example:"interrupted"` // 防火墙日志记录策略
+	LogScoreThreshold *int    `json:"logScoreThreshold,omitempty" binding:"omitempty,min=0,max=10000" example:"5"`                     // anomaly 策略下记录日志的异常分数，0 表示使用 CRS 阻断阈值
 }
 
 // HaproxyPatchDTO HAProxy配置补丁DTO
 type HaproxyPatchDTO struct {
-	ConfigBaseDir *string `json:"configBaseDir,omitempty" binding:"omitempty" example:"/simple-waf"` // 配置文件根目录
-	HaproxyBin    *string `json:"haproxyBin,omitempty" binding:"omitempty" example:"haproxy"`        // HAProxy二进制文件路径
-	BackupsNumber *int    `json:"backupsNumber,omitempty" binding:"omitempty" example:"5"`           // 备份数量
-	SpoeAgentAddr *string `json:"spoeAgentAddr,omitempty" binding:"omitempty" example:"127.0.0.1"`   // SPOE代理地址
-	SpoeAgentPort *int    `json:"spoeAgentPort,omitempty" binding:"omitempty" example:"2342"`        // SPOE代理端口
-	Thread        *int    `json:"thread,omitempty" binding:"omitempty,min=0,max=256" example:"4"`    // 线程数
+	ConfigBaseDir *string       `json:"configBaseDir,omitempty" binding:"omitempty" example:"/simple-waf"`       // 配置文件根目录
+	HaproxyBin    *string       `json:"haproxyBin,omitempty" binding:"omitempty" example:"haproxy"`              // HAProxy二进制文件路径
+	BackupsNumber *int          `json:"backupsNumber,omitempty" binding:"omitempty" example:"5"`                 // 备份数量
+	SpoeAgentAddr *string       `json:"spoeAgentAddr,omitempty" binding:"omitempty" example:"127.0.0.1"`         // SPOE代理地址
+	SpoeAgentPort *int          `json:"spoeAgentPort,omitempty" binding:"omitempty" example:"2342"`              // SPOE代理端口
+	Thread        *int          `json:"thread,omitempty" binding:"omitempty,min=0,max=256" example:"4"`          // 线程数
+	HardStopAfter *int          `json:"hardStopAfter,omitempty" binding:"omitempty,min=0,max=3600" example:"30"` // 软停止后强制关闭连接的秒数，0 表示不限制
+	BlockPage     *BlockPageDTO `json:"blockPage,omitempty" binding:"omitempty"`                                 // 全局拦截页面，提供时整体替换
+}
+
+// LogRetentionPatchDTO 日志保留策略补丁DTO
+type LogRetentionPatchDTO struct {
+	Enabled        *bool   `json:"enabled,omitempty" binding:"omitempty" example:"true"`                    // 是否启用过期删除
+	RetentionDays  *int    `json:"retentionDays,omitempty" binding:"omitempty,min=1,max=3650" example:"30"` // 日志保留天数
+	ArchiveEnabled *bool   `json:"archiveEnabled,omitempty" binding:"omitempty" example:"false"`            // 删除前是否归档
+	ArchiveDir     *string `json:"archiveDir,omitempty" binding:"omitempty" example:"/simple-waf/archive"`  // 归档目录
+}
+
+// ChallengePatchDTO 人机验证配置补丁DTO，签名密钥由服务端生成，不通过接口读写
+type ChallengePatchDTO struct {
+	Enabled    *bool `json:"enabled,omitempty" binding:"omitempty" example:"true"`               // 是否启用人机验证
+	TTL        *int  `json:"ttl,omitempty" binding:"omitempty,min=60,max=604800" example:"1800"` // 验证通过后的有效期（秒）
+	Difficulty *int  `json:"difficulty,omitempty" binding:"omitempty,min=1,max=24" example:"16"` // 工作量证明难度（前导零位数）
+}
+
+// BotPatchDTO 机器人识别配置补丁DTO
+type BotPatchDTO struct {
+	Enabled        *bool `json:"enabled,omitempty" binding:"omitempty" example:"true"`        // 是否识别机器人
+	VerifyCrawlers *bool `json:"verifyCrawlers,omitempty" binding:"omitempty" example:"true"` // 是否通过 DNS 验证自称搜索引擎爬虫的请求
+}
+
+// GeoIPPatchDTO GeoIP 配置补丁DTO，数据库文件路径为引擎所在主机上的路径
+type GeoIPPatchDTO struct {
+	Enabled   *bool   `json:"enabled,omitempty" binding:"omitempty" example:"true"`                                               // 是否查询来源IP的地理位置
+	CountryDB *string `json:"countryDB,omitempty" binding:"omitempty,max=1024" example:"/simple-waf/geoip/GeoLite2-Country.mmdb"` // 国家或城市数据库路径
+	ASNDB     *string `json:"asnDB,omitempty" binding:"omitempty,max=1024" example:"/simple-waf/geoip/GeoLite2-ASN.mmdb"`         // ASN 数据库路径，为空时不查询 ASN
 }
 
 // ConfigResponse 配置响应
 // @Description 配置响应
 type ConfigResponse struct {
-	ID              string     `json:"id,omitempty"`    // 配置ID
-	Name            string     `json:"name"`            // 配置名称
-	Engine          EngineDTO  `json:"engine"`          // 引擎配置
-	Haproxy         HaproxyDTO `json:"haproxy"`         // HAProxy配置
-	CreatedAt       time.Time  `json:"createdAt"`       // 创建时间
-	UpdatedAt       time.Time  `json:"updatedAt"`       // 更新时间
-	IsResponseCheck bool       `json:"isResponseCheck"` // 是否检查响应
-	IsDebug         bool       `json:"isDebug"`         // 是否开启调试模式
+	ID              string          `json:"id,omitempty"`    // 配置ID
+	Name            string          `json:"name"`            // 配置名称
+	Engine          EngineDTO       `json:"engine"`          // 引擎配置
+	Haproxy         HaproxyDTO      `json:"haproxy"`         // HAProxy配置
+	CreatedAt       time.Time       `json:"createdAt"`       // 创建时间
+	UpdatedAt       time.Time       `json:"updatedAt"`       // 更新时间
+	IsResponseCheck bool            `json:"isResponseCheck"` // 是否检查响应
+	IsDebug         bool            `json:"isDebug"`         // 是否开启调试模式
+	LogRetention    LogRetentionDTO `json:"logRetention"`    // 日志保留策略
+	Challenge       ChallengeDTO    `json:"challenge"`       // 人机验证配置
+	Bot             BotDTO          `json:"bot"`             // 机器人识别配置
+	GeoIP           GeoIPDTO        `json:"geoip"`           // GeoIP 配置
 }
 
 // EngineDTO 引擎配置DTO
 type EngineDTO struct {
-	Bind            string         `json:"bind"`            // 引擎绑定地址
-	UseBuiltinRules bool           `json:"useBuiltinRules"` // 是否使用内置规则
-	AppConfig       []AppConfigDTO `json:"appConfig"`       // 应用配置列表
+	Bind            string              `json:"bind"`            // 引擎绑定地址
+	UseBuiltinRules bool                `json:"useBuiltinRules"` // 是否使用内置规则
+	AppConfig       []AppConfigDTO      `json:"appConfig"`       // 应用配置列表
+	ExternalOnly    bool                `json:"externalOnly"`    // 只使用外部引擎实例
+	Balance         string              `json:"balance"`         // 引擎实例负载均衡算法
+	Instances       []EngineInstanceDTO `json:"instances"`       // 外部引擎实例
 }
 
 // AppConfigDTO 应用配置DTO
 type AppConfigDTO struct {
-	Name           string `json:"name"`                           // 应用名称
-	Directives     string `json:"directives"`                     // 指令配置
-	TransactionTTL int64  `json:"transactionTTL" example:"60000"` // 事务超时时间(毫秒)
-	LogLevel       string `json:"logLevel"`                       // 日志级别
-	LogFile        string `json:"logFile"`                        // 日志文件
-	LogFormat      string `json:"logFormat"`                      // 日志格式
+	Name              string `json:"name"`                            // 应用名称
+	Directives        string `json:"directives"`                      // 指令配置
+	TransactionTTL    int64  `json:"transactionTTL" example:"60000"`  // 事务超时时间(毫秒)
+	LogLevel          string `json:"logLevel"`                        // 日志级别
+	LogFile           string `json:"logFile"`                         // 日志文件
+	LogFormat         string `json:"logFormat"`                       // 日志格式
+	LogPolicy         string `json:"logPolicy" example:"interrupted"` // 防火墙日志记录策略：interrupted、matched、anomaly
+	LogScoreThreshold int    `json:"logScoreThreshold" example:"0"`   // anomaly 策略下记录日志的异常分数
 }
 
 // HaproxyDTO HAProxy配置DTO
 type HaproxyDTO struct {
-	ConfigBaseDir string `json:"configBaseDir"` // 配置文件根目录
-	HaproxyBin    string `json:"haproxyBin"`    // HAProxy二进制文件路径
-	BackupsNumber int    `json:"backupsNumber"` // 备份数量
-	SpoeAgentAddr string `json:"spoeAgentAddr"` // SPOE代理地址
-	SpoeAgentPort int    `json:"spoeAgentPort"` // SPOE代理端口
-	Thread        int    `json:"thread"`        // 线程数
+	ConfigBaseDir string       `json:"configBaseDir"` // 配置文件根目录
+	HaproxyBin    string       `json:"haproxyBin"`    // HAProxy二进制文件路径
+	BackupsNumber int          `json:"backupsNumber"` // 备份数量
+	SpoeAgentAddr string       `json:"spoeAgentAddr"` // SPOE代理地址
+	SpoeAgentPort int          `json:"spoeAgentPort"` // SPOE代理端口
+	Thread        int          `json:"thread"`        // 线程数
+	HardStopAfter int          `json:"hardStopAfter"` // 软停止后强制关闭连接的秒数
+	BlockPage     BlockPageDTO `json:"blockPage"`     // 全局拦截页面
+}
+
+// LogRetentionDTO 日志保留策略DTO
+type LogRetentionDTO struct {
+	Enabled        bool   `json:"enabled"`        // 是否启用过期删除
+	RetentionDays  int    `json:"retentionDays"`  // 日志保留天数
+	ArchiveEnabled bool   `json:"archiveEnabled"` // 删除前是否归档
+	ArchiveDir     string `json:"archiveDir"`     // 归档目录
+}
+
+// ChallengeDTO 人机验证配置DTO
+type ChallengeDTO struct {
+	Enabled    bool `json:"enabled"`    // 是否启用人机验证
+	TTL        int  `json:"ttl"`        // 验证通过后的有效期（秒）
+	Difficulty int  `json:"difficulty"` // 工作量证明难度（前导零位数）
+}
+
+// BotDTO 机器人识别配置DTO
+type BotDTO struct {
+	Enabled        bool `json:"enabled"`        // 是否识别机器人
+	VerifyCrawlers bool `json:"verifyCrawlers"` // 是否通过 DNS 验证自称搜索引擎爬虫的请求
+}
+
+// GeoIPDTO GeoIP 配置DTO
+type GeoIPDTO struct {
+	Enabled   bool   `json:"enabled"`   // 是否查询来源IP的地理位置
+	CountryDB string `json:"countryDB"` // 国家或城市数据库路径
+	ASNDB     string `json:"asnDB"`     // ASN 数据库路径
+}
+
+// ConfigValidateRequest 指令校验请求
+type ConfigValidateRequest struct {
+	Directives string `json:"directives" binding:"required" example:"Include @coraza.conf-recommended\nSecRuleEngine On"` // 待校验的指令
 }
 
 // 将 time.Duration 转换为毫秒表示的 int64
@@ -0,0 +1,54 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// ReplayRequest 单条请求回放
+// @Description 使用正在运行的引擎应用检测一条原始HTTP请求，格式与WAF日志中的请求相同
+type ReplayRequest struct {
+	AppName  string `json:"appName" binding:"required" example:"coraza"`                                                                 // 引擎应用名称
+	Request  string `json:"request" binding:"required" example:"GET /index.php?id=1%27%20OR%20%271%27=%271 HTTP/1.1\nHost: example.com"` // 原始HTTP请求
+	Response string `json:"response" binding:"omitempty" example:"HTTP/1.1 200 OK\nContent-Type: text/html\n\n<html></html>"`            // 原始HTTP响应（可选）
+	SrcIP    string `json:"srcIp" binding:"omitempty,ip" example:"192.168.1.1"`                                                          // 来源IP地址
+	SrcPort  int    `json:"srcPort" binding:"omitempty,min=1,max=65535" example:"52134"`                                                 // 来源端口
+	DstIP    string `json:"dstIp" binding:"omitempty,ip" example:"10.0.0.1"`                                                             // 目标IP地址
+	DstPort  int    `json:"dstPort" binding:"omitempty,min=1,max=65535" example:"443"`                                                   // 目标端口
+}
+
+// ReplayBatchRequest 批量回放历史WAF日志
+// @Description 使用候选规则集回放已存储的WAF日志请求，评估规则变更的影响。候选规则集为（替换后的）基础指令 + 当前启用的自定义规则、规则排除和站点策略 + 追加指令。Include 只能引入内置规则集，不能使用 SecAuditLog、SecDebugLog、SecDataDir、SecUploadDir 等指令和 *FromFile 操作符
+type ReplayBatchRequest struct {
+	AppName          string    `json:"appName" binding:"required" example:"coraza"`                               // 引擎应用名称
+	Directives       *string   `json:"directives" binding:"omitempty"`                                            // 候选基础指令，为空时使用当前配置
+	AppendDirectives string    `json:"appendDirectives" binding:"omitempty" example:"SecRuleRemoveById 942100"`   // 追加到规则集末尾的候选指令
+	LogIDs           []string  `json:"logIds" binding:"omitempty,dive,len=24" example:"65f8a1b2c3d4e5f6a7b8c9d0"` // 指定回放的日志ID，为空时按条件筛选
+	RuleID           int       `json:"ruleId" binding:"omitempty" example:"942100"`                               // 原始触发的规则ID
+	Domain           string    `json:"domain" binding:"omitempty" example:"example.com"`                          // 域名
+	StartTime        time.Time `json:"startTime" binding:"omitempty" example:"2024-03-17T00:00:00Z"`              // 起始时间
+	EndTime          time.Time `json:"endTime" binding:"omitempty" example:"2024-03-18T23:59:59Z"`                // 结束时间
+	Limit            int64     `json:"limit" binding:"omitempty,min=1,max=1000" default:"100" example:"100"`      // 最多回放条数
+}
+
+// ReplayBatchItem 单条日志的回放结果
+type ReplayBatchItem struct {
+	LogID          string              `json:"logId" example:"65f8a1b2c3d4e5f6a7b8c9d0"` // 日志ID
+	Domain         string              `json:"domain" example:"example.com"`             // 域名
+	OriginalRuleID int                 `json:"originalRuleId" example:"949110"`          // 原始拦截规则ID
+	CreatedAt      time.Time           `json:"createdAt"`                                // 原始请求时间
+	Outcome        string              `json:"outcome" example:"allowed"`                // blocked: 仍被同一规则拦截; changed: 被其他规则拦截; allowed: 不再拦截; error: 回放失败
+	Result         *model.ReplayResult `json:"result,omitempty"`                         // 回放结果
+	Error          string              `json:"error,omitempty"`                          // 回放失败原因
+}
+
+// ReplayBatchResponse 批量回放结果
+type ReplayBatchResponse struct {
+	Total   int               `json:"total" example:"100"`  // 回放条数
+	Blocked int               `json:"blocked" example:"80"` // 仍被同一规则拦截
+	Changed int               `json:"changed" example:"5"`  // 被其他规则拦截
+	Allowed int               `json:"allowed" example:"15"` // 不再拦截
+	Failed  int               `json:"failed" example:"0"`   // 回放失败
+	Items   []ReplayBatchItem `json:"items"`                // 每条日志的结果
+}
@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"github.com/HUAHUAI23/simple-waf/server/model"
+)
+
+// RevisionListRequest 版本列表查询请求
+// @Description 版本列表查询参数，支持按资源类型和资源ID过滤
+type RevisionListRequest struct {
+	ResourceType string `json:"resourceType" form:"resourceType" binding:"omitempty,oneof=config site rule certificate" example:"site"` // 资源类型
+	ResourceID   string `json:"resourceId" form:"resourceId" binding:"omitempty" example:"65f8a1b2c3d4e5f6a7b8c9d0"`                    // 资源ID
+	Page         int64  `json:"page" form:"page" binding:"omitempty,min=1" default:"1" example:"1"`                                     // 当前页码
+	Size         int64  `json:"size" form:"size" binding:"omitempty,min=1,max=100" default:"10" example:"10"`                           // 每页数量
+}
+
+// RevisionListResponse 版本列表响应
+// @Description 版本列表响应，不包含快照内容
+type RevisionListResponse struct {
+	Total int64            `json:"total"` // 总数
+	Items []model.Revision `json:"items"` // 版本列表
+}
+
+// RevisionDetailResponse 版本详情
+// @Description 版本详情，快照中的私钥已隐藏
+type RevisionDetailResponse struct {
+	model.Revision
+	Snapshot map[string]any `json:"snapshot"` // 资源快照
+}
+
+// RevisionDiffRequest 版本对比请求
+type RevisionDiffRequest struct {
+	From string `json:"from" form:"from" binding:"required,len=24" example:"65f8a1b2c3d4e5f6a7b8c9d0"` // 旧版本ID
+	To   string `json:"to" form:"to" binding:"required,len=24" example:"65f8a1b2c3d4e5f6a7b8c9d1"`     // 新版本ID
+}
+
+// RevisionFieldChange 字段变更
+type RevisionFieldChange struct {
+	Path  string   `json:"path" example:"engine.appConfig[0].directives"` // 字段路径
+	Type  string   `json:"type" example:"modified"`                       // added / removed / modified
+	Old   any      `json:"old,omitempty"`                                 // 旧值
+	New   any      `json:"new,omitempty"`                                 // 新值
+	Lines []string `json:"lines,omitempty"`                               // 多行文本的逐行差异，以 "+ "、"- "、"  " 开头
+}
+
+// RevisionDiffResponse 版本对比结果
+type RevisionDiffResponse struct {
+	From    model.Revision        `json:"from"`    // 旧版本
+	To      model.Revision        `json:"to"`      // 新版本
+	Changes []RevisionFieldChange `json:"changes"` // 字段变更列表
+}
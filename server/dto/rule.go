@@ -0,0 +1,40 @@
+package dto
+
+import "github.com/HUAHUAI23/simple-waf/pkg/model"
+
+// RuleRequest 创建/更新自定义规则请求
+// @Description 自定义规则内容，保存前会检查规则ID冲突并编译校验
+type RuleRequest struct {
+	RuleID      int      `json:"ruleId" binding:"required,min=1" example:"100001"`                                                                      // SecLang 规则ID
+	Name        string   `json:"name" binding:"required,max=100" example:"block-admin-path"`                                                            // 规则名称
+	Description string   `json:"description" binding:"omitempty,max=500" example:"禁止访问后台路径"`                                                            // 规则描述
+	SecLang     string   `json:"secLang" binding:"required" example:"SecRule REQUEST_URI \"@beginsWith /admin\" \"id:100001,phase:1,deny,status:403\""` // 规则内容
+	Priority    int      `json:"priority" binding:"omitempty" example:"0"`                                                                              // 排序，越小越靠前
+	Enabled     *bool    `json:"enabled" binding:"required" example:"true"`                                                                             // 是否启用
+	Tags        []string `json:"tags" binding:"omitempty,dive,max=50" example:"custom"`                                                                 // 标签
+	Domains     []string `json:"domains" binding:"omitempty,dive,required" example:"api.example.com"`                                                   // 生效域名，为空表示全局
+}
+
+// RuleListRequest 自定义规则列表查询请求
+// @Description 自定义规则列表查询参数
+type RuleListRequest struct {
+	Tag     string `json:"tag" form:"tag" binding:"omitempty" example:"custom"`                          // 标签
+	Domain  string `json:"domain" form:"domain" binding:"omitempty" example:"api.example.com"`           // 生效域名
+	Enabled *bool  `json:"enabled" form:"enabled" binding:"omitempty" example:"true"`                    // 是否启用
+	Page    int64  `json:"page" form:"page" binding:"omitempty,min=1" default:"1" example:"1"`           // 当前页码
+	Size    int64  `json:"size" form:"size" binding:"omitempty,min=1,max=100" default:"10" example:"10"` // 每页数量
+}
+
+// RuleListResponse 自定义规则列表响应
+// @Description 自定义规则列表响应
+type RuleListResponse struct {
+	Total int64        `json:"total"` // 总数
+	Items []model.Rule `json:"items"` // 规则列表
+}
+
+// DirectivesPreviewResponse 组装后的指令预览
+// @Description 每个引擎应用最终加载的完整指令
+type DirectivesPreviewResponse struct {
+	Name       string `json:"name" example:"coraza"` // 引擎应用名称
+	Directives string `json:"directives"`            // 组装后的完整指令
+}
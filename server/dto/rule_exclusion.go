@@ -0,0 +1,51 @@
+package dto
+
+import "github.com/HUAHUAI23/simple-waf/pkg/model"
+
+// ExclusionProposeRequest 根据WAF日志生成规则排除建议的请求
+// @Description 根据一条WAF日志生成规则排除建议
+type ExclusionProposeRequest struct {
+	LogID string `json:"logId" binding:"required" example:"65f7a8b9c0d1e2f3a4b5c6d7"` // WAF日志ID
+}
+
+// ExclusionProposal 规则排除建议
+// @Description 针对日志中命中的单条规则生成的排除建议，确认后可直接提交创建
+type ExclusionProposal struct {
+	RuleID      int                  `json:"ruleId" example:"942100"`                         // 命中的规则ID
+	Message     string               `json:"message" example:"SQL Injection Attack Detected"` // 规则消息
+	Payload     string               `json:"payload" example:"1' or '1'='1"`                  // 命中的数据
+	Type        model.ExclusionType  `json:"type" example:"remove_target"`                    // 建议的排除类型
+	Target      string               `json:"target,omitempty" example:"ARGS:content"`         // 建议移除的检测目标
+	Scope       model.ExclusionScope `json:"scope"`                                           // 建议的生效范围
+	SourceLogID string               `json:"sourceLogId" example:"65f7a8b9c0d1e2f3a4b5c6d7"`  // 来源WAF日志ID
+	Directives  string               `json:"directives"`                                      // 编译后的指令预览
+}
+
+// ExclusionCreateRequest 创建规则排除请求
+// @Description 创建规则排除，保存后引擎自动热重载
+type ExclusionCreateRequest struct {
+	RuleID      int                 `json:"ruleId" binding:"required,min=1" example:"942100"`                                // 目标规则ID
+	Type        model.ExclusionType `json:"type" binding:"required,oneof=remove_rule remove_target" example:"remove_target"` // 排除类型
+	Target      string              `json:"target" binding:"required_if=Type remove_target" example:"ARGS:content"`          // 需移除的检测目标
+	Domain      string              `json:"domain" binding:"omitempty" example:"api.example.com"`                            // 生效域名，为空表示所有站点
+	Path        string              `json:"path" binding:"omitempty,startswith=/" example:"/api/v1/upload"`                  // 生效路径前缀，为空表示所有路径
+	Reason      string              `json:"reason" binding:"omitempty,max=500" example:"富文本编辑器误报"`                           // 排除原因
+	SourceLogID string              `json:"sourceLogId" binding:"omitempty" example:"65f7a8b9c0d1e2f3a4b5c6d7"`              // 来源WAF日志ID
+}
+
+// ExclusionListRequest 规则排除列表查询请求
+// @Description 规则排除列表查询参数
+type ExclusionListRequest struct {
+	RuleID         int    `json:"ruleId" form:"ruleId" binding:"omitempty" example:"942100"`                    // 规则ID
+	Domain         string `json:"domain" form:"domain" binding:"omitempty" example:"api.example.com"`           // 生效域名
+	IncludeRevoked bool   `json:"includeRevoked" form:"includeRevoked" binding:"omitempty" example:"false"`     // 是否包含已撤销的排除
+	Page           int64  `json:"page" form:"page" binding:"omitempty,min=1" default:"1" example:"1"`           // 当前页码
+	Size           int64  `json:"size" form:"size" binding:"omitempty,min=1,max=100" default:"10" example:"10"` // 每页数量
+}
+
+// ExclusionListResponse 规则排除列表响应
+// @Description 规则排除列表响应
+type ExclusionListResponse struct {
+	Total int64                 `json:"total"` // 总数
+	Items []model.RuleExclusion `json:"items"` // 规则排除列表
+}
@@ -1,8 +1,14 @@
 package dto
 
+import (
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/haproxy"
+)
+
 // RunnerControlRequest 运行器控制请求
 type RunnerControlRequest struct {
-	Action string `json:"action" binding:"required,oneof=start stop restart force_stop reload"` // 控制动作
+	Action string `json:"action" binding:"required,oneof=start stop restart force_stop drain reload"` // 控制动作
 }
 
 // RunnerControlResponse 运行器控制响应
@@ -15,6 +21,38 @@ type RunnerControlResponse struct {
 
 // RunnerStatusResponse 运行器状态响应
 type RunnerStatusResponse struct {
-	State     string `json:"state" example:"running"`  // 状态：running, stopped, error
-	IsRunning bool   `json:"isRunning" example:"true"` // 是否正在运行
+	State       string                   `json:"state" example:"running"`  // 状态：running, stopped, error
+	IsRunning   bool                     `json:"isRunning" example:"true"` // 是否正在运行
+	HAProxy     haproxy.SupervisorStatus `json:"haproxy"`                  // HAProxy 进程监管状态
+	ConfigWatch ConfigWatchStatus        `json:"configWatch"`              // 配置变更自动重载状态
+}
+
+// HAProxyOutputRequest HAProxy 输出查询请求
+type HAProxyOutputRequest struct {
+	Lines int `json:"lines" form:"lines" binding:"omitempty,min=1,max=1000" default:"200" example:"200"` // 返回最近的行数
+}
+
+// HAProxyOutputResponse HAProxy 输出
+type HAProxyOutputResponse struct {
+	Lines []haproxy.OutputLine `json:"lines"` // 按时间顺序排列的输出
+}
+
+// ConfigWatchStatus 配置变更自动重载状态
+type ConfigWatchStatus struct {
+	Enabled       bool                 `json:"enabled" example:"true"`      // 是否启用
+	Mode          string               `json:"mode" example:"changestream"` // 当前使用的监听方式：changestream 或 poll
+	LastChangeAt  time.Time            `json:"lastChangeAt,omitempty"`      // 最近一次检测到变更的时间
+	LastAppliedAt time.Time            `json:"lastAppliedAt,omitempty"`     // 最近一次重载成功的时间
+	LastResult    *ConfigReloadRecord  `json:"lastResult,omitempty"`        // 最近一次重载结果
+	History       []ConfigReloadRecord `json:"history"`                     // 最近的重载记录，按时间倒序
+}
+
+// ConfigReloadRecord 一次由配置变更触发的重载
+type ConfigReloadRecord struct {
+	Scope       string    `json:"scope" example:"full"`     // 重载范围：full 重载 HAProxy 和引擎，engine 只重载引擎
+	Collections []string  `json:"collections"`              // 触发重载的集合
+	Result      string    `json:"result" example:"applied"` // 结果：applied, failed, skipped
+	Error       string    `json:"error,omitempty"`          // 失败或跳过的原因
+	ChangedAt   time.Time `json:"changedAt"`                // 首次检测到变更的时间
+	FinishedAt  time.Time `json:"finishedAt"`               // 重载完成的时间
 }
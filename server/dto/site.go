@@ -9,29 +9,39 @@ import (
 // CreateSiteRequest 创建站点请求
 // @Description 创建站点的请求参数
 type CreateSiteRequest struct {
-	Name         string          `json:"name" binding:"required" example:"my-site"`                                      // 站点名称
-	Domain       string          `json:"domain" binding:"required,domain" example:"example.com"`                         // 域名
-	ListenPort   int             `json:"listenPort" binding:"required,min=1,max=65535" example:"8080"`                   // 监听端口
-	EnableHTTPS  bool            `json:"enableHTTPS" example:"false"`                                                    // 是否启用HTTPS
-	Certificate  *CertificateDTO `json:"certificate,omitempty" binding:"omitempty,required_if=EnableHTTPS true"`         // 证书信息
-	Backend      BackendDTO      `json:"backend" binding:"required"`                                                     // 后端服务器配置
-	WAFEnabled   bool            `json:"wafEnabled" example:"false"`                                                     // 是否启用WAF
-	WAFMode      string          `json:"wafMode" binding:"omitempty,oneof=protection observation" example:"observation"` // WAF模式
-	ActiveStatus bool            `json:"activeStatus" example:"true"`                                                    // 站点状态
+	Name           string             `json:"name" binding:"required" example:"my-site"`                                      // 站点名称
+	Domain         string             `json:"domain" binding:"required,domain" example:"example.com"`                         // 域名
+	ListenPort     int                `json:"listenPort" binding:"required,min=1,max=65535" example:"8080"`                   // 监听端口
+	EnableHTTPS    bool               `json:"enableHTTPS" example:"false"`                                                    // 是否启用HTTPS
+	EnableHTTP2    bool               `json:"enableHTTP2" example:"false"`                                                    // 是否启用HTTP/2
+	Certificate    *CertificateDTO    `json:"certificate,omitempty" binding:"omitempty,required_if=EnableHTTPS true"`         // 证书信息
+	Backend        BackendDTO         `json:"backend" binding:"required"`                                                     // 后端服务器配置
+	WAFEnabled     bool               `json:"wafEnabled" example:"false"`                                                     // 是否启用WAF
+	WAFMode        string             `json:"wafMode" binding:"omitempty,oneof=protection observation" example:"observation"` // WAF模式
+	BodyInspection *BodyInspectionDTO `json:"bodyInspection,omitempty" binding:"omitempty"`                                   // 请求体检测配置
+	BlockPage      *BlockPageDTO      `json:"blockPage,omitempty" binding:"omitempty"`                                        // 拦截页面，未配置的字段使用全局配置
+	GeoPolicy      *GeoPolicyDTO      `json:"geoPolicy,omitempty" binding:"omitempty"`                                        // 国家访问策略
+	IPLists        []string           `json:"ipLists,omitempty" binding:"omitempty,max=20,dive,required,max=64"`              // 引用的 IP 信誉列表名称
+	ActiveStatus   bool               `json:"activeStatus" example:"true"`                                                    // 站点状态
 }
 
 // UpdateSiteRequest 更新站点请求
 // @Description 更新站点的请求参数
 type UpdateSiteRequest struct {
-	Name         string          `json:"name,omitempty" binding:"omitempty" example:"my-site"`                           // 站点名称
-	Domain       string          `json:"domain,omitempty" binding:"omitempty,domain" example:"example.com"`              // 域名
-	ListenPort   int             `json:"listenPort,omitempty" binding:"omitempty,min=1,max=65535" example:"8080"`        // 监听端口
-	EnableHTTPS  bool            `json:"enableHTTPS" example:"false"`                                                    // 是否启用HTTPS
-	Certificate  *CertificateDTO `json:"certificate,omitempty" binding:"omitempty,required_if=EnableHTTPS true"`         // 证书信息
-	Backend      *BackendDTO     `json:"backend,omitempty" binding:"omitempty"`                                          // 后端服务器配置
-	WAFEnabled   bool            `json:"wafEnabled" example:"false"`                                                     // 是否启用WAF
-	WAFMode      string          `json:"wafMode" binding:"omitempty,oneof=protection observation" example:"observation"` // WAF模式
-	ActiveStatus bool            `json:"activeStatus" example:"true"`                                                    // 站点状态
+	Name           string             `json:"name,omitempty" binding:"omitempty" example:"my-site"`                           // 站点名称
+	Domain         string             `json:"domain,omitempty" binding:"omitempty,domain" example:"example.com"`              // 域名
+	ListenPort     int                `json:"listenPort,omitempty" binding:"omitempty,min=1,max=65535" example:"8080"`        // 监听端口
+	EnableHTTPS    bool               `json:"enableHTTPS" example:"false"`                                                    // 是否启用HTTPS
+	EnableHTTP2    bool               `json:"enableHTTP2" example:"false"`                                                    // 是否启用HTTP/2
+	Certificate    *CertificateDTO    `json:"certificate,omitempty" binding:"omitempty,required_if=EnableHTTPS true"`         // 证书信息
+	Backend        *BackendDTO        `json:"backend,omitempty" binding:"omitempty"`                                          // 后端服务器配置
+	WAFEnabled     bool               `json:"wafEnabled" example:"false"`                                                     // 是否启用WAF
+	WAFMode        string             `json:"wafMode" binding:"omitempty,oneof=protection observation" example:"observation"` // WAF模式
+	BodyInspection *BodyInspectionDTO `json:"bodyInspection,omitempty" binding:"omitempty"`                                   // 请求体检测配置
+	BlockPage      *BlockPageDTO      `json:"blockPage,omitempty" binding:"omitempty"`                                        // 拦截页面，未配置的字段使用全局配置
+	GeoPolicy      *GeoPolicyDTO      `json:"geoPolicy,omitempty" binding:"omitempty"`                                        // 国家访问策略
+	IPLists        []string           `json:"ipLists,omitempty" binding:"omitempty,max=20,dive,required,max=64"`              // 引用的 IP 信誉列表名称，传空数组表示清除
+	ActiveStatus   bool               `json:"activeStatus" example:"true"`                                                    // 站点状态
 }
 
 // CertificateDTO 证书DTO
@@ -54,6 +64,28 @@ type ServerDTO struct {
 	Host  string `json:"host" binding:"required" example:"backend.example.com"` // 主机地址
 	Port  int    `json:"port" binding:"required,min=1,max=65535" example:"80"`  // 端口
 	IsSSL bool   `json:"isSSL" example:"false"`                                 // 是否启用SSL
+	HTTP2 bool   `json:"http2" example:"false"`                                 // 是否使用HTTP/2连接后端
+}
+
+// BodyInspectionDTO 请求体检测配置DTO
+type BodyInspectionDTO struct {
+	Enabled          bool     `json:"enabled" example:"true"`                                                                                    // 是否检测请求体
+	MaxBytes         int64    `json:"maxBytes" binding:"omitempty,min=1,max=49152" example:"32768"`                                              // 检测上限字节数，0 表示使用引擎默认设置
+	LimitAction      string   `json:"limitAction" binding:"omitempty,oneof=process_partial reject" example:"reject"`                             // 超出上限时的处理方式，默认 process_partial
+	SkipContentTypes []string `json:"skipContentTypes,omitempty" binding:"omitempty,max=20,dive,required,max=100" example:"multipart/form-data"` // 不检测请求体的 Content-Type 前缀
+}
+
+// GeoPolicyDTO 国家访问策略DTO，更新站点时 mode 为空表示删除策略
+type GeoPolicyDTO struct {
+	Mode      string   `json:"mode" binding:"omitempty,oneof=allow deny" example:"deny"`         // 策略：allow 只允许列表中的国家，deny 拒绝列表中的国家
+	Countries []string `json:"countries" binding:"omitempty,max=300,dive,len=2" example:"CN,RU"` // ISO 3166-1 两位国家代码
+}
+
+// BlockPageDTO 拦截页面DTO，模板中可以使用 {{requestId}} 和 {{supportContact}} 占位符
+type BlockPageDTO struct {
+	HTML           string `json:"html" binding:"max=8192"`                                         // HTML 模板
+	JSON           string `json:"json" binding:"max=8192"`                                         // JSON 模板
+	SupportContact string `json:"supportContact" binding:"max=200" example:"security@example.com"` // 支持联系方式
 }
 
 // SiteResponse 站点响应
@@ -0,0 +1,14 @@
+package dto
+
+// ThreatFeedRequest 创建/更新威胁情报源请求
+// @Description 威胁情报源设置，url 与 filePath 二选一，保存后立即刷新一次
+type ThreatFeedRequest struct {
+	Name      string `json:"name" binding:"required,max=64" example:"firehol-level1"`                                                // 情报源名称
+	List      string `json:"list" binding:"required,max=64" example:"firehol"`                                                       // 合并到的 IP 信誉列表名称
+	URL       string `json:"url" binding:"omitempty,url,max=2048" example:"https://iplists.firehol.org/files/firehol_level1.netset"` // 下载地址，支持 http 和 https
+	FilePath  string `json:"filePath" binding:"omitempty,max=1024" example:"/simple-waf/feeds/level1.netset"`                        // 本地文件路径，用于无法访问外网的环境
+	Format    string `json:"format" binding:"omitempty,oneof=text csv" example:"text"`                                               // 列表格式，默认 text
+	CSVColumn int    `json:"csvColumn" binding:"omitempty,min=0,max=100" example:"0"`                                                // CSV 格式中 IP 所在的列，从 0 开始
+	Interval  int    `json:"interval" binding:"omitempty,min=300,max=604800" example:"3600"`                                         // 刷新间隔（秒），默认 3600
+	Enabled   *bool  `json:"enabled" binding:"required" example:"true"`                                                              // 是否启用
+}
@@ -34,6 +34,13 @@ type AttackLogRequest struct {
 	EndTime   time.Time `json:"endTime" form:"endTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-18T23:59:59Z"`     // 查询结束时间，ISO8601格式
 	Page      int       `json:"page" form:"page" binding:"omitempty,min=1" default:"1" example:"1"`                                               // 当前页码，从1开始
 	PageSize  int       `json:"pageSize" form:"pageSize" binding:"omitempty,min=1,max=100" default:"10" example:"10"`                             // 每页记录数，最大100条
+
+	MinInboundScore int    `json:"minInboundScore" form:"minInboundScore" binding:"omitempty,min=0" example:"5"`                                             // 最小入站异常分数
+	MaxInboundScore int    `json:"maxInboundScore" form:"maxInboundScore" binding:"omitempty,min=0" example:"20"`                                            // 最大入站异常分数
+	Action          string `json:"action" form:"action" binding:"omitempty,oneof=blocked redirected dropped observed challenged" example:"blocked"`          // 实际执行的动作
+	Category        string `json:"category" form:"category" binding:"omitempty,oneof=sqli xss rce lfi rfi php sessionFixation httpViolation" example:"sqli"` // 攻击类别，只返回该类别分数大于0的日志
+	BotClass        string `json:"botClass" form:"botClass" binding:"omitempty,oneof=verified fake bad headless automated" example:"fake"`                   // 机器人分类
+	Country         string `json:"country" form:"country" binding:"omitempty,len=2" example:"CN"`                                                            // 来源国家代码
 }
 
 // AttackEventAggregateResult 攻击事件聚合结果
@@ -68,3 +75,90 @@ type AttackLogResponse struct {
 	CurrentPage int            `json:"currentPage" example:"1"`  // 当前页码，从1开始计数
 	TotalPages  int            `json:"totalPages" example:"13"`  // 总页数，根据总记录数和每页大小计算
 }
+
+// LogExportRequest 日志导出请求
+// @Description 日志导出参数，过滤条件与攻击日志查询一致，额外支持导出格式、字段选择和条数上限，不受分页大小限制
+type LogExportRequest struct {
+	AttackLogRequest
+	Format string   `json:"format" form:"format" binding:"omitempty,oneof=csv ndjson jsonl" default:"ndjson" example:"csv"` // 导出格式：csv、ndjson(jsonl)
+	Fields []string `json:"fields" form:"fields" binding:"omitempty" example:"createdAt,srcIp,domain,uri,ruleId"`           // 导出字段，逗号分隔，为空时导出全部字段
+	Limit  int64    `json:"limit" form:"limit" binding:"omitempty,min=1" example:"10000"`                                   // 最大导出条数，为空时不限制
+}
+
+// LogStreamRequest 实时日志订阅请求
+// @Description 实时攻击日志订阅的服务端过滤条件，未指定的条件不参与过滤
+type LogStreamRequest struct {
+	Domain   string `json:"domain" form:"domain" binding:"omitempty" example:"example.com"`            // 域名
+	Severity []int  `json:"severity" form:"severity" binding:"omitempty,dive,min=0,max=7" example:"2"` // 严重级别，可重复传递多个
+	RuleID   int    `json:"ruleId" form:"ruleId" binding:"omitempty" example:"942100"`                 // 规则ID，同时匹配关联的规则记录
+}
+
+// AnomalyScoreStatsRequest 异常评分统计请求
+// @Description 统计指定时间范围内日志的 CRS 异常分数分布，用于评估请求离阻断阈值的距离和调整偏执级别
+type AnomalyScoreStatsRequest struct {
+	Domain    string    `json:"domain" form:"domain" binding:"omitempty" example:"example.com"`                                                   // 域名
+	StartTime time.Time `json:"startTime" form:"startTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-17T00:00:00Z"` // 查询起始时间，ISO8601格式
+	EndTime   time.Time `json:"endTime" form:"endTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-18T23:59:59Z"`     // 查询结束时间，ISO8601格式
+}
+
+// AnomalyScoreSummary 异常评分汇总
+type AnomalyScoreSummary struct {
+	Total          int64   `bson:"total" json:"total" example:"128"`                  // 参与统计的日志数
+	AvgInbound     float64 `bson:"avgInbound" json:"avgInbound" example:"7.5"`        // 平均入站异常分数
+	MaxInbound     int     `bson:"maxInbound" json:"maxInbound" example:"43"`         // 最高入站异常分数
+	AboveThreshold int64   `bson:"aboveThreshold" json:"aboveThreshold" example:"96"` // 入站分数达到阻断阈值的日志数
+	BelowThreshold int64   `bson:"belowThreshold" json:"belowThreshold" example:"32"` // 入站分数大于0但未达到阻断阈值的日志数
+}
+
+// AnomalyScoreBucket 按入站异常分数分组的日志数
+type AnomalyScoreBucket struct {
+	Score int   `bson:"_id" json:"score" example:"5"`    // 入站异常分数
+	Count int64 `bson:"count" json:"count" example:"42"` // 日志数
+}
+
+// AnomalyCategoryStat 攻击类别的异常分数统计
+type AnomalyCategoryStat struct {
+	Category string  `bson:"_id" json:"category" example:"sqli"`      // 攻击类别
+	Count    int64   `bson:"count" json:"count" example:"30"`         // 该类别分数大于0的日志数
+	AvgScore float64 `bson:"avgScore" json:"avgScore" example:"12.5"` // 平均分数
+	MaxScore int     `bson:"maxScore" json:"maxScore" example:"35"`   // 最高分数
+}
+
+// GeoStatsRequest 地理位置统计请求
+// @Description 统计指定时间范围内日志的来源国家和自治系统排行
+type GeoStatsRequest struct {
+	Domain    string    `json:"domain" form:"domain" binding:"omitempty" example:"example.com"`                                                   // 域名
+	StartTime time.Time `json:"startTime" form:"startTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-17T00:00:00Z"` // 查询起始时间，ISO8601格式
+	EndTime   time.Time `json:"endTime" form:"endTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-18T23:59:59Z"`     // 查询结束时间，ISO8601格式
+	Limit     int       `json:"limit" form:"limit" binding:"omitempty,min=1,max=100" default:"10" example:"10"`                                   // 排行返回的条数，默认10条
+}
+
+// GeoCountryStat 按来源国家统计的日志数
+type GeoCountryStat struct {
+	Country  string `bson:"_id" json:"country" example:"US"`      // 国家代码
+	Count    int64  `bson:"count" json:"count" example:"42"`      // 日志数
+	UniqueIP int64  `bson:"uniqueIp" json:"uniqueIp" example:"7"` // 来源IP数
+}
+
+// GeoASNStat 按自治系统统计的日志数
+type GeoASNStat struct {
+	ASN      uint   `bson:"_id" json:"asn" example:"15169"`       // 自治系统号
+	ASOrg    string `bson:"asOrg" json:"asOrg" example:"GOOGLE"`  // 自治系统所属组织
+	Count    int64  `bson:"count" json:"count" example:"42"`      // 日志数
+	UniqueIP int64  `bson:"uniqueIp" json:"uniqueIp" example:"7"` // 来源IP数
+}
+
+// GeoStatsResponse 地理位置统计响应
+type GeoStatsResponse struct {
+	Total     int64            `json:"total" example:"128"`   // 时间范围内的日志数
+	Located   int64            `json:"located" example:"120"` // 查询到国家的日志数
+	Countries []GeoCountryStat `json:"countries"`             // 来源国家排行，按日志数降序
+	ASNs      []GeoASNStat     `json:"asns"`                  // 自治系统排行，按日志数降序
+}
+
+// AnomalyScoreStatsResponse 异常评分统计响应
+type AnomalyScoreStatsResponse struct {
+	Summary      AnomalyScoreSummary   `json:"summary"`      // 汇总
+	Distribution []AnomalyScoreBucket  `json:"distribution"` // 入站异常分数分布，按分数升序
+	Categories   []AnomalyCategoryStat `json:"categories"`   // 各攻击类别统计，按日志数降序
+}
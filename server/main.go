@@ -16,8 +16,12 @@ import (
 	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	_ "github.com/HUAHUAI23/simple-waf/server/docs" // 导入 swagger 文档
+	"github.com/HUAHUAI23/simple-waf/server/repository"
 	"github.com/HUAHUAI23/simple-waf/server/router"
 	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/archiver"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/feed"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/watcher"
 	"github.com/HUAHUAI23/simple-waf/server/validator"
 )
 
@@ -77,6 +81,26 @@ func main() {
 		return
 	}
 
+	// 启动日志归档器
+	logArchiver := archiver.NewLogArchiver(repository.NewWAFLogRepository(db))
+	logArchiver.Start()
+
+	// 启动配置变更监听，未启用时不做任何事
+	configWatcher, err := watcher.GetConfigWatcher()
+	if err != nil {
+		config.Logger.Error().Err(err).Msg("Failed to create config watcher")
+		return
+	}
+	configWatcher.Start()
+
+	// 启动威胁情报源定时刷新
+	feedManager, err := feed.GetFeedManager()
+	if err != nil {
+		config.Logger.Error().Err(err).Msg("Failed to create threat feed manager")
+		return
+	}
+	feedManager.Start()
+
 	// Set Gin mode based on configuration
 	if config.Global.IsProduction {
 		gin.SetMode(gin.ReleaseMode)
@@ -87,8 +111,12 @@ func main() {
 	// Initialize the Gin route
 	route := gin.New()
 
+	// 服务中的后台任务（如日志变更流监听）在关闭时随 appCtx 取消
+	appCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
 	// Setup the router
-	router.Setup(route, db)
+	router.Setup(appCtx, route, db)
 
 	// 初始化验证器
 	validator.InitValidators()
@@ -162,8 +190,20 @@ func main() {
 		config.Logger.Info().Msg("Server shutdown gracefully")
 	}
 
-	// 停止后台服务
-	err = runner.StopServices()
+	// 停止服务中的后台任务
+	stopApp()
+
+	// 停止日志归档器
+	logArchiver.Stop()
+
+	// 停止配置变更监听
+	configWatcher.Stop()
+
+	// 停止威胁情报源定时刷新
+	feedManager.Stop()
+
+	// 优雅停止后台服务，等待进行中的请求和事务处理完成
+	err = runner.DrainServices()
 	if err != nil {
 		config.Logger.Error().Err(err).Msg("Failed to stop daemon services")
 	}
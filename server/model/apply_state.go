@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// ApplyStateID 配置生效状态记录的固定ID，集合中只有这一条记录
+const ApplyStateID = "haproxy"
+
+// ApplyState 配置生效状态，服务重启后据此判断哪些版本尚未生效
+type ApplyState struct {
+	ID        string    `bson:"_id"`       // 固定为 ApplyStateID
+	AppliedAt time.Time `bson:"appliedAt"` // 最近一次配置生效的时间
+}
+
+// GetCollectionName 返回集合名称
+func (a *ApplyState) GetCollectionName() string {
+	return "apply_state"
+}
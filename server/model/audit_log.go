@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// 审计动作常量
+const (
+	AuditActionWAFLogExport = "waf:log:export" // 导出WAF日志
+	AuditActionChangesApply = "changes:apply"  // 应用配置变更
+)
+
+// AuditLog 审计日志，记录用户的敏感操作
+type AuditLog struct {
+	ID        bson.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"` // 审计日志ID
+	UserID    string         `bson:"userId" json:"userId"`              // 操作用户ID
+	Username  string         `bson:"username" json:"username"`          // 操作用户名
+	Action    string         `bson:"action" json:"action"`              // 操作类型
+	RequestID string         `bson:"requestId" json:"requestId"`        // 请求ID
+	ClientIP  string         `bson:"clientIp" json:"clientIp"`          // 客户端IP
+	Success   bool           `bson:"success" json:"success"`            // 操作是否成功
+	Error     string         `bson:"error,omitempty" json:"error,omitempty"`
+	Details   map[string]any `bson:"details,omitempty" json:"details,omitempty"` // 操作详情
+	CreatedAt time.Time      `bson:"createdAt" json:"createdAt"`
+}
+
+// GetCollectionName 返回集合名称
+func (a *AuditLog) GetCollectionName() string {
+	return "audit_log"
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// 版本化资源类型
+const (
+	RevisionResourceConfig      = "config"      // 系统配置
+	RevisionResourceSite        = "site"        // 站点
+	RevisionResourceRule        = "rule"        // 自定义规则
+	RevisionResourceCertificate = "certificate" // 证书
+)
+
+// 版本变更动作
+const (
+	RevisionActionCreate   = "create"   // 创建
+	RevisionActionUpdate   = "update"   // 更新
+	RevisionActionDelete   = "delete"   // 删除
+	RevisionActionRollback = "rollback" // 回滚
+)
+
+// Revision 资源的不可变版本快照，每次变更写入一条
+type Revision struct {
+	ID           bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`                // 版本ID
+	ResourceType string        `bson:"resourceType" json:"resourceType" example:"site"`  // 资源类型
+	ResourceID   string        `bson:"resourceId" json:"resourceId"`                     // 资源ID，系统配置为配置名称
+	ResourceName string        `bson:"resourceName" json:"resourceName"`                 // 资源名称
+	Version      int           `bson:"version" json:"version" example:"3"`               // 资源内递增的版本号
+	Action       string        `bson:"action" json:"action" example:"update"`            // 变更动作
+	Deleted      bool          `bson:"deleted" json:"deleted"`                           // 该版本中资源是否已删除
+	RollbackOf   string        `bson:"rollbackOf,omitempty" json:"rollbackOf,omitempty"` // 回滚时指向目标版本ID
+	Snapshot     bson.Raw      `bson:"snapshot" json:"-"`                                // 变更后的资源快照，删除时为删除前的状态
+	AuthorID     string        `bson:"authorId" json:"authorId"`                         // 操作用户ID
+	Author       string        `bson:"author" json:"author"`                             // 操作用户名
+	CreatedAt    time.Time     `bson:"createdAt" json:"createdAt"`                       // 创建时间
+}
+
+// GetCollectionName 返回集合名称
+func (r *Revision) GetCollectionName() string {
+	return "revision"
+}
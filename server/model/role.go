@@ -34,6 +34,12 @@ const (
 	PermConfigRead   = "config:read"
 	PermConfigUpdate = "config:update"
 
+	// 规则管理权限（自定义规则与规则排除）
+	PermRuleCreate = "rule:create"
+	PermRuleRead   = "rule:read"
+	PermRuleUpdate = "rule:update"
+	PermRuleDelete = "rule:delete"
+
 	// 审计日志权限
 	PermAuditRead = "audit:read"
 
@@ -67,6 +73,7 @@ func GetDefaultRolePermissions() map[string][]string {
 			PermSystemRestart, PermSystemStatus,
 			PermWAFLogRead,
 			PermCertCreate, PermCertRead, PermCertUpdate, PermCertDelete,
+			PermRuleCreate, PermRuleRead, PermRuleUpdate, PermRuleDelete,
 		},
 		RoleAuditor: {
 			// 审计员可以查看用户、站点、配置和审计日志
@@ -77,6 +84,7 @@ func GetDefaultRolePermissions() map[string][]string {
 			PermSystemStatus,
 			PermWAFLogRead,
 			PermCertRead,
+			PermRuleRead,
 		},
 		RoleConfigurator: {
 			// 配置管理员可以管理站点和配置
@@ -85,6 +93,7 @@ func GetDefaultRolePermissions() map[string][]string {
 			PermSystemStatus,
 			PermWAFLogRead,
 			PermCertRead, PermCertUpdate, PermCertDelete,
+			PermRuleCreate, PermRuleRead, PermRuleUpdate, PermRuleDelete,
 		},
 		RoleUser: {
 			// 普通用户只能查看站点和系统状态
@@ -3,6 +3,7 @@ package model
 import (
 	"time"
 
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
@@ -16,18 +17,23 @@ const (
 
 // Site 代表一个站点配置
 type Site struct {
-	ID           bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`                  // 站点ID
-	Name         string        `bson:"name" json:"name"`                                   // 站点名称
-	Domain       string        `bson:"domain" json:"domain"`                               // 域名，如 a.com
-	ListenPort   int           `bson:"listenPort" json:"listenPort"`                       // 监听端口，如 9000
-	EnableHTTPS  bool          `bson:"enableHTTPS" json:"enableHTTPS"`                     // 是否启用HTTPS
-	Certificate  Certificate   `bson:"certificate,omitempty" json:"certificate,omitempty"` // 证书信息
-	Backend      Backend       `bson:"backend" json:"backend"`                             // 后端服务器配置
-	WAFEnabled   bool          `bson:"wafEnabled" json:"wafEnabled"`                       // 是否启用WAF
-	WAFMode      WAFMode       `bson:"wafMode" json:"wafMode"`                             // WAF防护模式
-	CreatedAt    time.Time     `bson:"createdAt" json:"createdAt"`
-	UpdatedAt    time.Time     `bson:"updatedAt" json:"updatedAt"`
-	ActiveStatus bool          `bson:"activeStatus" json:"activeStatus"` // 站点是否激活
+	ID             bson.ObjectID            `bson:"_id,omitempty" json:"id,omitempty"`                        // 站点ID
+	Name           string                   `bson:"name" json:"name"`                                         // 站点名称
+	Domain         string                   `bson:"domain" json:"domain"`                                     // 域名，如 a.com
+	ListenPort     int                      `bson:"listenPort" json:"listenPort"`                             // 监听端口，如 9000
+	EnableHTTPS    bool                     `bson:"enableHTTPS" json:"enableHTTPS"`                           // 是否启用HTTPS
+	EnableHTTP2    bool                     `bson:"enableHTTP2" json:"enableHTTP2"`                           // 是否启用HTTP/2（HTTPS 为 h2，HTTP 为 h2c）
+	Certificate    Certificate              `bson:"certificate,omitempty" json:"certificate,omitempty"`       // 证书信息
+	Backend        Backend                  `bson:"backend" json:"backend"`                                   // 后端服务器配置
+	WAFEnabled     bool                     `bson:"wafEnabled" json:"wafEnabled"`                             // 是否启用WAF
+	WAFMode        WAFMode                  `bson:"wafMode" json:"wafMode"`                                   // WAF防护模式
+	BodyInspection *pkgmodel.BodyInspection `bson:"bodyInspection,omitempty" json:"bodyInspection,omitempty"` // 请求体检测配置，未配置时使用引擎默认设置
+	BlockPage      *pkgmodel.BlockPage      `bson:"blockPage,omitempty" json:"blockPage,omitempty"`           // 拦截页面，未配置的字段使用全局配置
+	GeoPolicy      *pkgmodel.GeoPolicy      `bson:"geoPolicy,omitempty" json:"geoPolicy,omitempty"`           // 国家访问策略，需要启用 GeoIP
+	IPLists        []string                 `bson:"ipLists,omitempty" json:"ipLists,omitempty"`               // 引用的 IP 信誉列表，来源IP命中时拒绝请求
+	CreatedAt      time.Time                `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time                `bson:"updatedAt" json:"updatedAt"`
+	ActiveStatus   bool                     `bson:"activeStatus" json:"activeStatus"` // 站点是否激活
 }
 
 // Certificate 代表证书信息
@@ -50,6 +56,7 @@ type Server struct {
 	Host  string `bson:"host" json:"host"`   // 主机地址，如 IP 或域名
 	Port  int    `bson:"port" json:"port"`   // 端口
 	IsSSL bool   `bson:"isSSL" json:"isSSL"` // 是否启用SSL
+	HTTP2 bool   `bson:"http2" json:"http2"` // 是否使用HTTP/2连接后端，gRPC 后端需要启用
 }
 
 // IsValidWAFMode 检查WAF模式是否有效
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// 威胁情报源默认值和限制
+const (
+	ThreatFeedDefaultInterval = 3600 // 默认刷新间隔（秒）
+	ThreatFeedMinInterval     = 300  // 最短刷新间隔（秒）
+)
+
+// ThreatFeed 威胁情报源，定期下载或读取本地文件，解析出的网段合并到指定的 IP 信誉列表
+type ThreatFeed struct {
+	ID        bson.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`                                                                    // 情报源ID
+	Name      string          `bson:"name" json:"name" example:"firehol-level1"`                                                            // 情报源名称
+	List      string          `bson:"list" json:"list" example:"firehol"`                                                                   // 合并到的 IP 信誉列表名称，多个情报源可以合并到同一列表
+	URL       string          `bson:"url,omitempty" json:"url,omitempty" example:"https://iplists.firehol.org/files/firehol_level1.netset"` // 下载地址，与 FilePath 二选一
+	FilePath  string          `bson:"filePath,omitempty" json:"filePath,omitempty" example:"/simple-waf/feeds/level1.netset"`               // 本地文件路径，用于无法访问外网的环境
+	Format    string          `bson:"format" json:"format" example:"text"`                                                                  // 列表格式：text、csv
+	CSVColumn int             `bson:"csvColumn" json:"csvColumn" example:"0"`                                                               // CSV 格式中 IP 所在的列，从 0 开始
+	Interval  int             `bson:"interval" json:"interval" example:"3600"`                                                              // 刷新间隔（秒）
+	Enabled   bool            `bson:"enabled" json:"enabled" example:"true"`                                                                // 是否启用，停用后条目不再参与列表合并
+	Entries   []string        `bson:"entries" json:"-"`                                                                                     // 最近一次成功刷新解析出的网段
+	Stats     ThreatFeedStats `bson:"stats" json:"stats"`                                                                                   // 刷新统计
+	CreatedAt time.Time       `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time       `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ThreatFeedStats 威胁情报源的刷新统计
+type ThreatFeedStats struct {
+	LastAttemptAt time.Time `bson:"lastAttemptAt" json:"lastAttemptAt"`             // 最近一次刷新时间
+	LastSuccessAt time.Time `bson:"lastSuccessAt" json:"lastSuccessAt"`             // 最近一次刷新成功的时间
+	LastError     string    `bson:"lastError,omitempty" json:"lastError,omitempty"` // 最近一次刷新失败的原因，成功后清空
+	Duration      int64     `bson:"duration" json:"duration" example:"850"`         // 最近一次刷新耗时（毫秒）
+	Bytes         int64     `bson:"bytes" json:"bytes" example:"102400"`            // 最近一次成功下载的字节数
+	Lines         int       `bson:"lines" json:"lines" example:"4500"`              // 最近一次成功解析的有效行数
+	Invalid       int       `bson:"invalid" json:"invalid" example:"2"`             // 最近一次成功解析时无法识别的行数
+	Entries       int       `bson:"entries" json:"entries" example:"4480"`          // 去重后的网段数
+	NotModified   bool      `bson:"notModified" json:"notModified"`                 // 最近一次下载时远端内容未变化
+	ETag          string    `bson:"etag,omitempty" json:"-"`                        // 远端返回的 ETag，用于条件请求
+	LastModified  string    `bson:"lastModified,omitempty" json:"-"`                // 远端返回的 Last-Modified，用于条件请求
+}
+
+// GetCollectionName 返回集合名称
+func (f *ThreatFeed) GetCollectionName() string {
+	return "threat_feed"
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// GetAppliedAt 读取持久化的最近一次配置生效时间，从未生效时返回零值
+func GetAppliedAt(ctx context.Context, collection *mongo.Collection) (time.Time, error) {
+	var state model.ApplyState
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: model.ApplyStateID}}).Decode(&state)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return time.Time{}, nil
+		}
+		config.Logger.Error().Err(err).Msg("查询配置生效时间时出错")
+		return time.Time{}, err
+	}
+	return state.AppliedAt, nil
+}
+
+// SaveAppliedAt 持久化最近一次配置生效时间
+func SaveAppliedAt(ctx context.Context, collection *mongo.Collection, appliedAt time.Time) error {
+	_, err := collection.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: model.ApplyStateID}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "appliedAt", Value: appliedAt}}}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		config.Logger.Error().Err(err).Msg("保存配置生效时间时出错")
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// AuditLogRepository 审计日志仓库
+type AuditLogRepository interface {
+	CreateAuditLog(ctx context.Context, auditLog *model.AuditLog) error
+	GetAuditLogs(ctx context.Context, filter bson.D, page, size int64) ([]model.AuditLog, int64, error)
+}
+
+// MongoAuditLogRepository 审计日志仓库实现
+type MongoAuditLogRepository struct {
+	collection *mongo.Collection
+	logger     zerolog.Logger
+}
+
+// NewAuditLogRepository 创建审计日志仓库
+func NewAuditLogRepository(db *mongo.Database) AuditLogRepository {
+	var auditLog model.AuditLog
+	collection := db.Collection(auditLog.GetCollectionName())
+	logger := config.GetRepositoryLogger("audit_log")
+
+	// 创建索引
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("创建审计日志索引失败")
+	}
+
+	return &MongoAuditLogRepository{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// CreateAuditLog 写入审计日志
+func (r *MongoAuditLogRepository) CreateAuditLog(ctx context.Context, auditLog *model.AuditLog) error {
+	if auditLog.CreatedAt.IsZero() {
+		auditLog.CreatedAt = time.Now()
+	}
+
+	result, err := r.collection.InsertOne(ctx, auditLog)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("写入审计日志失败")
+		return err
+	}
+
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		auditLog.ID = id
+	}
+
+	return nil
+}
+
+// GetAuditLogs 分页获取审计日志
+func (r *MongoAuditLogRepository) GetAuditLogs(ctx context.Context, filter bson.D, page, size int64) ([]model.AuditLog, int64, error) {
+	skip := (page - 1) * size
+
+	findOptions := options.Find().
+		SetSkip(skip).
+		SetLimit(size).
+		SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("统计审计日志数量失败")
+		return nil, 0, err
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询审计日志失败")
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []model.AuditLog
+	if err = cursor.All(ctx, &logs); err != nil {
+		r.logger.Error().Err(err).Msg("解析审计日志失败")
+		return nil, 0, err
+	}
+
+	return logs, total, nil
+}
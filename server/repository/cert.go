@@ -26,6 +26,7 @@ type CertificateRepository interface {
 	GetCertificateByID(ctx context.Context, id bson.ObjectID) (*model.CertificateStore, error)
 	UpdateCertificate(ctx context.Context, certificate *model.CertificateStore) error
 	DeleteCertificate(ctx context.Context, id bson.ObjectID) error
+	RestoreCertificate(ctx context.Context, certificate *model.CertificateStore) error
 	CheckCertificateNameExists(ctx context.Context, name string, excludeID bson.ObjectID) (bool, error)
 }
 
@@ -164,6 +165,23 @@ func (r *MongoCertificateRepository) DeleteCertificate(ctx context.Context, id b
 	return nil
 }
 
+// RestoreCertificate 按快照恢复证书，证书已删除时按原ID重新写入
+func (r *MongoCertificateRepository) RestoreCertificate(ctx context.Context, certificate *model.CertificateStore) error {
+	certificate.UpdatedAt = time.Now()
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.D{{Key: "_id", Value: certificate.ID}},
+		certificate,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", certificate.ID.Hex()).Msg("恢复证书时出错")
+		return err
+	}
+
+	return nil
+}
+
 // CheckCertificateNameExists 检查证书名称是否已存在
 func (r *MongoCertificateRepository) CheckCertificateNameExists(ctx context.Context, name string, excludeID bson.ObjectID) (bool, error) {
 	filter := bson.D{{Key: "name", Value: name}}
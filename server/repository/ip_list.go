@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrIPListNotFound = errors.New("IP 信誉列表不存在")
+
+// IPListRepository IP 信誉列表仓库
+type IPListRepository interface {
+	GetLists(ctx context.Context) ([]model.IPList, error)
+	GetListByName(ctx context.Context, name string) (*model.IPList, error)
+	SaveList(ctx context.Context, list *model.IPList) error
+	DeleteList(ctx context.Context, name string) error
+}
+
+// MongoIPListRepository IP 信誉列表仓库实现
+type MongoIPListRepository struct {
+	collection *mongo.Collection
+	logger     zerolog.Logger
+}
+
+// NewIPListRepository 创建 IP 信誉列表仓库
+func NewIPListRepository(db *mongo.Database) IPListRepository {
+	var list model.IPList
+	collection := db.Collection(list.GetCollectionName())
+	logger := config.GetRepositoryLogger("ip_list")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("创建 IP 信誉列表索引失败")
+	}
+
+	return &MongoIPListRepository{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// GetLists 获取全部列表，按名称排序，不返回条目
+func (r *MongoIPListRepository) GetLists(ctx context.Context) ([]model.IPList, error) {
+	cursor, err := r.collection.Find(ctx, bson.D{},
+		options.Find().SetProjection(bson.D{{Key: "entries", Value: 0}}).SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询 IP 信誉列表时出错")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var lists []model.IPList
+	if err = cursor.All(ctx, &lists); err != nil {
+		r.logger.Error().Err(err).Msg("解析 IP 信誉列表时出错")
+		return nil, err
+	}
+	return lists, nil
+}
+
+// GetListByName 根据名称获取列表，不返回条目
+func (r *MongoIPListRepository) GetListByName(ctx context.Context, name string) (*model.IPList, error) {
+	var list model.IPList
+	err := r.collection.FindOne(ctx, bson.D{{Key: "name", Value: name}},
+		options.FindOne().SetProjection(bson.D{{Key: "entries", Value: 0}})).Decode(&list)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrIPListNotFound
+		}
+		r.logger.Error().Err(err).Str("name", name).Msg("获取 IP 信誉列表时出错")
+		return nil, err
+	}
+	return &list, nil
+}
+
+// SaveList 按名称创建或替换列表
+func (r *MongoIPListRepository) SaveList(ctx context.Context, list *model.IPList) error {
+	_, err := r.collection.ReplaceOne(ctx,
+		bson.D{{Key: "name", Value: list.Name}},
+		list,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		r.logger.Error().Err(err).Str("name", list.Name).Msg("保存 IP 信誉列表时出错")
+		return err
+	}
+	return nil
+}
+
+// DeleteList 删除列表，列表不存在时不报错
+func (r *MongoIPListRepository) DeleteList(ctx context.Context, name string) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.D{{Key: "name", Value: name}}); err != nil {
+		r.logger.Error().Err(err).Str("name", name).Msg("删除 IP 信誉列表时出错")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("版本不存在")
+)
+
+// 并发写入同一资源版本时的重试次数
+const revisionInsertRetries = 3
+
+// RevisionRepository 版本仓库
+type RevisionRepository interface {
+	CreateRevision(ctx context.Context, revision *model.Revision) error
+	GetRevisionByID(ctx context.Context, id bson.ObjectID) (*model.Revision, error)
+	GetRevisions(ctx context.Context, filter bson.D, page, size int64) ([]model.Revision, int64, error)
+	GetLatestRevisionBefore(ctx context.Context, resourceType, resourceID string, before time.Time) (*model.Revision, error)
+}
+
+// MongoRevisionRepository 版本仓库实现
+type MongoRevisionRepository struct {
+	collection *mongo.Collection
+	logger     zerolog.Logger
+}
+
+// NewRevisionRepository 创建版本仓库
+func NewRevisionRepository(db *mongo.Database) RevisionRepository {
+	var revision model.Revision
+	collection := db.Collection(revision.GetCollectionName())
+	logger := config.GetRepositoryLogger("revision")
+
+	// 创建索引
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "resourceType", Value: 1},
+				{Key: "resourceId", Value: 1},
+				{Key: "version", Value: -1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("创建版本索引失败")
+	}
+
+	return &MongoRevisionRepository{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// CreateRevision 写入新版本，版本号为该资源当前最大版本号加一
+func (r *MongoRevisionRepository) CreateRevision(ctx context.Context, revision *model.Revision) error {
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+
+	var err error
+	for range revisionInsertRetries {
+		var latest model.Revision
+		err = r.collection.FindOne(ctx,
+			bson.D{
+				{Key: "resourceType", Value: revision.ResourceType},
+				{Key: "resourceId", Value: revision.ResourceID},
+			},
+			options.FindOne().
+				SetSort(bson.D{{Key: "version", Value: -1}}).
+				SetProjection(bson.D{{Key: "version", Value: 1}}),
+		).Decode(&latest)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			r.logger.Error().Err(err).Msg("查询最新版本失败")
+			return err
+		}
+		revision.Version = latest.Version + 1
+
+		var result *mongo.InsertOneResult
+		result, err = r.collection.InsertOne(ctx, revision)
+		if err == nil {
+			if id, ok := result.InsertedID.(bson.ObjectID); ok {
+				revision.ID = id
+			}
+			return nil
+		}
+		// 并发写入导致版本号冲突时重试
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+
+	r.logger.Error().Err(err).
+		Str("resourceType", revision.ResourceType).
+		Str("resourceId", revision.ResourceID).
+		Msg("写入版本失败")
+	return err
+}
+
+// GetRevisionByID 根据ID获取版本（包含快照）
+func (r *MongoRevisionRepository) GetRevisionByID(ctx context.Context, id bson.ObjectID) (*model.Revision, error) {
+	var revision model.Revision
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&revision)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRevisionNotFound
+		}
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("查询版本失败")
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// GetRevisions 分页获取版本列表，不返回快照内容
+func (r *MongoRevisionRepository) GetRevisions(ctx context.Context, filter bson.D, page, size int64) ([]model.Revision, int64, error) {
+	skip := (page - 1) * size
+
+	findOptions := options.Find().
+		SetSkip(skip).
+		SetLimit(size).
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetProjection(bson.D{{Key: "snapshot", Value: 0}})
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("统计版本数量失败")
+		return nil, 0, err
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询版本列表失败")
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var revisions []model.Revision
+	if err := cursor.All(ctx, &revisions); err != nil {
+		r.logger.Error().Err(err).Msg("解析版本列表失败")
+		return nil, 0, err
+	}
+
+	return revisions, total, nil
+}
+
+// GetLatestRevisionBefore 获取资源在指定时间（含）之前的最新版本（包含快照）
+func (r *MongoRevisionRepository) GetLatestRevisionBefore(ctx context.Context, resourceType, resourceID string, before time.Time) (*model.Revision, error) {
+	var revision model.Revision
+	err := r.collection.FindOne(ctx,
+		bson.D{
+			{Key: "resourceType", Value: resourceType},
+			{Key: "resourceId", Value: resourceID},
+			{Key: "createdAt", Value: bson.D{{Key: "$lte", Value: before}}},
+		},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}),
+	).Decode(&revision)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRevisionNotFound
+		}
+		r.logger.Error().Err(err).Str("resourceType", resourceType).Str("resourceId", resourceID).Msg("查询历史版本失败")
+		return nil, err
+	}
+	return &revision, nil
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrRuleNotFound = errors.New("规则不存在")
+	ErrRuleIDExists = errors.New("规则ID已被其他自定义规则使用")
+)
+
+// RuleRepository 自定义规则仓库
+type RuleRepository interface {
+	CreateRule(ctx context.Context, rule *model.Rule) error
+	GetRuleByID(ctx context.Context, id bson.ObjectID) (*model.Rule, error)
+	GetRules(ctx context.Context, filter bson.D, page, size int64) ([]model.Rule, int64, error)
+	GetAllRules(ctx context.Context) ([]model.Rule, error)
+	UpdateRule(ctx context.Context, rule *model.Rule) error
+	DeleteRule(ctx context.Context, id bson.ObjectID) error
+	RestoreRule(ctx context.Context, rule *model.Rule) error
+	CheckRuleIDExists(ctx context.Context, ruleID int, excludeID bson.ObjectID) error
+}
+
+// MongoRuleRepository 自定义规则仓库实现
+type MongoRuleRepository struct {
+	collection *mongo.Collection
+	logger     zerolog.Logger
+}
+
+// NewRuleRepository 创建自定义规则仓库
+func NewRuleRepository(db *mongo.Database) RuleRepository {
+	var rule model.Rule
+	collection := db.Collection(rule.GetCollectionName())
+	logger := config.GetRepositoryLogger("rule")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 规则ID唯一索引
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ruleId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("创建规则ID索引失败")
+	}
+
+	return &MongoRuleRepository{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// CreateRule 创建规则
+func (r *MongoRuleRepository) CreateRule(ctx context.Context, rule *model.Rule) error {
+	now := time.Now()
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, rule)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrRuleIDExists
+		}
+		r.logger.Error().Err(err).Msg("插入规则时出错")
+		return err
+	}
+
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		rule.ID = id
+	}
+
+	return nil
+}
+
+// GetRuleByID 根据ID获取规则
+func (r *MongoRuleRepository) GetRuleByID(ctx context.Context, id bson.ObjectID) (*model.Rule, error) {
+	var rule model.Rule
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&rule)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRuleNotFound
+		}
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("获取规则时出错")
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// GetRules 分页获取规则
+func (r *MongoRuleRepository) GetRules(ctx context.Context, filter bson.D, page, size int64) ([]model.Rule, int64, error) {
+	skip := (page - 1) * size
+
+	findOptions := options.Find().
+		SetSkip(skip).
+		SetLimit(size).
+		SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "ruleId", Value: 1}})
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("统计规则数量时出错")
+		return nil, 0, err
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询规则时出错")
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var rules []model.Rule
+	if err = cursor.All(ctx, &rules); err != nil {
+		r.logger.Error().Err(err).Msg("解析规则时出错")
+		return nil, 0, err
+	}
+
+	return rules, total, nil
+}
+
+// GetAllRules 获取全部规则，用于组装指令
+func (r *MongoRuleRepository) GetAllRules(ctx context.Context) ([]model.Rule, error) {
+	cursor, err := r.collection.Find(ctx, bson.D{})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询规则时出错")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rules []model.Rule
+	if err = cursor.All(ctx, &rules); err != nil {
+		r.logger.Error().Err(err).Msg("解析规则时出错")
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// UpdateRule 更新规则
+func (r *MongoRuleRepository) UpdateRule(ctx context.Context, rule *model.Rule) error {
+	rule.UpdatedAt = time.Now()
+
+	result, err := r.collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: rule.ID}}, rule)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrRuleIDExists
+		}
+		r.logger.Error().Err(err).Str("id", rule.ID.Hex()).Msg("更新规则时出错")
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRuleNotFound
+	}
+
+	return nil
+}
+
+// DeleteRule 删除规则
+func (r *MongoRuleRepository) DeleteRule(ctx context.Context, id bson.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("删除规则时出错")
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// RestoreRule 按快照恢复规则，规则已删除时按原ID重新写入
+func (r *MongoRuleRepository) RestoreRule(ctx context.Context, rule *model.Rule) error {
+	rule.UpdatedAt = time.Now()
+
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.D{{Key: "_id", Value: rule.ID}},
+		rule,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrRuleIDExists
+		}
+		r.logger.Error().Err(err).Str("id", rule.ID.Hex()).Msg("恢复规则时出错")
+		return err
+	}
+
+	return nil
+}
+
+// CheckRuleIDExists 检查规则ID是否已被其他规则使用
+func (r *MongoRuleRepository) CheckRuleIDExists(ctx context.Context, ruleID int, excludeID bson.ObjectID) error {
+	filter := bson.D{{Key: "ruleId", Value: ruleID}}
+	if !excludeID.IsZero() {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$ne", Value: excludeID}}})
+	}
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		r.logger.Error().Err(err).Int("ruleId", ruleID).Msg("检查规则ID时出错")
+		return err
+	}
+	if count > 0 {
+		return ErrRuleIDExists
+	}
+	return nil
+}
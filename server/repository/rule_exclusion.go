@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrExclusionNotFound = errors.New("规则排除不存在")
+	ErrExclusionRevoked  = errors.New("规则排除已撤销")
+)
+
+// RuleExclusionRepository 规则排除仓库
+type RuleExclusionRepository interface {
+	CreateExclusion(ctx context.Context, exclusion *model.RuleExclusion) error
+	GetExclusionByID(ctx context.Context, id bson.ObjectID) (*model.RuleExclusion, error)
+	GetExclusions(ctx context.Context, filter bson.D, page, size int64) ([]model.RuleExclusion, int64, error)
+	GetActiveExclusions(ctx context.Context) ([]model.RuleExclusion, error)
+	RevokeExclusion(ctx context.Context, id bson.ObjectID, revokedBy string) (*model.RuleExclusion, error)
+}
+
+// MongoRuleExclusionRepository 规则排除仓库实现
+type MongoRuleExclusionRepository struct {
+	collection *mongo.Collection
+	logger     zerolog.Logger
+}
+
+// NewRuleExclusionRepository 创建规则排除仓库
+func NewRuleExclusionRepository(db *mongo.Database) RuleExclusionRepository {
+	var exclusion model.RuleExclusion
+	collection := db.Collection(exclusion.GetCollectionName())
+	logger := config.GetRepositoryLogger("rule_exclusion")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "revoked", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "ruleId", Value: 1}}},
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("创建规则排除索引失败")
+	}
+
+	return &MongoRuleExclusionRepository{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// CreateExclusion 创建规则排除
+func (r *MongoRuleExclusionRepository) CreateExclusion(ctx context.Context, exclusion *model.RuleExclusion) error {
+	now := time.Now()
+	exclusion.CreatedAt = now
+	exclusion.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, exclusion)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("插入规则排除时出错")
+		return err
+	}
+
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		exclusion.ID = id
+	}
+
+	return nil
+}
+
+// GetExclusionByID 根据ID获取规则排除
+func (r *MongoRuleExclusionRepository) GetExclusionByID(ctx context.Context, id bson.ObjectID) (*model.RuleExclusion, error) {
+	var exclusion model.RuleExclusion
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&exclusion)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrExclusionNotFound
+		}
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("获取规则排除时出错")
+		return nil, err
+	}
+	return &exclusion, nil
+}
+
+// GetExclusions 分页获取规则排除
+func (r *MongoRuleExclusionRepository) GetExclusions(ctx context.Context, filter bson.D, page, size int64) ([]model.RuleExclusion, int64, error) {
+	skip := (page - 1) * size
+
+	findOptions := options.Find().
+		SetSkip(skip).
+		SetLimit(size).
+		SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("统计规则排除数量时出错")
+		return nil, 0, err
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询规则排除时出错")
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var exclusions []model.RuleExclusion
+	if err = cursor.All(ctx, &exclusions); err != nil {
+		r.logger.Error().Err(err).Msg("解析规则排除时出错")
+		return nil, 0, err
+	}
+
+	return exclusions, total, nil
+}
+
+// GetActiveExclusions 获取所有未撤销的规则排除，按创建时间排序
+func (r *MongoRuleExclusionRepository) GetActiveExclusions(ctx context.Context) ([]model.RuleExclusion, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.D{{Key: "revoked", Value: false}}, findOptions)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询规则排除时出错")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var exclusions []model.RuleExclusion
+	if err = cursor.All(ctx, &exclusions); err != nil {
+		r.logger.Error().Err(err).Msg("解析规则排除时出错")
+		return nil, err
+	}
+
+	return exclusions, nil
+}
+
+// RevokeExclusion 撤销规则排除，保留记录以便追溯
+func (r *MongoRuleExclusionRepository) RevokeExclusion(ctx context.Context, id bson.ObjectID, revokedBy string) (*model.RuleExclusion, error) {
+	now := time.Now()
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "revoked", Value: true},
+		{Key: "revokedBy", Value: revokedBy},
+		{Key: "revokedAt", Value: now},
+		{Key: "updatedAt", Value: now},
+	}}}
+
+	var exclusion model.RuleExclusion
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		bson.D{{Key: "_id", Value: id}, {Key: "revoked", Value: false}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&exclusion)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// 区分不存在和已撤销
+			if _, getErr := r.GetExclusionByID(ctx, id); getErr != nil {
+				return nil, getErr
+			}
+			return nil, ErrExclusionRevoked
+		}
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("撤销规则排除时出错")
+		return nil, err
+	}
+
+	return &exclusion, nil
+}
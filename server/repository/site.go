@@ -27,6 +27,7 @@ type SiteRepository interface {
 	GetSiteByID(ctx context.Context, id bson.ObjectID) (*model.Site, error)
 	UpdateSite(ctx context.Context, site *model.Site) error
 	DeleteSite(ctx context.Context, id bson.ObjectID) error
+	RestoreSite(ctx context.Context, site *model.Site) error
 	CheckDomainPortExists(ctx context.Context, site *model.Site) error
 	CheckDomainPortConflict(ctx context.Context, site *model.Site) error
 }
@@ -151,6 +152,23 @@ func (r *MongoSiteRepository) DeleteSite(ctx context.Context, id bson.ObjectID)
 	return nil
 }
 
+// RestoreSite 按快照恢复站点，站点已删除时按原ID重新写入
+func (r *MongoSiteRepository) RestoreSite(ctx context.Context, site *model.Site) error {
+	site.UpdatedAt = time.Now()
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.D{{Key: "_id", Value: site.ID}},
+		site,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", site.ID.Hex()).Msg("恢复站点时出错")
+		return err
+	}
+
+	return nil
+}
+
 func (r *MongoSiteRepository) CheckDomainPortExists(ctx context.Context, site *model.Site) error {
 	// 检查域名和端口组合是否已存在
 	filter := bson.D{
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrThreatFeedNotFound   = errors.New("威胁情报源不存在")
+	ErrThreatFeedNameExists = errors.New("威胁情报源名称已存在")
+)
+
+// withoutEntries 查询情报源时不返回网段条目
+var withoutEntries = bson.D{{Key: "entries", Value: 0}}
+
+// ThreatFeedRepository 威胁情报源仓库
+type ThreatFeedRepository interface {
+	CreateFeed(ctx context.Context, feed *model.ThreatFeed) error
+	GetFeedByID(ctx context.Context, id bson.ObjectID) (*model.ThreatFeed, error)
+	GetFeeds(ctx context.Context) ([]model.ThreatFeed, error)
+	GetEnabledFeedsByList(ctx context.Context, list string) ([]model.ThreatFeed, error)
+	UpdateFeed(ctx context.Context, feed *model.ThreatFeed) error
+	DeleteFeed(ctx context.Context, id bson.ObjectID) error
+	SaveRefreshResult(ctx context.Context, id bson.ObjectID, stats model.ThreatFeedStats, entries []string) error
+}
+
+// MongoThreatFeedRepository 威胁情报源仓库实现
+type MongoThreatFeedRepository struct {
+	collection *mongo.Collection
+	logger     zerolog.Logger
+}
+
+// NewThreatFeedRepository 创建威胁情报源仓库
+func NewThreatFeedRepository(db *mongo.Database) ThreatFeedRepository {
+	var feed model.ThreatFeed
+	collection := db.Collection(feed.GetCollectionName())
+	logger := config.GetRepositoryLogger("threat_feed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "list", Value: 1}}},
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("创建威胁情报源索引失败")
+	}
+
+	return &MongoThreatFeedRepository{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// CreateFeed 创建情报源
+func (r *MongoThreatFeedRepository) CreateFeed(ctx context.Context, feed *model.ThreatFeed) error {
+	now := time.Now()
+	feed.CreatedAt = now
+	feed.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, feed)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrThreatFeedNameExists
+		}
+		r.logger.Error().Err(err).Msg("插入威胁情报源时出错")
+		return err
+	}
+
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		feed.ID = id
+	}
+	return nil
+}
+
+// GetFeedByID 根据ID获取情报源，不返回网段条目
+func (r *MongoThreatFeedRepository) GetFeedByID(ctx context.Context, id bson.ObjectID) (*model.ThreatFeed, error) {
+	var feed model.ThreatFeed
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}, options.FindOne().SetProjection(withoutEntries)).Decode(&feed)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrThreatFeedNotFound
+		}
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("获取威胁情报源时出错")
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// GetFeeds 获取全部情报源，按名称排序，不返回网段条目
+func (r *MongoThreatFeedRepository) GetFeeds(ctx context.Context) ([]model.ThreatFeed, error) {
+	cursor, err := r.collection.Find(ctx, bson.D{},
+		options.Find().SetProjection(withoutEntries).SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询威胁情报源时出错")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var feeds []model.ThreatFeed
+	if err = cursor.All(ctx, &feeds); err != nil {
+		r.logger.Error().Err(err).Msg("解析威胁情报源时出错")
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// GetEnabledFeedsByList 获取合并到指定列表的启用情报源，包含网段条目
+func (r *MongoThreatFeedRepository) GetEnabledFeedsByList(ctx context.Context, list string) ([]model.ThreatFeed, error) {
+	cursor, err := r.collection.Find(ctx,
+		bson.D{{Key: "list", Value: list}, {Key: "enabled", Value: true}},
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		r.logger.Error().Err(err).Str("list", list).Msg("查询威胁情报源时出错")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var feeds []model.ThreatFeed
+	if err = cursor.All(ctx, &feeds); err != nil {
+		r.logger.Error().Err(err).Str("list", list).Msg("解析威胁情报源时出错")
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// UpdateFeed 更新情报源设置，不修改网段条目和刷新统计
+func (r *MongoThreatFeedRepository) UpdateFeed(ctx context.Context, feed *model.ThreatFeed) error {
+	feed.UpdatedAt = time.Now()
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: feed.ID}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "name", Value: feed.Name},
+			{Key: "list", Value: feed.List},
+			{Key: "url", Value: feed.URL},
+			{Key: "filePath", Value: feed.FilePath},
+			{Key: "format", Value: feed.Format},
+			{Key: "csvColumn", Value: feed.CSVColumn},
+			{Key: "interval", Value: feed.Interval},
+			{Key: "enabled", Value: feed.Enabled},
+			{Key: "updatedAt", Value: feed.UpdatedAt},
+		}}},
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrThreatFeedNameExists
+		}
+		r.logger.Error().Err(err).Str("id", feed.ID.Hex()).Msg("更新威胁情报源时出错")
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrThreatFeedNotFound
+	}
+	return nil
+}
+
+// DeleteFeed 删除情报源
+func (r *MongoThreatFeedRepository) DeleteFeed(ctx context.Context, id bson.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("删除威胁情报源时出错")
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrThreatFeedNotFound
+	}
+	return nil
+}
+
+// SaveRefreshResult 保存刷新统计，entries 为 nil 时保留上次成功刷新的条目
+func (r *MongoThreatFeedRepository) SaveRefreshResult(ctx context.Context, id bson.ObjectID, stats model.ThreatFeedStats, entries []string) error {
+	set := bson.D{{Key: "stats", Value: stats}}
+	if entries != nil {
+		set = append(set, bson.E{Key: "entries", Value: entries})
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, bson.D{{Key: "$set", Value: set}})
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("保存威胁情报源刷新结果时出错")
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrThreatFeedNotFound
+	}
+	return nil
+}
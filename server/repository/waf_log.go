@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"sort"
@@ -16,11 +17,20 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+var ErrWAFLogNotFound = errors.New("WAF日志不存在")
+
 type WAFLogRepository interface {
 	AggregateAttackEvents(ctx context.Context, pipeline mongo.Pipeline) ([]dto.AttackEventAggregateResult, error)
 	CountAggregateAttackEvents(ctx context.Context, pipeline mongo.Pipeline) (int64, error)
+	AggregateAnomalyScores(ctx context.Context, pipeline mongo.Pipeline) (*dto.AnomalyScoreStatsResponse, error)
+	AggregateGeoStats(ctx context.Context, pipeline mongo.Pipeline) (*dto.GeoStatsResponse, error)
 	FindAttackLogs(ctx context.Context, filter bson.D, skip int64, limit int64) ([]model.WAFLog, error)
 	CountAttackLogs(ctx context.Context, filter bson.D) (int64, error)
+	FindLogByID(ctx context.Context, id bson.ObjectID) (*model.WAFLog, error)
+	StreamAttackLogs(ctx context.Context, filter bson.D, projection bson.D, limit int64, fn func(*model.WAFLog) error) (int64, error)
+	FindLogsBefore(ctx context.Context, cutoff time.Time, limit int64) ([]model.WAFLog, error)
+	DeleteLogsByIDs(ctx context.Context, ids []bson.ObjectID) (int64, error)
+	ApplyRetention(ctx context.Context, retention model.LogRetention) error
 }
 
 type MongoWAFLogRepository struct {
@@ -170,6 +180,190 @@ func (r *MongoWAFLogRepository) CountAttackLogs(ctx context.Context, filter bson
 	return total, nil
 }
 
+// AggregateAnomalyScores 执行异常评分统计管道，管道以 $facet 输出 summary、distribution、categories 三个分组
+func (r *MongoWAFLogRepository) AggregateAnomalyScores(
+	ctx context.Context,
+	pipeline mongo.Pipeline,
+) (*dto.AnomalyScoreStatsResponse, error) {
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error executing anomaly score aggregation: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var facet struct {
+		Summary      []dto.AnomalyScoreSummary `bson:"summary"`
+		Distribution []dto.AnomalyScoreBucket  `bson:"distribution"`
+		Categories   []dto.AnomalyCategoryStat `bson:"categories"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&facet); err != nil {
+			return nil, fmt.Errorf("error decoding anomaly score result: %w", err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	result := &dto.AnomalyScoreStatsResponse{
+		Distribution: facet.Distribution,
+		Categories:   facet.Categories,
+	}
+	if len(facet.Summary) > 0 {
+		result.Summary = facet.Summary[0]
+	}
+	if result.Distribution == nil {
+		result.Distribution = []dto.AnomalyScoreBucket{}
+	}
+	if result.Categories == nil {
+		result.Categories = []dto.AnomalyCategoryStat{}
+	}
+	return result, nil
+}
+
+// AggregateGeoStats 执行地理位置统计管道，管道以 $facet 输出 summary、countries、asns 三个分组
+func (r *MongoWAFLogRepository) AggregateGeoStats(
+	ctx context.Context,
+	pipeline mongo.Pipeline,
+) (*dto.GeoStatsResponse, error) {
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error executing geo stats aggregation: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var facet struct {
+		Summary []struct {
+			Total   int64 `bson:"total"`
+			Located int64 `bson:"located"`
+		} `bson:"summary"`
+		Countries []dto.GeoCountryStat `bson:"countries"`
+		ASNs      []dto.GeoASNStat     `bson:"asns"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&facet); err != nil {
+			return nil, fmt.Errorf("error decoding geo stats result: %w", err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	result := &dto.GeoStatsResponse{
+		Countries: facet.Countries,
+		ASNs:      facet.ASNs,
+	}
+	if len(facet.Summary) > 0 {
+		result.Total = facet.Summary[0].Total
+		result.Located = facet.Summary[0].Located
+	}
+	if result.Countries == nil {
+		result.Countries = []dto.GeoCountryStat{}
+	}
+	if result.ASNs == nil {
+		result.ASNs = []dto.GeoASNStat{}
+	}
+	return result, nil
+}
+
+// FindLogByID finds a single log by its id
+func (r *MongoWAFLogRepository) FindLogByID(ctx context.Context, id bson.ObjectID) (*model.WAFLog, error) {
+	var wafLog model.WAFLog
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&wafLog)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrWAFLogNotFound
+		}
+		return nil, fmt.Errorf("error finding log: %w", err)
+	}
+	return &wafLog, nil
+}
+
+// StreamAttackLogs iterates over matching logs with a cursor and calls fn for each document.
+// limit <= 0 means no limit. It returns the number of documents handed to fn.
+func (r *MongoWAFLogRepository) StreamAttackLogs(
+	ctx context.Context,
+	filter bson.D,
+	projection bson.D,
+	limit int64,
+	fn func(*model.WAFLog) error,
+) (int64, error) {
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}). // 最近的优先
+		SetBatchSize(500)
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+	if len(projection) > 0 {
+		findOptions.SetProjection(projection)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return 0, fmt.Errorf("error executing find query: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var count int64
+	for cursor.Next(ctx) {
+		var wafLog model.WAFLog
+		if err := cursor.Decode(&wafLog); err != nil {
+			return count, fmt.Errorf("error decoding document: %w", err)
+		}
+		if err := fn(&wafLog); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	if err := cursor.Err(); err != nil {
+		return count, fmt.Errorf("cursor error: %w", err)
+	}
+	return count, nil
+}
+
+// FindLogsBefore finds the oldest logs created before cutoff, used by the archive task
+func (r *MongoWAFLogRepository) FindLogsBefore(ctx context.Context, cutoff time.Time, limit int64) ([]model.WAFLog, error) {
+	findOptions := options.Find().
+		SetLimit(limit).
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}) // 最早的优先
+
+	filter := bson.D{{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: cutoff.UTC()}}}}
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error executing find query: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []model.WAFLog
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("error decoding query results: %w", err)
+	}
+
+	return results, nil
+}
+
+// DeleteLogsByIDs deletes logs by their ids and returns the number of deleted documents
+func (r *MongoWAFLogRepository) DeleteLogsByIDs(ctx context.Context, ids []bson.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return 0, fmt.Errorf("error deleting logs: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// ApplyRetention updates the waf_log and audit log indexes to match the retention policy
+func (r *MongoWAFLogRepository) ApplyRetention(ctx context.Context, retention model.LogRetention) error {
+	if err := config.EnsureWAFLogIndexes(ctx, r.collection, retention); err != nil {
+		return err
+	}
+	return config.EnsureAuditIndexes(ctx, r.collection.Database(), retention)
+}
+
 // calculateAttackDuration calculates the duration of a continuous attack
 // by finding the longest sequence of attacks with gaps no larger than 5 minutes
 func (r *MongoWAFLogRepository) calculateAttackDuration(attackTimes []time.Time) float64 {
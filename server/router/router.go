@@ -1,9 +1,11 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"strings"
 
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/controller"
 	"github.com/HUAHUAI23/simple-waf/server/middleware"
 	"github.com/HUAHUAI23/simple-waf/server/model"
@@ -16,7 +18,8 @@ import (
 )
 
 // Setup configures all the routes for the application
-func Setup(route *gin.Engine, db *mongo.Database) {
+// ctx 在服务关闭时取消，用于停止服务中的后台任务
+func Setup(ctx context.Context, route *gin.Engine, db *mongo.Database) {
 	// 基础中间件
 	route.Use(middleware.RequestID())
 	route.Use(middleware.Logger())
@@ -30,20 +33,43 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 	wafLogRepo := repository.NewWAFLogRepository(db)
 	certRepo := repository.NewCertificateRepository(db)
 	configRepo := repository.NewConfigRepository(db)
+	auditLogRepo := repository.NewAuditLogRepository(db)
+	exclusionRepo := repository.NewRuleExclusionRepository(db)
+	ruleRepo := repository.NewRuleRepository(db)
+	revisionRepo := repository.NewRevisionRepository(db)
+	threatFeedRepo := repository.NewThreatFeedRepository(db)
+	ipListRepo := repository.NewIPListRepository(db)
 	// 创建服务
 	authService := service.NewAuthService(userRepo, roleRepo)
-	siteService := service.NewSiteService(siteRepo)
+	revisionService := service.NewRevisionService(revisionRepo, configRepo, siteRepo, ruleRepo, certRepo, wafLogRepo, db)
+	siteService := service.NewSiteService(siteRepo, revisionService)
 	wafLogService := service.NewWAFLogService(wafLogRepo)
-	certService := service.NewCertificateService(certRepo)
+	certService := service.NewCertificateService(certRepo, revisionService)
 	runnerService, _ := service.NewRunnerService()
-	configService := service.NewConfigService(configRepo)
+	configService := service.NewConfigService(configRepo, wafLogRepo, revisionService, db)
+	auditLogService := service.NewAuditLogService(auditLogRepo)
+	logStreamService := service.NewLogStreamService(ctx, db)
+	exclusionService := service.NewRuleExclusionService(exclusionRepo, wafLogRepo, configRepo, db)
+	ruleService := service.NewRuleService(ruleRepo, exclusionRepo, configRepo, revisionService, db)
+	replayService := service.NewReplayService(wafLogRepo, configRepo, db)
 	// 创建控制器
 	authController := controller.NewAuthController(authService)
 	siteController := controller.NewSiteController(siteService)
-	wafLogController := controller.NewWAFLogController(wafLogService)
+	wafLogController := controller.NewWAFLogController(wafLogService, auditLogService, logStreamService)
 	certController := controller.NewCertificateController(certService)
 	runnerController := controller.NewRunnerController(runnerService)
 	configController := controller.NewConfigController(configService)
+	auditLogController := controller.NewAuditLogController(auditLogService)
+	exclusionController := controller.NewRuleExclusionController(exclusionService)
+	replayController := controller.NewReplayController(replayService)
+	ruleController := controller.NewRuleController(ruleService)
+	revisionController := controller.NewRevisionController(revisionService)
+	changeService := service.NewChangeService(revisionRepo, revisionService)
+	changeController := controller.NewChangeController(changeService, auditLogService)
+	challengeService := service.NewChallengeService(configRepo)
+	challengeController := controller.NewChallengeController(challengeService)
+	threatFeedService := service.NewThreatFeedService(threatFeedRepo, ipListRepo)
+	threatFeedController := controller.NewThreatFeedController(threatFeedService)
 	// 将仓库添加到上下文中，供中间件使用
 	route.Use(func(c *gin.Context) {
 		c.Set("userRepo", userRepo)
@@ -56,6 +82,10 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// 人机验证路由 - 由 HAProxy 从被保护站点转发，不需要认证
+	route.GET(pkgmodel.ChallengePath, challengeController.Page)
+	route.POST(pkgmodel.ChallengeVerifyPath, challengeController.Verify)
+
 	// API v1 路由
 	api := route.Group("/api/v1")
 
@@ -131,6 +161,68 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 		wafLogRoutes.GET("/event", middleware.HasPermission(model.PermWAFLogRead), wafLogController.GetAttackEvents)
 		// 获取攻击日志 - 需要logs:read权限
 		wafLogRoutes.GET("", middleware.HasPermission(model.PermWAFLogRead), wafLogController.GetAttackLogs)
+		// 导出攻击日志 - 需要logs:read权限
+		wafLogRoutes.GET("/export", middleware.HasPermission(model.PermWAFLogRead), wafLogController.ExportAttackLogs)
+		// 实时攻击日志推送 - 需要logs:read权限
+		wafLogRoutes.GET("/stream", middleware.HasPermission(model.PermWAFLogRead), wafLogController.StreamAttackLogs)
+		// 异常评分统计 - 需要logs:read权限
+		wafLogRoutes.GET("/anomaly-stats", middleware.HasPermission(model.PermWAFLogRead), wafLogController.GetAnomalyScoreStats)
+		// 地理位置统计 - 需要logs:read权限
+		wafLogRoutes.GET("/geo-stats", middleware.HasPermission(model.PermWAFLogRead), wafLogController.GetGeoStats)
+	}
+
+	// 自定义规则
+	ruleRoutes := authenticated.Group("/rule")
+	{
+		// 预览组装后的指令 - 需要rule:read权限
+		ruleRoutes.GET("/directives", middleware.HasPermission(model.PermRuleRead), ruleController.PreviewDirectives)
+		ruleRoutes.POST("", middleware.HasPermission(model.PermRuleCreate), ruleController.CreateRule)
+		ruleRoutes.GET("", middleware.HasPermission(model.PermRuleRead), ruleController.GetRules)
+		ruleRoutes.GET("/:id", middleware.HasPermission(model.PermRuleRead), ruleController.GetRuleByID)
+		ruleRoutes.PUT("/:id", middleware.HasPermission(model.PermRuleUpdate), ruleController.UpdateRule)
+		ruleRoutes.DELETE("/:id", middleware.HasPermission(model.PermRuleDelete), ruleController.DeleteRule)
+	}
+
+	// 规则排除（误报处理）
+	exclusionRoutes := authenticated.Group("/exclusion")
+	{
+		// 根据日志生成排除建议 - 需要rule:read权限
+		exclusionRoutes.POST("/propose", middleware.HasPermission(model.PermRuleRead), exclusionController.ProposeExclusion)
+		// 获取排除列表 - 需要rule:read权限
+		exclusionRoutes.GET("", middleware.HasPermission(model.PermRuleRead), exclusionController.GetExclusions)
+		// 创建排除 - 需要rule:create权限
+		exclusionRoutes.POST("", middleware.HasPermission(model.PermRuleCreate), exclusionController.CreateExclusion)
+		// 撤销排除 - 需要rule:delete权限
+		exclusionRoutes.DELETE("/:id", middleware.HasPermission(model.PermRuleDelete), exclusionController.RevokeExclusion)
+	}
+
+	// 威胁情报源
+	threatFeedRoutes := authenticated.Group("/threat-feed")
+	{
+		// 获取情报源列表 - 需要rule:read权限
+		threatFeedRoutes.GET("", middleware.HasPermission(model.PermRuleRead), threatFeedController.GetFeeds)
+		// 创建情报源 - 需要rule:create权限
+		threatFeedRoutes.POST("", middleware.HasPermission(model.PermRuleCreate), threatFeedController.CreateFeed)
+		// 获取情报源详情 - 需要rule:read权限
+		threatFeedRoutes.GET("/:id", middleware.HasPermission(model.PermRuleRead), threatFeedController.GetFeedByID)
+		// 更新情报源 - 需要rule:update权限
+		threatFeedRoutes.PUT("/:id", middleware.HasPermission(model.PermRuleUpdate), threatFeedController.UpdateFeed)
+		// 删除情报源 - 需要rule:delete权限
+		threatFeedRoutes.DELETE("/:id", middleware.HasPermission(model.PermRuleDelete), threatFeedController.DeleteFeed)
+		// 立即刷新情报源 - 需要rule:update权限
+		threatFeedRoutes.POST("/:id/refresh", middleware.HasPermission(model.PermRuleUpdate), threatFeedController.RefreshFeed)
+	}
+
+	// IP 信誉列表 - 需要rule:read权限
+	authenticated.GET("/ip-list", middleware.HasPermission(model.PermRuleRead), threatFeedController.GetIPLists)
+
+	// 规则测试模块
+	replayRoutes := authenticated.Group("/replay")
+	{
+		// 回放单条请求 - 需要rule:read权限
+		replayRoutes.POST("", middleware.HasPermission(model.PermRuleRead), replayController.Replay)
+		// 批量回放WAF日志 - 会在服务端编译请求中的候选指令，需要rule:update权限
+		replayRoutes.POST("/logs", middleware.HasPermission(model.PermRuleUpdate), replayController.ReplayLogs)
 	}
 
 	// 配置管理模块
@@ -138,6 +230,8 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 	{
 		// 获取配置 - 需要config:read权限
 		runnerRoutes.GET("/status", middleware.HasPermission(model.PermConfigRead), runnerController.GetStatus)
+		// 获取HAProxy输出 - 需要config:read权限
+		runnerRoutes.GET("/haproxy/output", middleware.HasPermission(model.PermConfigRead), runnerController.GetHAProxyOutput)
 		// 更新配置 - 需要config:update权限
 		runnerRoutes.POST("/control", middleware.HasPermission(model.PermConfigUpdate), runnerController.Control)
 	}
@@ -147,13 +241,37 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 		configRoutes.GET("", middleware.HasPermission(model.PermConfigRead), configController.GetConfig)
 		// 更新配置 - 需要config:update权限
 		configRoutes.PATCH("", middleware.HasPermission(model.PermConfigUpdate), configController.PatchConfig)
+		// 校验指令 - 需要config:update权限
+		configRoutes.POST("/validate", middleware.HasPermission(model.PermConfigUpdate), configController.ValidateConfig)
+	}
+
+	// 配置版本模块
+	revisionRoutes := authenticated.Group("/revision")
+	{
+		// 获取版本列表 - 需要config:read权限
+		revisionRoutes.GET("", middleware.HasPermission(model.PermConfigRead), revisionController.GetRevisions)
+		// 对比版本 - 需要config:read权限
+		revisionRoutes.GET("/diff", middleware.HasPermission(model.PermConfigRead), revisionController.DiffRevisions)
+		// 获取版本详情 - 需要config:read权限
+		revisionRoutes.GET("/:id", middleware.HasPermission(model.PermConfigRead), revisionController.GetRevision)
+		// 回滚到指定版本 - 需要config:update权限
+		revisionRoutes.POST("/:id/rollback", middleware.HasPermission(model.PermConfigUpdate), revisionController.Rollback)
+	}
+
+	// 配置变更模块
+	changeRoutes := authenticated.Group("/changes")
+	{
+		// 获取待应用变更 - 需要config:read权限
+		changeRoutes.GET("/pending", middleware.HasPermission(model.PermConfigRead), changeController.GetPendingChanges)
+		// 应用变更 - 需要config:update权限
+		changeRoutes.POST("/apply", middleware.HasPermission(model.PermConfigUpdate), changeController.ApplyChanges)
 	}
 
 	// 审计日志模块
 	auditRoutes := authenticated.Group("/audit")
 	{
 		// 获取审计日志 - 需要audit:read权限
-		auditRoutes.GET("", middleware.HasPermission(model.PermAuditRead), nil)
+		auditRoutes.GET("", middleware.HasPermission(model.PermAuditRead), auditLogController.GetAuditLogs)
 	}
 
 	// 系统管理模块
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// AuditLogService 审计日志服务
+type AuditLogService interface {
+	Record(ctx context.Context, auditLog *model.AuditLog) error
+	GetAuditLogs(ctx context.Context, req dto.AuditLogRequest) (*dto.AuditLogListResponse, error)
+}
+
+// AuditLogServiceImpl 审计日志服务实现
+type AuditLogServiceImpl struct {
+	auditLogRepo repository.AuditLogRepository
+	logger       zerolog.Logger
+}
+
+// NewAuditLogService 创建审计日志服务
+func NewAuditLogService(auditLogRepo repository.AuditLogRepository) AuditLogService {
+	logger := config.GetServiceLogger("audit_log")
+	return &AuditLogServiceImpl{
+		auditLogRepo: auditLogRepo,
+		logger:       logger,
+	}
+}
+
+// Record 记录审计日志，未填写的用户信息从请求上下文中获取
+func (s *AuditLogServiceImpl) Record(ctx context.Context, auditLog *model.AuditLog) error {
+	if auditLog.UserID == "" {
+		auditLog.UserID, _ = ctx.Value("userID").(string)
+	}
+	if auditLog.Username == "" {
+		auditLog.Username, _ = ctx.Value("username").(string)
+	}
+	if auditLog.RequestID == "" {
+		auditLog.RequestID, _ = ctx.Value("RequestID").(string)
+	}
+
+	if err := s.auditLogRepo.CreateAuditLog(ctx, auditLog); err != nil {
+		s.logger.Error().Err(err).Str("action", auditLog.Action).Str("username", auditLog.Username).Msg("记录审计日志失败")
+		return err
+	}
+	return nil
+}
+
+// GetAuditLogs 获取审计日志列表
+func (s *AuditLogServiceImpl) GetAuditLogs(ctx context.Context, req dto.AuditLogRequest) (*dto.AuditLogListResponse, error) {
+	page, size := req.Page, req.Size
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 10
+	}
+
+	filter := bson.D{}
+	if req.Action != "" {
+		filter = append(filter, bson.E{Key: "action", Value: req.Action})
+	}
+	if req.Username != "" {
+		filter = append(filter, bson.E{Key: "username", Value: req.Username})
+	}
+	timeFilter := bson.D{}
+	if !req.StartTime.IsZero() {
+		timeFilter = append(timeFilter, bson.E{Key: "$gte", Value: req.StartTime.UTC()})
+	}
+	if !req.EndTime.IsZero() {
+		timeFilter = append(timeFilter, bson.E{Key: "$lte", Value: req.EndTime.UTC()})
+	}
+	if len(timeFilter) > 0 {
+		filter = append(filter, bson.E{Key: "createdAt", Value: timeFilter})
+	}
+
+	logs, total, err := s.auditLogRepo.GetAuditLogs(ctx, filter, page, size)
+	if err != nil {
+		return nil, err
+	}
+	if logs == nil {
+		logs = []model.AuditLog{}
+	}
+
+	return &dto.AuditLogListResponse{
+		Total: total,
+		Items: logs,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+)
+
+// toBlockPage 将请求中的拦截页面配置转换为模型
+func toBlockPage(req *dto.BlockPageDTO) *pkgmodel.BlockPage {
+	if req == nil {
+		return nil
+	}
+	return &pkgmodel.BlockPage{
+		HTML:           req.HTML,
+		JSON:           req.JSON,
+		SupportContact: req.SupportContact,
+	}
+}
+
+// validateBlockPage 校验拦截页面模板，JSON 模板替换占位符后需要是合法的 JSON
+func validateBlockPage(page *pkgmodel.BlockPage) error {
+	if page == nil {
+		return nil
+	}
+	if len(page.HTML) > pkgmodel.BlockPageMaxSize || len(page.JSON) > pkgmodel.BlockPageMaxSize {
+		return errors.New("拦截页面模板过大")
+	}
+	if page.JSON != "" {
+		sample := strings.NewReplacer(
+			pkgmodel.BlockPagePlaceholderRequestID, "id",
+			pkgmodel.BlockPagePlaceholderSupportContact, "contact",
+		).Replace(page.JSON)
+		if !json.Valid([]byte(sample)) {
+			return errors.New("JSON 拦截页面模板不是合法的 JSON")
+		}
+	}
+	return nil
+}
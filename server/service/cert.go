@@ -30,16 +30,18 @@ type CertificateService interface {
 
 // CertificateServiceImpl 证书服务实现
 type CertificateServiceImpl struct {
-	certRepo repository.CertificateRepository
-	logger   zerolog.Logger
+	certRepo        repository.CertificateRepository
+	revisionService RevisionService
+	logger          zerolog.Logger
 }
 
 // NewCertificateService 创建证书服务
-func NewCertificateService(certRepo repository.CertificateRepository) CertificateService {
+func NewCertificateService(certRepo repository.CertificateRepository, revisionService RevisionService) CertificateService {
 	logger := config.GetServiceLogger("certificate")
 	return &CertificateServiceImpl{
-		certRepo: certRepo,
-		logger:   logger,
+		certRepo:        certRepo,
+		revisionService: revisionService,
+		logger:          logger,
 	}
 }
 
@@ -80,6 +82,7 @@ func (s *CertificateServiceImpl) CreateCertificate(ctx context.Context, req *dto
 		return nil, err
 	}
 
+	s.revisionService.Record(ctx, model.RevisionResourceCertificate, cert.ID.Hex(), cert.Name, model.RevisionActionCreate, cert)
 	s.logger.Info().Str("id", cert.ID.Hex()).Str("name", cert.Name).Msg("证书创建成功")
 	return cert, nil
 }
@@ -196,6 +199,7 @@ func (s *CertificateServiceImpl) UpdateCertificate(ctx context.Context, id bson.
 		return nil, err
 	}
 
+	s.revisionService.Record(ctx, model.RevisionResourceCertificate, cert.ID.Hex(), cert.Name, model.RevisionActionUpdate, cert)
 	s.logger.Info().Str("id", id.Hex()).Str("name", cert.Name).Msg("证书更新成功")
 	return cert, nil
 }
@@ -203,7 +207,7 @@ func (s *CertificateServiceImpl) UpdateCertificate(ctx context.Context, id bson.
 // DeleteCertificate 删除证书
 func (s *CertificateServiceImpl) DeleteCertificate(ctx context.Context, id bson.ObjectID) error {
 	// 检查证书是否存在
-	_, err := s.certRepo.GetCertificateByID(ctx, id)
+	cert, err := s.certRepo.GetCertificateByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrCertNotFound) {
 			return ErrCertificateNotFound
@@ -218,6 +222,7 @@ func (s *CertificateServiceImpl) DeleteCertificate(ctx context.Context, id bson.
 		return err
 	}
 
+	s.revisionService.Record(ctx, model.RevisionResourceCertificate, cert.ID.Hex(), cert.Name, model.RevisionActionDelete, cert)
 	s.logger.Info().Str("id", id.Hex()).Msg("证书删除成功")
 	return nil
 }
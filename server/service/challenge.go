@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/challenge"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrChallengeDisabled = errors.New("人机验证未启用")
+	ErrChallengeFailed   = errors.New("人机验证未通过")
+)
+
+// challengeTokenTTL 题目的有效期，超时后需要刷新页面重新获取
+const challengeTokenTTL = 5 * time.Minute
+
+// ChallengeService 人机验证服务，目前只支持浏览器工作量证明，
+// 需要第三方服务的验证码（CAPTCHA）不在内置范围内
+type ChallengeService interface {
+	Issue(ctx context.Context, clientIP, userAgent string) (*dto.ChallengeTask, error)
+	Verify(ctx context.Context, clientIP, userAgent, host string, req *dto.ChallengeVerifyRequest) (string, int, error)
+}
+
+// ChallengeServiceImpl 人机验证服务实现
+type ChallengeServiceImpl struct {
+	configRepo repository.ConfigRepository
+	logger     zerolog.Logger
+
+	// usedTokens 已通过验证的题目及其过期时间，题目只能使用一次，过期后清理
+	usedMu     sync.Mutex
+	usedTokens map[string]time.Time
+}
+
+// NewChallengeService 创建人机验证服务
+func NewChallengeService(configRepo repository.ConfigRepository) ChallengeService {
+	logger := config.GetServiceLogger("challenge")
+	return &ChallengeServiceImpl{
+		configRepo: configRepo,
+		logger:     logger,
+		usedTokens: make(map[string]time.Time),
+	}
+}
+
+// Issue 为客户端生成工作量证明题目
+func (s *ChallengeServiceImpl) Issue(ctx context.Context, clientIP, userAgent string) (*dto.ChallengeTask, error) {
+	cfg, err := s.challengeConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.ChallengeTask{
+		Token:      challenge.NewToken(cfg.Secret, clientIP, userAgent, time.Now().Add(challengeTokenTTL)),
+		Difficulty: cfg.Difficulty,
+	}, nil
+}
+
+// Verify 校验工作量证明结果，通过后返回放行 Cookie 的值和有效期（秒），每个题目只能通过一次
+func (s *ChallengeServiceImpl) Verify(ctx context.Context, clientIP, userAgent, host string, req *dto.ChallengeVerifyRequest) (string, int, error) {
+	cfg, err := s.challengeConfig(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	if !challenge.VerifySolution(cfg.Secret, req.Token, req.Nonce, clientIP, userAgent, cfg.Difficulty, now) {
+		s.logger.Debug().Str("clientIP", clientIP).Str("host", host).Msg("人机验证未通过")
+		return "", 0, ErrChallengeFailed
+	}
+	if !s.useToken(req.Token, now) {
+		s.logger.Debug().Str("clientIP", clientIP).Str("host", host).Msg("人机验证题目已被使用")
+		return "", 0, ErrChallengeFailed
+	}
+
+	expires := now.Add(time.Duration(cfg.TTL) * time.Second)
+	return challenge.NewClearance(cfg.Secret, clientIP, userAgent, host, expires), cfg.TTL, nil
+}
+
+// useToken 将题目标记为已使用，题目已被使用时返回 false。过期的题目签名校验不会通过，记录随之清理
+func (s *ChallengeServiceImpl) useToken(token string, now time.Time) bool {
+	s.usedMu.Lock()
+	defer s.usedMu.Unlock()
+
+	for used, expires := range s.usedTokens {
+		if now.Unix() > expires.Unix() {
+			delete(s.usedTokens, used)
+		}
+	}
+	if _, ok := s.usedTokens[token]; ok {
+		return false
+	}
+	s.usedTokens[token] = challenge.TokenExpires(token)
+	return true
+}
+
+// challengeConfig 读取人机验证配置，未设置的有效期和难度使用默认值
+func (s *ChallengeServiceImpl) challengeConfig(ctx context.Context) (*model.ChallengeConfig, error) {
+	cfg, err := s.configRepo.GetConfig(ctx)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("获取配置失败")
+		return nil, err
+	}
+
+	challengeCfg := cfg.Challenge
+	if !challengeCfg.Active() {
+		return nil, ErrChallengeDisabled
+	}
+	if challengeCfg.TTL <= 0 {
+		challengeCfg.TTL = model.DefaultChallengeTTL
+	}
+	if challengeCfg.Difficulty <= 0 || challengeCfg.Difficulty > model.MaxChallengeDifficulty {
+		challengeCfg.Difficulty = model.DefaultChallengeDifficulty
+	}
+	return &challengeCfg, nil
+}
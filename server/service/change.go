@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var (
+	ErrChangesInvalid = errors.New("待应用配置未通过 haproxy -c 校验")
+	ErrChangesApply   = errors.New("应用配置变更失败，已回滚")
+)
+
+const (
+	// 待应用变更中最多返回的版本数
+	maxPendingRevisions = 100
+	// 差异片段保留的上下文行数
+	diffContextLines = 3
+)
+
+// ChangeService 待应用变更服务
+type ChangeService interface {
+	GetPendingChanges(ctx context.Context) (*dto.PendingChangesResponse, error)
+	ApplyChanges(ctx context.Context) (*dto.ApplyChangesResponse, error)
+}
+
+// ChangeServiceImpl 待应用变更服务实现。
+// 站点和配置的修改保存后即写入数据库，在下次热重载时生效；应用变更即立即校验并热重载，
+// 失败时回滚 HAProxy 配置，并只撤销本次应用的变更批次，使数据库与运行中的配置一致。
+// 生效时间由 ServiceRunner 持久化，服务重启后待应用的版本不会丢失
+type ChangeServiceImpl struct {
+	revisionRepo    repository.RevisionRepository
+	revisionService RevisionService
+	logger          zerolog.Logger
+}
+
+// NewChangeService 创建待应用变更服务
+func NewChangeService(revisionRepo repository.RevisionRepository, revisionService RevisionService) ChangeService {
+	logger := config.GetServiceLogger("change")
+	return &ChangeServiceImpl{
+		revisionRepo:    revisionRepo,
+		revisionService: revisionService,
+		logger:          logger,
+	}
+}
+
+// GetPendingChanges 获取上次生效以来的变更，以及生成配置与运行中配置的差异
+func (s *ChangeServiceImpl) GetPendingChanges(ctx context.Context) (*dto.PendingChangesResponse, error) {
+	runner, err := daemon.GetRunnerService()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("获取ServiceRunner失败")
+		return nil, err
+	}
+
+	pending, running, err := runner.RenderPendingConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := runner.GetAppliedAt()
+	revisions, err := s.pendingRevisions(ctx, appliedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.PendingChangesResponse{
+		Running:     runner.GetState() == daemon.ServiceRunning,
+		Revisions:   revisions,
+		Valid:       pending.Valid,
+		CheckOutput: pending.CheckOutput,
+		SiteErrors:  pending.SiteErrors,
+	}
+	if !appliedAt.IsZero() {
+		result.AppliedAt = &appliedAt
+	}
+
+	haproxyLines := diffLines(running.HAProxyConfig, pending.HAProxyConfig)
+	if haproxyLines == nil {
+		// 配置过大无法逐行对比时直接返回完整配置
+		result.HAProxyConfig = pending.HAProxyConfig
+	}
+	result.HAProxyDiff = compactDiff(haproxyLines, diffContextLines)
+	result.SpoeDiff = compactDiff(diffLines(running.SpoeConfig, pending.SpoeConfig), diffContextLines)
+
+	result.HasChanges = len(revisions) > 0 ||
+		running.HAProxyConfig != pending.HAProxyConfig ||
+		running.SpoeConfig != pending.SpoeConfig
+
+	return result, nil
+}
+
+// ApplyChanges 校验并立即热重载，使上次生效以来保存的变更生效
+func (s *ChangeServiceImpl) ApplyChanges(ctx context.Context) (*dto.ApplyChangesResponse, error) {
+	runner, err := daemon.GetRunnerService()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("获取ServiceRunner失败")
+		return nil, err
+	}
+
+	// 本次批次为 (appliedAt, batchEnd] 内保存的版本，之后保存的版本不属于本次应用，失败时也不撤销
+	appliedAt := runner.GetAppliedAt()
+	batchEnd := time.Now()
+	batch, err := s.batchRevisions(ctx, appliedAt, batchEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := runner.ApplyChanges()
+	if err != nil {
+		switch {
+		case errors.Is(err, daemon.ErrConfigCheckFailed):
+			return nil, fmt.Errorf("%w: %s", ErrChangesInvalid, strings.TrimSpace(rendered.CheckOutput))
+		case errors.Is(err, daemon.ErrApplyFailed):
+			return nil, fmt.Errorf("%w: %s%s", ErrChangesApply, err.Error(), s.revertChanges(ctx, runner, appliedAt, batchEnd))
+		}
+		return nil, err
+	}
+
+	result := &dto.ApplyChangesResponse{
+		Applied:     runner.GetState() == daemon.ServiceRunning,
+		AppliedAt:   time.Now(),
+		Revisions:   batch,
+		CheckOutput: rendered.CheckOutput,
+		SiteErrors:  rendered.SiteErrors,
+	}
+	if result.Applied {
+		result.AppliedAt = runner.GetAppliedAt()
+	}
+
+	s.logger.Info().Bool("applied", result.Applied).Int("revisions", result.Revisions).Msg("配置变更已应用")
+	return result, nil
+}
+
+// revertChanges 应用失败后撤销本次批次中修改过的资源，恢复到上次生效时的版本，并让引擎重新加载恢复后的规则，返回附加到错误中的说明
+func (s *ChangeServiceImpl) revertChanges(ctx context.Context, runner daemon.ServiceRunner, appliedAt, batchEnd time.Time) string {
+	if appliedAt.IsZero() {
+		return ""
+	}
+
+	reverted, skipped, err := s.revisionService.RevertBatch(context.WithoutCancel(ctx), appliedAt, batchEnd)
+	if err != nil {
+		s.logger.Error().Err(err).Int("reverted", reverted).Int("skipped", skipped).Msg("恢复数据库中的变更失败")
+		return fmt.Sprintf("; 已恢复 %d 个资源，部分资源恢复失败: %v", reverted, err)
+	}
+	if reverted > 0 && runner.GetState() == daemon.ServiceRunning {
+		if err := runner.ReloadEngine(); err != nil {
+			s.logger.Error().Err(err).Msg("恢复变更后热重载引擎失败")
+		}
+	}
+	if skipped > 0 {
+		return fmt.Sprintf("; 已将 %d 个资源恢复到上次生效时的版本，%d 个资源在应用期间被再次修改，保留最新修改", reverted, skipped)
+	}
+	return fmt.Sprintf("; 已将 %d 个资源恢复到上次生效时的版本", reverted)
+}
+
+// batchRevisions 统计本次应用批次 (since, until] 内保存的配置版本数
+func (s *ChangeServiceImpl) batchRevisions(ctx context.Context, since, until time.Time) (int, error) {
+	filter := bson.D{{Key: "createdAt", Value: bson.D{{Key: "$lte", Value: until}}}}
+	if !since.IsZero() {
+		filter = bson.D{{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: since}, {Key: "$lte", Value: until}}}}
+	}
+
+	_, total, err := s.revisionRepo.GetRevisions(ctx, filter, 1, 1)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("统计待应用配置版本失败")
+		return 0, err
+	}
+	return int(total), nil
+}
+
+// pendingRevisions 获取指定时间之后的配置版本，服务从未启动时返回全部版本
+func (s *ChangeServiceImpl) pendingRevisions(ctx context.Context, since time.Time) ([]model.Revision, error) {
+	filter := bson.D{}
+	if !since.IsZero() {
+		filter = append(filter, bson.E{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: since}}})
+	}
+
+	revisions, _, err := s.revisionRepo.GetRevisions(ctx, filter, 1, maxPendingRevisions)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("获取待应用配置版本失败")
+		return nil, err
+	}
+	if revisions == nil {
+		revisions = []model.Revision{}
+	}
+	return revisions, nil
+}
+
+// compactDiff 只保留变更行及其前后若干行上下文，不相邻的片段之间用 "@@" 分隔
+func compactDiff(lines []string, context int) []string {
+	keep := make([]bool, len(lines))
+	changed := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "  ") {
+			continue
+		}
+		changed = true
+		for j := max(0, i-context); j <= min(len(lines)-1, i+context); j++ {
+			keep[j] = true
+		}
+	}
+	if !changed {
+		return []string{}
+	}
+
+	result := make([]string, 0, len(lines))
+	last := -1
+	for i, line := range lines {
+		if !keep[i] {
+			continue
+		}
+		if last >= 0 && i != last+1 {
+			result = append(result, "@@")
+		}
+		result = append(result, line)
+		last = i
+	}
+	return result
+}
@@ -4,36 +4,57 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/challenge"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	"github.com/HUAHUAI23/simple-waf/server/dto"
+	servermodel "github.com/HUAHUAI23/simple-waf/server/model"
 	"github.com/HUAHUAI23/simple-waf/server/repository"
 	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 var (
-	ErrConfigNotFound = errors.New("配置不存在")
+	ErrConfigNotFound    = errors.New("配置不存在")
+	ErrInvalidDirectives = errors.New("指令校验失败")
+	ErrInvalidInstances  = errors.New("引擎实例配置无效")
+	ErrInvalidBlockPage  = errors.New("拦截页面配置无效")
+	ErrInvalidGeoIP      = errors.New("启用 GeoIP 至少需要配置一个数据库文件")
 )
 
 // ConfigService 配置服务接口
 type ConfigService interface {
 	GetConfig(ctx context.Context) (*model.Config, error)
 	PatchConfig(ctx context.Context, req *dto.ConfigPatchRequest) (*model.Config, error)
+	ValidateDirectives(ctx context.Context, directives string) *seclang.ValidationResult
 }
 
 // ConfigServiceImpl 配置服务实现
 type ConfigServiceImpl struct {
-	configRepo repository.ConfigRepository
-	logger     zerolog.Logger
+	configRepo      repository.ConfigRepository
+	saver           *configSaver
+	revisionService RevisionService
+	logger          zerolog.Logger
 }
 
 // NewConfigService 创建配置服务
-func NewConfigService(configRepo repository.ConfigRepository) ConfigService {
+func NewConfigService(
+	configRepo repository.ConfigRepository,
+	wafLogRepo repository.WAFLogRepository,
+	revisionService RevisionService,
+	db *mongo.Database,
+) ConfigService {
 	logger := config.GetServiceLogger("config")
 	return &ConfigServiceImpl{
-		configRepo: configRepo,
-		logger:     logger,
+		configRepo:      configRepo,
+		saver:           newConfigSaver(configRepo, wafLogRepo, db, logger),
+		revisionService: revisionService,
+		logger:          logger,
 	}
 }
 
@@ -63,6 +84,8 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 		return nil, err
 	}
 
+	previousRetention := cfg.LogRetention
+
 	if req.IsResponseCheck != nil {
 		cfg.IsResponseCheck = *req.IsResponseCheck
 	}
@@ -81,6 +104,27 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 			cfg.Engine.UseBuiltinRules = *req.Engine.UseBuiltinRules
 		}
 
+		if req.Engine.ExternalOnly != nil {
+			cfg.Engine.ExternalOnly = *req.Engine.ExternalOnly
+		}
+
+		if req.Engine.Balance != nil {
+			cfg.Engine.Balance = *req.Engine.Balance
+		}
+
+		// 外部引擎实例整体替换
+		if req.Engine.Instances != nil {
+			instances, err := toEngineInstances(*req.Engine.Instances)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Engine.Instances = instances
+		}
+
+		if cfg.Engine.ExternalOnly && !hasEnabledInstance(cfg.Engine.Instances) {
+			return nil, fmt.Errorf("%w: 只使用外部引擎时至少需要一个启用的实例", ErrInvalidInstances)
+		}
+
 		// 更新AppConfig
 		if len(req.Engine.AppConfig) > 0 {
 			for _, reqApp := range req.Engine.AppConfig {
@@ -103,6 +147,12 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 						if reqApp.LogFormat != nil {
 							cfg.Engine.AppConfig[i].LogFormat = *reqApp.LogFormat
 						}
+						if reqApp.LogPolicy != nil {
+							cfg.Engine.AppConfig[i].LogPolicy = *reqApp.LogPolicy
+						}
+						if reqApp.LogScoreThreshold != nil {
+							cfg.Engine.AppConfig[i].LogScoreThreshold = *reqApp.LogScoreThreshold
+						}
 						break
 					}
 				}
@@ -130,15 +180,211 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 		if req.Haproxy.Thread != nil {
 			cfg.Haproxy.Thread = *req.Haproxy.Thread
 		}
+		if req.Haproxy.HardStopAfter != nil {
+			cfg.Haproxy.HardStopAfter = *req.Haproxy.HardStopAfter
+		}
+		if req.Haproxy.BlockPage != nil {
+			blockPage := toBlockPage(req.Haproxy.BlockPage)
+			if err := validateBlockPage(blockPage); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidBlockPage, err.Error())
+			}
+			cfg.Haproxy.BlockPage = *blockPage
+		}
 	}
 
-	// 保存更新
-	err = s.configRepo.UpdateConfig(ctx, cfg)
-	if err != nil {
-		s.logger.Error().Err(err).Msg("更新配置失败")
+	// 更新日志保留策略
+	if req.LogRetention != nil {
+		if req.LogRetention.Enabled != nil {
+			cfg.LogRetention.Enabled = *req.LogRetention.Enabled
+		}
+		if req.LogRetention.RetentionDays != nil {
+			cfg.LogRetention.RetentionDays = *req.LogRetention.RetentionDays
+		}
+		if req.LogRetention.ArchiveEnabled != nil {
+			cfg.LogRetention.ArchiveEnabled = *req.LogRetention.ArchiveEnabled
+		}
+		if req.LogRetention.ArchiveDir != nil {
+			cfg.LogRetention.ArchiveDir = *req.LogRetention.ArchiveDir
+		}
+	}
+
+	// 更新人机验证配置，启用时没有签名密钥则生成
+	if req.Challenge != nil {
+		if req.Challenge.Enabled != nil {
+			cfg.Challenge.Enabled = *req.Challenge.Enabled
+		}
+		if req.Challenge.TTL != nil {
+			cfg.Challenge.TTL = *req.Challenge.TTL
+		}
+		if req.Challenge.Difficulty != nil {
+			cfg.Challenge.Difficulty = *req.Challenge.Difficulty
+		}
+		if cfg.Challenge.Enabled && cfg.Challenge.Secret == "" {
+			cfg.Challenge.Secret = challenge.NewSecret()
+		}
+	}
+
+	// 更新机器人识别配置
+	if req.Bot != nil {
+		if req.Bot.Enabled != nil {
+			cfg.Bot.Enabled = *req.Bot.Enabled
+		}
+		if req.Bot.VerifyCrawlers != nil {
+			cfg.Bot.VerifyCrawlers = *req.Bot.VerifyCrawlers
+		}
+	}
+
+	// 更新 GeoIP 配置，启用时至少需要一个数据库文件
+	if req.GeoIP != nil {
+		if req.GeoIP.Enabled != nil {
+			cfg.GeoIP.Enabled = *req.GeoIP.Enabled
+		}
+		if req.GeoIP.CountryDB != nil {
+			cfg.GeoIP.CountryDB = strings.TrimSpace(*req.GeoIP.CountryDB)
+		}
+		if req.GeoIP.ASNDB != nil {
+			cfg.GeoIP.ASNDB = strings.TrimSpace(*req.GeoIP.ASNDB)
+		}
+		if cfg.GeoIP.Enabled && cfg.GeoIP.CountryDB == "" && cfg.GeoIP.ASNDB == "" {
+			return nil, ErrInvalidGeoIP
+		}
+	}
+
+	// 校验并保存更新，保存成功后才记录版本
+	if err := s.saver.save(ctx, previousRetention, cfg); err != nil {
 		return nil, err
 	}
+	s.revisionService.Record(ctx, servermodel.RevisionResourceConfig, cfg.Name, cfg.Name, servermodel.RevisionActionUpdate, cfg)
 
 	s.logger.Info().Str("name", cfg.Name).Msg("配置更新成功")
 	return cfg, nil
 }
+
+// ValidateDirectives 试编译指令，不保存
+func (s *ConfigServiceImpl) ValidateDirectives(ctx context.Context, directives string) *seclang.ValidationResult {
+	result := seclang.Validate(directives)
+	s.logger.Debug().
+		Bool("valid", result.Valid).
+		Int("ruleCount", result.RuleCount).
+		Int("errors", len(result.Errors)).
+		Int("duplicateIds", len(result.DuplicateIDs)).
+		Msg("指令校验完成")
+	return &result
+}
+
+// configSaver 校验并保存全局配置，配置更新和版本回滚共用，保证两者的校验和副作用一致
+type configSaver struct {
+	configRepo repository.ConfigRepository
+	wafLogRepo repository.WAFLogRepository
+	db         *mongo.Database
+	logger     zerolog.Logger
+}
+
+func newConfigSaver(
+	configRepo repository.ConfigRepository,
+	wafLogRepo repository.WAFLogRepository,
+	db *mongo.Database,
+	logger zerolog.Logger,
+) *configSaver {
+	return &configSaver{
+		configRepo: configRepo,
+		wafLogRepo: wafLogRepo,
+		db:         db,
+		logger:     logger,
+	}
+}
+
+// save 校验并保存配置。保留策略变化时先同步 TTL 索引，索引更新失败时不保存配置；配置保存失败时恢复原来的索引
+func (c *configSaver) save(ctx context.Context, previousRetention model.LogRetention, cfg *model.Config) error {
+	// 无法编译的指令会导致引擎热更新失败，保存前先校验
+	if err := c.validateDirectives(ctx, cfg); err != nil {
+		return err
+	}
+
+	retentionChanged := previousRetention != cfg.LogRetention
+	if retentionChanged {
+		if err := c.wafLogRepo.ApplyRetention(ctx, cfg.LogRetention); err != nil {
+			c.logger.Error().Err(err).Msg("更新日志保留策略索引失败")
+			return err
+		}
+	}
+
+	if err := c.configRepo.UpdateConfig(ctx, cfg); err != nil {
+		c.logger.Error().Err(err).Msg("更新配置失败")
+		if retentionChanged {
+			if rollbackErr := c.wafLogRepo.ApplyRetention(ctx, previousRetention); rollbackErr != nil {
+				c.logger.Error().Err(rollbackErr).Msg("恢复日志保留策略索引失败")
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// validateDirectives 校验每个应用的基础指令，再按引擎的加载方式组装自定义规则、规则排除和站点策略后试编译，
+// 保证引擎最终加载的指令可以编译
+func (c *configSaver) validateDirectives(ctx context.Context, cfg *model.Config) error {
+	for _, app := range cfg.Engine.AppConfig {
+		if result := seclang.Validate(app.Directives); !result.Valid {
+			return fmt.Errorf("%w: 应用 %s: %s", ErrInvalidDirectives, app.Name, describeValidation(result))
+		}
+	}
+
+	ruleSet, err := server.LoadRuleSet(ctx, c.db, true)
+	if err != nil {
+		return err
+	}
+	if err := validateRuleSet(cfg.Engine.AppConfig, ruleSet); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidDirectives, err.Error())
+	}
+	return nil
+}
+
+// describeValidation 将校验结果中的第一个问题转换为错误描述
+func describeValidation(result seclang.ValidationResult) string {
+	if len(result.Errors) > 0 {
+		e := result.Errors[0]
+		return fmt.Sprintf("第 %d 行: %s", e.Line, e.Message)
+	}
+	if len(result.DuplicateIDs) > 0 {
+		d := result.DuplicateIDs[0]
+		return fmt.Sprintf("规则ID %d 重复声明于 %v", d.ID, d.Locations)
+	}
+	return "未知错误"
+}
+
+// toEngineInstances 转换外部引擎实例，名称和地址不能重复
+func toEngineInstances(items []dto.EngineInstanceDTO) ([]model.EngineInstance, error) {
+	names := make(map[string]bool, len(items))
+	addresses := make(map[string]bool, len(items))
+	instances := make([]model.EngineInstance, 0, len(items))
+	for _, item := range items {
+		address := fmt.Sprintf("%s:%d", item.Address, item.Port)
+		if names[item.Name] {
+			return nil, fmt.Errorf("%w: 实例名称重复 %s", ErrInvalidInstances, item.Name)
+		}
+		if addresses[address] {
+			return nil, fmt.Errorf("%w: 实例地址重复 %s", ErrInvalidInstances, address)
+		}
+		names[item.Name] = true
+		addresses[address] = true
+
+		instances = append(instances, model.EngineInstance{
+			Name:    item.Name,
+			Address: item.Address,
+			Port:    item.Port,
+			Weight:  item.Weight,
+			Enabled: item.Enabled,
+		})
+	}
+	return instances, nil
+}
+
+func hasEnabledInstance(instances []model.EngineInstance) bool {
+	for _, instance := range instances {
+		if instance.Enabled {
+			return true
+		}
+	}
+	return false
+}
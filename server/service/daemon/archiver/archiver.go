@@ -0,0 +1,194 @@
+package archiver
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// 归档检查间隔
+	archiveInterval = time.Hour
+	// 每批归档的日志条数
+	archiveBatchSize = 1000
+)
+
+// LogArchiver 在 TTL 索引删除日志之前，将过期日志导出到归档目录
+type LogArchiver interface {
+	Start()
+	Stop()
+	RunOnce(ctx context.Context) (int64, error)
+}
+
+type LogArchiverImpl struct {
+	wafLogRepo repository.WAFLogRepository
+	logger     zerolog.Logger
+	cancel     context.CancelFunc
+	done       chan struct{}
+	mu         sync.Mutex
+}
+
+// NewLogArchiver 创建日志归档器
+func NewLogArchiver(wafLogRepo repository.WAFLogRepository) LogArchiver {
+	return &LogArchiverImpl{
+		wafLogRepo: wafLogRepo,
+		logger:     config.GetServiceLogger("log_archiver"),
+	}
+}
+
+// Start 启动后台归档循环
+func (a *LogArchiverImpl) Start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.done = make(chan struct{})
+
+	go func() {
+		defer close(a.done)
+
+		ticker := time.NewTicker(archiveInterval)
+		defer ticker.Stop()
+
+		for {
+			if n, err := a.RunOnce(ctx); err != nil {
+				a.logger.Error().Err(err).Msg("归档过期日志失败")
+			} else if n > 0 {
+				a.logger.Info().Int64("count", n).Msg("已归档过期日志")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	a.logger.Info().Msg("日志归档器已启动")
+}
+
+// Stop 停止后台归档循环并等待当前批次完成
+func (a *LogArchiverImpl) Stop() {
+	a.mu.Lock()
+	cancel, done := a.cancel, a.done
+	a.cancel, a.done = nil, nil
+	a.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	a.logger.Info().Msg("日志归档器已停止")
+}
+
+// RunOnce 执行一次归档，返回归档的日志条数
+func (a *LogArchiverImpl) RunOnce(ctx context.Context) (int64, error) {
+	cfg, err := config.GetAppConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	retention := cfg.LogRetention
+	if !retention.Enabled || !retention.ArchiveEnabled || retention.RetentionDays <= 0 {
+		return 0, nil
+	}
+
+	if err := os.MkdirAll(retention.ArchiveDir, 0755); err != nil {
+		return 0, fmt.Errorf("创建归档目录失败: %w", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -retention.RetentionDays)
+	var total int64
+
+	for {
+		if ctx.Err() != nil {
+			return total, nil
+		}
+
+		logs, err := a.wafLogRepo.FindLogsBefore(ctx, cutoff, archiveBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(logs) == 0 {
+			return total, nil
+		}
+
+		// 先写归档文件，写入成功后再删除，避免数据丢失
+		if err := writeArchive(retention.ArchiveDir, logs); err != nil {
+			return total, err
+		}
+
+		ids := make([]bson.ObjectID, 0, len(logs))
+		for _, log := range logs {
+			ids = append(ids, log.ID)
+		}
+
+		deleted, err := a.wafLogRepo.DeleteLogsByIDs(ctx, ids)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+
+		if len(logs) < archiveBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// writeArchive 将一批日志以 gzip 压缩的 JSON Lines 格式写入归档目录
+func writeArchive(dir string, logs []model.WAFLog) error {
+	first := logs[0].CreatedAt.UTC()
+	name := fmt.Sprintf("waf_log_%s_%s_%d.jsonl.gz",
+		first.Format("20060102T150405"),
+		logs[0].ID.Hex(),
+		len(logs),
+	)
+	path := filepath.Join(dir, name)
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("创建归档文件失败: %w", err)
+	}
+
+	gz := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gz)
+	for _, log := range logs {
+		if err := encoder.Encode(log); err != nil {
+			gz.Close()
+			file.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("写入归档文件失败: %w", err)
+		}
+	}
+
+	if err := gz.Close(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入归档文件失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入归档文件失败: %w", err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
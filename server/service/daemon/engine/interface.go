@@ -2,6 +2,7 @@ package engine
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
 	"github.com/rs/zerolog"
@@ -11,7 +12,10 @@ type EngineService interface {
 	Start() error
 	Restart() error
 	Stop() error
+	Drain(timeout time.Duration) error
 	Reload() error
+	IsRunning() bool
+	GetReplayer(appName string) (server.Replayer, error)
 }
 
 // NewEngineService 创建一个新的引擎服务实例
@@ -52,6 +56,19 @@ func (s *EngineServiceImpl) Stop() error {
 	return s.agent.Stop()
 }
 
+// Drain 优雅停止引擎，等待进行中的事务处理完成并写完剩余日志
+func (s *EngineServiceImpl) Drain(timeout time.Duration) error {
+	return s.agent.Drain(timeout)
+}
+
 func (s *EngineServiceImpl) Reload() error {
 	return s.agent.UpdateApplications()
 }
+
+func (s *EngineServiceImpl) IsRunning() bool {
+	return s.agent.GetState() == server.ServerRunning
+}
+
+func (s *EngineServiceImpl) GetReplayer(appName string) (server.Replayer, error) {
+	return s.agent.GetReplayer(appName)
+}
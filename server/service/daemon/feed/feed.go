@@ -0,0 +1,442 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/HUAHUAI23/simple-waf/server/utils/iplist"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// 检查情报源是否到期的间隔
+	checkInterval = time.Minute
+	// 单次下载的超时时间
+	fetchTimeout = 2 * time.Minute
+	// 单个情报源的最大字节数
+	maxFeedBytes = 64 << 20
+)
+
+var (
+	ErrFeedTooLarge = errors.New("威胁情报源超过大小限制")
+	ErrListTooLarge = fmt.Errorf("IP 信誉列表超过 %d 条", pkgmodel.IPListMaxEntries)
+)
+
+// FeedManager 定期刷新威胁情报源，合并为 IP 信誉列表，列表变化后热重载引擎
+type FeedManager interface {
+	Start()
+	Stop()
+	// Refresh 立即刷新指定情报源，返回刷新后的情报源
+	Refresh(ctx context.Context, id bson.ObjectID) (*model.ThreatFeed, error)
+	// RebuildLists 按当前启用的情报源重新合并指定列表，情报源设置变更或删除后调用
+	RebuildLists(ctx context.Context, names ...string) error
+}
+
+type FeedManagerImpl struct {
+	feedRepo   repository.ThreatFeedRepository
+	listRepo   repository.IPListRepository
+	httpClient *http.Client
+	logger     zerolog.Logger
+
+	refreshMu sync.Mutex // 同一时间只刷新一个情报源，避免同一列表被并发合并
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// 单例模式实现
+var (
+	instance FeedManager
+	once     sync.Once
+	initErr  error
+)
+
+// GetFeedManager 获取威胁情报源管理器的单例实例
+func GetFeedManager() (FeedManager, error) {
+	once.Do(func() {
+		instance, initErr = newFeedManager()
+	})
+	return instance, initErr
+}
+
+func newFeedManager() (FeedManager, error) {
+	client, err := mongodb.Connect(config.Global.DBConfig.URI)
+	if err != nil {
+		return nil, fmt.Errorf("连接数据库失败: %w", err)
+	}
+	db := client.Database(config.Global.DBConfig.Database)
+	return NewFeedManager(repository.NewThreatFeedRepository(db), repository.NewIPListRepository(db)), nil
+}
+
+// NewFeedManager 创建威胁情报源管理器
+func NewFeedManager(feedRepo repository.ThreatFeedRepository, listRepo repository.IPListRepository) FeedManager {
+	return &FeedManagerImpl{
+		feedRepo:   feedRepo,
+		listRepo:   listRepo,
+		httpClient: &http.Client{Timeout: fetchTimeout},
+		logger:     config.GetServiceLogger("threat_feed"),
+	}
+}
+
+// Start 启动后台刷新循环
+func (m *FeedManagerImpl) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			m.refreshDue(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	m.logger.Info().Msg("威胁情报源管理器已启动")
+}
+
+// Stop 停止后台刷新循环并等待当前刷新完成
+func (m *FeedManagerImpl) Stop() {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel, m.done = nil, nil
+	m.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	m.logger.Info().Msg("威胁情报源管理器已停止")
+}
+
+// refreshDue 刷新所有到期的启用情报源，有列表变化时只热重载一次引擎
+func (m *FeedManagerImpl) refreshDue(ctx context.Context) {
+	feeds, err := m.feedRepo.GetFeeds(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			m.logger.Error().Err(err).Msg("查询威胁情报源失败")
+		}
+		return
+	}
+
+	now := time.Now()
+	changed := false
+	for _, feed := range feeds {
+		if ctx.Err() != nil {
+			return
+		}
+		if !feed.Enabled || now.Sub(feed.Stats.LastAttemptAt) < feedInterval(&feed) {
+			continue
+		}
+
+		listChanged, err := m.refresh(ctx, &feed)
+		if err != nil {
+			m.logger.Warn().Err(err).Str("feed", feed.Name).Msg("刷新威胁情报源失败，继续使用上次成功刷新的条目")
+			continue
+		}
+		changed = changed || listChanged
+	}
+
+	if changed {
+		m.reloadEngine()
+	}
+}
+
+// Refresh 立即刷新指定情报源，列表变化时热重载引擎
+func (m *FeedManagerImpl) Refresh(ctx context.Context, id bson.ObjectID) (*model.ThreatFeed, error) {
+	feed, err := m.feedRepo.GetFeedByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, refreshErr := m.refresh(ctx, feed)
+	if changed {
+		m.reloadEngine()
+	}
+
+	// 返回包含最新统计的情报源，刷新失败时统计中记录失败原因
+	updated, err := m.feedRepo.GetFeedByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return updated, refreshErr
+}
+
+// RebuildLists 重新合并指定列表，列表变化时热重载引擎
+func (m *FeedManagerImpl) RebuildLists(ctx context.Context, names ...string) error {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	changed := false
+	var errs []error
+	for _, name := range names {
+		listChanged, err := m.rebuildList(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		changed = changed || listChanged
+	}
+
+	if changed {
+		m.reloadEngine()
+	}
+	return errors.Join(errs...)
+}
+
+// refresh 下载并解析情报源，保存刷新统计，成功时重新合并所属列表，返回列表是否变化
+func (m *FeedManagerImpl) refresh(ctx context.Context, feed *model.ThreatFeed) (bool, error) {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	start := time.Now()
+	stats := feed.Stats
+	stats.LastAttemptAt = start
+	stats.NotModified = false
+
+	entries, err := m.fetch(ctx, feed, &stats)
+	stats.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		// 内容未能成功解析时不保存新的条件请求标识，下次刷新重新下载
+		stats.ETag, stats.LastModified = feed.Stats.ETag, feed.Stats.LastModified
+		stats.LastError = err.Error()
+		if saveErr := m.feedRepo.SaveRefreshResult(ctx, feed.ID, stats, nil); saveErr != nil {
+			return false, errors.Join(err, saveErr)
+		}
+		return false, err
+	}
+
+	stats.LastSuccessAt = time.Now()
+	stats.LastError = ""
+	if err := m.feedRepo.SaveRefreshResult(ctx, feed.ID, stats, entries); err != nil {
+		return false, err
+	}
+
+	m.logger.Info().
+		Str("feed", feed.Name).
+		Str("list", feed.List).
+		Int("entries", stats.Entries).
+		Int("invalid", stats.Invalid).
+		Bool("notModified", stats.NotModified).
+		Int64("duration", stats.Duration).
+		Msg("威胁情报源已刷新")
+
+	// 远端内容未变化时列表不会变化
+	if entries == nil {
+		return false, nil
+	}
+	return m.rebuildList(ctx, feed.List)
+}
+
+// fetch 读取情报源并解析，远端返回 304 时返回 nil 条目
+func (m *FeedManagerImpl) fetch(ctx context.Context, feed *model.ThreatFeed, stats *model.ThreatFeedStats) ([]string, error) {
+	var body io.ReadCloser
+	switch {
+	case feed.FilePath != "":
+		file, err := os.Open(feed.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("读取本地文件失败: %w", err)
+		}
+		body = file
+	case feed.URL != "":
+		resp, err := m.download(ctx, feed, stats)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			stats.NotModified = true
+			return nil, nil
+		}
+		body = resp
+	default:
+		return nil, errors.New("未配置下载地址或本地文件路径")
+	}
+	defer body.Close()
+
+	counter := &countingReader{r: io.LimitReader(body, maxFeedBytes+1)}
+	result, err := iplist.Parse(counter, feed.Format, feed.CSVColumn)
+	if err != nil {
+		return nil, err
+	}
+	if counter.n > maxFeedBytes {
+		return nil, fmt.Errorf("%w: %d 字节", ErrFeedTooLarge, maxFeedBytes)
+	}
+	if len(result.Prefixes) == 0 {
+		// 空列表通常是下载到了错误页面，保留上次成功刷新的条目
+		return nil, fmt.Errorf("没有解析到有效的 IP 或网段，共 %d 行", result.Lines)
+	}
+
+	merged := iplist.Merge(result.Prefixes)
+	if len(merged) > pkgmodel.IPListMaxEntries {
+		return nil, ErrListTooLarge
+	}
+
+	stats.Bytes = counter.n
+	stats.Lines = result.Lines
+	stats.Invalid = result.Invalid
+	stats.Entries = len(merged)
+	return iplist.Strings(merged), nil
+}
+
+// download 使用条件请求下载情报源，远端内容未变化时返回 nil
+func (m *FeedManagerImpl) download(ctx context.Context, feed *model.ThreatFeed, stats *model.ThreatFeedStats) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("User-Agent", "simple-waf-threat-feed")
+	// 没有保存的条目时（如首次刷新）不使用条件请求
+	if feed.Stats.Entries > 0 {
+		if stats.ETag != "" {
+			req.Header.Set("If-None-Match", stats.ETag)
+		}
+		if stats.LastModified != "" {
+			req.Header.Set("If-Modified-Since", stats.LastModified)
+		}
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("下载失败: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		resp.Body.Close()
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, fmt.Errorf("下载失败: HTTP %d", resp.StatusCode)
+	}
+
+	stats.ETag = resp.Header.Get("ETag")
+	stats.LastModified = resp.Header.Get("Last-Modified")
+	return resp.Body, nil
+}
+
+// rebuildList 合并所有启用且合并到该列表的情报源，没有情报源时删除列表，返回列表内容是否变化
+func (m *FeedManagerImpl) rebuildList(ctx context.Context, name string) (bool, error) {
+	feeds, err := m.feedRepo.GetEnabledFeedsByList(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := m.listRepo.GetListByName(ctx, name)
+	if err != nil && !errors.Is(err, repository.ErrIPListNotFound) {
+		return false, err
+	}
+
+	if len(feeds) == 0 {
+		if current == nil {
+			return false, nil
+		}
+		if err := m.listRepo.DeleteList(ctx, name); err != nil {
+			return false, err
+		}
+		m.logger.Info().Str("list", name).Msg("IP 信誉列表没有启用的情报源，已删除")
+		return true, nil
+	}
+
+	feedNames := make([]string, 0, len(feeds))
+	prefixes := make([][]netip.Prefix, 0, len(feeds))
+	for _, feed := range feeds {
+		feedNames = append(feedNames, feed.Name)
+		prefixes = append(prefixes, iplist.ParseEntries(feed.Entries))
+	}
+	entries := iplist.Strings(iplist.Merge(prefixes...))
+	if len(entries) > pkgmodel.IPListMaxEntries {
+		return false, fmt.Errorf("%s: %w", name, ErrListTooLarge)
+	}
+
+	digest := iplist.Digest(entries)
+	if current != nil && current.Digest == digest && slices.Equal(current.Feeds, feedNames) {
+		return false, nil
+	}
+
+	list := &pkgmodel.IPList{
+		Name:      name,
+		Entries:   entries,
+		Count:     len(entries),
+		Digest:    digest,
+		Feeds:     feedNames,
+		UpdatedAt: time.Now(),
+	}
+	if err := m.listRepo.SaveList(ctx, list); err != nil {
+		return false, err
+	}
+
+	m.logger.Info().Str("list", name).Int("entries", list.Count).Strs("feeds", feedNames).Msg("IP 信誉列表已更新")
+	// 只有来源名称变化时引擎不需要重载
+	return current == nil || current.Digest != digest, nil
+}
+
+// reloadEngine 服务运行中时热重载引擎，未运行时列表会在下次启动时生效
+func (m *FeedManagerImpl) reloadEngine() {
+	runner, err := daemon.GetRunnerService()
+	if err != nil {
+		m.logger.Error().Err(err).Msg("获取ServiceRunner失败")
+		return
+	}
+	if runner.GetState() != daemon.ServiceRunning {
+		return
+	}
+	if err := runner.ReloadEngine(); err != nil {
+		m.logger.Error().Err(err).Msg("IP 信誉列表更新后热重载引擎失败")
+	}
+}
+
+// feedInterval 情报源的刷新间隔
+func feedInterval(feed *model.ThreatFeed) time.Duration {
+	interval := feed.Interval
+	if interval <= 0 {
+		interval = model.ThreatFeedDefaultInterval
+	}
+	if interval < model.ThreatFeedMinInterval {
+		interval = model.ThreatFeedMinInterval
+	}
+	return time.Duration(interval) * time.Second
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
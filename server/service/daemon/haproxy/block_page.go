@@ -0,0 +1,214 @@
+package haproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/haproxytech/client-native/v6/models"
+)
+
+const (
+	// blockPageDefault 全局拦截页面的文件名
+	blockPageDefault = "default"
+
+	// blockCond 引擎判定拦截的条件
+	blockCond = "{ var(txn.coraza.action) -m str deny }"
+	// blockJSONCond 请求方优先接受 JSON 的条件，由请求阶段的 set-var 规则写入，响应阶段无法读取请求头
+	blockJSONCond = "{ var(txn.block_json) -m bool }"
+
+	htmlContentType = "text/html;charset=utf-8"
+	jsonContentType = "application/json"
+)
+
+// blockPagePath 返回拦截页面文件路径，ext 为 html 或 json
+func (s *HAProxyServiceImpl) blockPagePath(name, ext string) string {
+	return filepath.Join(s.BlockPageDir, name+"."+ext)
+}
+
+// writeBlockPage 将模板渲染为 HAProxy lf-file 格式并写入拦截页面目录
+func (s *HAProxyServiceImpl) writeBlockPage(name string, page pkgmodel.BlockPage) error {
+	if err := os.MkdirAll(s.BlockPageDir, 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s: %v", s.BlockPageDir, err)
+	}
+	files := map[string]string{
+		"html": renderBlockPage(page.HTML, html.EscapeString(page.SupportContact)),
+		"json": renderBlockPage(page.JSON, jsonEscape(page.SupportContact)),
+	}
+	for ext, content := range files {
+		if err := os.WriteFile(s.blockPagePath(name, ext), []byte(content), 0644); err != nil {
+			return fmt.Errorf("写入拦截页面失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// renderBlockPage 转义模板中的 %，再把请求 ID 占位符替换为 HAProxy 的事务变量
+func renderBlockPage(tmpl, supportContact string) string {
+	body := strings.ReplaceAll(tmpl, "%", "%%")
+	return strings.NewReplacer(
+		pkgmodel.BlockPagePlaceholderRequestID, "%[var(txn.coraza.id)]",
+		pkgmodel.BlockPagePlaceholderSupportContact, strings.ReplaceAll(supportContact, "%", "%%"),
+	).Replace(body)
+}
+
+// jsonEscape 转义字符串使其可以放入 JSON 字符串中
+func jsonEscape(v string) string {
+	b, _ := json.Marshal(v)
+	return string(b[1 : len(b)-1])
+}
+
+// blockRequestRules 返回请求阶段的拦截响应规则，cond 为空时用于全局页面
+func (s *HAProxyServiceImpl) blockRequestRules(name, cond string) []*models.HTTPRequestRule {
+	rules := make([]*models.HTTPRequestRule, 0, 2)
+	for _, item := range []struct{ ext, contentType, cond string }{
+		{"json", jsonContentType, blockJSONCond},
+		{"html", htmlContentType, ""},
+	} {
+		rules = append(rules, &models.HTTPRequestRule{
+			Type:                "return",
+			ReturnStatusCode:    Int64P(403),
+			ReturnContentType:   StringP(item.contentType),
+			ReturnContentFormat: "lf-file",
+			ReturnContent:       s.blockPagePath(name, item.ext),
+			ReturnHeaders:       []*models.ReturnHeader{{Name: StringP("waf-block"), Fmt: StringP("request")}},
+			Cond:                "if",
+			CondTest:            joinCond(blockCond, cond, item.cond),
+		})
+	}
+	return rules
+}
+
+// blockResponseRules 返回响应阶段的拦截响应规则，cond 为空时用于全局页面
+func (s *HAProxyServiceImpl) blockResponseRules(name, cond string) []*models.HTTPResponseRule {
+	rules := make([]*models.HTTPResponseRule, 0, 2)
+	for _, item := range []struct{ ext, contentType, cond string }{
+		{"json", jsonContentType, blockJSONCond},
+		{"html", htmlContentType, ""},
+	} {
+		rules = append(rules, &models.HTTPResponseRule{
+			Type:                "return",
+			ReturnStatusCode:    Int64P(403),
+			ReturnContentType:   StringP(item.contentType),
+			ReturnContentFormat: "lf-file",
+			ReturnContent:       s.blockPagePath(name, item.ext),
+			ReturnHeaders:       []*models.ReturnHeader{{Name: StringP("waf-block"), Fmt: StringP("response")}},
+			Cond:                "if",
+			CondTest:            joinCond(blockCond, cond, item.cond),
+		})
+	}
+	return rules
+}
+
+// createBlockPageRules 为前端添加全局拦截页面规则：请求开始时按 Accept 记录响应格式，
+// 请求和响应阶段被引擎拦截时返回 403 和对应格式的拦截页面
+func (s *HAProxyServiceImpl) createBlockPageRules(frontend, transactionID string) error {
+	acceptJSON := &models.HTTPRequestRule{
+		Type:     "set-var",
+		VarScope: "txn",
+		VarName:  "block_json",
+		VarExpr:  "bool(true)",
+		Cond:     "if",
+		CondTest: "{ req.hdr(accept) -m sub -i application/json } !{ req.hdr(accept) -m sub -i text/html }",
+	}
+	if err := s.confClient.CreateHTTPRequestRule(0, "frontend", frontend, acceptJSON, transactionID, 0); err != nil {
+		return fmt.Errorf("添加拦截页面规则失败: %v", err)
+	}
+
+	_, requestRules, err := s.confClient.GetHTTPRequestRules("frontend", frontend, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取HTTP请求规则失败: %v", err)
+	}
+	for i, rule := range s.blockRequestRules(blockPageDefault, "") {
+		if err := s.confClient.CreateHTTPRequestRule(int64(len(requestRules)+i), "frontend", frontend, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加拦截页面规则失败: %v", err)
+		}
+	}
+
+	_, responseRules, err := s.confClient.GetHTTPResponseRules("frontend", frontend, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取HTTP响应规则失败: %v", err)
+	}
+	for i, rule := range s.blockResponseRules(blockPageDefault, "") {
+		if err := s.confClient.CreateHTTPResponseRule(int64(len(responseRules)+i), "frontend", frontend, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加拦截页面规则失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// addBlockPageRules 为配置了拦截页面的站点生成页面文件，并在全局拦截页面规则之前插入站点规则。
+// 响应阶段无法按 Host 匹配，请求阶段先把站点记录到 txn.block_page，同一请求匹配多个站点时与后端切换规则一样使用第一个
+func (s *HAProxyServiceImpl) addBlockPageRules(site model.Site, frontend, aclName, transactionID string) error {
+	if site.BlockPage == nil {
+		return nil
+	}
+
+	name := fmt.Sprintf("%d_%s", site.ListenPort, getDashDomain(site.Domain))
+	if err := s.writeBlockPage(name, site.BlockPage.WithDefaults(s.blockPage)); err != nil {
+		return err
+	}
+
+	_, requestRules, err := s.confClient.GetHTTPRequestRules("frontend", frontend, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取HTTP请求规则失败: %v", err)
+	}
+	index := firstReturnRule(len(requestRules), func(i int) string { return requestRules[i].Type })
+	siteVar := &models.HTTPRequestRule{
+		Type:     "set-var",
+		VarScope: "txn",
+		VarName:  "block_page",
+		VarExpr:  fmt.Sprintf("str(%s)", getDashDomain(site.Domain)),
+		Cond:     "if",
+		CondTest: joinCond(aclName, "!{ var(txn.block_page) -m found }"),
+	}
+	rules := append([]*models.HTTPRequestRule{siteVar}, s.blockRequestRules(name, blockSiteCond(site))...)
+	for i, rule := range rules {
+		if err := s.confClient.CreateHTTPRequestRule(int64(index+i), "frontend", frontend, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加站点拦截页面规则失败: %v", err)
+		}
+	}
+
+	_, responseRules, err := s.confClient.GetHTTPResponseRules("frontend", frontend, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取HTTP响应规则失败: %v", err)
+	}
+	index = firstReturnRule(len(responseRules), func(i int) string { return responseRules[i].Type })
+	for i, rule := range s.blockResponseRules(name, blockSiteCond(site)) {
+		if err := s.confClient.CreateHTTPResponseRule(int64(index+i), "frontend", frontend, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加站点拦截页面规则失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// blockSiteCond 匹配请求阶段记录的站点
+func blockSiteCond(site model.Site) string {
+	return fmt.Sprintf("{ var(txn.block_page) -m str %s }", getDashDomain(site.Domain))
+}
+
+// firstReturnRule 返回第一条 return 规则的位置，没有时返回规则数量
+func firstReturnRule(n int, ruleType func(i int) string) int {
+	for i := 0; i < n; i++ {
+		if ruleType(i) == "return" {
+			return i
+		}
+	}
+	return n
+}
+
+// joinCond 合并非空的条件
+func joinCond(conds ...string) string {
+	parts := make([]string, 0, len(conds))
+	for _, cond := range conds {
+		if cond != "" {
+			parts = append(parts, cond)
+		}
+	}
+	return strings.Join(parts, " ")
+}
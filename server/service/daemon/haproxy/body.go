@@ -0,0 +1,67 @@
+package haproxy
+
+import (
+	"fmt"
+	"strings"
+
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/haproxytech/client-native/v6/models"
+)
+
+const (
+	// defaultBufSize HAProxy 默认的 tune.bufsize
+	defaultBufSize = 16384
+	// maxBufSize tune.bufsize 的上限，SPOE 帧大小由 tune.bufsize 决定，引擎最多接收 64KB 的帧
+	maxBufSize = 65536
+)
+
+// bodyBufferSize 按站点的请求体检测上限计算 tune.bufsize，缓冲区需要同时容纳请求头和检测上限以内的请求体，
+// 没有站点需要更大的缓冲区时返回 0，使用 HAProxy 默认值
+func bodyBufferSize(sites []model.Site) int {
+	size := 0
+	for _, site := range sites {
+		b := site.BodyInspection
+		if !site.ActiveStatus || b == nil || !b.Enabled || b.MaxBytes <= 0 {
+			continue
+		}
+		size = max(size, int(b.MaxBytes)+pkgmodel.BodyBufferHeadroom)
+	}
+	if size <= defaultBufSize {
+		return 0
+	}
+	return min(size, maxBufSize)
+}
+
+// addBodyLimitRule 为超限时拒绝的站点追加按 Content-Length 返回 413 的请求规则，
+// 请求体超出缓冲区时引擎只能收到截断的内容，需要在 HAProxy 中直接拒绝，跳过检测的 Content-Type 不受限制
+func (s *HAProxyServiceImpl) addBodyLimitRule(site model.Site, frontend, aclName, transactionID string) error {
+	b := site.BodyInspection
+	if b == nil || !b.RejectOversize() {
+		return nil
+	}
+
+	conds := make([]string, 0, 3)
+	if aclName != "" {
+		conds = append(conds, aclName)
+	}
+	conds = append(conds, fmt.Sprintf("{ req.hdr_val(content-length) gt %d }", b.MaxBytes))
+	if len(b.SkipContentTypes) > 0 {
+		conds = append(conds, fmt.Sprintf("!{ req.hdr(content-type) -m beg -i %s }", strings.Join(b.SkipContentTypes, " ")))
+	}
+
+	_, rules, err := s.confClient.GetHTTPRequestRules("frontend", frontend, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取HTTP请求规则失败: %v", err)
+	}
+	rule := &models.HTTPRequestRule{
+		Type:       "deny",
+		DenyStatus: Int64P(413),
+		Cond:       "if",
+		CondTest:   strings.Join(conds, " "),
+	}
+	if err := s.confClient.CreateHTTPRequestRule(int64(len(rules)), "frontend", frontend, rule, transactionID, 0); err != nil {
+		return fmt.Errorf("添加请求体大小限制规则失败: %v", err)
+	}
+	return nil
+}
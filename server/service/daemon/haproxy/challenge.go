@@ -0,0 +1,125 @@
+package haproxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/haproxytech/client-native/v6/models"
+)
+
+const (
+	// challengeBackend 转发到管理服务验证页面的后端
+	challengeBackend = "be_waf_challenge"
+	// challengeCond 引擎要求客户端先通过人机验证的条件
+	challengeCond = "{ var(txn.coraza.action) -m str challenge }"
+)
+
+// createChallengeRules 启用人机验证时为前端添加验证规则：引擎返回验证动作的请求改写为验证页面，
+// 验证页面路径的请求转发给管理服务。改写不是重定向，浏览器地址不变，验证通过后刷新即可访问原页面
+func (s *HAProxyServiceImpl) createChallengeRules(frontend, transactionID string) error {
+	if !s.isChallenge {
+		return nil
+	}
+
+	if err := s.ensureChallengeBackend(transactionID); err != nil {
+		return err
+	}
+
+	_, requestRules, err := s.confClient.GetHTTPRequestRules("frontend", frontend, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取HTTP请求规则失败: %v", err)
+	}
+	rules := []*models.HTTPRequestRule{
+		{
+			Type:      "set-method",
+			MethodFmt: "GET",
+			Cond:      "if",
+			CondTest:  challengeCond,
+		},
+		{
+			Type:     "set-uri",
+			URIFmt:   pkgmodel.ChallengePath,
+			Cond:     "if",
+			CondTest: challengeCond,
+		},
+	}
+	for i, rule := range rules {
+		if err := s.confClient.CreateHTTPRequestRule(int64(len(requestRules)+i), "frontend", frontend, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加人机验证规则失败: %v", err)
+		}
+	}
+
+	useBackend := &models.BackendSwitchingRule{
+		Name:     challengeBackend,
+		Cond:     "if",
+		CondTest: fmt.Sprintf("{ path_beg %s }", pkgmodel.ChallengePath),
+	}
+	if err := s.confClient.CreateBackendSwitchingRule(0, frontend, useBackend, transactionID, 0); err != nil {
+		return fmt.Errorf("创建人机验证后端切换规则失败: %v", err)
+	}
+	return nil
+}
+
+// ensureChallengeBackend 创建转发到管理服务的验证后端，多个端口的前端共用一个后端
+func (s *HAProxyServiceImpl) ensureChallengeBackend(transactionID string) error {
+	if _, _, err := s.confClient.GetBackend(challengeBackend, transactionID); err == nil {
+		return nil
+	}
+
+	host, port, err := managementAddress(config.Global.Bind)
+	if err != nil {
+		return err
+	}
+
+	backend := &models.Backend{
+		BackendBase: models.BackendBase{
+			Name:    challengeBackend,
+			Mode:    "http",
+			Enabled: true,
+			From:    "http",
+		},
+	}
+	if err := s.confClient.CreateBackend(backend, transactionID, 0); err != nil {
+		return fmt.Errorf("创建人机验证后端失败: %v", err)
+	}
+
+	// 管理服务使用这些请求头识别客户端IP和协议，覆盖客户端自行携带的同名请求头
+	headers := []*models.HTTPRequestRule{
+		{
+			Type:      "set-header",
+			HdrName:   pkgmodel.ChallengeClientIPHeader,
+			HdrFormat: "%[src]",
+		},
+		{
+			Type:      "set-header",
+			HdrName:   pkgmodel.ChallengeClientProtoHeader,
+			HdrFormat: "%[ssl_fc,iif(https,http)]",
+		},
+	}
+	for i, rule := range headers {
+		if err := s.confClient.CreateHTTPRequestRule(int64(i), "backend", challengeBackend, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加人机验证后端规则失败: %v", err)
+		}
+	}
+
+	return s.createBackendServer("management", host, port, transactionID, challengeBackend, false, false)
+}
+
+// managementAddress 将管理服务的监听地址转换为 HAProxy 可以连接的地址，监听所有地址时使用本机地址
+func managementAddress(bind string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(bind)
+	if err != nil {
+		return "", 0, fmt.Errorf("解析管理服务地址失败: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("解析管理服务端口失败: %v", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return host, port, nil
+}
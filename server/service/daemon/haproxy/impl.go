@@ -18,6 +18,7 @@ import (
 	"text/template"
 	"time"
 
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	"github.com/HUAHUAI23/simple-waf/server/model"
 	client_native "github.com/haproxytech/client-native/v6"
@@ -39,12 +40,20 @@ const (
 	StatusError
 )
 
+const (
+	// defaultDrainTimeout 未配置 hard-stop-after 时软停止的最长等待时间
+	defaultDrainTimeout = 60 * time.Second
+	// drainTimeoutMargin 配置了 hard-stop-after 时额外等待进程退出的时间
+	drainTimeoutMargin = 5 * time.Second
+)
+
 type HAProxyServiceImpl struct {
 	ConfigBaseDir      string
 	HAProxyConfigFile  string // 配置文件路径
 	HaproxyBin         string // HAProxy二进制文件路径
 	BackupsNumber      int
 	CertDir            string // 证书目录
+	BlockPageDir       string // 拦截页面目录
 	TransactionDir     string // 事务目录
 	SpoeDir            string // SPOE目录
 	SpoeTransactionDir string // SPOE事务目录
@@ -64,10 +73,20 @@ type HAProxyServiceImpl struct {
 	status          atomic.Int32                // 使用原子操作的状态
 	isDebug         bool                        // 是否为生产环境
 	thread          int                         // 线程数
-
-	logger zerolog.Logger
-	ctx    context.Context
-	mutex  sync.Mutex
+	hardStopAfter   int                         // 软停止后强制关闭连接的秒数
+	bufSize         int                         // tune.bufsize，0 表示使用 HAProxy 默认值
+	blockPage       pkgmodel.BlockPage          // 全局拦截页面，已用默认模板补全
+	isChallenge     bool                        // 是否启用人机验证
+	engine          pkgmodel.EngineConfig       // 引擎配置，用于生成 coraza-spoa 后端
+
+	haproxyExited chan struct{} // 进程退出时关闭
+	supervisor    supervisor    // 进程监管状态
+	output        *outputBuffer // 进程输出缓冲
+
+	logger       zerolog.Logger
+	ctx          context.Context
+	mutex        sync.Mutex
+	stagingMutex sync.Mutex // 暂存目录同一时间只允许一次生成
 }
 
 func (s *HAProxyServiceImpl) GetStatus() HAProxyStatus {
@@ -78,11 +97,15 @@ func (s *HAProxyServiceImpl) Start() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if _, err := os.Stat(s.HAProxyConfigFile); os.IsNotExist(err) {
-		return fmt.Errorf("没有 haporxy 配置文件")
-	}
-	if _, err := os.Stat(s.SpoeConfigFile); os.IsNotExist(err) {
-		return fmt.Errorf("没有 spoe 配置文件")
+	s.resetSupervisor()
+	return s.startHAProxy()
+}
+
+// startHAProxy 启动 HAProxy 进程并交由 supervise 监管，调用方需持有 mutex
+func (s *HAProxyServiceImpl) startHAProxy() error {
+	// 配置缺失或校验不通过时恢复最近一次可用配置
+	if err := s.ensureValidConfig(); err != nil {
+		return err
 	}
 
 	// 检查HAProxy是否已经在运行
@@ -107,14 +130,17 @@ func (s *HAProxyServiceImpl) Start() error {
 	// 启动HAProxy进程
 	cmd := exec.Command(s.HaproxyBin, args...)
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// 输出同时写入标准输出和缓冲，便于通过接口查看
+	cmd.Stdout = io.MultiWriter(os.Stdout, s.output.Writer("stdout"))
+	cmd.Stderr = io.MultiWriter(os.Stderr, s.output.Writer("stderr"))
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("启动HAProxy失败: %v", err)
 	}
 
 	s.haproxyCmd = cmd
+	s.haproxyExited = make(chan struct{})
+	s.supervise(cmd, s.haproxyExited)
 
 	maxAttempts := 10
 	for i := 0; i < maxAttempts; i++ {
@@ -125,6 +151,7 @@ func (s *HAProxyServiceImpl) Start() error {
 		}
 
 		if i == maxAttempts-1 {
+			s.stopHAProxy()
 			return fmt.Errorf("套接字文件未创建: %s", s.SocketFile)
 		}
 
@@ -139,6 +166,7 @@ func (s *HAProxyServiceImpl) Start() error {
 	}
 
 	s.status.Store(int32(StatusRunning))
+	s.saveLastKnownGood()
 
 	return nil
 }
@@ -186,12 +214,22 @@ func (s *HAProxyServiceImpl) AddSiteConfig(site model.Site) error {
 		}
 
 		for index, server := range site.Backend.Servers {
-			err = s.createBackendServer(fmt.Sprintf("s%s_%d", getDashDomain(site.Domain), index), server.Host, server.Port, transaction.ID, fmt.Sprintf("p%d_backend", site.ListenPort), server.IsSSL)
+			err = s.createBackendServer(fmt.Sprintf("s%s_%d", getDashDomain(site.Domain), index), server.Host, server.Port, transaction.ID, fmt.Sprintf("p%d_backend", site.ListenPort), server.IsSSL, server.HTTP2)
 			if err != nil {
 				return fmt.Errorf("创建后端服务器失败: %v", err)
 			}
 		}
 
+		if err := s.addBodyLimitRule(site, fmt.Sprintf("fe_%d_http", site.ListenPort), "", transaction.ID); err != nil {
+			return err
+		}
+		if err := s.addHTTP2Rule(site, fmt.Sprintf("fe_%d_http", site.ListenPort), "", transaction.ID); err != nil {
+			return err
+		}
+		if err := s.addBlockPageRules(site, fmt.Sprintf("fe_%d_http", site.ListenPort), "", transaction.ID); err != nil {
+			return err
+		}
+
 	} else {
 		_, aclList, err := s.confClient.GetACLs("frontend", fmt.Sprintf("fe_%d_http", site.ListenPort), "")
 		if err != nil {
@@ -244,11 +282,21 @@ func (s *HAProxyServiceImpl) AddSiteConfig(site model.Site) error {
 		}
 
 		for index, server := range site.Backend.Servers {
-			err = s.createBackendServer(fmt.Sprintf("%s_%d", getDashDomain(site.Domain), index), server.Host, server.Port, transaction.ID, backend_http.Name, server.IsSSL)
+			err = s.createBackendServer(fmt.Sprintf("%s_%d", getDashDomain(site.Domain), index), server.Host, server.Port, transaction.ID, backend_http.Name, server.IsSSL, server.HTTP2)
 			if err != nil {
 				return fmt.Errorf("创建后端服务器失败: %v", err)
 			}
 		}
+
+		if err := s.addBodyLimitRule(site, fmt.Sprintf("fe_%d_http", site.ListenPort), acl_http.ACLName, transaction.ID); err != nil {
+			return err
+		}
+		if err := s.addHTTP2Rule(site, fmt.Sprintf("fe_%d_http", site.ListenPort), acl_http.ACLName, transaction.ID); err != nil {
+			return err
+		}
+		if err := s.addBlockPageRules(site, fmt.Sprintf("fe_%d_http", site.ListenPort), acl_http.ACLName, transaction.ID); err != nil {
+			return err
+		}
 	}
 
 	// handle https
@@ -283,6 +331,10 @@ func (s *HAProxyServiceImpl) AddSiteConfig(site model.Site) error {
 			}
 		}
 		https_bind.Ssl = true
+		// ALPN 在绑定上协商，同一端口任一站点启用 HTTP/2 时该端口的 HTTPS 连接都可以使用 h2
+		if site.EnableHTTP2 {
+			https_bind.Alpn = "h2,http/1.1"
+		}
 
 		err = s.confClient.EditBind("internal_https", "frontend", fmt.Sprintf("fe_%d_https", site.ListenPort), https_bind, transaction.ID, 0)
 		if err != nil {
@@ -322,6 +374,18 @@ func (s *HAProxyServiceImpl) AddSiteConfig(site model.Site) error {
 			return fmt.Errorf("创建后端切换规则失败: %v", err)
 		}
 
+		// IP 站点独占端口，不需要按 Host 区分
+		hostACL := acl_https.ACLName
+		if isIPAddress(site.Domain) {
+			hostACL = ""
+		}
+		if err := s.addBodyLimitRule(site, fmt.Sprintf("fe_%d_https", site.ListenPort), hostACL, transaction.ID); err != nil {
+			return err
+		}
+		if err := s.addBlockPageRules(site, fmt.Sprintf("fe_%d_https", site.ListenPort), hostACL, transaction.ID); err != nil {
+			return err
+		}
+
 	}
 
 	transaction, err = s.confClient.CommitTransaction(transaction.ID)
@@ -338,10 +402,52 @@ func (s *HAProxyServiceImpl) Stop() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	s.resetSupervisor()
 	return s.stopHAProxy()
 
 }
 
+// Drain 软停止 HAProxy：向 master 进程发送 SIGUSR1，停止监听新连接并等待已有连接处理完成，
+// 超过 hard-stop-after 仍未退出时强制终止
+func (s *HAProxyServiceImpl) Drain() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.resetSupervisor()
+	timeout := s.drainTimeout()
+
+	cmd := s.haproxyCmd
+	if cmd == nil || cmd.Process == nil {
+		return s.stopHAProxy()
+	}
+
+	s.logger.Info().Int("pid", cmd.Process.Pid).Dur("timeout", timeout).Msg("软停止HAProxy，等待已有连接处理完成")
+	if err := cmd.Process.Signal(syscall.SIGUSR1); err != nil {
+		s.logger.Error().Err(err).Msg("发送软停止信号失败，直接停止HAProxy")
+		return s.stopHAProxy()
+	}
+
+	select {
+	case <-s.haproxyExited:
+		// 持有锁时清空进程，supervise 不会把这次退出当作崩溃
+		s.haproxyCmd = nil
+		s.cleanupAfterStop()
+		s.logger.Info().Msg("HAProxy已软停止")
+		return nil
+	case <-time.After(timeout):
+		s.logger.Warn().Msg("等待HAProxy软停止超时，强制停止")
+		return s.stopHAProxy()
+	}
+}
+
+// drainTimeout 软停止的等待时间：配置了 hard-stop-after 时多等待几秒，否则使用默认值
+func (s *HAProxyServiceImpl) drainTimeout() time.Duration {
+	if s.hardStopAfter > 0 {
+		return time.Duration(s.hardStopAfter)*time.Second + drainTimeoutMargin
+	}
+	return defaultDrainTimeout
+}
+
 func (s *HAProxyServiceImpl) Reload() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -368,6 +474,7 @@ func (s *HAProxyServiceImpl) HotReloadRemoveConfig() error {
 		s.TransactionDir,
 		s.SpoeTransactionDir,
 		s.CertDir,
+		s.BlockPageDir,
 	}
 
 	// 特殊处理 filepath.Dir(s.HAProxyConfigFile)
@@ -460,6 +567,7 @@ func (s *HAProxyServiceImpl) RemoveConfig() error {
 		s.TransactionDir,
 		s.SpoeTransactionDir,
 		s.CertDir,
+		s.BlockPageDir,
 	}
 
 	// 删除文件
@@ -510,6 +618,7 @@ func (s *HAProxyServiceImpl) InitHAProxyConfig() error {
 		s.SpoeDir,
 		s.SpoeTransactionDir,
 		s.CertDir,
+		s.BlockPageDir,
 	}
 
 	for _, dir := range dirs {
@@ -536,6 +645,8 @@ func (s *HAProxyServiceImpl) InitHAProxyConfig() error {
 global
     log stdout format raw local0
 {{if gt .Thread 0}}    nbthread {{.Thread}} # 线程数
+{{end}}{{if gt .HardStopAfter 0}}    hard-stop-after {{.HardStopAfter}}s # 软停止后强制关闭连接的时间
+{{end}}{{if gt .BufSize 0}}    tune.bufsize {{.BufSize}} # 缓冲区大小，决定可以缓冲并发送给引擎检测的请求体大小
 {{end}} 
     # user {{.Username}}
     # group {{.Username}}
@@ -547,6 +658,7 @@ defaults http
     timeout client 1m
     timeout server 1m
     timeout connect 10s
+    timeout tunnel 1h # WebSocket 升级后的隧道空闲超时
 defaults tcp
     mode tcp
     log global
@@ -565,11 +677,15 @@ frontend stats from http
 	fmt.Println("s.thread", s.thread)
 	// 准备模板数据
 	data := struct {
-		Username string
-		Thread   int
+		Username      string
+		Thread        int
+		HardStopAfter int
+		BufSize       int
 	}{
-		Username: username,
-		Thread:   s.thread,
+		Username:      username,
+		Thread:        s.thread,
+		HardStopAfter: s.hardStopAfter,
+		BufSize:       s.bufSize,
 	}
 
 	// 解析模板
@@ -588,6 +704,10 @@ frontend stats from http
 		return fmt.Errorf("failed to create basic config file: %v", err)
 	}
 
+	if err := s.writeBlockPage(blockPageDefault, s.blockPage); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -637,13 +757,14 @@ func (s *HAProxyServiceImpl) InitSpoeConfig() error {
 
 	agent := &models.SpoeAgent{
 		Name: StringP("coraza-agent"),
-		// 根据 isResponseCheck 决定是否包含响应处理
+		// 请求消息由前端的 send-spoe-group 规则在请求体缓冲之后发送，响应消息按事件发送
 		Messages: func() string {
 			if s.isResponseCheck {
-				return "coraza-req coraza-res"
+				return "coraza-res"
 			}
-			return "coraza-req"
+			return ""
 		}(),
+		Groups:            spoeRequestGroup,
 		OptionVarPrefix:   "coraza",
 		OptionSetOnError:  "error",
 		HelloTimeout:      2000,   // 2s (毫秒)
@@ -659,14 +780,10 @@ func (s *HAProxyServiceImpl) InitSpoeConfig() error {
 		return fmt.Errorf("创建 SPOE 代理错误: %v", err)
 	}
 
-	// 创建 coraza-req 消息
-	reqEvent := &models.SpoeMessageEvent{
-		Name: StringP("on-frontend-http-request"),
-	}
+	// 创建 coraza-req 消息，不绑定事件，通过 coraza-req 组发送
 	reqMsg := &models.SpoeMessage{
-		Name:  StringP("coraza-req"),
-		Event: reqEvent,
-		Args:  "app=str(coraza) src-ip=src src-port=src_port dst-ip=dst dst-port=dst_port method=method path=path query=query version=req.ver headers=req.hdrs body=req.body",
+		Name: StringP("coraza-req"),
+		Args: "app=str(coraza) src-ip=src src-port=src_port dst-ip=dst dst-port=dst_port method=method path=path query=query version=req.ver headers=req.hdrs body=req.body",
 	}
 
 	// 在 coraza section 下创建 message
@@ -676,6 +793,16 @@ func (s *HAProxyServiceImpl) InitSpoeConfig() error {
 		return fmt.Errorf("创建 SPOE 请求消息错误: %v", err)
 	}
 
+	reqGroup := &models.SpoeGroup{
+		Name:     StringP(spoeRequestGroup),
+		Messages: "coraza-req",
+	}
+	err = singleSpoe.CreateGroup(string(scopeName), reqGroup, transaction.ID, 0)
+	if err != nil {
+		singleSpoe.Transaction.DeleteTransaction(transaction.ID)
+		return fmt.Errorf("创建 SPOE 请求消息组错误: %v", err)
+	}
+
 	// 创建 coraza-res 消息
 	if s.isResponseCheck {
 		resEvent := &models.SpoeMessageEvent{
@@ -768,12 +895,22 @@ func (s *HAProxyServiceImpl) AddCorazaBackend() error {
 		return fmt.Errorf("启动事务失败: %v", err)
 	}
 
+	balance := s.engine.Balance
+	if balance == "" {
+		balance = "roundrobin"
+	}
+
 	coraza_backend := &models.Backend{
 		BackendBase: models.BackendBase{
 			Name:    "coraza-spoa",
 			Mode:    "tcp",
 			From:    "tcp",
 			Enabled: true,
+			Balance: &models.Balance{
+				Algorithm: StringP(balance),
+			},
+			// 使用 SPOP HELLO 握手检查引擎实例是否可用
+			SpopCheck: models.BackendBaseSpopCheckEnabled,
 		},
 	}
 	err = s.confClient.CreateBackend(coraza_backend, transaction.ID, 0)
@@ -781,14 +918,16 @@ func (s *HAProxyServiceImpl) AddCorazaBackend() error {
 		return fmt.Errorf("创建后端失败: %v", err)
 	}
 
-	server_coraza := &models.Server{
-		Name:    "coraza-agent",
-		Address: s.SpoeAgentAddress,      // 从结构体中获取地址，支持域名或IP
-		Port:    Int64P(s.SpoeAgentPort), // 从结构体中获取端口
+	servers := s.engineServers()
+	if len(servers) == 0 {
+		s.confClient.DeleteTransaction(transaction.ID)
+		return fmt.Errorf("没有可用的引擎实例")
 	}
-	err = s.confClient.CreateServer("backend", coraza_backend.Name, server_coraza, transaction.ID, 0)
-	if err != nil {
-		return fmt.Errorf("创建服务器失败: %v", err)
+	for _, server := range servers {
+		err = s.confClient.CreateServer("backend", coraza_backend.Name, server, transaction.ID, 0)
+		if err != nil {
+			return fmt.Errorf("创建服务器失败 %s: %v", server.Name, err)
+		}
 	}
 
 	transaction, err = s.confClient.CommitTransaction(transaction.ID)
@@ -810,8 +949,12 @@ func (s *HAProxyServiceImpl) Reset() error {
 	}
 
 	s.thread = appConfig.Haproxy.Thread
+	s.hardStopAfter = appConfig.Haproxy.HardStopAfter
+	s.blockPage = appConfig.Haproxy.BlockPage.WithDefaults(pkgmodel.DefaultBlockPage())
+	s.isChallenge = appConfig.Challenge.Active()
 	s.isResponseCheck = appConfig.IsResponseCheck
 	s.isDebug = appConfig.IsDebug
+	s.engine = appConfig.Engine
 
 	if err := s.resetClients(); err != nil {
 		return fmt.Errorf("重置客户端失败: %v", err)
@@ -820,6 +963,43 @@ func (s *HAProxyServiceImpl) Reset() error {
 	return nil
 }
 
+// engineServers 返回 coraza-spoa 后端中的引擎实例：内置引擎和启用的外部实例，均开启健康检查
+func (s *HAProxyServiceImpl) engineServers() []*models.Server {
+	healthCheck := models.ServerParams{
+		Check: "enabled",
+		Inter: Int64P(2000),
+		Fall:  Int64P(3),
+		Rise:  Int64P(2),
+	}
+
+	var servers []*models.Server
+	if !s.engine.ExternalOnly {
+		servers = append(servers, &models.Server{
+			Name:         "coraza-agent",
+			Address:      s.SpoeAgentAddress,      // 从结构体中获取地址，支持域名或IP
+			Port:         Int64P(s.SpoeAgentPort), // 从结构体中获取端口
+			ServerParams: healthCheck,
+		})
+	}
+
+	for _, instance := range s.engine.Instances {
+		if !instance.Enabled {
+			continue
+		}
+		params := healthCheck
+		if instance.Weight > 0 {
+			params.Weight = Int64P(int64(instance.Weight))
+		}
+		servers = append(servers, &models.Server{
+			Name:         "coraza-agent-" + instance.Name,
+			Address:      instance.Address,
+			Port:         Int64P(int64(instance.Port)),
+			ServerParams: params,
+		})
+	}
+	return servers
+}
+
 // ========================== internal method ==========================
 func (s *HAProxyServiceImpl) initConfClient() error {
 	confClient, err := configuration.New(s.ctx,
@@ -956,8 +1136,14 @@ func (s *HAProxyServiceImpl) stopHAProxy() error {
 			}
 		}
 
-		// 等待进程完全退出
-		s.haproxyCmd.Wait()
+		// 等待进程完全退出，Wait 由 supervise 调用
+		select {
+		case <-s.haproxyExited:
+		case <-time.After(10 * time.Second):
+			s.logger.Warn().Msg("等待HAProxy退出超时，强制终止")
+			s.haproxyCmd.Process.Kill()
+			<-s.haproxyExited
+		}
 		s.haproxyCmd = nil
 	} else {
 		// 尝试读取PID文件
@@ -986,6 +1172,12 @@ func (s *HAProxyServiceImpl) stopHAProxy() error {
 		}
 	}
 
+	s.cleanupAfterStop()
+	return nil
+}
+
+// cleanupAfterStop 进程退出后重置客户端并删除套接字和PID文件
+func (s *HAProxyServiceImpl) cleanupAfterStop() {
 	// 重置客户端
 	s.runtimeClient = nil
 
@@ -1004,31 +1196,70 @@ func (s *HAProxyServiceImpl) stopHAProxy() error {
 	}
 
 	s.status.Store(int32(StatusStopped))
-	return nil
 }
 
 func (s *HAProxyServiceImpl) reloadHAProxy() error {
-
 	if err := s.ensureRuntimeClient(); err != nil {
 		return fmt.Errorf("初始化运行时客户端失败: %v", err)
 	}
-	_, err := s.runtimeClient.Reload()
+
+	if output, err := s.checkConfig(); err != nil {
+		s.logger.Error().Err(err).Str("output", output).Msg("HAProxy 配置未通过校验，放弃重载")
+		if restoreErr := s.restoreLastKnownGood(); restoreErr != nil {
+			s.logger.Error().Err(restoreErr).Msg("恢复最近一次可用配置失败")
+		}
+		return fmt.Errorf("%w: %s", ErrConfigInvalid, strings.TrimSpace(output))
+	}
+
+	logs, err := s.runtimeClient.Reload()
 	if err != nil {
+		s.logger.Error().Err(err).Str("logs", logs).Msg("重新加载 HAProxy 失败，恢复最近一次可用配置")
+		if restoreErr := s.restoreLastKnownGood(); restoreErr != nil {
+			s.logger.Error().Err(restoreErr).Msg("恢复最近一次可用配置失败")
+		} else if err := s.ensureRuntimeClient(); err == nil {
+			if _, retryErr := s.runtimeClient.Reload(); retryErr != nil {
+				s.logger.Error().Err(retryErr).Msg("使用最近一次可用配置重新加载失败")
+			}
+		}
 		return fmt.Errorf("重新加载 HAProxy 失败: %v", err)
 	}
+
+	s.saveLastKnownGood()
+	return nil
+}
+
+// ensureValidConfig 校验正在使用的配置，缺失或不通过时恢复最近一次可用配置
+func (s *HAProxyServiceImpl) ensureValidConfig() error {
+	output, err := s.checkConfig()
+	if err == nil {
+		if _, err := os.Stat(s.SpoeConfigFile); err == nil {
+			return nil
+		}
+		output = "没有 spoe 配置文件"
+	} else if strings.TrimSpace(output) == "" {
+		output = err.Error()
+	}
+
+	s.logger.Warn().Str("output", output).Msg("HAProxy 配置不可用，尝试恢复最近一次可用配置")
+	if restoreErr := s.restoreLastKnownGood(); restoreErr != nil {
+		return fmt.Errorf("%w: %s（%v）", ErrConfigInvalid, strings.TrimSpace(output), restoreErr)
+	}
+	if output, err := s.checkConfig(); err != nil {
+		return fmt.Errorf("%w: 最近一次可用配置也未通过校验: %s", ErrConfigInvalid, strings.TrimSpace(output))
+	}
 	return nil
 }
 
 func (s *HAProxyServiceImpl) isHAProxyRunning() (bool, error) {
 	// 如果实例中存储了HAProxy命令，检查它
 	if s.haproxyCmd != nil && s.haproxyCmd.Process != nil {
-		// 尝试发送信号0检查进程是否存在
-		if err := s.haproxyCmd.Process.Signal(syscall.Signal(0)); err != nil {
-			// 进程不存在
-			s.haproxyCmd = nil
+		select {
+		case <-s.haproxyExited:
+			// 进程已退出
 			return false, nil
+		default:
+			return true, nil
 		}
-		return true, nil
 	}
 
 	// 尝试读取PID文件
@@ -1194,13 +1425,25 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		return fmt.Errorf("创建TCP请求规则失败: %v", err)
 	}
 
+	// h2c（prior knowledge）的连接前言不是 HTTP/1 请求，单独识别后交给 HTTP 前端
+	tcpAcceptH2C := &models.TCPRequestRule{
+		Action:   "accept",
+		Type:     "content",
+		Cond:     "if",
+		CondTest: h2cPrefaceCond,
+	}
+	err = s.confClient.CreateTCPRequestRule(2, "frontend", fe_combined.Name, tcpAcceptH2C, transaction.ID, 0)
+	if err != nil {
+		return fmt.Errorf("创建TCP请求规则失败: %v", err)
+	}
+
 	tcpAcceptSSL := &models.TCPRequestRule{
 		Action:   "accept",
 		Type:     "content",
 		Cond:     "if",
 		CondTest: "{ req.ssl_hello_type 1 }",
 	}
-	err = s.confClient.CreateTCPRequestRule(2, "frontend", fe_combined.Name, tcpAcceptSSL, transaction.ID, 0)
+	err = s.confClient.CreateTCPRequestRule(3, "frontend", fe_combined.Name, tcpAcceptSSL, transaction.ID, 0)
 	if err != nil {
 		return fmt.Errorf("创建TCP请求规则失败: %v", err)
 	}
@@ -1216,6 +1459,16 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		return fmt.Errorf("创建后端切换规则失败: %v", err)
 	}
 
+	useBackendH2C := &models.BackendSwitchingRule{
+		Name:     fmt.Sprintf("be_%d_http", port),
+		Cond:     "if",
+		CondTest: h2cPrefaceCond,
+	}
+	err = s.confClient.CreateBackendSwitchingRule(1, fe_combined.Name, useBackendH2C, transaction.ID, 0)
+	if err != nil {
+		return fmt.Errorf("创建后端切换规则失败: %v", err)
+	}
+
 	// abstract backend abns@haproxy-{port}-http
 	be_http := &models.Backend{
 		BackendBase: models.BackendBase{
@@ -1343,19 +1596,11 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 				CondTest:   "{ var(txn.coraza.action) -m str redirect }",
 			}},
 			{2, &models.HTTPRequestRule{
-				Type:       "deny",
-				DenyStatus: Int64P(403),
-				HdrName:    "waf-block", // 设置头部名称
-				HdrFormat:  "request",   // 设置头部值
-				Cond:       "if",
-				CondTest:   "{ var(txn.coraza.action) -m str deny }",
-			}},
-			{3, &models.HTTPRequestRule{
 				Type:     "silent-drop",
 				Cond:     "if",
 				CondTest: "{ var(txn.coraza.action) -m str drop }",
 			}},
-			{4, &models.HTTPRequestRule{
+			{3, &models.HTTPRequestRule{
 				Type:       "deny",
 				DenyStatus: Int64P(500),
 				Cond:       "if",
@@ -1377,19 +1622,11 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 				CondTest:   "{ var(txn.coraza.action) -m str redirect }",
 			}},
 			{1, &models.HTTPRequestRule{
-				Type:       "deny",
-				DenyStatus: Int64P(403),
-				HdrName:    "waf-block", // 设置头部名称
-				HdrFormat:  "request",   // 设置头部值
-				Cond:       "if",
-				CondTest:   "{ var(txn.coraza.action) -m str deny }",
-			}},
-			{2, &models.HTTPRequestRule{
 				Type:     "silent-drop",
 				Cond:     "if",
 				CondTest: "{ var(txn.coraza.action) -m str drop }",
 			}},
-			{3, &models.HTTPRequestRule{
+			{2, &models.HTTPRequestRule{
 				Type:       "deny",
 				DenyStatus: Int64P(500),
 				Cond:       "if",
@@ -1406,6 +1643,10 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		}
 	}
 
+	if err := s.createInspectRules(fe_http.Name, transaction.ID); err != nil {
+		return err
+	}
+
 	// 添加HTTP响应规则 - 确保HTTP响应规则结构正确
 	fe_http_response_rule := []struct {
 		index int64
@@ -1420,19 +1661,11 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			CondTest:   "{ var(txn.coraza.action) -m str redirect }",
 		}},
 		{1, &models.HTTPResponseRule{
-			Type:       "deny",
-			DenyStatus: Int64P(403),
-			HdrName:    "waf-block", // 设置头部名称
-			HdrFormat:  "response",  // 设置头部值
-			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.action) -m str deny }",
-		}},
-		{2, &models.HTTPResponseRule{
 			Type:     "silent-drop",
 			Cond:     "if",
 			CondTest: "{ var(txn.coraza.action) -m str drop }",
 		}},
-		{3, &models.HTTPResponseRule{
+		{2, &models.HTTPResponseRule{
 			Type:       "deny",
 			DenyStatus: Int64P(500),
 			Cond:       "if",
@@ -1447,6 +1680,16 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		}
 	}
 
+	// 被引擎拦截时返回拦截页面
+	if err := s.createBlockPageRules(fe_http.Name, transaction.ID); err != nil {
+		return err
+	}
+
+	// 引擎要求验证时返回验证页面
+	if err := s.createChallengeRules(fe_http.Name, transaction.ID); err != nil {
+		return err
+	}
+
 	// fe_(port)_https
 	fe_https := &models.Frontend{
 		FrontendBase: models.FrontendBase{
@@ -1504,19 +1747,11 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			CondTest:   "{ var(txn.coraza.action) -m str redirect }",
 		}},
 		{1, &models.HTTPRequestRule{
-			Type:       "deny",
-			DenyStatus: Int64P(403),
-			HdrName:    "waf-block", // 设置头部名称
-			HdrFormat:  "request",   // 设置头部值
-			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.action) -m str deny }",
-		}},
-		{2, &models.HTTPRequestRule{
 			Type:     "silent-drop",
 			Cond:     "if",
 			CondTest: "{ var(txn.coraza.action) -m str drop }",
 		}},
-		{3, &models.HTTPRequestRule{
+		{2, &models.HTTPRequestRule{
 			Type:       "deny",
 			DenyStatus: Int64P(500),
 			Cond:       "if",
@@ -1531,6 +1766,10 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		}
 	}
 
+	if err := s.createInspectRules(fe_https.Name, transaction.ID); err != nil {
+		return err
+	}
+
 	// 添加HTTPs响应规则 - 确保HTTP响应规则结构正确
 	fe_https_response_rule := []struct {
 		index int64
@@ -1545,19 +1784,11 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			CondTest:   "{ var(txn.coraza.action) -m str redirect }",
 		}},
 		{1, &models.HTTPResponseRule{
-			Type:       "deny",
-			DenyStatus: Int64P(403),
-			HdrName:    "waf-block", // 设置头部名称
-			HdrFormat:  "response",  // 设置头部值
-			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.action) -m str deny }",
-		}},
-		{2, &models.HTTPResponseRule{
 			Type:     "silent-drop",
 			Cond:     "if",
 			CondTest: "{ var(txn.coraza.action) -m str drop }",
 		}},
-		{3, &models.HTTPResponseRule{
+		{2, &models.HTTPResponseRule{
 			Type:       "deny",
 			DenyStatus: Int64P(500),
 			Cond:       "if",
@@ -1572,6 +1803,16 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		}
 	}
 
+	// 被引擎拦截时返回拦截页面
+	if err := s.createBlockPageRules(fe_https.Name, transaction.ID); err != nil {
+		return err
+	}
+
+	// 引擎要求验证时返回验证页面
+	if err := s.createChallengeRules(fe_https.Name, transaction.ID); err != nil {
+		return err
+	}
+
 	// default backend
 	be_default := &models.Backend{
 		BackendBase: models.BackendBase{
@@ -1611,7 +1852,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 
 }
 
-func (s *HAProxyServiceImpl) createBackendServer(name, address string, port int, transactionID string, backendName string, isSsl bool) error {
+func (s *HAProxyServiceImpl) createBackendServer(name, address string, port int, transactionID string, backendName string, isSsl bool, isH2 bool) error {
 	server := &models.Server{
 		Name:    name,
 		Address: address,
@@ -1626,6 +1867,14 @@ func (s *HAProxyServiceImpl) createBackendServer(name, address string, port int,
 		}
 	}
 
+	// gRPC 等只支持 HTTP/2 的后端，TLS 时通过 ALPN 协商，明文时使用 h2c
+	if isH2 {
+		server.ServerParams.Proto = "h2"
+		if isSsl {
+			server.ServerParams.Alpn = "h2"
+		}
+	}
+
 	return s.confClient.CreateServer("backend", backendName, server, transactionID, 0)
 
 }
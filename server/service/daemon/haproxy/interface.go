@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	"github.com/HUAHUAI23/simple-waf/server/model"
 )
@@ -21,8 +22,17 @@ type HAProxyService interface {
 	Start() error
 	Reload() error
 	Stop() error
+	Drain() error
 	GetStatus() HAProxyStatus
+	GetSupervisorStatus() SupervisorStatus
+	GetOutput(limit int) []OutputLine
 	Reset() error
+	RenderConfig(sites []model.Site) (*RenderedConfig, error)
+	StageConfig(sites []model.Site) (*RenderedConfig, error)
+	RunningConfig() (*RenderedConfig, error)
+	BackupConfig() (string, error)
+	RestoreConfig(backupDir string) error
+	RemoveBackup(backupDir string) error
 }
 
 // NewHAProxyService 创建一个新的HAProxy服务实例
@@ -60,6 +70,7 @@ func NewHAProxyService(configBaseDir, haproxyBin string, ctx context.Context) (H
 		HaproxyBin:         haproxyBin,
 		BackupsNumber:      3,
 		CertDir:            filepath.Join(configBaseDir, "/haproxy/cert"),
+		BlockPageDir:       filepath.Join(configBaseDir, "/haproxy/block-page"),
 		TransactionDir:     filepath.Join(configBaseDir, "/haproxy/conf/transaction"),
 		SpoeDir:            filepath.Join(configBaseDir, "/haproxy/spoe"),
 		SpoeTransactionDir: filepath.Join(configBaseDir, "/haproxy/spoe/transaction"),
@@ -73,5 +84,10 @@ func NewHAProxyService(configBaseDir, haproxyBin string, ctx context.Context) (H
 		logger:             logger,
 		isDebug:            config.Global.IsProduction,
 		thread:             appConfig.Haproxy.Thread,
+		hardStopAfter:      appConfig.Haproxy.HardStopAfter,
+		blockPage:          appConfig.Haproxy.BlockPage.WithDefaults(pkgmodel.DefaultBlockPage()),
+		isChallenge:        appConfig.Challenge.Active(),
+		engine:             appConfig.Engine,
+		output:             newOutputBuffer(outputBufferLines),
 	}, nil
 }
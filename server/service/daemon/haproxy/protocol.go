@@ -0,0 +1,74 @@
+package haproxy
+
+import (
+	"fmt"
+
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/haproxytech/client-native/v6/models"
+)
+
+const (
+	// spoeRequestGroup 发送请求消息的 SPOE 组
+	spoeRequestGroup = "coraza-req"
+
+	// bodyWaitTime 发送给引擎前等待请求体的最长时间（毫秒），超时后按已到达的部分检测
+	bodyWaitTime = 5000
+
+	// h2cPrefaceCond 匹配 HTTP/2 明文连接前言 "PRI * HTTP/2.0"
+	h2cPrefaceCond = "{ req.payload(0,14) -m bin 505249202a20485454502f322e30 }"
+
+	// streamingCond 匹配不能等待请求体的流式请求：HTTP/2 上的 gRPC 和 WebSocket 升级（HTTP/2 扩展 CONNECT 由 HAProxy 转换为升级请求）。
+	// 请求头可以由客户端任意设置，条件必须限定为真实的流式协议，否则普通请求可以借此绕过请求体检测
+	streamingCond = "{ req.ver 2.0 } { req.hdr(content-type) -m beg -i application/grpc } || METH_GET { req.hdr(upgrade) -i websocket }"
+)
+
+// createInspectRules 在前端请求规则的最前面插入等待请求体和发送 SPOE 请求消息的规则，
+// 流式请求不等待请求体，只检测已到达的部分，其余数据直接转发
+func (s *HAProxyServiceImpl) createInspectRules(frontend, transactionID string) error {
+	rules := []*models.HTTPRequestRule{
+		{
+			Type:     "wait-for-body",
+			WaitTime: Int64P(bodyWaitTime),
+			Cond:     "unless",
+			CondTest: streamingCond,
+		},
+		{
+			Type:       "send-spoe-group",
+			SpoeEngine: "coraza",
+			SpoeGroup:  spoeRequestGroup,
+		},
+	}
+	for i, rule := range rules {
+		if err := s.confClient.CreateHTTPRequestRule(int64(i), "frontend", frontend, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加检测规则 #%d 错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// addHTTP2Rule 未启用 HTTP/2 的站点拒绝 h2c 请求，返回 505
+func (s *HAProxyServiceImpl) addHTTP2Rule(site model.Site, frontend, aclName, transactionID string) error {
+	if site.EnableHTTP2 {
+		return nil
+	}
+
+	cond := "{ req.ver 2.0 }"
+	if aclName != "" {
+		cond = aclName + " " + cond
+	}
+
+	_, rules, err := s.confClient.GetHTTPRequestRules("frontend", frontend, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取HTTP请求规则失败: %v", err)
+	}
+	rule := &models.HTTPRequestRule{
+		Type:       "deny",
+		DenyStatus: Int64P(505),
+		Cond:       "if",
+		CondTest:   cond,
+	}
+	if err := s.confClient.CreateHTTPRequestRule(int64(len(rules)), "frontend", frontend, rule, transactionID, 0); err != nil {
+		return fmt.Errorf("添加 HTTP/2 限制规则失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/server/model"
+)
+
+// ErrConfigInvalid 生成的配置未通过 haproxy -c 校验
+var ErrConfigInvalid = errors.New("HAProxy 配置校验失败")
+
+// RenderedConfig 生成的 HAProxy 与 SPOE 配置内容
+type RenderedConfig struct {
+	HAProxyConfig string   // haproxy.cfg 内容
+	SpoeConfig    string   // SPOE 配置内容
+	SiteErrors    []string // 生成失败的站点
+	CheckOutput   string   // haproxy -c 的输出
+	Valid         bool     // 是否通过 haproxy -c 校验
+}
+
+// newStagingService 创建与当前服务目录结构相同、根目录位于 staging 下的服务实例，只用于生成和校验配置
+func (s *HAProxyServiceImpl) newStagingService() *HAProxyServiceImpl {
+	base := filepath.Join(s.ConfigBaseDir, "staging")
+	return &HAProxyServiceImpl{
+		ConfigBaseDir:      base,
+		HAProxyConfigFile:  filepath.Join(base, "/haproxy/conf/haproxy.cfg"),
+		HaproxyBin:         s.HaproxyBin,
+		BackupsNumber:      0,
+		CertDir:            filepath.Join(base, "/haproxy/cert"),
+		BlockPageDir:       filepath.Join(base, "/haproxy/block-page"),
+		TransactionDir:     filepath.Join(base, "/haproxy/conf/transaction"),
+		SpoeDir:            filepath.Join(base, "/haproxy/spoe"),
+		SpoeTransactionDir: filepath.Join(base, "/haproxy/spoe/transaction"),
+		SocketFile:         filepath.Join(base, "/haproxy/conf/haproxy-master.sock"),
+		PidFile:            filepath.Join(base, "/haproxy/conf/haproxy.pid"),
+		SpoeConfigFile:     filepath.Join(base, "/haproxy/spoe/", filepath.Base(s.SpoeConfigFile)),
+		SpoeAgentAddress:   s.SpoeAgentAddress,
+		SpoeAgentPort:      s.SpoeAgentPort,
+		ctx:                s.ctx,
+		logger:             s.logger.With().Str("stage", "staging").Logger(),
+	}
+}
+
+// RenderConfig 在暂存目录中按站点列表生成完整配置，并用 haproxy -c 校验，不影响正在运行的配置
+func (s *HAProxyServiceImpl) RenderConfig(sites []model.Site) (*RenderedConfig, error) {
+	s.stagingMutex.Lock()
+	defer s.stagingMutex.Unlock()
+
+	return s.renderConfig(sites)
+}
+
+// StageConfig 在暂存目录生成配置并校验，校验通过后才替换正在使用的配置，未通过时正在使用的配置保持不变
+func (s *HAProxyServiceImpl) StageConfig(sites []model.Site) (*RenderedConfig, error) {
+	s.stagingMutex.Lock()
+	defer s.stagingMutex.Unlock()
+
+	rendered, err := s.renderConfig(sites)
+	if err != nil {
+		return nil, err
+	}
+	if !rendered.Valid {
+		return rendered, fmt.Errorf("%w: %s", ErrConfigInvalid, strings.TrimSpace(rendered.CheckOutput))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.promoteConfig(rendered); err != nil {
+		return rendered, err
+	}
+	return rendered, nil
+}
+
+func (s *HAProxyServiceImpl) renderConfig(sites []model.Site) (*RenderedConfig, error) {
+	staging := s.newStagingService()
+
+	// 使用数据库中最新的应用配置（线程数、响应检测等）
+	if err := staging.Reset(); err != nil {
+		return nil, err
+	}
+	// 缓冲区大小由站点的请求体检测上限决定，需要在生成全局配置之前计算
+	staging.bufSize = bodyBufferSize(sites)
+	if err := staging.RemoveConfig(); err != nil {
+		return nil, err
+	}
+	if err := staging.InitSpoeConfig(); err != nil {
+		return nil, err
+	}
+	if err := staging.InitHAProxyConfig(); err != nil {
+		return nil, err
+	}
+	if err := staging.AddCorazaBackend(); err != nil {
+		return nil, err
+	}
+	if err := staging.CreateHAProxyCrtStore(); err != nil {
+		return nil, err
+	}
+
+	rendered := &RenderedConfig{SiteErrors: []string{}}
+	for _, site := range sites {
+		if err := staging.AddSiteConfig(site); err != nil {
+			staging.logger.Error().Err(err).Str("domain", site.Domain).Msg("添加站点配置失败")
+			rendered.SiteErrors = append(rendered.SiteErrors, fmt.Sprintf("%s: %v", site.Domain, err))
+		}
+	}
+
+	output, err := staging.checkConfig()
+	rendered.CheckOutput = output
+	rendered.Valid = err == nil
+
+	haproxyConfig, err := os.ReadFile(staging.HAProxyConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取暂存 HAProxy 配置失败: %v", err)
+	}
+	spoeConfig, err := os.ReadFile(staging.SpoeConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取暂存 SPOE 配置失败: %v", err)
+	}
+
+	// 暂存配置中的路径替换为正式路径，便于与运行中的配置对比
+	rendered.HAProxyConfig = strings.ReplaceAll(string(haproxyConfig), staging.ConfigBaseDir, s.ConfigBaseDir)
+	rendered.SpoeConfig = strings.ReplaceAll(string(spoeConfig), staging.ConfigBaseDir, s.ConfigBaseDir)
+	rendered.CheckOutput = strings.ReplaceAll(rendered.CheckOutput, staging.ConfigBaseDir, s.ConfigBaseDir)
+
+	return rendered, nil
+}
+
+// RunningConfig 读取当前正在使用的配置，文件不存在时返回空内容
+func (s *HAProxyServiceImpl) RunningConfig() (*RenderedConfig, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	running := &RenderedConfig{SiteErrors: []string{}}
+	for path, target := range map[string]*string{
+		s.HAProxyConfigFile: &running.HAProxyConfig,
+		s.SpoeConfigFile:    &running.SpoeConfig,
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("读取配置文件失败 %s: %v", path, err)
+		}
+		*target = string(data)
+	}
+	running.Valid = true
+	return running, nil
+}
+
+// BackupConfig 备份当前的 HAProxy 配置、SPOE 配置、证书和拦截页面目录，返回备份目录
+func (s *HAProxyServiceImpl) BackupConfig() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	backupDir := filepath.Join(s.ConfigBaseDir, "backup", time.Now().Format("20060102T150405.000000000"))
+	if err := s.snapshotConfig(backupDir); err != nil {
+		return "", fmt.Errorf("备份配置失败: %v", err)
+	}
+	return backupDir, nil
+}
+
+// RestoreConfig 从备份目录恢复配置并重新加载 HAProxy
+func (s *HAProxyServiceImpl) RestoreConfig(backupDir string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.restoreSnapshot(backupDir); err != nil {
+		return err
+	}
+	if s.GetStatus() == StatusRunning {
+		return s.reloadHAProxy()
+	}
+	return nil
+}
+
+// RemoveBackup 删除备份目录
+func (s *HAProxyServiceImpl) RemoveBackup(backupDir string) error {
+	return os.RemoveAll(backupDir)
+}
+
+// promoteConfig 将校验通过的配置写入正式路径，调用方需持有 mutex
+func (s *HAProxyServiceImpl) promoteConfig(rendered *RenderedConfig) error {
+	dirs := []string{
+		filepath.Dir(s.HAProxyConfigFile),
+		s.TransactionDir,
+		s.SpoeDir,
+		s.SpoeTransactionDir,
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("unable to create directory %s: %v", dir, err)
+		}
+	}
+
+	// 证书和拦截页面目录先整体复制到临时目录，再替换正式目录
+	staging := s.newStagingService()
+	if err := replaceDir(staging.CertDir, s.CertDir); err != nil {
+		return fmt.Errorf("替换证书目录失败: %v", err)
+	}
+	if err := replaceDir(staging.BlockPageDir, s.BlockPageDir); err != nil {
+		return fmt.Errorf("替换拦截页面目录失败: %v", err)
+	}
+
+	if err := writeFileAtomic(s.SpoeConfigFile, []byte(rendered.SpoeConfig)); err != nil {
+		return fmt.Errorf("写入 SPOE 配置失败: %v", err)
+	}
+	if err := writeFileAtomic(s.HAProxyConfigFile, []byte(rendered.HAProxyConfig)); err != nil {
+		return fmt.Errorf("写入 HAProxy 配置失败: %v", err)
+	}
+
+	// 配置文件已替换，客户端需要重新加载
+	return s.resetClients()
+}
+
+// replaceDir 用 src 目录的内容替换 dst 目录
+func replaceDir(src, dst string) error {
+	tmpDir := dst + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := copyPath(src, tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, dst)
+}
+
+// lastKnownGoodDir 最近一次成功启动或重载的配置的保存目录
+func (s *HAProxyServiceImpl) lastKnownGoodDir() string {
+	return filepath.Join(s.ConfigBaseDir, "last-known-good")
+}
+
+// saveLastKnownGood 将正在使用的配置保存为最近一次可用配置，调用方需持有 mutex
+func (s *HAProxyServiceImpl) saveLastKnownGood() {
+	dir := s.lastKnownGoodDir()
+	tmpDir := dir + ".tmp"
+	os.RemoveAll(tmpDir)
+	if err := s.snapshotConfig(tmpDir); err != nil {
+		s.logger.Warn().Err(err).Msg("保存最近一次可用配置失败")
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		s.logger.Warn().Err(err).Msg("保存最近一次可用配置失败")
+		return
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		s.logger.Warn().Err(err).Msg("保存最近一次可用配置失败")
+	}
+}
+
+// restoreLastKnownGood 恢复最近一次可用配置，调用方需持有 mutex
+func (s *HAProxyServiceImpl) restoreLastKnownGood() error {
+	dir := s.lastKnownGoodDir()
+	if _, err := os.Stat(s.backupPath(dir, s.HAProxyConfigFile)); err != nil {
+		return fmt.Errorf("没有可恢复的配置")
+	}
+	s.logger.Warn().Str("dir", dir).Msg("恢复最近一次可用配置")
+	return s.restoreSnapshot(dir)
+}
+
+// snapshotConfig 复制正在使用的配置文件、证书和拦截页面目录到指定目录，调用方需持有 mutex
+func (s *HAProxyServiceImpl) snapshotConfig(dir string) error {
+	for _, src := range []string{s.HAProxyConfigFile, s.SpoeConfigFile, s.CertDir, s.BlockPageDir} {
+		if err := copyPath(src, s.backupPath(dir, src)); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSnapshot 用指定目录中的文件替换正在使用的配置，调用方需持有 mutex
+func (s *HAProxyServiceImpl) restoreSnapshot(dir string) error {
+	for _, dst := range []string{s.HAProxyConfigFile, s.SpoeConfigFile, s.CertDir, s.BlockPageDir} {
+		src := s.backupPath(dir, dst)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.RemoveAll(dst); err != nil {
+			return fmt.Errorf("清理配置失败 %s: %v", dst, err)
+		}
+		if err := copyPath(src, dst); err != nil {
+			return fmt.Errorf("恢复配置失败 %s: %v", dst, err)
+		}
+	}
+
+	// 配置文件已替换，客户端需要重新加载
+	return s.resetClients()
+}
+
+// backupPath 返回文件在备份目录中的对应路径
+func (s *HAProxyServiceImpl) backupPath(backupDir, path string) string {
+	rel, err := filepath.Rel(s.ConfigBaseDir, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(backupDir, rel)
+}
+
+// checkConfig 使用 haproxy -c 校验配置文件
+func (s *HAProxyServiceImpl) checkConfig() (string, error) {
+	cmd := exec.CommandContext(s.ctx, s.HaproxyBin, "-c", "-f", s.HAProxyConfigFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("haproxy 配置校验失败: %v", err)
+	}
+	return string(output), nil
+}
+
+// writeFileAtomic 先写入临时文件再重命名，避免留下写了一半的配置
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// copyPath 复制文件或目录，源不存在时忽略
+func copyPath(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if !info.IsDir() {
+		return copyFile(src, dst, info.Mode())
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		fileInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return copyFile(path, target, fileInfo.Mode())
+	})
+}
+
+func copyFile(src, dst string, mode fs.FileMode) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, mode.Perm())
+}
@@ -0,0 +1,412 @@
+package haproxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// 崩溃后首次重启的等待时间，之后每次翻倍
+	restartBaseDelay = time.Second
+	// 重启等待时间上限
+	restartMaxDelay = time.Minute
+	// 连续重启的最大次数，超过后放弃重启
+	maxRestartAttempts = 10
+	// 进程持续运行超过该时间后视为稳定，重置连续重启计数
+	stableUptime = time.Minute
+	// master 套接字探测间隔
+	probeInterval = 10 * time.Second
+	// master 套接字探测超时时间
+	probeTimeout = 3 * time.Second
+	// 连续探测失败达到该次数后视为进程失去响应
+	probeFailureThreshold = 3
+	// 保留的崩溃事件数
+	maxCrashEvents = 20
+	// 输出缓冲保留的行数
+	outputBufferLines = 1000
+	// 单行输出的最大长度
+	maxOutputLineLength = 4096
+)
+
+// CrashEvent HAProxy 进程异常退出事件
+type CrashEvent struct {
+	Time     time.Time `json:"time"`              // 发生时间
+	Pid      int       `json:"pid,omitempty"`     // 进程ID
+	ExitCode int       `json:"exitCode"`          // 退出码，被信号终止时为 -1
+	Reason   string    `json:"reason"`            // 退出原因
+	Uptime   string    `json:"uptime,omitempty"`  // 本次运行时长
+	Attempt  int       `json:"attempt"`           // 第几次连续重启
+	GaveUp   bool      `json:"gaveUp,omitempty"`  // 是否已放弃重启
+	RetryIn  string    `json:"retryIn,omitempty"` // 下次重启前的等待时间
+}
+
+// SupervisorStatus HAProxy 进程监管状态
+type SupervisorStatus struct {
+	Status        string       `json:"status" example:"running"` // running, stopped, error
+	Pid           int          `json:"pid,omitempty"`            // master 进程ID
+	StartedAt     *time.Time   `json:"startedAt,omitempty"`      // 本次启动时间
+	Restarts      int          `json:"restarts"`                 // 连续重启次数
+	TotalRestarts int          `json:"totalRestarts"`            // 累计自动重启次数
+	GaveUp        bool         `json:"gaveUp"`                   // 是否已放弃自动重启
+	NextRestartAt *time.Time   `json:"nextRestartAt,omitempty"`  // 下次自动重启时间
+	Crashes       []CrashEvent `json:"crashes"`                  // 最近的崩溃事件，按时间倒序
+}
+
+// OutputLine HAProxy 标准输出或标准错误中的一行
+type OutputLine struct {
+	Time   time.Time `json:"time"`   // 输出时间
+	Stream string    `json:"stream"` // stdout 或 stderr
+	Line   string    `json:"line"`   // 内容
+}
+
+// String 返回状态名称
+func (st HAProxyStatus) String() string {
+	switch st {
+	case StatusRunning:
+		return "running"
+	case StatusStopped:
+		return "stopped"
+	case StatusError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// supervisor 记录进程监管过程中的状态
+type supervisor struct {
+	mu            sync.Mutex
+	generation    uint64 // 每次主动启动或停止时递增，使过期的重启任务失效
+	pid           int
+	startedAt     time.Time
+	restarts      int
+	totalRestarts int
+	gaveUp        bool
+	nextRestartAt time.Time
+	crashes       []CrashEvent
+}
+
+// GetSupervisorStatus 获取进程监管状态
+func (s *HAProxyServiceImpl) GetSupervisorStatus() SupervisorStatus {
+	sv := &s.supervisor
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	status := SupervisorStatus{
+		Status:        s.GetStatus().String(),
+		Pid:           sv.pid,
+		Restarts:      sv.restarts,
+		TotalRestarts: sv.totalRestarts,
+		GaveUp:        sv.gaveUp,
+		Crashes:       make([]CrashEvent, 0, len(sv.crashes)),
+	}
+	if !sv.startedAt.IsZero() {
+		startedAt := sv.startedAt
+		status.StartedAt = &startedAt
+	}
+	if !sv.nextRestartAt.IsZero() {
+		nextRestartAt := sv.nextRestartAt
+		status.NextRestartAt = &nextRestartAt
+	}
+	for i := len(sv.crashes) - 1; i >= 0; i-- {
+		status.Crashes = append(status.Crashes, sv.crashes[i])
+	}
+	return status
+}
+
+// GetOutput 获取最近的 HAProxy 输出，limit 小于等于 0 时返回全部缓冲内容
+func (s *HAProxyServiceImpl) GetOutput(limit int) []OutputLine {
+	return s.output.Lines(limit)
+}
+
+// resetSupervisor 主动启动或停止时调用，取消未执行的重启并清空连续重启计数，调用方需持有 mutex
+func (s *HAProxyServiceImpl) resetSupervisor() {
+	sv := &s.supervisor
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	sv.generation++
+	sv.restarts = 0
+	sv.gaveUp = false
+	sv.nextRestartAt = time.Time{}
+}
+
+// supervise 等待进程退出，并定期探测 master 套接字，调用方需在启动进程后立即调用
+func (s *HAProxyServiceImpl) supervise(cmd *exec.Cmd, exited chan struct{}) {
+	startedAt := time.Now()
+
+	s.supervisor.mu.Lock()
+	s.supervisor.pid = cmd.Process.Pid
+	s.supervisor.startedAt = startedAt
+	s.supervisor.mu.Unlock()
+
+	go s.probeMasterSocket(cmd, exited)
+
+	go func() {
+		waitErr := cmd.Wait()
+		close(exited)
+		s.handleExit(cmd, waitErr, startedAt)
+	}()
+}
+
+// handleExit 处理进程退出，非主动停止时记录崩溃并安排重启
+func (s *HAProxyServiceImpl) handleExit(cmd *exec.Cmd, waitErr error, startedAt time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 主动停止或进程已被替换
+	if s.haproxyCmd != cmd {
+		return
+	}
+
+	s.haproxyCmd = nil
+	s.runtimeClient = nil
+	s.clientNative = nil
+	s.status.Store(int32(StatusError))
+
+	event := CrashEvent{
+		Time:     time.Now(),
+		Pid:      cmd.Process.Pid,
+		ExitCode: -1,
+		Uptime:   time.Since(startedAt).Round(time.Second).String(),
+	}
+	if cmd.ProcessState != nil {
+		event.ExitCode = cmd.ProcessState.ExitCode()
+		event.Reason = cmd.ProcessState.String()
+	}
+	if waitErr != nil && event.Reason == "" {
+		event.Reason = waitErr.Error()
+	}
+
+	s.logger.Error().
+		Int("pid", event.Pid).
+		Int("exitCode", event.ExitCode).
+		Str("reason", event.Reason).
+		Str("uptime", event.Uptime).
+		Msg("HAProxy 进程异常退出")
+
+	sv := &s.supervisor
+	sv.mu.Lock()
+	sv.pid = 0
+	sv.startedAt = time.Time{}
+	// 稳定运行一段时间后再崩溃，重新开始计算退避
+	if time.Since(startedAt) >= stableUptime {
+		sv.restarts = 0
+	}
+	generation := sv.generation
+	sv.mu.Unlock()
+
+	s.scheduleRestart(generation, event)
+}
+
+// scheduleRestart 按指数退避安排重启，超过最大次数后放弃，调用方需持有 mutex
+func (s *HAProxyServiceImpl) scheduleRestart(generation uint64, event CrashEvent) {
+	sv := &s.supervisor
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	if generation != sv.generation {
+		return
+	}
+
+	sv.restarts++
+	event.Attempt = sv.restarts
+
+	if sv.restarts > maxRestartAttempts || s.ctx.Err() != nil {
+		event.GaveUp = true
+		sv.gaveUp = true
+		sv.nextRestartAt = time.Time{}
+		sv.addCrash(event)
+		s.logger.Error().Int("attempts", sv.restarts-1).Msg("HAProxy 连续重启次数过多，放弃自动重启")
+		return
+	}
+
+	delay := restartBaseDelay << (sv.restarts - 1)
+	if delay > restartMaxDelay {
+		delay = restartMaxDelay
+	}
+	event.RetryIn = delay.String()
+	sv.nextRestartAt = time.Now().Add(delay)
+	sv.addCrash(event)
+
+	s.logger.Info().Int("attempt", sv.restarts).Dur("delay", delay).Msg("将自动重启 HAProxy")
+	time.AfterFunc(delay, func() {
+		s.restartAfterCrash(generation)
+	})
+}
+
+// restartAfterCrash 崩溃后自动重启
+func (s *HAProxyServiceImpl) restartAfterCrash(generation uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sv := &s.supervisor
+	sv.mu.Lock()
+	if generation != sv.generation || s.ctx.Err() != nil {
+		sv.mu.Unlock()
+		return
+	}
+	sv.nextRestartAt = time.Time{}
+	sv.totalRestarts++
+	sv.mu.Unlock()
+
+	// 清理崩溃进程遗留的套接字和 pid 文件，否则启动时会误判为已就绪
+	os.Remove(s.SocketFile)
+	os.Remove(s.PidFile)
+
+	if err := s.startHAProxy(); err != nil {
+		s.logger.Error().Err(err).Msg("自动重启 HAProxy 失败")
+		s.status.Store(int32(StatusError))
+		s.scheduleRestart(generation, CrashEvent{
+			Time:     time.Now(),
+			ExitCode: -1,
+			Reason:   "重启失败: " + err.Error(),
+		})
+		return
+	}
+
+	s.logger.Info().Msg("HAProxy 已自动重启")
+}
+
+// probeMasterSocket 定期通过 master 套接字确认进程仍能响应，连续失败时终止进程交由 supervise 重启
+func (s *HAProxyServiceImpl) probeMasterSocket(cmd *exec.Cmd, exited chan struct{}) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.probeOnce(); err != nil {
+			failures++
+			s.logger.Warn().Err(err).Int("failures", failures).Msg("HAProxy master 套接字无响应")
+			if failures >= probeFailureThreshold {
+				s.logger.Error().Msg("HAProxy master 套接字持续无响应，终止进程")
+				cmd.Process.Kill()
+				return
+			}
+			continue
+		}
+		failures = 0
+	}
+}
+
+// probeOnce 向 master 套接字发送 show proc 并确认有返回
+func (s *HAProxyServiceImpl) probeOnce() error {
+	conn, err := net.DialTimeout("unix", s.SocketFile, probeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(probeTimeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte("show proc\n")); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if n > 0 {
+		return nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		return errors.New("master 套接字没有返回内容")
+	}
+	return err
+}
+
+func (sv *supervisor) addCrash(event CrashEvent) {
+	sv.crashes = append(sv.crashes, event)
+	if len(sv.crashes) > maxCrashEvents {
+		sv.crashes = sv.crashes[len(sv.crashes)-maxCrashEvents:]
+	}
+}
+
+// outputBuffer 按行保存最近输出的环形缓冲
+type outputBuffer struct {
+	mu    sync.Mutex
+	lines []OutputLine
+	next  int
+	full  bool
+}
+
+func newOutputBuffer(size int) *outputBuffer {
+	return &outputBuffer{lines: make([]OutputLine, size)}
+}
+
+// Writer 返回写入指定输出流的 io.Writer
+func (b *outputBuffer) Writer(stream string) io.Writer {
+	return &streamWriter{buffer: b, stream: stream}
+}
+
+func (b *outputBuffer) add(stream, line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lines[b.next] = OutputLine{Time: time.Now(), Stream: stream, Line: line}
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Lines 按时间顺序返回最近的 limit 行
+func (b *outputBuffer) Lines(limit int) []OutputLine {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.lines)
+	}
+	if limit <= 0 || limit > count {
+		limit = count
+	}
+
+	result := make([]OutputLine, 0, limit)
+	start := b.next - limit
+	for i := 0; i < limit; i++ {
+		result = append(result, b.lines[(start+i+len(b.lines))%len(b.lines)])
+	}
+	return result
+}
+
+// streamWriter 将写入内容按行拆分后放入缓冲，未结束的行留到下次写入
+type streamWriter struct {
+	buffer  *outputBuffer
+	stream  string
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, p...)
+	for {
+		idx := bytes.IndexByte(w.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		w.buffer.add(w.stream, string(bytes.TrimRight(w.pending[:idx], "\r")))
+		w.pending = w.pending[idx+1:]
+	}
+	if len(w.pending) > maxOutputLineLength {
+		w.buffer.add(w.stream, string(w.pending))
+		w.pending = nil
+	}
+	return len(p), nil
+}
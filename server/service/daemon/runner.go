@@ -2,10 +2,12 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
 	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
 
 	"github.com/HUAHUAI23/simple-waf/server/config"
@@ -14,6 +16,7 @@ import (
 	"github.com/HUAHUAI23/simple-waf/server/service/daemon/engine"
 	"github.com/HUAHUAI23/simple-waf/server/service/daemon/haproxy"
 	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type ServiceState int
@@ -27,12 +30,28 @@ const (
 type ServiceRunner interface {
 	StartServices() error
 	StopServices() error
+	DrainServices() error
 	ForceStop()
 	Restart() error
 	HotReload() error
+	ReloadEngine() error
+	GetReplayer(appName string) (server.Replayer, error)
 	GetState() ServiceState
+	RenderPendingConfig() (pending *haproxy.RenderedConfig, running *haproxy.RenderedConfig, err error)
+	ApplyChanges() (*haproxy.RenderedConfig, error)
+	GetAppliedAt() time.Time
+	GetHAProxyStatus() haproxy.SupervisorStatus
+	GetHAProxyOutput(limit int) []haproxy.OutputLine
 }
 
+// engineDrainTimeout 优雅停止时引擎等待进行中事务的最长时间
+const engineDrainTimeout = 30 * time.Second
+
+var (
+	ErrConfigCheckFailed = haproxy.ErrConfigInvalid
+	ErrApplyFailed       = errors.New("应用配置变更失败")
+)
+
 // ServiceRunner 负责管理和协调所有后台服务
 type ServiceRunnerImpl struct {
 	haproxyService haproxy.HAProxyService
@@ -44,6 +63,9 @@ type ServiceRunnerImpl struct {
 	haproxyDone    chan struct{} // 通知HAProxy服务已停止
 	engineDone     chan struct{} // 通知Engine服务已停止
 	state          ServiceState
+	appliedAt      time.Time    // 最近一次配置生效的时间
+	appliedMu      sync.RWMutex // 保护 appliedAt，重载协程写入，HTTP 请求读取
+	applyMutex     sync.Mutex   // 保证同一时间只有一次配置应用
 }
 
 // 单例模式实现
@@ -79,12 +101,15 @@ func newServiceRunner() (ServiceRunner, error) {
 		return nil, fmt.Errorf("初始化 Engine 服务失败: %w", err)
 	}
 
-	return &ServiceRunnerImpl{
+	runner := &ServiceRunnerImpl{
 		haproxyService: haproxyService,
 		engineService:  engineService,
 		logger:         &logger,
 		state:          ServiceStopped,
-	}, nil
+	}
+	// 恢复持久化的生效时间，重启后仍能区分已生效和待应用的版本
+	runner.appliedAt = runner.loadAppliedAt()
+	return runner, nil
 }
 
 // StartServices 启动所有服务
@@ -126,41 +151,16 @@ func (r *ServiceRunnerImpl) StartServices() error {
 
 		r.logger.Info().Msg("开始启动HAProxy服务...")
 
+		// 清理上次运行遗留的配置、pid 和套接字文件
 		if err = r.haproxyService.RemoveConfig(); err != nil {
 			r.logger.Error().Err(err).Msg("删除HAProxy配置失败")
 			r.errChan <- err
 			return
 		}
 
-		if err = r.haproxyService.InitSpoeConfig(); err != nil {
-			r.logger.Error().Err(err).Msg("初始化HAProxy SPOE配置失败")
-			r.errChan <- err
-			return
-		}
-
-		if err = r.haproxyService.InitHAProxyConfig(); err != nil {
-			r.logger.Error().Err(err).Msg("初始化HAProxy配置失败")
-			r.errChan <- err
-			return
-		}
-
-		if err = r.haproxyService.AddCorazaBackend(); err != nil {
-			r.logger.Error().Err(err).Msg("添加Coraza后端失败")
-			r.errChan <- err
-			return
-		}
-
-		if err = r.haproxyService.CreateHAProxyCrtStore(); err != nil {
-			r.logger.Error().Err(err).Msg("创建HAProxy证书存储失败")
-			r.errChan <- err
-			return
-		}
-
-		for i, site := range siteList {
-			if err := r.haproxyService.AddSiteConfig(site); err != nil {
-				r.logger.Error().Err(err).Msgf("添加站点配置失败 %d", i)
-				// 继续处理其他站点，不返回错误
-			}
+		// 配置在暂存目录生成并校验，失败时由 Start 恢复最近一次可用配置
+		if _, err = r.haproxyService.StageConfig(siteList); err != nil {
+			r.logger.Error().Err(err).Msg("生成HAProxy配置失败，将尝试使用最近一次可用配置")
 		}
 
 		if err := r.haproxyService.Start(); err != nil {
@@ -168,9 +168,13 @@ func (r *ServiceRunnerImpl) StartServices() error {
 			r.errChan <- err
 			return
 		}
+		r.setAppliedAt(time.Now())
 
-		// 等待停止信号
+		// 等待停止信号，优雅停止时 HAProxy 已经退出
 		<-r.ctx.Done()
+		if r.haproxyService.GetStatus() == haproxy.StatusStopped {
+			return
+		}
 		r.logger.Info().Msg("收到停止信号，停止HAProxy服务")
 		if err := r.haproxyService.Stop(); err != nil {
 			r.logger.Error().Err(err).Msg("停止HAProxy服务失败")
@@ -182,15 +186,23 @@ func (r *ServiceRunnerImpl) StartServices() error {
 	go func() {
 		defer close(r.engineDone) // 服务停止时关闭通道
 
-		r.logger.Info().Msg("启动Engine服务...")
-		if err := r.engineService.Start(); err != nil {
-			r.logger.Error().Err(err).Msg("Engine服务启动失败")
-			r.errChan <- err
-			return
+		// 只使用外部引擎实例时不在进程内启动引擎
+		if r.embeddedEngineEnabled() {
+			r.logger.Info().Msg("启动Engine服务...")
+			if err := r.engineService.Start(); err != nil {
+				r.logger.Error().Err(err).Msg("Engine服务启动失败")
+				r.errChan <- err
+				return
+			}
+		} else {
+			r.logger.Info().Msg("只使用外部引擎实例，跳过内置Engine服务")
 		}
 
 		// 等待停止信号
 		<-r.ctx.Done()
+		if !r.engineService.IsRunning() {
+			return
+		}
 		r.logger.Info().Msg("收到停止信号，停止Engine服务")
 		if err := r.engineService.Stop(); err != nil {
 			r.logger.Error().Err(err).Msg("停止Engine服务失败")
@@ -301,6 +313,38 @@ func (r *ServiceRunnerImpl) StopServices() error {
 	return nil
 }
 
+// DrainServices 优雅停止所有服务：先软停止 HAProxy 等待已有连接结束，期间引擎继续处理检测请求，
+// 再让引擎处理完进行中的事务并写完剩余日志，最后清理运行状态
+func (r *ServiceRunnerImpl) DrainServices() error {
+	if r.state != ServiceRunning {
+		return fmt.Errorf("服务未在运行中")
+	}
+
+	r.logger.Info().Msg("开始优雅停止所有服务...")
+
+	var drainErr error
+	if err := r.haproxyService.Drain(); err != nil {
+		r.logger.Error().Err(err).Msg("软停止HAProxy服务失败")
+		drainErr = err
+	}
+
+	if r.engineService.IsRunning() {
+		if err := r.engineService.Drain(engineDrainTimeout); err != nil {
+			r.logger.Error().Err(err).Msg("优雅停止Engine服务失败")
+			if drainErr == nil {
+				drainErr = err
+			}
+		}
+	}
+
+	// 服务均已停止，StopServices 只负责通知后台协程退出并清理状态
+	if err := r.StopServices(); err != nil && drainErr == nil {
+		drainErr = err
+	}
+
+	return drainErr
+}
+
 // ForceStop 强制停止所有服务
 func (r *ServiceRunnerImpl) ForceStop() {
 	r.logger.Info().Msg("强制停止所有服务...")
@@ -345,9 +389,9 @@ func (r *ServiceRunnerImpl) ForceStop() {
 
 // Restart 重启所有服务
 func (r *ServiceRunnerImpl) Restart() error {
-	// 停止服务
+	// 优雅停止服务，等待进行中的请求和事务处理完成
 	if r.state == ServiceRunning {
-		if err := r.StopServices(); err != nil {
+		if err := r.DrainServices(); err != nil {
 			r.logger.Error().Err(err).Msg("重启时停止服务失败")
 			return err
 		}
@@ -389,55 +433,236 @@ func (r *ServiceRunnerImpl) HotReload() error {
 	}
 
 	r.logger.Info().Msg("开始热加载HAProxy配置...")
-	if err = r.haproxyService.HotReloadRemoveConfig(); err != nil {
-		r.logger.Error().Err(err).Msg("热加载删除HAProxy配置失败")
+	// 配置在暂存目录生成并校验，未通过时正在使用的配置保持不变
+	if _, err = r.haproxyService.StageConfig(siteList); err != nil {
+		r.logger.Error().Err(err).Msg("生成HAProxy配置失败")
 		return err
 	}
 
-	if err = r.haproxyService.InitSpoeConfig(); err != nil {
-		r.logger.Error().Err(err).Msg("初始化HAProxy SPOE配置失败")
+	if err := r.haproxyService.Reload(); err != nil {
+		r.logger.Error().Err(err).Msg("热加载HAProxy配置失败")
 		return err
 	}
 
-	if err = r.haproxyService.InitHAProxyConfig(); err != nil {
-		r.logger.Error().Err(err).Msg("初始化HAProxy配置失败")
+	// reload engine config
+
+	if err := r.syncEngine(); err != nil {
+		r.logger.Error().Err(err).Msg("热加载Engine配置失败")
 		return err
 	}
 
-	if err = r.haproxyService.AddCorazaBackend(); err != nil {
-		r.logger.Error().Err(err).Msg("添加Coraza后端失败")
-		return err
+	r.setAppliedAt(time.Now())
+	r.logger.Info().Msg("热重载成功")
+
+	return nil
+}
+
+// ReloadEngine 仅热重载引擎规则，不涉及HAProxy配置
+func (r *ServiceRunnerImpl) ReloadEngine() error {
+	if r.state != ServiceRunning {
+		return fmt.Errorf("服务未在运行中，无法热重载引擎")
 	}
 
-	if err = r.haproxyService.CreateHAProxyCrtStore(); err != nil {
-		r.logger.Error().Err(err).Msg("创建HAProxy证书存储失败")
+	if err := r.syncEngine(); err != nil {
+		r.logger.Error().Err(err).Msg("热加载Engine配置失败")
 		return err
 	}
 
-	for i, site := range siteList {
-		if err := r.haproxyService.AddSiteConfig(site); err != nil {
-			r.logger.Error().Err(err).Msgf("添加站点配置失败 %d", i)
-			// 继续处理其他站点，不返回错误
-		}
+	r.logger.Info().Msg("引擎热重载成功")
+	return nil
+}
+
+// GetReplayer 获取引擎中指定应用的回放器
+func (r *ServiceRunnerImpl) GetReplayer(appName string) (server.Replayer, error) {
+	if r.state != ServiceRunning {
+		return nil, fmt.Errorf("服务未在运行中，无法回放请求")
 	}
+	return r.engineService.GetReplayer(appName)
+}
 
-	if err := r.haproxyService.Reload(); err != nil {
-		r.logger.Error().Err(err).Msg("热加载HAProxy配置失败")
-		return err
+// RenderPendingConfig 按数据库中的最新配置生成待应用的 HAProxy 配置，并读取正在运行的配置
+func (r *ServiceRunnerImpl) RenderPendingConfig() (*haproxy.RenderedConfig, *haproxy.RenderedConfig, error) {
+	r.applyMutex.Lock()
+	defer r.applyMutex.Unlock()
+
+	siteList, err := r.loadSites()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// reload engine config
+	pending, err := r.haproxyService.RenderConfig(siteList)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("生成待应用配置失败")
+		return nil, nil, err
+	}
 
-	if err := r.engineService.Reload(); err != nil {
-		r.logger.Error().Err(err).Msg("热加载Engine配置失败")
-		return err
+	running, err := r.haproxyService.RunningConfig()
+	if err != nil {
+		r.logger.Error().Err(err).Msg("读取运行中配置失败")
+		return nil, nil, err
 	}
 
-	r.logger.Info().Msg("热重载成功")
+	return pending, running, nil
+}
+
+// ApplyChanges 校验待应用配置并热重载，热重载失败时回滚到之前的配置
+func (r *ServiceRunnerImpl) ApplyChanges() (*haproxy.RenderedConfig, error) {
+	r.applyMutex.Lock()
+	defer r.applyMutex.Unlock()
 
+	siteList, err := r.loadSites()
+	if err != nil {
+		return nil, err
+	}
+
+	// 先在暂存目录中生成并校验，校验不通过时不触碰运行中的配置
+	rendered, err := r.haproxyService.RenderConfig(siteList)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("生成待应用配置失败")
+		return nil, err
+	}
+	if !rendered.Valid {
+		r.logger.Warn().Str("output", rendered.CheckOutput).Msg("待应用配置未通过校验")
+		return rendered, ErrConfigCheckFailed
+	}
+
+	// 服务未运行时配置会在下次启动时生效
+	if r.state != ServiceRunning {
+		return rendered, nil
+	}
+
+	backupDir, err := r.haproxyService.BackupConfig()
+	if err != nil {
+		r.logger.Error().Err(err).Msg("备份运行中配置失败")
+		return rendered, err
+	}
+	defer func() {
+		if err := r.haproxyService.RemoveBackup(backupDir); err != nil {
+			r.logger.Warn().Err(err).Str("dir", backupDir).Msg("删除配置备份失败")
+		}
+	}()
+
+	if err := r.HotReload(); err != nil {
+		r.logger.Error().Err(err).Msg("应用配置变更失败，开始回滚")
+		if restoreErr := r.haproxyService.RestoreConfig(backupDir); restoreErr != nil {
+			r.logger.Error().Err(restoreErr).Msg("回滚配置失败")
+			return rendered, fmt.Errorf("%w: %v; 回滚失败: %v", ErrApplyFailed, err, restoreErr)
+		}
+		r.logger.Info().Msg("已回滚到之前的配置")
+		return rendered, fmt.Errorf("%w: %v（已回滚到之前的配置）", ErrApplyFailed, err)
+	}
+
+	return rendered, nil
+}
+
+// GetAppliedAt 获取最近一次配置生效的时间，服务从未启动时返回零值
+func (r *ServiceRunnerImpl) GetAppliedAt() time.Time {
+	r.appliedMu.RLock()
+	defer r.appliedMu.RUnlock()
+	return r.appliedAt
+}
+
+func (r *ServiceRunnerImpl) setAppliedAt(t time.Time) {
+	r.appliedMu.Lock()
+	r.appliedAt = t
+	r.appliedMu.Unlock()
+
+	collection, err := r.applyStateCollection()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := repository.SaveAppliedAt(ctx, collection, t); err != nil {
+		r.logger.Error().Err(err).Msg("保存配置生效时间失败")
+	}
+}
+
+// GetHAProxyStatus 获取 HAProxy 进程监管状态，包括最近的崩溃事件
+func (r *ServiceRunnerImpl) GetHAProxyStatus() haproxy.SupervisorStatus {
+	return r.haproxyService.GetSupervisorStatus()
+}
+
+// GetHAProxyOutput 获取最近的 HAProxy 输出
+func (r *ServiceRunnerImpl) GetHAProxyOutput(limit int) []haproxy.OutputLine {
+	return r.haproxyService.GetOutput(limit)
+}
+
+// embeddedEngineEnabled 是否在进程内运行引擎，读取配置失败时按默认值运行
+func (r *ServiceRunnerImpl) embeddedEngineEnabled() bool {
+	appConfig, err := config.GetAppConfig()
+	if err != nil {
+		r.logger.Warn().Err(err).Msg("获取应用配置失败，默认启动内置Engine服务")
+		return true
+	}
+	return !appConfig.Engine.ExternalOnly
+}
+
+// syncEngine 按配置重新加载、启动或停止内置引擎，外部引擎实例自行从数据库同步配置
+func (r *ServiceRunnerImpl) syncEngine() error {
+	enabled := r.embeddedEngineEnabled()
+	running := r.engineService.IsRunning()
+
+	switch {
+	case enabled && running:
+		return r.engineService.Reload()
+	case enabled && !running:
+		r.logger.Info().Msg("启动内置Engine服务")
+		return r.engineService.Start()
+	case !enabled && running:
+		r.logger.Info().Msg("只使用外部引擎实例，停止内置Engine服务")
+		return r.engineService.Stop()
+	}
 	return nil
 }
 
+// loadAppliedAt 读取持久化的配置生效时间，读取失败时返回零值
+func (r *ServiceRunnerImpl) loadAppliedAt() time.Time {
+	collection, err := r.applyStateCollection()
+	if err != nil {
+		return time.Time{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	appliedAt, err := repository.GetAppliedAt(ctx, collection)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("读取配置生效时间失败")
+		return time.Time{}
+	}
+	return appliedAt
+}
+
+// applyStateCollection 获取配置生效状态集合
+func (r *ServiceRunnerImpl) applyStateCollection() (*mongo.Collection, error) {
+	client, err := mongodb.Connect(config.Global.DBConfig.URI)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("连接数据库失败")
+		return nil, err
+	}
+
+	var state model.ApplyState
+	return client.Database(config.Global.DBConfig.Database).Collection(state.GetCollectionName()), nil
+}
+
+// loadSites 从数据库读取全部站点
+func (r *ServiceRunnerImpl) loadSites() ([]model.Site, error) {
+	client, err := mongodb.Connect(config.Global.DBConfig.URI)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("连接数据库失败")
+		return nil, err
+	}
+
+	db := client.Database(config.Global.DBConfig.Database)
+
+	var site model.Site
+	siteList, err := repository.GetAllSites(context.Background(), db.Collection(site.GetCollectionName()))
+	if err != nil {
+		r.logger.Error().Err(err).Msg("获取站点列表失败")
+		return nil, err
+	}
+	return siteList, nil
+}
+
 // GetState 获取当前服务状态
 func (r *ServiceRunnerImpl) GetState() ServiceState {
 	return r.state
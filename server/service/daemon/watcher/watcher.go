@@ -0,0 +1,506 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/constant"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// 保留的重载记录条数
+	maxReloadHistory = 20
+	// 变更流重连的最长等待时间
+	maxStreamBackoff = time.Minute
+)
+
+// 重载范围
+const (
+	ScopeFull   = "full"   // 重新生成 HAProxy 配置并同步引擎
+	ScopeEngine = "engine" // 只重新加载引擎规则
+)
+
+// 重载结果
+const (
+	ResultApplied = "applied"
+	ResultFailed  = "failed"
+	ResultSkipped = "skipped"
+)
+
+var ErrServiceNotRunning = errors.New("服务未运行，变更将在下次启动时生效")
+
+// Reloader 配置变更后执行重载的服务
+type Reloader interface {
+	GetState() daemon.ServiceState
+	HotReload() error
+	ReloadEngine() error
+}
+
+// ConfigWatcher 监听配置、站点和证书的变更，合并连续变更后自动重载
+type ConfigWatcher interface {
+	Start()
+	Stop()
+	GetStatus() dto.ConfigWatchStatus
+}
+
+type ConfigWatcherImpl struct {
+	db       *mongo.Database
+	reloader Reloader
+	cfg      config.ConfigWatchConfig
+	logger   zerolog.Logger
+
+	mu            sync.Mutex
+	cancel        context.CancelFunc
+	done          chan struct{}
+	mode          string
+	timer         *time.Timer
+	pending       []string  // 等待重载的变更集合
+	pendingScope  string    // 等待重载的范围
+	changedAt     time.Time // 等待重载的首次变更时间
+	lastChangeAt  time.Time
+	lastAppliedAt time.Time
+	history       []dto.ConfigReloadRecord
+
+	reloadMutex sync.Mutex       // 保证同一时间只有一次重载
+	lastConfig  *pkgmodel.Config // 最近一次处理的配置，只在监听协程中访问
+}
+
+// 单例模式实现
+var (
+	instance ConfigWatcher
+	once     sync.Once
+	initErr  error
+)
+
+// GetConfigWatcher 获取配置变更监听器的单例实例
+func GetConfigWatcher() (ConfigWatcher, error) {
+	once.Do(func() {
+		instance, initErr = newConfigWatcher()
+	})
+	return instance, initErr
+}
+
+func newConfigWatcher() (ConfigWatcher, error) {
+	runner, err := daemon.GetRunnerService()
+	if err != nil {
+		return nil, fmt.Errorf("获取ServiceRunner失败: %w", err)
+	}
+
+	client, err := mongodb.Connect(config.Global.DBConfig.URI)
+	if err != nil {
+		return nil, fmt.Errorf("连接数据库失败: %w", err)
+	}
+
+	return NewConfigWatcher(client.Database(config.Global.DBConfig.Database), runner, config.Global.ConfigWatch), nil
+}
+
+// NewConfigWatcher 创建配置变更监听器
+func NewConfigWatcher(db *mongo.Database, reloader Reloader, cfg config.ConfigWatchConfig) ConfigWatcher {
+	return &ConfigWatcherImpl{
+		db:       db,
+		reloader: reloader,
+		cfg:      cfg,
+		logger:   config.GetServiceLogger("config_watcher"),
+	}
+}
+
+// watchedCollections 监听的集合
+func watchedCollections() []string {
+	var cfg pkgmodel.Config
+	var site model.Site
+	var cert model.CertificateStore
+	return []string{cfg.GetCollectionName(), site.GetCollectionName(), cert.GetCollectionName()}
+}
+
+// Start 启动后台监听，未启用时直接返回
+func (w *ConfigWatcherImpl) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.cfg.Enabled || w.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+
+	go func() {
+		defer close(w.done)
+
+		w.lastConfig, _ = w.loadConfig(ctx)
+
+		switch w.cfg.Mode {
+		case config.ConfigWatchModePoll:
+			w.poll(ctx)
+		case config.ConfigWatchModeChangeStream:
+			w.watchChangeStream(ctx, false)
+		default:
+			// 变更流需要副本集，不可用时回退到轮询
+			if err := w.watchChangeStream(ctx, true); err != nil && ctx.Err() == nil {
+				w.logger.Warn().Err(err).Msg("变更流不可用，回退到轮询")
+				w.poll(ctx)
+			}
+		}
+	}()
+
+	w.logger.Info().Str("mode", w.cfg.Mode).Dur("debounce", w.cfg.Debounce).Msg("配置变更监听已启动")
+}
+
+// Stop 停止后台监听，丢弃尚未执行的重载
+func (w *ConfigWatcherImpl) Stop() {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.cancel, w.done = nil, nil
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.pending, w.pendingScope = nil, ""
+	w.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	w.logger.Info().Msg("配置变更监听已停止")
+}
+
+// GetStatus 获取监听状态和最近的重载记录
+func (w *ConfigWatcherImpl) GetStatus() dto.ConfigWatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := dto.ConfigWatchStatus{
+		Enabled:       w.cfg.Enabled,
+		Mode:          w.mode,
+		LastChangeAt:  w.lastChangeAt,
+		LastAppliedAt: w.lastAppliedAt,
+		History:       make([]dto.ConfigReloadRecord, 0, len(w.history)),
+	}
+	for i := len(w.history) - 1; i >= 0; i-- {
+		status.History = append(status.History, w.history[i])
+	}
+	if len(status.History) > 0 {
+		last := status.History[0]
+		status.LastResult = &last
+	}
+	return status
+}
+
+func (w *ConfigWatcherImpl) setMode(mode string) {
+	w.mu.Lock()
+	w.mode = mode
+	w.mu.Unlock()
+}
+
+// watchChangeStream 通过变更流监听集合变更，断开后使用 resume token 重连；
+// fallback 为 true 时首次打开失败直接返回错误，由调用方回退到轮询
+func (w *ConfigWatcherImpl) watchChangeStream(ctx context.Context, fallback bool) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "ns.coll", Value: bson.D{{Key: "$in", Value: watchedCollections()}}}}}},
+	}
+
+	var resumeToken bson.Raw
+	backoff := time.Second
+	opened := false
+
+	for {
+		opts := options.ChangeStream()
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+
+		stream, err := w.db.Watch(ctx, pipeline, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if fallback && !opened {
+				return err
+			}
+			w.logger.Error().Err(err).Dur("retryIn", backoff).Msg("打开配置变更流失败")
+			if !sleepContext(ctx, backoff) {
+				return nil
+			}
+			backoff = min(backoff*2, maxStreamBackoff)
+			continue
+		}
+
+		if !opened {
+			opened = true
+			w.setMode(config.ConfigWatchModeChangeStream)
+		}
+		backoff = time.Second
+
+		for stream.Next(ctx) {
+			var change struct {
+				Ns struct {
+					Coll string `bson:"coll"`
+				} `bson:"ns"`
+			}
+			if err := stream.Decode(&change); err != nil {
+				w.logger.Warn().Err(err).Msg("解析配置变更事件失败")
+				continue
+			}
+			resumeToken = stream.ResumeToken()
+			w.onChange(ctx, change.Ns.Coll)
+		}
+
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			w.logger.Error().Err(err).Msg("配置变更流中断，准备重连")
+		}
+		stream.Close(context.Background())
+
+		if !sleepContext(ctx, backoff) {
+			return nil
+		}
+	}
+}
+
+// poll 定期计算各集合内容的摘要，摘要变化时视为集合发生变更
+func (w *ConfigWatcherImpl) poll(ctx context.Context) {
+	w.setMode(config.ConfigWatchModePoll)
+
+	collections := watchedCollections()
+	digests := make(map[string]string, len(collections))
+	for _, coll := range collections {
+		digest, err := w.collectionDigest(ctx, coll)
+		if err != nil {
+			w.logger.Error().Err(err).Str("collection", coll).Msg("计算集合摘要失败")
+			continue
+		}
+		digests[coll] = digest
+	}
+
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, coll := range collections {
+			digest, err := w.collectionDigest(ctx, coll)
+			if err != nil {
+				if ctx.Err() == nil {
+					w.logger.Error().Err(err).Str("collection", coll).Msg("计算集合摘要失败")
+				}
+				continue
+			}
+			if previous, ok := digests[coll]; ok && previous != digest {
+				w.onChange(ctx, coll)
+			}
+			digests[coll] = digest
+		}
+	}
+}
+
+// collectionDigest 按 _id 顺序计算集合中所有文档的摘要
+func (w *ConfigWatcherImpl) collectionDigest(ctx context.Context, coll string) (string, error) {
+	cursor, err := w.db.Collection(coll).Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return "", err
+	}
+	defer cursor.Close(ctx)
+
+	h := sha256.New()
+	for cursor.Next(ctx) {
+		h.Write(cursor.Current)
+	}
+	if err := cursor.Err(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// onChange 记录集合变更并推迟重载，等待期内的后续变更合并为一次重载
+func (w *ConfigWatcherImpl) onChange(ctx context.Context, coll string) {
+	scope := ScopeFull
+	var cfg pkgmodel.Config
+	if coll == cfg.GetCollectionName() {
+		scope = w.configScope(ctx)
+		if scope == "" {
+			w.logger.Debug().Msg("配置变更不影响运行中的服务，跳过重载")
+			return
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cancel == nil {
+		return
+	}
+
+	now := time.Now()
+	w.lastChangeAt = now
+	if len(w.pending) == 0 {
+		w.changedAt = now
+	}
+	if !slices.Contains(w.pending, coll) {
+		w.pending = append(w.pending, coll)
+	}
+	if w.pendingScope != ScopeFull {
+		w.pendingScope = scope
+	}
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(w.cfg.Debounce, w.flush)
+
+	w.logger.Debug().Str("collection", coll).Str("scope", scope).Msg("检测到配置变更")
+}
+
+// configScope 对比最新配置与上次处理的配置，判断需要重载的范围，无需重载时返回空字符串
+func (w *ConfigWatcherImpl) configScope(ctx context.Context) string {
+	current, err := w.loadConfig(ctx)
+	if err != nil {
+		w.logger.Warn().Err(err).Msg("读取最新配置失败，执行完整重载")
+		return ScopeFull
+	}
+
+	previous := w.lastConfig
+	w.lastConfig = current
+	if previous == nil {
+		return ScopeFull
+	}
+
+	// HAProxy 配置依赖的字段变化时需要完整重载
+	if !reflect.DeepEqual(haproxyFields(previous), haproxyFields(current)) {
+		return ScopeFull
+	}
+	// 只有引擎应用、规则、人机验证、机器人识别和 GeoIP 相关字段变化时只重载引擎
+	if !reflect.DeepEqual(previous.Engine.AppConfig, current.Engine.AppConfig) ||
+		previous.Engine.UseBuiltinRules != current.Engine.UseBuiltinRules ||
+		previous.Challenge != current.Challenge ||
+		previous.Bot != current.Bot ||
+		previous.GeoIP != current.GeoIP {
+		return ScopeEngine
+	}
+	return ""
+}
+
+// haproxyFields 提取生成 HAProxy 配置和决定引擎运行方式所需的字段
+func haproxyFields(cfg *pkgmodel.Config) any {
+	return struct {
+		Haproxy         pkgmodel.HaproxyConfig
+		Bind            string
+		ExternalOnly    bool
+		Balance         string
+		Instances       []pkgmodel.EngineInstance
+		IsResponseCheck bool
+		IsDebug         bool
+		Challenge       bool
+	}{
+		Haproxy:         cfg.Haproxy,
+		Bind:            cfg.Engine.Bind,
+		ExternalOnly:    cfg.Engine.ExternalOnly,
+		Balance:         cfg.Engine.Balance,
+		Instances:       cfg.Engine.Instances,
+		IsResponseCheck: cfg.IsResponseCheck,
+		IsDebug:         cfg.IsDebug,
+		Challenge:       cfg.Challenge.Active(),
+	}
+}
+
+func (w *ConfigWatcherImpl) loadConfig(ctx context.Context) (*pkgmodel.Config, error) {
+	var cfg pkgmodel.Config
+	configName := constant.GetString("APP_CONFIG_NAME", "AppConfig")
+
+	findCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := w.db.Collection(cfg.GetCollectionName()).FindOne(findCtx, bson.D{{Key: "name", Value: configName}}).Decode(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// flush 执行等待中的重载并记录结果
+func (w *ConfigWatcherImpl) flush() {
+	w.reloadMutex.Lock()
+	defer w.reloadMutex.Unlock()
+
+	w.mu.Lock()
+	if w.cancel == nil || len(w.pending) == 0 {
+		w.mu.Unlock()
+		return
+	}
+	record := dto.ConfigReloadRecord{
+		Scope:       w.pendingScope,
+		Collections: w.pending,
+		ChangedAt:   w.changedAt,
+	}
+	w.pending, w.pendingScope = nil, ""
+	w.timer = nil
+	w.mu.Unlock()
+
+	var err error
+	switch {
+	case w.reloader.GetState() != daemon.ServiceRunning:
+		err = ErrServiceNotRunning
+	case record.Scope == ScopeEngine:
+		err = w.reloader.ReloadEngine()
+	default:
+		err = w.reloader.HotReload()
+	}
+
+	record.FinishedAt = time.Now()
+	switch {
+	case errors.Is(err, ErrServiceNotRunning):
+		record.Result = ResultSkipped
+		record.Error = err.Error()
+		w.logger.Info().Strs("collections", record.Collections).Msg("服务未运行，跳过自动重载")
+	case err != nil:
+		record.Result = ResultFailed
+		record.Error = err.Error()
+		w.logger.Error().Err(err).Str("scope", record.Scope).Strs("collections", record.Collections).Msg("配置变更自动重载失败")
+	default:
+		record.Result = ResultApplied
+		w.logger.Info().Str("scope", record.Scope).Strs("collections", record.Collections).Msg("配置变更已自动重载")
+	}
+
+	w.mu.Lock()
+	if record.Result == ResultApplied {
+		w.lastAppliedAt = record.FinishedAt
+	}
+	w.history = append(w.history, record)
+	if len(w.history) > maxReloadHistory {
+		w.history = w.history[len(w.history)-maxReloadHistory:]
+	}
+	w.mu.Unlock()
+}
+
+// sleepContext 等待指定时间，上下文取消时返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+)
+
+// assembleDirectives 按引擎的加载方式为每个应用组装最终指令：自定义规则、规则排除和站点策略，
+// IP 信誉列表数据文件写入 ipListDir
+func assembleDirectives(apps []model.AppConfig, ruleSet *server.RuleSet, ipListDir string) ([]dto.DirectivesPreviewResponse, error) {
+	compiled, err := ruleSet.Compile(ipListDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.DirectivesPreviewResponse, 0, len(apps))
+	for _, app := range apps {
+		directives, err := compiled.Directives(app.Directives)
+		if err != nil {
+			return nil, fmt.Errorf("应用 %s: %w", app.Name, err)
+		}
+		result = append(result, dto.DirectivesPreviewResponse{
+			Name:       app.Name,
+			Directives: directives,
+		})
+	}
+	return result, nil
+}
+
+// validateRuleSet 组装每个应用的最终指令并试编译，保证引擎可以加载。返回的错误由调用方包装为各自的校验错误
+func validateRuleSet(apps []model.AppConfig, ruleSet *server.RuleSet) error {
+	// IP 信誉列表写入临时目录，试编译后删除
+	dir, err := os.MkdirTemp("", "simple-waf-validate-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	assembled, err := assembleDirectives(apps, ruleSet, dir)
+	if err != nil {
+		return err
+	}
+	for _, app := range assembled {
+		if result := seclang.Validate(app.Directives); !result.Valid {
+			return fmt.Errorf("应用 %s 组装自定义规则和站点策略后: %s", app.Name, describeValidation(result))
+		}
+	}
+	return nil
+}
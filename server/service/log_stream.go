@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/event"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// LogStreamService 实时攻击日志推送服务
+type LogStreamService interface {
+	Subscribe() *event.Subscription
+	Match(req dto.LogStreamRequest, wafLog *model.WAFLog) bool
+}
+
+// LogStreamServiceImpl 实时攻击日志推送服务实现
+type LogStreamServiceImpl struct {
+	ctx        context.Context
+	broker     *event.WAFLogBroker
+	collection *mongo.Collection
+	logger     zerolog.Logger
+	watchOnce  sync.Once
+}
+
+// NewLogStreamService 创建实时日志推送服务，ctx 取消时停止变更流监听
+// embedded 模式下直接订阅引擎的进程内事件；changestream 模式下监听 waf_log 集合的插入事件，
+// 转发到独立的发布订阅中心，内嵌引擎在进程内发布的同一条日志不会重复推送
+func NewLogStreamService(ctx context.Context, db *mongo.Database) LogStreamService {
+	var wafLog model.WAFLog
+	broker := event.DefaultWAFLogBroker()
+	if config.Global.LogStream.Source == config.LogStreamSourceChangeStream {
+		broker = event.NewWAFLogBroker()
+	}
+	return &LogStreamServiceImpl{
+		ctx:        ctx,
+		broker:     broker,
+		collection: db.Collection(wafLog.GetCollectionName()),
+		logger:     config.GetServiceLogger("log_stream"),
+	}
+}
+
+// Subscribe 订阅实时日志
+func (s *LogStreamServiceImpl) Subscribe() *event.Subscription {
+	if config.Global.LogStream.Source == config.LogStreamSourceChangeStream {
+		// 有订阅者时才启动变更流监听
+		s.watchOnce.Do(func() {
+			go s.watchChangeStream(s.ctx)
+		})
+	}
+	return s.broker.Subscribe(128)
+}
+
+// Match 判断日志是否满足订阅过滤条件
+func (s *LogStreamServiceImpl) Match(req dto.LogStreamRequest, wafLog *model.WAFLog) bool {
+	if req.Domain != "" && wafLog.Domain != req.Domain {
+		return false
+	}
+
+	if len(req.Severity) > 0 {
+		matched := false
+		for _, severity := range req.Severity {
+			if wafLog.Severity == severity {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if req.RuleID > 0 && wafLog.RuleID != req.RuleID {
+		// 主规则不匹配时，检查关联的规则匹配记录
+		for _, log := range wafLog.Logs {
+			if log.RuleID == req.RuleID {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// watchChangeStream 监听 waf_log 集合的插入事件，断开后使用 resume token 重连
+func (s *LogStreamServiceImpl) watchChangeStream(ctx context.Context) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}},
+	}
+
+	var resumeToken bson.Raw
+	backoff := time.Second
+
+	for {
+		opts := options.ChangeStream()
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+
+		stream, err := s.collection.Watch(ctx, pipeline, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error().Err(err).Dur("retryIn", backoff).Msg("打开日志变更流失败")
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+
+		s.logger.Info().Msg("日志变更流已启动")
+		backoff = time.Second
+
+		for stream.Next(ctx) {
+			var change struct {
+				FullDocument model.WAFLog `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&change); err != nil {
+				s.logger.Warn().Err(err).Msg("解析日志变更事件失败")
+				continue
+			}
+			resumeToken = stream.ResumeToken()
+			s.broker.Publish(change.FullDocument)
+		}
+
+		stream.Close(context.Background())
+		if ctx.Err() != nil {
+			s.logger.Info().Msg("日志变更流已停止")
+			return
+		}
+		if err := stream.Err(); err != nil {
+			s.logger.Error().Err(err).Msg("日志变更流中断，准备重连")
+		}
+		if !sleepContext(ctx, backoff) {
+			return
+		}
+	}
+}
+
+// sleepContext 等待指定时间，上下文取消时返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	ErrReplayUnavailable = errors.New("引擎未运行，无法回放请求")
+	ErrReplayAppNotFound = errors.New("引擎应用不存在")
+	ErrInvalidReplay     = errors.New("回放请求无效")
+	ErrInvalidCandidate  = errors.New("候选规则集无法编译")
+)
+
+// 批量回放默认条数
+const defaultReplayLimit = 100
+
+// 批量回放结果分类
+const (
+	replayOutcomeBlocked = "blocked"
+	replayOutcomeChanged = "changed"
+	replayOutcomeAllowed = "allowed"
+	replayOutcomeError   = "error"
+)
+
+// ReplayService 请求回放服务
+type ReplayService interface {
+	Replay(ctx context.Context, req *dto.ReplayRequest) (*model.ReplayResult, error)
+	ReplayLogs(ctx context.Context, req *dto.ReplayBatchRequest) (*dto.ReplayBatchResponse, error)
+}
+
+// ReplayServiceImpl 请求回放服务实现
+type ReplayServiceImpl struct {
+	wafLogRepo repository.WAFLogRepository
+	configRepo repository.ConfigRepository
+	db         *mongo.Database
+	logger     zerolog.Logger
+}
+
+// NewReplayService 创建请求回放服务
+func NewReplayService(
+	wafLogRepo repository.WAFLogRepository,
+	configRepo repository.ConfigRepository,
+	db *mongo.Database,
+) ReplayService {
+	logger := config.GetServiceLogger("replay")
+	return &ReplayServiceImpl{
+		wafLogRepo: wafLogRepo,
+		configRepo: configRepo,
+		db:         db,
+		logger:     logger,
+	}
+}
+
+// Replay 使用正在运行的引擎应用检测一条请求，不产生防火墙日志
+func (s *ReplayServiceImpl) Replay(ctx context.Context, req *dto.ReplayRequest) (*model.ReplayResult, error) {
+	runner, err := daemon.GetRunnerService()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("获取ServiceRunner失败")
+		return nil, err
+	}
+
+	replayer, err := runner.GetReplayer(req.AppName)
+	if err != nil {
+		if errors.Is(err, server.ErrAppNotFound) {
+			return nil, ErrReplayAppNotFound
+		}
+		return nil, fmt.Errorf("%w: %s", ErrReplayUnavailable, err.Error())
+	}
+
+	result, err := replayer.Replay(model.ReplayInput{
+		Request:  req.Request,
+		Response: req.Response,
+		SrcIP:    req.SrcIP,
+		SrcPort:  req.SrcPort,
+		DstIP:    req.DstIP,
+		DstPort:  req.DstPort,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidReplay, err.Error())
+	}
+
+	return result, nil
+}
+
+// ReplayLogs 使用候选规则集回放已存储的WAF日志，评估规则变更会拦截哪些请求
+func (s *ReplayServiceImpl) ReplayLogs(ctx context.Context, req *dto.ReplayBatchRequest) (*dto.ReplayBatchResponse, error) {
+	filter, err := buildReplayLogFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// IP 信誉列表数据文件只在编译候选规则集时读取，编译后即可删除
+	dir, err := os.MkdirTemp("", "simple-waf-replay-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	directives, responseCheck, err := s.candidateDirectives(ctx, req, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	replayer, err := server.NewCandidateReplayer(directives, responseCheck, s.logger)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCandidate, err.Error())
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultReplayLimit
+	}
+
+	resp := &dto.ReplayBatchResponse{Items: []dto.ReplayBatchItem{}}
+	projection := bson.D{
+		{Key: "request", Value: 1},
+		{Key: "response", Value: 1},
+		{Key: "ruleId", Value: 1},
+		{Key: "domain", Value: 1},
+		{Key: "srcIp", Value: 1},
+		{Key: "srcPort", Value: 1},
+		{Key: "dstIp", Value: 1},
+		{Key: "dstPort", Value: 1},
+		{Key: "createdAt", Value: 1},
+	}
+
+	_, err = s.wafLogRepo.StreamAttackLogs(ctx, filter, projection, limit, func(log *model.WAFLog) error {
+		item := dto.ReplayBatchItem{
+			LogID:          log.ID.Hex(),
+			Domain:         log.Domain,
+			OriginalRuleID: log.RuleID,
+			CreatedAt:      log.CreatedAt,
+		}
+
+		result, err := replayer.Replay(model.ReplayInput{
+			Request:  log.Request,
+			Response: log.Response,
+			SrcIP:    log.SrcIP,
+			SrcPort:  log.SrcPort,
+			DstIP:    log.DstIP,
+			DstPort:  log.DstPort,
+		})
+
+		switch {
+		case err != nil:
+			item.Outcome = replayOutcomeError
+			item.Error = err.Error()
+			resp.Failed++
+		case !result.Interrupted:
+			item.Outcome = replayOutcomeAllowed
+			resp.Allowed++
+		case result.Interruption.RuleID == log.RuleID:
+			item.Outcome = replayOutcomeBlocked
+			resp.Blocked++
+		default:
+			item.Outcome = replayOutcomeChanged
+			resp.Changed++
+		}
+		item.Result = result
+
+		resp.Items = append(resp.Items, item)
+		return nil
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("读取回放日志失败")
+		return nil, err
+	}
+
+	resp.Total = len(resp.Items)
+	s.logger.Info().
+		Str("app", req.AppName).
+		Int("total", resp.Total).
+		Int("allowed", resp.Allowed).
+		Int("changed", resp.Changed).
+		Msg("批量回放完成")
+
+	return resp, nil
+}
+
+// candidateDirectives 按引擎的加载方式组装候选规则集：基础指令（可替换）+ 启用的自定义规则、规则排除和站点策略 + 追加指令。
+// 请求中的指令不能读取或写入服务器文件
+func (s *ReplayServiceImpl) candidateDirectives(ctx context.Context, req *dto.ReplayBatchRequest, ipListDir string) (string, bool, error) {
+	cfg, err := s.configRepo.GetConfig(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	var app *model.AppConfig
+	for i := range cfg.Engine.AppConfig {
+		if cfg.Engine.AppConfig[i].Name == req.AppName {
+			app = &cfg.Engine.AppConfig[i]
+			break
+		}
+	}
+	if app == nil {
+		return "", false, ErrReplayAppNotFound
+	}
+
+	base := app.Directives
+	if req.Directives != nil {
+		if err := seclang.CheckUntrusted(*req.Directives); err != nil {
+			return "", false, fmt.Errorf("%w: 候选基础指令%s", ErrInvalidReplay, err.Error())
+		}
+		base = *req.Directives
+	}
+	if err := seclang.CheckUntrusted(req.AppendDirectives); err != nil {
+		return "", false, fmt.Errorf("%w: 追加指令%s", ErrInvalidReplay, err.Error())
+	}
+
+	ruleSet, err := server.LoadRuleSet(ctx, s.db, true)
+	if err != nil {
+		return "", false, err
+	}
+	compiled, err := ruleSet.Compile(ipListDir)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %s", ErrInvalidCandidate, err.Error())
+	}
+	directives, err := compiled.Directives(base)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %s", ErrInvalidCandidate, err.Error())
+	}
+	if req.AppendDirectives != "" {
+		directives += "\n" + req.AppendDirectives + "\n"
+	}
+
+	return directives, cfg.IsResponseCheck, nil
+}
+
+// buildReplayLogFilter 构建批量回放的日志筛选条件
+func buildReplayLogFilter(req *dto.ReplayBatchRequest) (bson.D, error) {
+	filter := bson.D{}
+
+	if len(req.LogIDs) > 0 {
+		ids := make([]bson.ObjectID, 0, len(req.LogIDs))
+		for _, id := range req.LogIDs {
+			objectID, err := bson.ObjectIDFromHex(id)
+			if err != nil {
+				return nil, fmt.Errorf("%w: 无效的日志ID %s", ErrInvalidReplay, id)
+			}
+			ids = append(ids, objectID)
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}})
+	}
+
+	if req.RuleID > 0 {
+		filter = append(filter, bson.E{Key: "ruleId", Value: req.RuleID})
+	}
+	if req.Domain != "" {
+		filter = append(filter, bson.E{Key: "domain", Value: req.Domain})
+	}
+
+	timeFilter := bson.D{}
+	if !req.StartTime.IsZero() {
+		timeFilter = append(timeFilter, bson.E{Key: "$gte", Value: req.StartTime})
+	}
+	if !req.EndTime.IsZero() {
+		timeFilter = append(timeFilter, bson.E{Key: "$lte", Value: req.EndTime})
+	}
+	if len(timeFilter) > 0 {
+		filter = append(filter, bson.E{Key: "createdAt", Value: timeFilter})
+	}
+
+	return filter, nil
+}
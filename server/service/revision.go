@@ -0,0 +1,595 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	ErrRevisionNotFound    = errors.New("版本不存在")
+	ErrRevisionUnsupported = errors.New("不支持回滚该版本")
+	ErrRollbackReload      = errors.New("已回滚，但服务热重载失败")
+)
+
+// 逐行对比的最大行数，超过后只给出新旧值
+const maxLineDiffLines = 2000
+
+// 字段变更类型
+const (
+	changeAdded    = "added"
+	changeRemoved  = "removed"
+	changeModified = "modified"
+)
+
+// RevisionService 配置版本服务
+type RevisionService interface {
+	Record(ctx context.Context, resourceType, resourceID, resourceName, action string, snapshot any)
+	GetRevisions(ctx context.Context, req dto.RevisionListRequest) (*dto.RevisionListResponse, error)
+	GetRevision(ctx context.Context, id bson.ObjectID) (*dto.RevisionDetailResponse, error)
+	DiffRevisions(ctx context.Context, fromID, toID bson.ObjectID) (*dto.RevisionDiffResponse, error)
+	Rollback(ctx context.Context, id bson.ObjectID) (*model.Revision, error)
+	RevertBatch(ctx context.Context, since, until time.Time) (reverted, skipped int, err error)
+}
+
+// RevisionServiceImpl 配置版本服务实现
+type RevisionServiceImpl struct {
+	revisionRepo repository.RevisionRepository
+	configRepo   repository.ConfigRepository
+	siteRepo     repository.SiteRepository
+	ruleRepo     repository.RuleRepository
+	certRepo     repository.CertificateRepository
+	configSaver  *configSaver
+	logger       zerolog.Logger
+}
+
+// NewRevisionService 创建配置版本服务
+func NewRevisionService(
+	revisionRepo repository.RevisionRepository,
+	configRepo repository.ConfigRepository,
+	siteRepo repository.SiteRepository,
+	ruleRepo repository.RuleRepository,
+	certRepo repository.CertificateRepository,
+	wafLogRepo repository.WAFLogRepository,
+	db *mongo.Database,
+) RevisionService {
+	logger := config.GetServiceLogger("revision")
+	return &RevisionServiceImpl{
+		revisionRepo: revisionRepo,
+		configRepo:   configRepo,
+		siteRepo:     siteRepo,
+		ruleRepo:     ruleRepo,
+		certRepo:     certRepo,
+		configSaver:  newConfigSaver(configRepo, wafLogRepo, db, logger),
+		logger:       logger,
+	}
+}
+
+// Record 记录资源变更后的快照。资源已经保存成功，版本写入失败只记录日志，不影响本次变更
+func (s *RevisionServiceImpl) Record(ctx context.Context, resourceType, resourceID, resourceName, action string, snapshot any) {
+	revision := &model.Revision{
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		ResourceName: resourceName,
+		Action:       action,
+		Deleted:      action == model.RevisionActionDelete,
+	}
+	_ = s.record(ctx, revision, snapshot)
+}
+
+func (s *RevisionServiceImpl) record(ctx context.Context, revision *model.Revision, snapshot any) error {
+	raw, err := bson.Marshal(snapshot)
+	if err != nil {
+		s.logger.Error().Err(err).Str("resourceType", revision.ResourceType).Msg("序列化资源快照失败")
+		return err
+	}
+	revision.Snapshot = raw
+	revision.AuthorID, _ = ctx.Value("userID").(string)
+	revision.Author, _ = ctx.Value("username").(string)
+
+	// 请求已结束时仍需写入版本
+	if err := s.revisionRepo.CreateRevision(context.WithoutCancel(ctx), revision); err != nil {
+		s.logger.Error().Err(err).
+			Str("resourceType", revision.ResourceType).
+			Str("resourceId", revision.ResourceID).
+			Str("action", revision.Action).
+			Msg("记录配置版本失败")
+		return err
+	}
+	return nil
+}
+
+// GetRevisions 获取版本列表
+func (s *RevisionServiceImpl) GetRevisions(ctx context.Context, req dto.RevisionListRequest) (*dto.RevisionListResponse, error) {
+	page, size := req.Page, req.Size
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 10
+	}
+
+	filter := bson.D{}
+	if req.ResourceType != "" {
+		filter = append(filter, bson.E{Key: "resourceType", Value: req.ResourceType})
+	}
+	if req.ResourceID != "" {
+		filter = append(filter, bson.E{Key: "resourceId", Value: req.ResourceID})
+	}
+
+	revisions, total, err := s.revisionRepo.GetRevisions(ctx, filter, page, size)
+	if err != nil {
+		return nil, err
+	}
+	if revisions == nil {
+		revisions = []model.Revision{}
+	}
+
+	return &dto.RevisionListResponse{
+		Total: total,
+		Items: revisions,
+	}, nil
+}
+
+// GetRevision 获取版本详情
+func (s *RevisionServiceImpl) GetRevision(ctx context.Context, id bson.ObjectID) (*dto.RevisionDetailResponse, error) {
+	revision, err := s.getRevision(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := snapshotToMap(revision)
+	if err != nil {
+		return nil, err
+	}
+	maskSecrets(snapshot)
+
+	return &dto.RevisionDetailResponse{
+		Revision: *revision,
+		Snapshot: snapshot,
+	}, nil
+}
+
+// DiffRevisions 逐字段对比两个版本
+func (s *RevisionServiceImpl) DiffRevisions(ctx context.Context, fromID, toID bson.ObjectID) (*dto.RevisionDiffResponse, error) {
+	from, err := s.getRevision(ctx, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.getRevision(ctx, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	fromMap, err := snapshotToMap(from)
+	if err != nil {
+		return nil, err
+	}
+	toMap, err := snapshotToMap(to)
+	if err != nil {
+		return nil, err
+	}
+	maskSecrets(fromMap)
+	maskSecrets(toMap)
+
+	return &dto.RevisionDiffResponse{
+		From:    *from,
+		To:      *to,
+		Changes: diffSnapshots(fromMap, toMap),
+	}, nil
+}
+
+// Rollback 将资源恢复到指定版本的状态，写入一条回滚版本并热重载服务
+func (s *RevisionServiceImpl) Rollback(ctx context.Context, id bson.ObjectID) (*model.Revision, error) {
+	target, err := s.getRevision(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := s.restore(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := &model.Revision{
+		ResourceType: target.ResourceType,
+		ResourceID:   target.ResourceID,
+		ResourceName: target.ResourceName,
+		Action:       model.RevisionActionRollback,
+		Deleted:      target.Deleted,
+		RollbackOf:   target.ID.Hex(),
+	}
+	if err := s.record(ctx, revision, snapshot); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("resourceType", target.ResourceType).
+		Str("resourceId", target.ResourceID).
+		Int("version", target.Version).
+		Msg("已回滚到指定版本")
+
+	if err := hotReloadIfRunning(s.logger); err != nil {
+		return revision, err
+	}
+	return revision, nil
+}
+
+// RevertBatch 撤销一次应用失败的变更批次：将 (since, until] 内变更过的资源恢复到 since 时的状态，期间新建的资源被删除，
+// 每个资源写入一条回滚版本。until 之后又被修改的资源属于其他用户的后续编辑，不做恢复，计入 skipped。
+// 用于配置应用失败后让数据库与运行中的配置保持一致，不热重载服务
+func (s *RevisionServiceImpl) RevertBatch(ctx context.Context, since, until time.Time) (int, int, error) {
+	// size 为 0 时不限制数量
+	revisions, _, err := s.revisionRepo.GetRevisions(ctx,
+		bson.D{{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: since}, {Key: "$lte", Value: until}}}}, 1, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 每个资源只处理一次，记录批次内最新的版本；系统配置最后恢复，校验指令时使用已恢复的规则
+	latest := make(map[string]model.Revision)
+	var keys []string
+	for _, revision := range revisions {
+		key := revision.ResourceType + "/" + revision.ResourceID
+		if _, ok := latest[key]; ok {
+			continue
+		}
+		latest[key] = revision
+		keys = append(keys, key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return latest[keys[i]].ResourceType != model.RevisionResourceConfig && latest[keys[j]].ResourceType == model.RevisionResourceConfig
+	})
+
+	reverted, skipped := 0, 0
+	var errs []error
+	for _, key := range keys {
+		current := latest[key]
+		// 批次之后资源又被修改，恢复会覆盖他人的编辑
+		_, newer, err := s.revisionRepo.GetRevisions(ctx, bson.D{
+			{Key: "resourceType", Value: current.ResourceType},
+			{Key: "resourceId", Value: current.ResourceID},
+			{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: until}}},
+		}, 1, 1)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		if newer > 0 {
+			skipped++
+			continue
+		}
+
+		target, err := s.revisionRepo.GetLatestRevisionBefore(ctx, current.ResourceType, current.ResourceID, since)
+		if err != nil {
+			if !errors.Is(err, repository.ErrRevisionNotFound) {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				continue
+			}
+			// 资源在该时间之后才创建，删除即可恢复
+			full, err := s.revisionRepo.GetRevisionByID(ctx, current.ID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				continue
+			}
+			full.Deleted = true
+			target = full
+		}
+
+		snapshot, err := s.restore(ctx, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		revision := &model.Revision{
+			ResourceType: target.ResourceType,
+			ResourceID:   target.ResourceID,
+			ResourceName: target.ResourceName,
+			Action:       model.RevisionActionRollback,
+			Deleted:      target.Deleted,
+		}
+		if !target.ID.IsZero() && target.ID != current.ID {
+			revision.RollbackOf = target.ID.Hex()
+		}
+		if err := s.record(ctx, revision, snapshot); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		reverted++
+	}
+
+	s.logger.Info().Time("since", since).Time("until", until).
+		Int("reverted", reverted).Int("skipped", skipped).Int("failed", len(errs)).
+		Msg("已撤销应用失败的变更批次")
+	return reverted, skipped, errors.Join(errs...)
+}
+
+// restore 按版本快照恢复资源，返回恢复后的资源用于记录新版本
+func (s *RevisionServiceImpl) restore(ctx context.Context, revision *model.Revision) (any, error) {
+	switch revision.ResourceType {
+	case model.RevisionResourceConfig:
+		if revision.Deleted {
+			return nil, ErrRevisionUnsupported
+		}
+		var cfg pkgmodel.Config
+		if err := bson.Unmarshal(revision.Snapshot, &cfg); err != nil {
+			return nil, err
+		}
+		current, err := s.configRepo.GetConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// 与配置更新相同：校验最终加载的指令并同步日志保留策略索引
+		if err := s.configSaver.save(ctx, current.LogRetention, &cfg); err != nil {
+			return nil, err
+		}
+		return &cfg, nil
+
+	case model.RevisionResourceSite:
+		var site model.Site
+		if err := bson.Unmarshal(revision.Snapshot, &site); err != nil {
+			return nil, err
+		}
+		if revision.Deleted {
+			if err := s.siteRepo.DeleteSite(ctx, site.ID); err != nil {
+				return nil, err
+			}
+			return &site, nil
+		}
+		if err := s.siteRepo.CheckDomainPortConflict(ctx, &site); err != nil {
+			return nil, err
+		}
+		if err := s.siteRepo.RestoreSite(ctx, &site); err != nil {
+			return nil, err
+		}
+		return &site, nil
+
+	case model.RevisionResourceRule:
+		var rule pkgmodel.Rule
+		if err := bson.Unmarshal(revision.Snapshot, &rule); err != nil {
+			return nil, err
+		}
+		if revision.Deleted {
+			if err := s.ruleRepo.DeleteRule(ctx, rule.ID); err != nil && !errors.Is(err, repository.ErrRuleNotFound) {
+				return nil, err
+			}
+			return &rule, nil
+		}
+		if err := s.ruleRepo.RestoreRule(ctx, &rule); err != nil {
+			return nil, err
+		}
+		return &rule, nil
+
+	case model.RevisionResourceCertificate:
+		var cert model.CertificateStore
+		if err := bson.Unmarshal(revision.Snapshot, &cert); err != nil {
+			return nil, err
+		}
+		if revision.Deleted {
+			if err := s.certRepo.DeleteCertificate(ctx, cert.ID); err != nil && !errors.Is(err, repository.ErrCertNotFound) {
+				return nil, err
+			}
+			return &cert, nil
+		}
+		if err := s.certRepo.RestoreCertificate(ctx, &cert); err != nil {
+			return nil, err
+		}
+		return &cert, nil
+	}
+
+	return nil, ErrRevisionUnsupported
+}
+
+func (s *RevisionServiceImpl) getRevision(ctx context.Context, id bson.ObjectID) (*model.Revision, error) {
+	revision, err := s.revisionRepo.GetRevisionByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrRevisionNotFound) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return revision, nil
+}
+
+// hotReloadIfRunning 服务运行中时热重载 HAProxy 和引擎，未运行时新配置会在下次启动时生效
+func hotReloadIfRunning(logger zerolog.Logger) error {
+	runner, err := daemon.GetRunnerService()
+	if err != nil {
+		logger.Error().Err(err).Msg("获取ServiceRunner失败")
+		return fmt.Errorf("%w: %s", ErrRollbackReload, err.Error())
+	}
+
+	if runner.GetState() != daemon.ServiceRunning {
+		logger.Info().Msg("服务未运行，配置将在下次启动时生效")
+		return nil
+	}
+
+	if err := runner.HotReload(); err != nil {
+		return fmt.Errorf("%w: %s", ErrRollbackReload, err.Error())
+	}
+	return nil
+}
+
+// snapshotToMap 将快照按资源模型解码后转换为与API一致的JSON结构
+func snapshotToMap(revision *model.Revision) (map[string]any, error) {
+	var target any
+	switch revision.ResourceType {
+	case model.RevisionResourceConfig:
+		target = &pkgmodel.Config{}
+	case model.RevisionResourceSite:
+		target = &model.Site{}
+	case model.RevisionResourceRule:
+		target = &pkgmodel.Rule{}
+	case model.RevisionResourceCertificate:
+		target = &model.CertificateStore{}
+	default:
+		return nil, ErrRevisionUnsupported
+	}
+
+	if err := bson.Unmarshal(revision.Snapshot, target); err != nil {
+		return nil, fmt.Errorf("解析资源快照失败: %w", err)
+	}
+
+	data, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]any{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// maskSecrets 隐藏快照中的私钥，只保留摘要用于判断是否变化
+func maskSecrets(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if s, ok := item.(string); ok && s != "" && strings.EqualFold(key, "privateKey") {
+				sum := sha256.Sum256([]byte(s))
+				v[key] = "****** (sha256:" + hex.EncodeToString(sum[:])[:16] + ")"
+				continue
+			}
+			maskSecrets(item)
+		}
+	case []any:
+		for _, item := range v {
+			maskSecrets(item)
+		}
+	}
+}
+
+// diffSnapshots 展开两个快照并逐字段对比
+func diffSnapshots(from, to map[string]any) []dto.RevisionFieldChange {
+	fromFields := map[string]any{}
+	toFields := map[string]any{}
+	flattenFields("", from, fromFields)
+	flattenFields("", to, toFields)
+
+	paths := make([]string, 0, len(fromFields)+len(toFields))
+	for path := range fromFields {
+		paths = append(paths, path)
+	}
+	for path := range toFields {
+		if _, ok := fromFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []dto.RevisionFieldChange{}
+	for _, path := range paths {
+		oldValue, inOld := fromFields[path]
+		newValue, inNew := toFields[path]
+
+		switch {
+		case !inOld:
+			changes = append(changes, dto.RevisionFieldChange{Path: path, Type: changeAdded, New: newValue})
+		case !inNew:
+			changes = append(changes, dto.RevisionFieldChange{Path: path, Type: changeRemoved, Old: oldValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			change := dto.RevisionFieldChange{Path: path, Type: changeModified, Old: oldValue, New: newValue}
+			oldText, oldOK := oldValue.(string)
+			newText, newOK := newValue.(string)
+			if oldOK && newOK && (strings.Contains(oldText, "\n") || strings.Contains(newText, "\n")) {
+				change.Lines = diffLines(oldText, newText)
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// flattenFields 将嵌套结构展开为 a.b[0].c 形式的路径
+func flattenFields(prefix string, value any, out map[string]any) {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 && prefix != "" {
+			out[prefix] = v
+			return
+		}
+		for key, item := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenFields(path, item, out)
+		}
+	case []any:
+		if len(v) == 0 {
+			out[prefix] = v
+			return
+		}
+		for i, item := range v {
+			flattenFields(fmt.Sprintf("%s[%d]", prefix, i), item, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+// diffLines 基于最长公共子序列的逐行对比
+func diffLines(oldText, newText string) []string {
+	a := strings.Split(oldText, "\n")
+	b := strings.Split(newText, "\n")
+	if len(a) > maxLineDiffLines || len(b) > maxLineDiffLines {
+		return nil
+	}
+
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+ "+b[j])
+	}
+	return lines
+}
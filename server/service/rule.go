@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	servermodel "github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	ErrInvalidRule     = errors.New("规则无效")
+	ErrRuleIDCollision = errors.New("规则ID冲突")
+	ErrRuleReferenced  = errors.New("规则仍被规则排除引用")
+)
+
+// RuleService 自定义规则服务
+type RuleService interface {
+	CreateRule(ctx context.Context, req *dto.RuleRequest) (*model.Rule, error)
+	GetRules(ctx context.Context, req dto.RuleListRequest) (*dto.RuleListResponse, error)
+	GetRuleByID(ctx context.Context, id bson.ObjectID) (*model.Rule, error)
+	UpdateRule(ctx context.Context, id bson.ObjectID, req *dto.RuleRequest) (*model.Rule, error)
+	DeleteRule(ctx context.Context, id bson.ObjectID) error
+	PreviewDirectives(ctx context.Context) ([]dto.DirectivesPreviewResponse, error)
+}
+
+// RuleServiceImpl 自定义规则服务实现
+type RuleServiceImpl struct {
+	ruleRepo        repository.RuleRepository
+	exclusionRepo   repository.RuleExclusionRepository
+	configRepo      repository.ConfigRepository
+	revisionService RevisionService
+	db              *mongo.Database
+	logger          zerolog.Logger
+}
+
+// NewRuleService 创建自定义规则服务
+func NewRuleService(
+	ruleRepo repository.RuleRepository,
+	exclusionRepo repository.RuleExclusionRepository,
+	configRepo repository.ConfigRepository,
+	revisionService RevisionService,
+	db *mongo.Database,
+) RuleService {
+	logger := config.GetServiceLogger("rule")
+	return &RuleServiceImpl{
+		ruleRepo:        ruleRepo,
+		exclusionRepo:   exclusionRepo,
+		configRepo:      configRepo,
+		revisionService: revisionService,
+		db:              db,
+		logger:          logger,
+	}
+}
+
+// CreateRule 创建自定义规则，校验通过后热重载引擎
+func (s *RuleServiceImpl) CreateRule(ctx context.Context, req *dto.RuleRequest) (*model.Rule, error) {
+	rule := &model.Rule{}
+	applyRuleRequest(rule, req)
+	rule.CreatedBy, _ = ctx.Value("username").(string)
+	rule.UpdatedBy = rule.CreatedBy
+
+	if err := s.validate(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.ruleRepo.CreateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	s.revisionService.Record(ctx, servermodel.RevisionResourceRule, rule.ID.Hex(), rule.Name, servermodel.RevisionActionCreate, rule)
+	s.logger.Info().Str("id", rule.ID.Hex()).Int("ruleId", rule.RuleID).Msg("自定义规则已创建")
+
+	if err := reloadEngineIfRunning(s.logger); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// GetRules 获取自定义规则列表
+func (s *RuleServiceImpl) GetRules(ctx context.Context, req dto.RuleListRequest) (*dto.RuleListResponse, error) {
+	page, size := req.Page, req.Size
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 10
+	}
+
+	filter := bson.D{}
+	if req.Tag != "" {
+		filter = append(filter, bson.E{Key: "tags", Value: req.Tag})
+	}
+	if req.Domain != "" {
+		filter = append(filter, bson.E{Key: "scope.domains", Value: req.Domain})
+	}
+	if req.Enabled != nil {
+		filter = append(filter, bson.E{Key: "enabled", Value: *req.Enabled})
+	}
+
+	rules, total, err := s.ruleRepo.GetRules(ctx, filter, page, size)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = []model.Rule{}
+	}
+
+	return &dto.RuleListResponse{
+		Total: total,
+		Items: rules,
+	}, nil
+}
+
+// GetRuleByID 获取单条自定义规则
+func (s *RuleServiceImpl) GetRuleByID(ctx context.Context, id bson.ObjectID) (*model.Rule, error) {
+	return s.ruleRepo.GetRuleByID(ctx, id)
+}
+
+// UpdateRule 更新自定义规则，校验通过后热重载引擎
+func (s *RuleServiceImpl) UpdateRule(ctx context.Context, id bson.ObjectID, req *dto.RuleRequest) (*model.Rule, error) {
+	rule, err := s.ruleRepo.GetRuleByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 禁用规则或修改规则ID后，引用原规则ID的排除会导致引擎无法加载
+	if rule.Enabled && (req.Enabled == nil || !*req.Enabled || req.RuleID != rule.RuleID) {
+		if err := s.checkReferences(ctx, rule.RuleID); err != nil {
+			return nil, err
+		}
+	}
+
+	applyRuleRequest(rule, req)
+	rule.UpdatedBy, _ = ctx.Value("username").(string)
+
+	if err := s.validate(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.ruleRepo.UpdateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	s.revisionService.Record(ctx, servermodel.RevisionResourceRule, rule.ID.Hex(), rule.Name, servermodel.RevisionActionUpdate, rule)
+	s.logger.Info().Str("id", rule.ID.Hex()).Int("ruleId", rule.RuleID).Msg("自定义规则已更新")
+
+	if err := reloadEngineIfRunning(s.logger); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// DeleteRule 删除自定义规则并热重载引擎，规则仍被未撤销的排除引用时拒绝删除
+func (s *RuleServiceImpl) DeleteRule(ctx context.Context, id bson.ObjectID) error {
+	rule, err := s.ruleRepo.GetRuleByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rule.Enabled {
+		if err := s.checkReferences(ctx, rule.RuleID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.ruleRepo.DeleteRule(ctx, id); err != nil {
+		return err
+	}
+	s.revisionService.Record(ctx, servermodel.RevisionResourceRule, rule.ID.Hex(), rule.Name, servermodel.RevisionActionDelete, rule)
+
+	s.logger.Info().Str("id", id.Hex()).Msg("自定义规则已删除")
+
+	return reloadEngineIfRunning(s.logger)
+}
+
+// PreviewDirectives 预览每个引擎应用最终加载的完整指令，包括站点策略
+func (s *RuleServiceImpl) PreviewDirectives(ctx context.Context) ([]dto.DirectivesPreviewResponse, error) {
+	cfg, ruleSet, err := s.loadRuleSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// IP 信誉列表写入临时目录，预览中的数据文件路径与引擎实际使用的目录不同
+	dir, err := os.MkdirTemp("", "simple-waf-preview-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	previews, err := assembleDirectives(cfg.Engine.AppConfig, ruleSet, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRule, err.Error())
+	}
+	return previews, nil
+}
+
+// validate 校验规则结构、规则ID冲突，并用候选规则按引擎的加载方式组装完整指令进行编译
+func (s *RuleServiceImpl) validate(ctx context.Context, rule *model.Rule) error {
+	if err := seclang.ValidateRule(*rule); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRule, err.Error())
+	}
+
+	if err := s.ruleRepo.CheckRuleIDExists(ctx, rule.RuleID, rule.ID); err != nil {
+		return err
+	}
+
+	cfg, ruleSet, err := s.loadRuleSet(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 检查与基础指令中已声明的规则ID冲突
+	for _, app := range cfg.Engine.AppConfig {
+		for _, id := range seclang.ParseRuleIDs(app.Directives) {
+			if id == rule.RuleID {
+				return fmt.Errorf("%w: 规则ID %d 已在引擎应用 %s 的基础指令中使用", ErrRuleIDCollision, id, app.Name)
+			}
+		}
+	}
+
+	// 用候选规则替换已有同名记录后编译
+	candidates := make([]model.Rule, 0, len(ruleSet.Rules)+1)
+	for _, r := range ruleSet.Rules {
+		if r.ID != rule.ID {
+			candidates = append(candidates, r)
+		}
+	}
+	candidate := *rule
+	candidate.Enabled = true // 禁用的规则也需要保证可编译，便于之后直接启用
+	ruleSet.Rules = append(candidates, candidate)
+
+	if err := validateRuleSet(cfg.Engine.AppConfig, ruleSet); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRule, err.Error())
+	}
+	return nil
+}
+
+// checkReferences 检查规则ID是否仍被未撤销的排除引用，引用时返回冲突错误并列出这些排除
+func (s *RuleServiceImpl) checkReferences(ctx context.Context, ruleID int) error {
+	exclusions, err := s.exclusionRepo.GetActiveExclusions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, e := range exclusions {
+		if e.RuleID == ruleID {
+			ids = append(ids, e.ID.Hex())
+		}
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("%w: 规则ID %d 被排除 %s 引用，请先撤销这些排除", ErrRuleReferenced, ruleID, strings.Join(ids, ", "))
+	}
+	return nil
+}
+
+// loadRuleSet 加载组装指令所需的配置，以及引擎加载的规则、规则排除和站点策略
+func (s *RuleServiceImpl) loadRuleSet(ctx context.Context) (*model.Config, *server.RuleSet, error) {
+	cfg, err := s.configRepo.GetConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ruleSet, err := server.LoadRuleSet(ctx, s.db, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, ruleSet, nil
+}
+
+// applyRuleRequest 将请求内容写入规则
+func applyRuleRequest(rule *model.Rule, req *dto.RuleRequest) {
+	rule.RuleID = req.RuleID
+	rule.Name = strings.TrimSpace(req.Name)
+	rule.Description = req.Description
+	rule.SecLang = strings.TrimSpace(req.SecLang)
+	rule.Phase = seclang.ParsePhase(rule.SecLang)
+	rule.Priority = req.Priority
+	rule.Enabled = req.Enabled != nil && *req.Enabled
+	rule.Tags = req.Tags
+
+	domains := make([]string, 0, len(req.Domains))
+	for _, d := range req.Domains {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	rule.Scope = model.RuleScope{Domains: domains}
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	ErrInvalidExclusion   = errors.New("规则排除配置无效")
+	ErrNoExclusionOptions = errors.New("该日志没有可排除的规则")
+	ErrEngineReload       = errors.New("引擎热重载失败")
+)
+
+// matchedTargetPattern 从规则日志中提取命中的变量，如 "found within ARGS:content: ..."
+var matchedTargetPattern = regexp.MustCompile(`found within ([A-Z_]+(?::[^:\s"\]]+)?)`)
+
+// RuleExclusionService 规则排除服务
+type RuleExclusionService interface {
+	ProposeFromLog(ctx context.Context, logID string) ([]dto.ExclusionProposal, error)
+	CreateExclusion(ctx context.Context, req *dto.ExclusionCreateRequest) (*model.RuleExclusion, error)
+	GetExclusions(ctx context.Context, req dto.ExclusionListRequest) (*dto.ExclusionListResponse, error)
+	RevokeExclusion(ctx context.Context, id bson.ObjectID) (*model.RuleExclusion, error)
+}
+
+// RuleExclusionServiceImpl 规则排除服务实现
+type RuleExclusionServiceImpl struct {
+	exclusionRepo repository.RuleExclusionRepository
+	wafLogRepo    repository.WAFLogRepository
+	configRepo    repository.ConfigRepository
+	db            *mongo.Database
+	logger        zerolog.Logger
+}
+
+// NewRuleExclusionService 创建规则排除服务
+func NewRuleExclusionService(
+	exclusionRepo repository.RuleExclusionRepository,
+	wafLogRepo repository.WAFLogRepository,
+	configRepo repository.ConfigRepository,
+	db *mongo.Database,
+) RuleExclusionService {
+	logger := config.GetServiceLogger("rule_exclusion")
+	return &RuleExclusionServiceImpl{
+		exclusionRepo: exclusionRepo,
+		wafLogRepo:    wafLogRepo,
+		configRepo:    configRepo,
+		db:            db,
+		logger:        logger,
+	}
+}
+
+// ProposeFromLog 根据WAF日志为每条命中的检测规则生成排除建议
+func (s *RuleExclusionServiceImpl) ProposeFromLog(ctx context.Context, logID string) ([]dto.ExclusionProposal, error) {
+	id, err := bson.ObjectIDFromHex(logID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 日志ID格式错误", ErrInvalidExclusion)
+	}
+
+	wafLog, err := s.wafLogRepo.FindLogByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := wafLog.Logs
+	if len(entries) == 0 && wafLog.RuleID != 0 {
+		entries = []model.Log{{
+			RuleID:  wafLog.RuleID,
+			Message: wafLog.Message,
+			Payload: wafLog.Payload,
+		}}
+	}
+
+	scope := model.ExclusionScope{
+		Domain: wafLog.Domain,
+		Path:   uriPath(wafLog.URI),
+	}
+
+	proposals := make([]dto.ExclusionProposal, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if isAnomalyEvaluationRule(entry.RuleID) {
+			continue
+		}
+
+		exclusion := model.RuleExclusion{
+			RuleID:      entry.RuleID,
+			Type:        model.ExclusionRemoveRule,
+			Scope:       scope,
+			SourceLogID: wafLog.ID,
+		}
+		if m := matchedTargetPattern.FindStringSubmatch(entry.LogRaw); m != nil {
+			exclusion.Type = model.ExclusionRemoveTarget
+			exclusion.Target = m[1]
+		}
+
+		key := fmt.Sprintf("%d|%s|%s", exclusion.RuleID, exclusion.Type, exclusion.Target)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		compiled, err := seclang.CompileExclusions([]model.RuleExclusion{exclusion})
+		if err != nil {
+			// 提取的目标无法编译时退回到禁用整条规则
+			exclusion.Type = model.ExclusionRemoveRule
+			exclusion.Target = ""
+			if compiled, err = seclang.CompileExclusions([]model.RuleExclusion{exclusion}); err != nil {
+				continue
+			}
+		}
+
+		proposals = append(proposals, dto.ExclusionProposal{
+			RuleID:      exclusion.RuleID,
+			Message:     entry.Message,
+			Payload:     entry.Payload,
+			Type:        exclusion.Type,
+			Target:      exclusion.Target,
+			Scope:       exclusion.Scope,
+			SourceLogID: wafLog.ID.Hex(),
+			Directives:  compiled.BeforeCRS + compiled.AfterCRS,
+		})
+	}
+
+	if len(proposals) == 0 {
+		return nil, ErrNoExclusionOptions
+	}
+
+	return proposals, nil
+}
+
+// CreateExclusion 创建规则排除并热重载引擎
+func (s *RuleExclusionServiceImpl) CreateExclusion(ctx context.Context, req *dto.ExclusionCreateRequest) (*model.RuleExclusion, error) {
+	exclusion := &model.RuleExclusion{
+		RuleID: req.RuleID,
+		Type:   req.Type,
+		Scope: model.ExclusionScope{
+			Domain: strings.TrimSpace(req.Domain),
+			Path:   strings.TrimSpace(req.Path),
+		},
+		Reason: req.Reason,
+	}
+	if req.Type == model.ExclusionRemoveTarget {
+		exclusion.Target = strings.TrimSpace(req.Target)
+	}
+	if req.SourceLogID != "" {
+		sourceID, err := bson.ObjectIDFromHex(req.SourceLogID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 来源日志ID格式错误", ErrInvalidExclusion)
+		}
+		exclusion.SourceLogID = sourceID
+	}
+	exclusion.CreatedBy, _ = ctx.Value("username").(string)
+
+	if err := seclang.ValidateExclusion(*exclusion); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExclusion, err.Error())
+	}
+	if err := s.validateCandidate(ctx, exclusion); err != nil {
+		return nil, err
+	}
+
+	if err := s.exclusionRepo.CreateExclusion(ctx, exclusion); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("id", exclusion.ID.Hex()).
+		Int("ruleId", exclusion.RuleID).
+		Str("type", string(exclusion.Type)).
+		Str("target", exclusion.Target).
+		Msg("规则排除已创建")
+
+	if err := reloadEngineIfRunning(s.logger); err != nil {
+		return exclusion, err
+	}
+
+	return exclusion, nil
+}
+
+// validateCandidate 将候选排除加入当前规则集，按引擎的加载方式组装每个应用的指令并试编译。
+// 排除的目标规则不存在时引擎无法加载指令，保存后每次热重载和重启都会失败
+func (s *RuleExclusionServiceImpl) validateCandidate(ctx context.Context, exclusion *model.RuleExclusion) error {
+	cfg, err := s.configRepo.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	ruleSet, err := server.LoadRuleSet(ctx, s.db, true)
+	if err != nil {
+		return err
+	}
+
+	ruleSet.Exclusions = append(ruleSet.Exclusions, *exclusion)
+	if err := validateRuleSet(cfg.Engine.AppConfig, ruleSet); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidExclusion, err.Error())
+	}
+	return nil
+}
+
+// GetExclusions 获取规则排除列表
+func (s *RuleExclusionServiceImpl) GetExclusions(ctx context.Context, req dto.ExclusionListRequest) (*dto.ExclusionListResponse, error) {
+	page, size := req.Page, req.Size
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 10
+	}
+
+	filter := bson.D{}
+	if !req.IncludeRevoked {
+		filter = append(filter, bson.E{Key: "revoked", Value: false})
+	}
+	if req.RuleID > 0 {
+		filter = append(filter, bson.E{Key: "ruleId", Value: req.RuleID})
+	}
+	if req.Domain != "" {
+		filter = append(filter, bson.E{Key: "scope.domain", Value: req.Domain})
+	}
+
+	exclusions, total, err := s.exclusionRepo.GetExclusions(ctx, filter, page, size)
+	if err != nil {
+		return nil, err
+	}
+	if exclusions == nil {
+		exclusions = []model.RuleExclusion{}
+	}
+
+	return &dto.ExclusionListResponse{
+		Total: total,
+		Items: exclusions,
+	}, nil
+}
+
+// RevokeExclusion 撤销规则排除并热重载引擎
+func (s *RuleExclusionServiceImpl) RevokeExclusion(ctx context.Context, id bson.ObjectID) (*model.RuleExclusion, error) {
+	username, _ := ctx.Value("username").(string)
+
+	exclusion, err := s.exclusionRepo.RevokeExclusion(ctx, id, username)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().Str("id", id.Hex()).Str("revokedBy", username).Msg("规则排除已撤销")
+
+	if err := reloadEngineIfRunning(s.logger); err != nil {
+		return exclusion, err
+	}
+
+	return exclusion, nil
+}
+
+// reloadEngineIfRunning 服务运行中时热重载引擎，未运行时新配置会在下次启动时生效
+func reloadEngineIfRunning(logger zerolog.Logger) error {
+	runner, err := daemon.GetRunnerService()
+	if err != nil {
+		logger.Error().Err(err).Msg("获取ServiceRunner失败")
+		return fmt.Errorf("%w: %s", ErrEngineReload, err.Error())
+	}
+
+	if runner.GetState() != daemon.ServiceRunning {
+		logger.Info().Msg("服务未运行，配置将在下次启动时生效")
+		return nil
+	}
+
+	if err := runner.ReloadEngine(); err != nil {
+		return fmt.Errorf("%w: %s", ErrEngineReload, err.Error())
+	}
+	return nil
+}
+
+// isAnomalyEvaluationRule 判断是否为 CRS 的异常评分判定/关联规则，这类规则不应被排除
+func isAnomalyEvaluationRule(ruleID int) bool {
+	switch ruleID / 1000 {
+	case 949, 959, 980:
+		return true
+	}
+	return false
+}
+
+// uriPath 去掉 URI 中的查询参数
+func uriPath(uri string) string {
+	if idx := strings.IndexAny(uri, "?#"); idx >= 0 {
+		uri = uri[:idx]
+	}
+	if !strings.HasPrefix(uri, "/") {
+		return ""
+	}
+	return uri
+}
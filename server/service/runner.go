@@ -6,7 +6,10 @@ import (
 	"fmt"
 
 	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
 	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/haproxy"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/watcher"
 	"github.com/rs/zerolog"
 )
 
@@ -20,10 +23,14 @@ var (
 type RunnerService interface {
 	// 获取运行器状态
 	GetStatus(ctx context.Context) (daemon.ServiceState, error)
+	GetHAProxyStatus(ctx context.Context) haproxy.SupervisorStatus
+	GetHAProxyOutput(ctx context.Context, limit int) []haproxy.OutputLine
+	GetConfigWatchStatus(ctx context.Context) dto.ConfigWatchStatus
 
 	// 运行器操作
 	Start(ctx context.Context) error
 	Stop(ctx context.Context) error
+	Drain(ctx context.Context) error
 	Restart(ctx context.Context) error
 	ForceStop(ctx context.Context) error
 	Reload(ctx context.Context) error
@@ -31,8 +38,9 @@ type RunnerService interface {
 
 // RunnerServiceImpl 运行器服务实现
 type RunnerServiceImpl struct {
-	logger zerolog.Logger
-	runner daemon.ServiceRunner
+	logger  zerolog.Logger
+	runner  daemon.ServiceRunner
+	watcher watcher.ConfigWatcher
 }
 
 // NewRunnerService 创建运行器服务
@@ -46,9 +54,17 @@ func NewRunnerService() (RunnerService, error) {
 		return nil, fmt.Errorf("初始化运行器服务失败: %w", err)
 	}
 
+	// 获取配置变更监听器
+	configWatcher, err := watcher.GetConfigWatcher()
+	if err != nil {
+		logger.Error().Err(err).Msg("获取配置变更监听器失败")
+		return nil, fmt.Errorf("初始化运行器服务失败: %w", err)
+	}
+
 	return &RunnerServiceImpl{
-		logger: logger,
-		runner: runner,
+		logger:  logger,
+		runner:  runner,
+		watcher: configWatcher,
 	}, nil
 }
 
@@ -57,6 +73,21 @@ func (s *RunnerServiceImpl) GetStatus(ctx context.Context) (daemon.ServiceState,
 	return s.runner.GetState(), nil
 }
 
+// GetHAProxyStatus 获取 HAProxy 进程监管状态
+func (s *RunnerServiceImpl) GetHAProxyStatus(ctx context.Context) haproxy.SupervisorStatus {
+	return s.runner.GetHAProxyStatus()
+}
+
+// GetHAProxyOutput 获取最近的 HAProxy 输出
+func (s *RunnerServiceImpl) GetHAProxyOutput(ctx context.Context, limit int) []haproxy.OutputLine {
+	return s.runner.GetHAProxyOutput(limit)
+}
+
+// GetConfigWatchStatus 获取配置变更自动重载的状态和最近的重载结果
+func (s *RunnerServiceImpl) GetConfigWatchStatus(ctx context.Context) dto.ConfigWatchStatus {
+	return s.watcher.GetStatus()
+}
+
 // Start 启动运行器
 func (s *RunnerServiceImpl) Start(ctx context.Context) error {
 	// 检查当前状态
@@ -91,6 +122,22 @@ func (s *RunnerServiceImpl) Stop(ctx context.Context) error {
 	return nil
 }
 
+// Drain 优雅停止运行器，等待已有连接和进行中的事务处理完成
+func (s *RunnerServiceImpl) Drain(ctx context.Context) error {
+	// 检查当前状态
+	if s.runner.GetState() != daemon.ServiceRunning {
+		return ErrRunnerNotRunning
+	}
+
+	err := s.runner.DrainServices()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("优雅停止运行器失败")
+		return fmt.Errorf("优雅停止运行器失败: %w", err)
+	}
+
+	return nil
+}
+
 // Restart 重启运行器
 func (s *RunnerServiceImpl) Restart(ctx context.Context) error {
 	// 重启服务
@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	"github.com/HUAHUAI23/simple-waf/server/dto"
 	"github.com/HUAHUAI23/simple-waf/server/model"
@@ -12,6 +17,8 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+var ErrInvalidSite = errors.New("站点配置无效")
+
 type SiteService interface {
 	CreateSite(ctx context.Context, req *dto.CreateSiteRequest) (*model.Site, error)
 	GetSites(ctx context.Context, pageStr, sizeStr string) ([]model.Site, int64, error)
@@ -22,16 +29,18 @@ type SiteService interface {
 
 // SiteService 站点服务
 type SiteServiceImpl struct {
-	siteRepo repository.SiteRepository
-	logger   zerolog.Logger
+	siteRepo        repository.SiteRepository
+	revisionService RevisionService
+	logger          zerolog.Logger
 }
 
 // NewSiteService 创建站点服务
-func NewSiteService(siteRepo repository.SiteRepository) SiteService {
+func NewSiteService(siteRepo repository.SiteRepository, revisionService RevisionService) SiteService {
 	logger := config.GetServiceLogger("site")
 	return &SiteServiceImpl{
-		siteRepo: siteRepo,
-		logger:   logger,
+		siteRepo:        siteRepo,
+		revisionService: revisionService,
+		logger:          logger,
 	}
 }
 
@@ -43,15 +52,21 @@ func (s *SiteServiceImpl) CreateSite(ctx context.Context, req *dto.CreateSiteReq
 	site.Domain = req.Domain
 	site.ListenPort = req.ListenPort
 	site.EnableHTTPS = req.EnableHTTPS
+	site.EnableHTTP2 = req.EnableHTTP2
 	site.WAFEnabled = req.WAFEnabled
 	site.WAFMode = model.WAFModeFromString(req.WAFMode)
+	site.BodyInspection = toBodyInspection(req.BodyInspection)
+	site.BlockPage = toBlockPage(req.BlockPage)
+	site.GeoPolicy = toGeoPolicy(req.GeoPolicy)
+	site.IPLists = toIPLists(req.IPLists)
 	site.ActiveStatus = req.ActiveStatus
 	// 设置后端服务器
 	site.Backend.Servers = make([]model.Server, len(req.Backend.Servers))
 	for i, server := range req.Backend.Servers {
 		site.Backend.Servers[i] = model.Server{
-			Host: server.Host,
-			Port: server.Port,
+			Host:  server.Host,
+			Port:  server.Port,
+			HTTP2: server.HTTP2,
 		}
 	}
 
@@ -72,6 +87,18 @@ func (s *SiteServiceImpl) CreateSite(ctx context.Context, req *dto.CreateSiteReq
 		s.logger.Error().Err(err).Msg("站点验证失败")
 		return nil, err
 	}
+	if err := seclang.ValidateBodyInspection(site.BodyInspection); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSite, err.Error())
+	}
+	if err := validateBlockPage(site.BlockPage); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSite, err.Error())
+	}
+	if err := seclang.ValidateGeoPolicy(site.GeoPolicy); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSite, err.Error())
+	}
+	if err := seclang.ValidateSiteIPLists(site.IPLists); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSite, err.Error())
+	}
 
 	// 检查域名和端口是否已存在
 	err := s.siteRepo.CheckDomainPortExists(ctx, site)
@@ -86,6 +113,7 @@ func (s *SiteServiceImpl) CreateSite(ctx context.Context, req *dto.CreateSiteReq
 		return nil, err
 	}
 
+	s.revisionService.Record(ctx, model.RevisionResourceSite, site.ID.Hex(), site.Name, model.RevisionActionCreate, site)
 	s.logger.Info().Str("name", site.Name).Str("domain", site.Domain).Msg("站点创建成功")
 	return site, nil
 }
@@ -153,10 +181,23 @@ func (s *SiteServiceImpl) UpdateSite(ctx context.Context, id bson.ObjectID, req
 
 	// 更新HTTPS设置
 	site.EnableHTTPS = req.EnableHTTPS
+	site.EnableHTTP2 = req.EnableHTTP2
 	site.WAFEnabled = req.WAFEnabled
 	if req.WAFMode != "" {
 		site.WAFMode = model.WAFModeFromString(req.WAFMode)
 	}
+	if req.BodyInspection != nil {
+		site.BodyInspection = toBodyInspection(req.BodyInspection)
+	}
+	if req.BlockPage != nil {
+		site.BlockPage = toBlockPage(req.BlockPage)
+	}
+	if req.GeoPolicy != nil {
+		site.GeoPolicy = toGeoPolicy(req.GeoPolicy)
+	}
+	if req.IPLists != nil {
+		site.IPLists = toIPLists(req.IPLists)
+	}
 	site.ActiveStatus = req.ActiveStatus
 
 	// 更新后端服务器
@@ -167,6 +208,7 @@ func (s *SiteServiceImpl) UpdateSite(ctx context.Context, id bson.ObjectID, req
 				Host:  server.Host,
 				Port:  server.Port,
 				IsSSL: server.IsSSL,
+				HTTP2: server.HTTP2,
 			}
 		}
 	}
@@ -188,6 +230,18 @@ func (s *SiteServiceImpl) UpdateSite(ctx context.Context, id bson.ObjectID, req
 		s.logger.Error().Err(err).Msg("站点验证失败")
 		return nil, err
 	}
+	if err := seclang.ValidateBodyInspection(site.BodyInspection); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSite, err.Error())
+	}
+	if err := validateBlockPage(site.BlockPage); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSite, err.Error())
+	}
+	if err := seclang.ValidateGeoPolicy(site.GeoPolicy); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSite, err.Error())
+	}
+	if err := seclang.ValidateSiteIPLists(site.IPLists); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSite, err.Error())
+	}
 
 	// 保存更新
 	err = s.siteRepo.UpdateSite(ctx, site)
@@ -196,6 +250,7 @@ func (s *SiteServiceImpl) UpdateSite(ctx context.Context, id bson.ObjectID, req
 		return nil, err
 	}
 
+	s.revisionService.Record(ctx, model.RevisionResourceSite, site.ID.Hex(), site.Name, model.RevisionActionUpdate, site)
 	s.logger.Info().Str("id", id.Hex()).Str("name", site.Name).Msg("站点更新成功")
 	return site, nil
 }
@@ -215,6 +270,63 @@ func (s *SiteServiceImpl) DeleteSite(ctx context.Context, id bson.ObjectID) erro
 		return err
 	}
 
+	s.revisionService.Record(ctx, model.RevisionResourceSite, site.ID.Hex(), site.Name, model.RevisionActionDelete, site)
 	s.logger.Info().Str("id", id.Hex()).Str("name", site.Name).Msg("站点删除成功")
 	return nil
 }
+
+// toBodyInspection 将请求中的请求体检测配置转换为模型，超限处理方式默认只检测上限以内的部分
+func toBodyInspection(req *dto.BodyInspectionDTO) *pkgmodel.BodyInspection {
+	if req == nil {
+		return nil
+	}
+	limitAction := req.LimitAction
+	if limitAction == "" {
+		limitAction = pkgmodel.BodyLimitActionProcessPartial
+	}
+	return &pkgmodel.BodyInspection{
+		Enabled:          req.Enabled,
+		MaxBytes:         req.MaxBytes,
+		LimitAction:      limitAction,
+		SkipContentTypes: req.SkipContentTypes,
+	}
+}
+
+// toGeoPolicy 将请求中的国家访问策略转换为模型，国家代码统一为大写，mode 为空时返回 nil
+func toGeoPolicy(req *dto.GeoPolicyDTO) *pkgmodel.GeoPolicy {
+	if req == nil || req.Mode == "" {
+		return nil
+	}
+	countries := make([]string, 0, len(req.Countries))
+	seen := make(map[string]bool, len(req.Countries))
+	for _, country := range req.Countries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if seen[country] {
+			continue
+		}
+		seen[country] = true
+		countries = append(countries, country)
+	}
+	return &pkgmodel.GeoPolicy{
+		Mode:      req.Mode,
+		Countries: countries,
+	}
+}
+
+// toIPLists 去除列表名称的首尾空白并去重，没有列表时返回 nil
+func toIPLists(names []string) []string {
+	lists := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		lists = append(lists, name)
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+	return lists
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/seclang"
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/feed"
+	"github.com/HUAHUAI23/simple-waf/server/utils/iplist"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var (
+	ErrInvalidThreatFeed = errors.New("威胁情报源配置无效")
+	ErrThreatFeedRefresh = errors.New("刷新威胁情报源失败")
+)
+
+// ThreatFeedService 威胁情报源服务
+type ThreatFeedService interface {
+	CreateFeed(ctx context.Context, req *dto.ThreatFeedRequest) (*model.ThreatFeed, error)
+	GetFeeds(ctx context.Context) ([]model.ThreatFeed, error)
+	GetFeedByID(ctx context.Context, id bson.ObjectID) (*model.ThreatFeed, error)
+	UpdateFeed(ctx context.Context, id bson.ObjectID, req *dto.ThreatFeedRequest) (*model.ThreatFeed, error)
+	DeleteFeed(ctx context.Context, id bson.ObjectID) error
+	RefreshFeed(ctx context.Context, id bson.ObjectID) (*model.ThreatFeed, error)
+	GetLists(ctx context.Context) ([]pkgmodel.IPList, error)
+}
+
+// ThreatFeedServiceImpl 威胁情报源服务实现
+type ThreatFeedServiceImpl struct {
+	feedRepo repository.ThreatFeedRepository
+	listRepo repository.IPListRepository
+	logger   zerolog.Logger
+}
+
+// NewThreatFeedService 创建威胁情报源服务
+func NewThreatFeedService(feedRepo repository.ThreatFeedRepository, listRepo repository.IPListRepository) ThreatFeedService {
+	logger := config.GetServiceLogger("threat_feed")
+	return &ThreatFeedServiceImpl{
+		feedRepo: feedRepo,
+		listRepo: listRepo,
+		logger:   logger,
+	}
+}
+
+// CreateFeed 创建情报源，启用时立即刷新一次，刷新失败不影响创建
+func (s *ThreatFeedServiceImpl) CreateFeed(ctx context.Context, req *dto.ThreatFeedRequest) (*model.ThreatFeed, error) {
+	threatFeed := &model.ThreatFeed{}
+	applyThreatFeedRequest(threatFeed, req)
+	if err := validateThreatFeed(threatFeed); err != nil {
+		return nil, err
+	}
+
+	if err := s.feedRepo.CreateFeed(ctx, threatFeed); err != nil {
+		return nil, err
+	}
+	s.logger.Info().Str("id", threatFeed.ID.Hex()).Str("name", threatFeed.Name).Str("list", threatFeed.List).Msg("威胁情报源已创建")
+
+	if !threatFeed.Enabled {
+		return threatFeed, nil
+	}
+	return s.refreshAfterSave(ctx, threatFeed)
+}
+
+// GetFeeds 获取全部情报源
+func (s *ThreatFeedServiceImpl) GetFeeds(ctx context.Context) ([]model.ThreatFeed, error) {
+	feeds, err := s.feedRepo.GetFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if feeds == nil {
+		feeds = []model.ThreatFeed{}
+	}
+	return feeds, nil
+}
+
+// GetFeedByID 获取单个情报源
+func (s *ThreatFeedServiceImpl) GetFeedByID(ctx context.Context, id bson.ObjectID) (*model.ThreatFeed, error) {
+	return s.feedRepo.GetFeedByID(ctx, id)
+}
+
+// UpdateFeed 更新情报源设置，来源变化时立即刷新，否则只重新合并受影响的列表
+func (s *ThreatFeedServiceImpl) UpdateFeed(ctx context.Context, id bson.ObjectID, req *dto.ThreatFeedRequest) (*model.ThreatFeed, error) {
+	threatFeed, err := s.feedRepo.GetFeedByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	previous := *threatFeed
+
+	applyThreatFeedRequest(threatFeed, req)
+	if err := validateThreatFeed(threatFeed); err != nil {
+		return nil, err
+	}
+
+	if err := s.feedRepo.UpdateFeed(ctx, threatFeed); err != nil {
+		return nil, err
+	}
+	s.logger.Info().Str("id", id.Hex()).Str("name", threatFeed.Name).Str("list", threatFeed.List).Msg("威胁情报源已更新")
+
+	sourceChanged := previous.URL != threatFeed.URL ||
+		previous.FilePath != threatFeed.FilePath ||
+		previous.Format != threatFeed.Format ||
+		previous.CSVColumn != threatFeed.CSVColumn
+	if sourceChanged {
+		// 清除条件请求标识，下次刷新重新下载并按新的格式解析
+		stats := threatFeed.Stats
+		stats.ETag, stats.LastModified = "", ""
+		if err := s.feedRepo.SaveRefreshResult(ctx, id, stats, nil); err != nil {
+			return nil, err
+		}
+	}
+	if threatFeed.Enabled && sourceChanged {
+		// 旧列表中不再包含该情报源的条目
+		if previous.List != threatFeed.List {
+			if err := s.rebuildLists(ctx, previous.List); err != nil {
+				return threatFeed, err
+			}
+		}
+		return s.refreshAfterSave(ctx, threatFeed)
+	}
+
+	if err := s.rebuildLists(ctx, previous.List, threatFeed.List); err != nil {
+		return threatFeed, err
+	}
+	return s.feedRepo.GetFeedByID(ctx, id)
+}
+
+// DeleteFeed 删除情报源并重新合并所属列表
+func (s *ThreatFeedServiceImpl) DeleteFeed(ctx context.Context, id bson.ObjectID) error {
+	threatFeed, err := s.feedRepo.GetFeedByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.feedRepo.DeleteFeed(ctx, id); err != nil {
+		return err
+	}
+	s.logger.Info().Str("id", id.Hex()).Str("name", threatFeed.Name).Msg("威胁情报源已删除")
+
+	return s.rebuildLists(ctx, threatFeed.List)
+}
+
+// RefreshFeed 立即刷新情报源，刷新失败时返回带有失败统计的情报源和错误
+func (s *ThreatFeedServiceImpl) RefreshFeed(ctx context.Context, id bson.ObjectID) (*model.ThreatFeed, error) {
+	manager, err := feed.GetFeedManager()
+	if err != nil {
+		return nil, err
+	}
+
+	threatFeed, err := manager.Refresh(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrThreatFeedNotFound) {
+			return nil, err
+		}
+		return threatFeed, fmt.Errorf("%w: %s", ErrThreatFeedRefresh, err.Error())
+	}
+	return threatFeed, nil
+}
+
+// GetLists 获取全部 IP 信誉列表，不返回条目
+func (s *ThreatFeedServiceImpl) GetLists(ctx context.Context) ([]pkgmodel.IPList, error) {
+	lists, err := s.listRepo.GetLists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if lists == nil {
+		lists = []pkgmodel.IPList{}
+	}
+	return lists, nil
+}
+
+// refreshAfterSave 保存后刷新情报源，刷新失败只记录在统计中，不作为保存失败返回
+func (s *ThreatFeedServiceImpl) refreshAfterSave(ctx context.Context, threatFeed *model.ThreatFeed) (*model.ThreatFeed, error) {
+	refreshed, err := s.RefreshFeed(ctx, threatFeed.ID)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("name", threatFeed.Name).Msg("威胁情报源已保存，首次刷新失败")
+	}
+	if refreshed == nil {
+		return threatFeed, nil
+	}
+	return refreshed, nil
+}
+
+// rebuildLists 重新合并列表，列表变化时管理器会热重载引擎
+func (s *ThreatFeedServiceImpl) rebuildLists(ctx context.Context, names ...string) error {
+	manager, err := feed.GetFeedManager()
+	if err != nil {
+		return err
+	}
+	if len(names) == 2 && names[0] == names[1] {
+		names = names[:1]
+	}
+	return manager.RebuildLists(ctx, names...)
+}
+
+// applyThreatFeedRequest 将请求写入情报源，格式和刷新间隔使用默认值
+func applyThreatFeedRequest(threatFeed *model.ThreatFeed, req *dto.ThreatFeedRequest) {
+	threatFeed.Name = req.Name
+	threatFeed.List = req.List
+	threatFeed.URL = req.URL
+	threatFeed.FilePath = req.FilePath
+	threatFeed.Format = req.Format
+	if threatFeed.Format == "" {
+		threatFeed.Format = iplist.FormatText
+	}
+	threatFeed.CSVColumn = req.CSVColumn
+	threatFeed.Interval = req.Interval
+	if threatFeed.Interval == 0 {
+		threatFeed.Interval = model.ThreatFeedDefaultInterval
+	}
+	threatFeed.Enabled = *req.Enabled
+}
+
+// validateThreatFeed 校验情报源设置
+func validateThreatFeed(threatFeed *model.ThreatFeed) error {
+	if err := seclang.ValidateIPListName(threatFeed.List); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidThreatFeed, err.Error())
+	}
+	if (threatFeed.URL == "") == (threatFeed.FilePath == "") {
+		return fmt.Errorf("%w: 下载地址和本地文件路径必须且只能配置一个", ErrInvalidThreatFeed)
+	}
+	if threatFeed.URL != "" {
+		u, err := url.Parse(threatFeed.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: 下载地址只支持 http 和 https", ErrInvalidThreatFeed)
+		}
+	}
+	if threatFeed.FilePath != "" && !filepath.IsAbs(threatFeed.FilePath) {
+		return fmt.Errorf("%w: 本地文件路径必须是绝对路径", ErrInvalidThreatFeed)
+	}
+	if threatFeed.Interval < model.ThreatFeedMinInterval {
+		return fmt.Errorf("%w: 刷新间隔不能小于 %d 秒", ErrInvalidThreatFeed, model.ThreatFeedMinInterval)
+	}
+	return nil
+}
@@ -1,9 +1,18 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/dto"
@@ -15,8 +24,14 @@ import (
 type WAFLogService interface {
 	GetAttackEvents(ctx context.Context, req dto.AttackEventRequset, page, pageSize int) (*dto.AttackEventResponse, error)
 	GetAttackLogs(ctx context.Context, req dto.AttackLogRequest, page, pageSize int) (*dto.AttackLogResponse, error)
+	ResolveExportFields(fields []string) ([]string, error)
+	ExportAttackLogs(ctx context.Context, req dto.LogExportRequest, fields []string, w io.Writer) (int64, error)
+	GetAnomalyScoreStats(ctx context.Context, req dto.AnomalyScoreStatsRequest) (*dto.AnomalyScoreStatsResponse, error)
+	GetGeoStats(ctx context.Context, req dto.GeoStatsRequest) (*dto.GeoStatsResponse, error)
 }
 
+var ErrInvalidExportField = errors.New("不支持的导出字段")
+
 type WAFLogServiceImpl struct {
 	wafLogRepository repository.WAFLogRepository
 }
@@ -223,6 +238,33 @@ func (s *WAFLogServiceImpl) buildAttackLogFilter(req dto.AttackLogRequest) bson.
 		filter = append(filter, bson.E{Key: "ruleId", Value: req.RuleID})
 	}
 
+	// 异常分数范围和攻击类别过滤
+	scoreFilter := bson.D{}
+	if req.MinInboundScore > 0 {
+		scoreFilter = append(scoreFilter, bson.E{Key: "$gte", Value: req.MinInboundScore})
+	}
+	if req.MaxInboundScore > 0 {
+		scoreFilter = append(scoreFilter, bson.E{Key: "$lte", Value: req.MaxInboundScore})
+	}
+	if len(scoreFilter) > 0 {
+		filter = append(filter, bson.E{Key: "anomalyScore.inbound", Value: scoreFilter})
+	}
+	if req.Action == model.WAFLogActionBlocked {
+		// 记录动作之前的日志都来自被拦截的事务，没有 action 字段
+		filter = append(filter, bson.E{Key: "action", Value: bson.D{{Key: "$in", Value: bson.A{req.Action, nil}}}})
+	} else if req.Action != "" {
+		filter = append(filter, bson.E{Key: "action", Value: req.Action})
+	}
+	if req.Category != "" {
+		filter = append(filter, bson.E{Key: "anomalyScore." + req.Category, Value: bson.D{{Key: "$gt", Value: 0}}})
+	}
+	if req.BotClass != "" {
+		filter = append(filter, bson.E{Key: "bot.class", Value: req.BotClass})
+	}
+	if req.Country != "" {
+		filter = append(filter, bson.E{Key: "geo.country", Value: strings.ToUpper(req.Country)})
+	}
+
 	// Add time range filter if provided
 	timeFilter := bson.D{}
 	if !req.StartTime.IsZero() {
@@ -237,3 +279,322 @@ func (s *WAFLogServiceImpl) buildAttackLogFilter(req dto.AttackLogRequest) bson.
 
 	return filter
 }
+
+// GetAnomalyScoreStats 统计入站异常分数分布、阈值命中情况和各攻击类别分数，未记录异常分数的旧日志不参与统计
+func (s *WAFLogServiceImpl) GetAnomalyScoreStats(
+	ctx context.Context,
+	req dto.AnomalyScoreStatsRequest,
+) (*dto.AnomalyScoreStatsResponse, error) {
+	filter := s.buildAttackLogFilter(dto.AttackLogRequest{
+		Domain:    req.Domain,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+	})
+	filter = append(filter, bson.E{Key: "anomalyScore", Value: bson.D{{Key: "$exists", Value: true}}})
+
+	inbound := "$anomalyScore.inbound"
+	threshold := "$anomalyScore.inboundThreshold"
+	reached := bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$gt", Value: bson.A{threshold, 0}}},
+		bson.D{{Key: "$gte", Value: bson.A{inbound, threshold}}},
+	}}}
+	below := bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$gt", Value: bson.A{inbound, 0}}},
+		bson.D{{Key: "$lt", Value: bson.A{inbound, threshold}}},
+	}}}
+
+	// 将各类别分数展开为 {k, v} 数组，再按类别分组统计
+	categoryScores := bson.A{}
+	for _, category := range model.AnomalyCategories {
+		categoryScores = append(categoryScores, bson.D{
+			{Key: "k", Value: category},
+			{Key: "v", Value: "$anomalyScore." + category},
+		})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "summary", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: nil},
+					{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "avgInbound", Value: bson.D{{Key: "$avg", Value: inbound}}},
+					{Key: "maxInbound", Value: bson.D{{Key: "$max", Value: inbound}}},
+					{Key: "aboveThreshold", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{reached, 1, 0}}}}}},
+					{Key: "belowThreshold", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{below, 1, 0}}}}}},
+				}}},
+			}},
+			{Key: "distribution", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: inbound},
+					{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+			}},
+			{Key: "categories", Value: bson.A{
+				bson.D{{Key: "$project", Value: bson.D{{Key: "scores", Value: categoryScores}}}},
+				bson.D{{Key: "$unwind", Value: "$scores"}},
+				bson.D{{Key: "$match", Value: bson.D{{Key: "scores.v", Value: bson.D{{Key: "$gt", Value: 0}}}}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$scores.k"},
+					{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "avgScore", Value: bson.D{{Key: "$avg", Value: "$scores.v"}}},
+					{Key: "maxScore", Value: bson.D{{Key: "$max", Value: "$scores.v"}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+			}},
+		}}},
+	}
+
+	result, err := s.wafLogRepository.AggregateAnomalyScores(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating anomaly scores: %w", err)
+	}
+	return result, nil
+}
+
+// exportField 可导出的日志字段
+type exportField struct {
+	bsonKey string
+	value   func(*model.WAFLog) any
+}
+
+// exportFields 字段名与 WAFLog 的 json 标签保持一致
+var exportFields = map[string]exportField{
+	"id":           {"_id", func(l *model.WAFLog) any { return l.ID.Hex() }},
+	"createdAt":    {"createdAt", func(l *model.WAFLog) any { return l.CreatedAt.UTC().Format(time.RFC3339) }},
+	"requestId":    {"requestId", func(l *model.WAFLog) any { return l.RequestID }},
+	"ruleId":       {"ruleId", func(l *model.WAFLog) any { return l.RuleID }},
+	"severity":     {"severity", func(l *model.WAFLog) any { return l.Severity }},
+	"phase":        {"phase", func(l *model.WAFLog) any { return l.Phase }},
+	"secMark":      {"secMark", func(l *model.WAFLog) any { return l.SecMark }},
+	"accuracy":     {"accuracy", func(l *model.WAFLog) any { return l.Accuracy }},
+	"domain":       {"domain", func(l *model.WAFLog) any { return l.Domain }},
+	"uri":          {"uri", func(l *model.WAFLog) any { return l.URI }},
+	"srcIp":        {"srcIp", func(l *model.WAFLog) any { return l.SrcIP }},
+	"srcPort":      {"srcPort", func(l *model.WAFLog) any { return l.SrcPort }},
+	"dstIp":        {"dstIp", func(l *model.WAFLog) any { return l.DstIP }},
+	"dstPort":      {"dstPort", func(l *model.WAFLog) any { return l.DstPort }},
+	"clientIp":     {"clientIp", func(l *model.WAFLog) any { return l.ClientIP }},
+	"serverIp":     {"serverIp", func(l *model.WAFLog) any { return l.ServerIP }},
+	"message":      {"message", func(l *model.WAFLog) any { return l.Message }},
+	"payload":      {"payload", func(l *model.WAFLog) any { return l.Payload }},
+	"secLangRaw":   {"secLangRaw", func(l *model.WAFLog) any { return l.SecLangRaw }},
+	"request":      {"request", func(l *model.WAFLog) any { return l.Request }},
+	"response":     {"response", func(l *model.WAFLog) any { return l.Response }},
+	"logs":         {"logs", func(l *model.WAFLog) any { return l.Logs }},
+	"anomalyScore": {"anomalyScore", func(l *model.WAFLog) any { return l.AnomalyScore }},
+	"action":       {"action", func(l *model.WAFLog) any { return l.Action }},
+	"bot":          {"bot", func(l *model.WAFLog) any { return l.Bot }},
+	"geo":          {"geo", func(l *model.WAFLog) any { return l.Geo }},
+}
+
+// defaultExportFields 未指定字段时的导出顺序
+var defaultExportFields = []string{
+	"id", "createdAt", "requestId", "ruleId", "severity", "phase", "secMark", "accuracy",
+	"domain", "uri", "srcIp", "srcPort", "dstIp", "dstPort", "clientIp", "serverIp",
+	"message", "payload", "secLangRaw", "request", "response", "logs", "anomalyScore", "action", "bot", "geo",
+}
+
+// GetGeoStats 统计来源国家和自治系统排行，同一来源IP的多条规则日志分别计数，未查询到地理位置的日志只计入总数
+func (s *WAFLogServiceImpl) GetGeoStats(
+	ctx context.Context,
+	req dto.GeoStatsRequest,
+) (*dto.GeoStatsResponse, error) {
+	filter := s.buildAttackLogFilter(dto.AttackLogRequest{
+		Domain:    req.Domain,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+	})
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "summary", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: nil},
+					{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "located", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+						bson.D{{Key: "$gt", Value: bson.A{"$geo.country", nil}}}, 1, 0,
+					}}}}}},
+				}}},
+			}},
+			{Key: "countries", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{{Key: "geo.country", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$geo.country"},
+					{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "ips", Value: bson.D{{Key: "$addToSet", Value: "$srcIp"}}},
+				}}},
+				bson.D{{Key: "$project", Value: bson.D{
+					{Key: "count", Value: 1},
+					{Key: "uniqueIp", Value: bson.D{{Key: "$size", Value: "$ips"}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+				bson.D{{Key: "$limit", Value: limit}},
+			}},
+			{Key: "asns", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{{Key: "geo.asn", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$geo.asn"},
+					{Key: "asOrg", Value: bson.D{{Key: "$first", Value: "$geo.asOrg"}}},
+					{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "ips", Value: bson.D{{Key: "$addToSet", Value: "$srcIp"}}},
+				}}},
+				bson.D{{Key: "$project", Value: bson.D{
+					{Key: "asOrg", Value: 1},
+					{Key: "count", Value: 1},
+					{Key: "uniqueIp", Value: bson.D{{Key: "$size", Value: "$ips"}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+				bson.D{{Key: "$limit", Value: limit}},
+			}},
+		}}},
+	}
+
+	return s.wafLogRepository.AggregateGeoStats(ctx, pipeline)
+}
+
+// ResolveExportFields 校验并展开导出字段，支持逗号分隔和重复参数两种写法
+func (s *WAFLogServiceImpl) ResolveExportFields(fields []string) ([]string, error) {
+	var resolved []string
+	seen := make(map[string]bool)
+
+	for _, item := range fields {
+		for _, name := range strings.Split(item, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			if _, ok := exportFields[name]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidExportField, name)
+			}
+			seen[name] = true
+			resolved = append(resolved, name)
+		}
+	}
+
+	if len(resolved) == 0 {
+		return defaultExportFields, nil
+	}
+	return resolved, nil
+}
+
+// ExportAttackLogs 使用游标流式导出攻击日志，返回导出的条数
+func (s *WAFLogServiceImpl) ExportAttackLogs(
+	ctx context.Context,
+	req dto.LogExportRequest,
+	fields []string,
+	w io.Writer,
+) (int64, error) {
+	filter := s.buildAttackLogFilter(req.AttackLogRequest)
+
+	projection := bson.D{}
+	for _, name := range fields {
+		projection = append(projection, bson.E{Key: exportFields[name].bsonKey, Value: 1})
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	if req.Format == "csv" {
+		csvWriter := csv.NewWriter(w)
+		if err := csvWriter.Write(fields); err != nil {
+			return 0, err
+		}
+
+		record := make([]string, len(fields))
+		count, err := s.wafLogRepository.StreamAttackLogs(ctx, filter, projection, req.Limit, func(wafLog *model.WAFLog) error {
+			for i, name := range fields {
+				record[i] = formatCSVValue(exportFields[name].value(wafLog))
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return err
+			}
+			return nil
+		})
+		csvWriter.Flush()
+		if err == nil {
+			err = csvWriter.Error()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return count, err
+	}
+
+	// ndjson / jsonl：每行一个 JSON 对象，字段顺序与 CSV 列顺序一致
+	encoder := json.NewEncoder(w)
+	row := exportRow{fields: fields, values: make([]any, len(fields))}
+	count, err := s.wafLogRepository.StreamAttackLogs(ctx, filter, projection, req.Limit, func(wafLog *model.WAFLog) error {
+		for i, name := range fields {
+			row.values[i] = exportFields[name].value(wafLog)
+		}
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+		return nil
+	})
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return count, err
+}
+
+// exportRow 按导出字段顺序序列化的一行日志，map 序列化时键按字母排序，与 CSV 列顺序不一致
+type exportRow struct {
+	fields []string
+	values []any
+}
+
+// MarshalJSON 按 fields 的顺序输出 JSON 对象
+func (r exportRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range r.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// formatCSVValue 将字段值转换为 CSV 单元格文本，复杂类型序列化为 JSON。
+// 以 =、+、-、@、制表符或回车开头的单元格会被电子表格当作公式执行，前面加 ' 转为文本
+func formatCSVValue(value any) string {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case int:
+		text = strconv.Itoa(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		text = string(data)
+	}
+
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFormatCSVValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "plain", value: "GET", want: "GET"},
+		{name: "int", value: 403, want: "403"},
+		{name: "negative int", value: -1, want: "'-1"},
+		{name: "formula", value: "=HYPERLINK(\"http://x\")", want: "'=HYPERLINK(\"http://x\")"},
+		{name: "plus", value: "+1", want: "'+1"},
+		{name: "minus", value: "-1+2", want: "'-1+2"},
+		{name: "at", value: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "tab", value: "\t=1", want: "'\t=1"},
+		{name: "carriage return", value: "\r=1", want: "'\r=1"},
+		{name: "empty", value: "", want: ""},
+		{name: "json", value: []string{"=1"}, want: `["=1"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatCSVValue(tt.value); got != tt.want {
+				t.Fatalf("formatCSVValue(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportRowFieldOrder(t *testing.T) {
+	row := exportRow{
+		fields: []string{"uri", "clientIp", "action"},
+		values: []any{"/login", "192.0.2.1", 403},
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	want := `{"uri":"/login","clientIp":"192.0.2.1","action":403}`
+	if string(data) != want {
+		t.Fatalf("json.Marshal() = %s, want %s", data, want)
+	}
+}
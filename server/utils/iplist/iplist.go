@@ -0,0 +1,206 @@
+// Package iplist 解析威胁情报源提供的 IP 列表，合并去重为 CIDR 列表
+package iplist
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// 列表格式
+const (
+	FormatText = "text" // 每行一个 IP 或 CIDR，# ; // 开头为注释，行内空白之后的内容忽略，FireHOL 的 .netset/.ipset 使用此格式
+	FormatCSV  = "csv"  // 逗号分隔，从指定列读取 IP 或 CIDR，无法解析的行（如表头）计入无效行
+)
+
+// maxLineLength 单行最大长度，超出时视为格式错误
+const maxLineLength = 64 * 1024
+
+var ErrUnknownFormat = errors.New("不支持的列表格式")
+
+// Result 解析结果
+type Result struct {
+	Prefixes []netip.Prefix // 解析出的网段，未去重
+	Lines    int            // 读取的非空、非注释行数
+	Invalid  int            // 无法解析的行数
+}
+
+// Parse 按格式解析列表，column 为 CSV 格式中 IP 所在的列，从 0 开始
+func Parse(r io.Reader, format string, column int) (*Result, error) {
+	switch format {
+	case FormatText, "":
+		return parseText(r)
+	case FormatCSV:
+		return parseCSV(r, column)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+func parseText(r io.Reader) (*Result, error) {
+	result := &Result{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), maxLineLength)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || isComment(line) {
+			continue
+		}
+		result.Lines++
+
+		field := strings.Fields(line)[0]
+		prefix, err := ParsePrefix(field)
+		if err != nil {
+			result.Invalid++
+			continue
+		}
+		result.Prefixes = append(result.Prefixes, prefix)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("读取列表失败: %w", err)
+	}
+	return result, nil
+}
+
+func parseCSV(r io.Reader, column int) (*Result, error) {
+	if column < 0 {
+		return nil, fmt.Errorf("CSV 列序号无效: %d", column)
+	}
+	result := &Result{}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.Lines++
+				result.Invalid++
+				continue
+			}
+			return nil, fmt.Errorf("读取列表失败: %w", err)
+		}
+		result.Lines++
+		if column >= len(record) {
+			result.Invalid++
+			continue
+		}
+		prefix, err := ParsePrefix(strings.TrimSpace(record[column]))
+		if err != nil {
+			result.Invalid++
+			continue
+		}
+		result.Prefixes = append(result.Prefixes, prefix)
+	}
+	return result, nil
+}
+
+func isComment(line string) bool {
+	return line[0] == '#' || line[0] == ';' || strings.HasPrefix(line, "//")
+}
+
+// ParsePrefix 解析 IP 或 CIDR，单个 IP 转换为 /32 或 /128，IPv4 映射的 IPv6 地址转换为 IPv4，主机位清零
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr := prefix.Addr()
+		bits := prefix.Bits()
+		if addr.Is4In6() {
+			if bits < 96 {
+				return netip.Prefix{}, fmt.Errorf("IPv4 映射地址的前缀长度无效: %s", s)
+			}
+			addr = addr.Unmap()
+			bits -= 96
+		}
+		return netip.PrefixFrom(addr, bits).Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	if addr.Zone() != "" {
+		return netip.Prefix{}, fmt.Errorf("不支持带区域的地址: %s", s)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Merge 合并多个来源的网段：排序去重，并去掉被其他网段包含的网段
+func Merge(sources ...[]netip.Prefix) []netip.Prefix {
+	total := 0
+	for _, source := range sources {
+		total += len(source)
+	}
+	all := make([]netip.Prefix, 0, total)
+	for _, source := range sources {
+		all = append(all, source...)
+	}
+
+	// 按地址升序、前缀长度升序排列，包含关系的网段中较大的网段排在前面
+	sort.Slice(all, func(i, j int) bool {
+		if c := all[i].Addr().Compare(all[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return all[i].Bits() < all[j].Bits()
+	})
+
+	// 保留的网段互不相交且有序，只需要与最后保留的网段比较
+	merged := make([]netip.Prefix, 0, len(all))
+	for _, prefix := range all {
+		if n := len(merged); n > 0 {
+			last := merged[n-1]
+			if last.Addr().Is4() == prefix.Addr().Is4() && last.Bits() <= prefix.Bits() && last.Contains(prefix.Addr()) {
+				continue
+			}
+		}
+		merged = append(merged, prefix)
+	}
+	return merged
+}
+
+// Strings 将网段转换为字符串
+func Strings(prefixes []netip.Prefix) []string {
+	entries := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		entries[i] = prefix.String()
+	}
+	return entries
+}
+
+// ParseEntries 解析已保存的条目，忽略无法解析的条目
+func ParseEntries(entries []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// Digest 计算条目摘要
+func Digest(entries []string) string {
+	h := sha256.New()
+	for _, entry := range entries {
+		h.Write([]byte(entry))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}